@@ -0,0 +1,156 @@
+package gondolier
+
+import (
+	"strings"
+)
+
+// Returns the names of the models referenced by fk tags of given model, in field order.
+// References to the model itself are ignored, as they do not affect the order of migration.
+func getModelReferences(model *MetaModel, naming NameSchema) []string {
+	refs := make([]string, 0)
+
+	for _, field := range model.Fields {
+		for _, tag := range field.Tags {
+			if ref := getReferencedModel(tag); ref != "" && naming.Get(ref) != naming.Get(model.ModelName) {
+				refs = append(refs, ref)
+			}
+		}
+	}
+
+	return refs
+}
+
+// Returns the name of the model referenced by given tag or an empty string if it is no fk tag.
+func getReferencedModel(tag MetaTag) string {
+	key := strings.ToLower(tag.Name)
+
+	if key != "fk" && key != "foreign key" {
+		return ""
+	}
+
+	ref := strings.SplitN(tag.Value, ",", 2)[0]
+	return strings.TrimSpace(strings.SplitN(ref, ".", 2)[0])
+}
+
+// Returns the models sorted so that each model comes after the models it references by fk tags,
+// which is the order to create them. If reverse is set, each model comes before the models it references,
+// which is the order to drop them. Models without dependencies between them keep the given order.
+// References to models which are not part of the given models are ignored.
+// Models which reference each other in a cycle cannot be sorted, they are appended in the given order
+// and returned as cycles too.
+func sortModels(models []MetaModel, naming NameSchema, reverse bool) ([]MetaModel, [][]string) {
+	deps := make([][]int, len(models))
+
+	for i := range models {
+		for _, ref := range getModelReferences(&models[i], naming) {
+			if j := findModel(models, ref, naming); j > -1 {
+				if reverse {
+					deps[j] = append(deps[j], i)
+				} else {
+					deps[i] = append(deps[i], j)
+				}
+			}
+		}
+	}
+
+	sorted := make([]MetaModel, 0, len(models))
+	done := make([]bool, len(models))
+
+	// add models whose dependencies were added until no more models can be added
+	for added := true; added; {
+		added = false
+
+		for i := range models {
+			if !done[i] && allDone(deps[i], done) {
+				sorted = append(sorted, models[i])
+				done[i] = true
+				added = true
+			}
+		}
+	}
+
+	cycles := getCycles(models, deps, done)
+
+	for i := range models {
+		if !done[i] {
+			sorted = append(sorted, models[i])
+		}
+	}
+
+	return sorted, cycles
+}
+
+// Returns the names of the models of each cycle among the models which could not be sorted.
+func getCycles(models []MetaModel, deps [][]int, done []bool) [][]string {
+	cycles := make([][]string, 0)
+	inCycle := make([]bool, len(models))
+
+	for i := range models {
+		if done[i] || inCycle[i] {
+			continue
+		}
+
+		// follow the dependencies until a model is visited twice, which closes the cycle
+		path := make([]int, 0)
+		visited := make(map[int]int)
+
+		for j := i; ; {
+			if start, ok := visited[j]; ok {
+				cycle := make([]string, 0)
+
+				for _, k := range path[start:] {
+					if !inCycle[k] {
+						cycle = append(cycle, models[k].ModelName)
+						inCycle[k] = true
+					}
+				}
+
+				if len(cycle) > 0 {
+					cycles = append(cycles, cycle)
+				}
+
+				break
+			}
+
+			visited[j] = len(path)
+			path = append(path, j)
+			j = nextPending(deps[j], done)
+		}
+	}
+
+	return cycles
+}
+
+func allDone(deps []int, done []bool) bool {
+	for _, dep := range deps {
+		if !done[dep] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the first dependency which was not sorted. Unsorted models always have one.
+func nextPending(deps []int, done []bool) int {
+	for _, dep := range deps {
+		if !done[dep] {
+			return dep
+		}
+	}
+
+	return -1
+}
+
+// Returns the index of the model with given name or -1 if it is not part of the models.
+func findModel(models []MetaModel, name string, naming NameSchema) int {
+	name = naming.Get(name)
+
+	for i, model := range models {
+		if naming.Get(model.ModelName) == name {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,129 @@
+package gondolier
+
+import (
+	"strings"
+	"testing"
+)
+
+type testDepOrder struct {
+	Id       uint64 `gondolier:"type:bigint;id"`
+	Customer uint64 `gondolier:"type:bigint;fk:testDepCustomer.Id,ondelete:cascade"`
+}
+
+type testDepCustomer struct {
+	Id     uint64 `gondolier:"type:bigint;id"`
+	Parent uint64 `gondolier:"type:bigint;fk:testDepCustomer.Id"`
+	Region uint64 `gondolier:"type:bigint;foreign key:testDepRegion.Id"`
+}
+
+type testDepRegion struct {
+	Id uint64 `gondolier:"type:bigint;id"`
+}
+
+type testDepCycleA struct {
+	Id uint64 `gondolier:"type:bigint;id"`
+	B  uint64 `gondolier:"type:bigint;fk:testDepCycleB.Id"`
+}
+
+type testDepCycleB struct {
+	Id uint64 `gondolier:"type:bigint;id"`
+	A  uint64 `gondolier:"type:bigint;fk:testDepCycleA.Id"`
+}
+
+func testBuildMetaModels(t *testing.T, models ...interface{}) []MetaModel {
+	metaModels := make([]MetaModel, 0, len(models))
+
+	for _, model := range models {
+		metaModel, err := buildMetaModel(model)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		metaModels = append(metaModels, metaModel)
+	}
+
+	return metaModels
+}
+
+func testModelNames(models []MetaModel) string {
+	names := make([]string, 0, len(models))
+
+	for _, model := range models {
+		names = append(names, model.ModelName)
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestSortModels(t *testing.T) {
+	models := testBuildMetaModels(t, testDepOrder{}, testModel{}, testDepCustomer{}, testDepRegion{})
+	sorted, cycles := sortModels(models, &SnakeCase{}, false)
+
+	if names := testModelNames(sorted); names != "testModel,testDepRegion,testDepCustomer,testDepOrder" || len(cycles) != 0 {
+		t.Fatalf("Models must be sorted by dependency, but was: %v %v", names, cycles)
+	}
+
+	sorted, cycles = sortModels(models, &SnakeCase{}, true)
+
+	if names := testModelNames(sorted); names != "testDepOrder,testModel,testDepCustomer,testDepRegion" || len(cycles) != 0 {
+		t.Fatalf("Models must be sorted by dependency in reverse, but was: %v %v", names, cycles)
+	}
+}
+
+func TestSortModelsCycle(t *testing.T) {
+	models := testBuildMetaModels(t, testDepCycleA{}, testDepOrder{}, testDepCycleB{}, testDepCustomer{}, testDepRegion{})
+	sorted, cycles := sortModels(models, &SnakeCase{}, false)
+
+	if names := testModelNames(sorted); names != "testDepRegion,testDepCustomer,testDepOrder,testDepCycleA,testDepCycleB" {
+		t.Fatalf("Models in a cycle must be appended, but was: %v", names)
+	}
+
+	if len(cycles) != 1 || strings.Join(cycles[0], ",") != "testDepCycleA,testDepCycleB" {
+		t.Fatalf("Cycle must have been detected, but was: %v", cycles)
+	}
+}
+
+func TestMigrateOrder(t *testing.T) {
+	dummy := &dummyMigrator{}
+	g := New(testdb, dummy)
+	g.Model(testDepOrder{}, testDepCustomer{}, testDepRegion{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := testModelNames(dummy.models); names != "testDepRegion,testDepCustomer,testDepOrder" {
+		t.Fatalf("Models must be migrated in dependency order, but was: %v", names)
+	}
+
+	// referenced models which were migrated before do not need to be added again
+	g.Model(testDepOrder{}, testDepCustomer{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := testModelNames(dummy.models); names != "testDepCustomer,testDepOrder" {
+		t.Fatalf("Models must be migrated without referenced models, but was: %v", names)
+	}
+}
+
+func TestDropOrder(t *testing.T) {
+	dummy := &dummyMigrator{}
+	g := New(testdb, dummy)
+
+	if err := g.DropE(testDepRegion{}, testDepCustomer{}, testDepOrder{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := strings.Join(dummy.drop, ","); names != "testDepOrder,testDepCustomer,testDepRegion" {
+		t.Fatalf("Tables must be dropped in reverse dependency order, but was: %v", names)
+	}
+
+	dummy.drop = nil
+
+	if err := g.DropE(testDepCycleA{}, testDepCycleB{}); err == nil || len(dummy.drop) != 0 {
+		t.Fatalf("Models referencing each other must not be dropped, but was: %v %v", err, dummy.drop)
+	}
+}
@@ -0,0 +1,183 @@
+package gondolier
+
+import (
+	"strings"
+)
+
+// Types of constraints read by a Dialect.
+const (
+	ConstraintPrimaryKey ConstraintType = "primary key"
+	ConstraintUnique     ConstraintType = "unique"
+	ConstraintForeignKey ConstraintType = "foreign key"
+	ConstraintCheck      ConstraintType = "check"
+)
+
+// Dialect is implemented by migrators which share the diff logic of SchemaDiff.
+// It reads the current state of tables and turns the operations found by SchemaDiff into SQL.
+// The methods are called during a migration, so the dialect can use the connection and naming of it.
+type Dialect interface {
+	// Table returns the current state of given table or nil if it does not exist.
+	Table(name string) (*TableState, error)
+
+	// Column returns the column declared by the tags of given field for a table.
+	// The default must be the expression read back from the database, like the one generated for ids.
+	Column(tableName string, field *MetaField) (*ColumnSpec, error)
+
+	// Indexes returns the indexes declared by the index tags of given model for a table.
+	Indexes(tableName string, model *MetaModel) ([]IndexSpec, error)
+
+	// NormalizeType returns given type in the form used by the database, so that types can be compared.
+	NormalizeType(columnType string) string
+
+	// NormalizeExpr returns given expression in the form used by the database,
+	// so that defaults, check constraints and where clauses of indexes can be compared.
+	NormalizeExpr(expr string) string
+
+	// SQL returns the statements for given operation.
+	SQL(op Operation) ([]string, error)
+}
+
+// ConstraintType is the type of a constraint read by a Dialect.
+type ConstraintType string
+
+// TableState is the current state of a table read from the database.
+// Sequences are the names of the sequences named after the columns of the table.
+// Indexes do not include the ones backing a constraint.
+type TableState struct {
+	Name        string
+	Columns     []ColumnState
+	Constraints []ConstraintState
+	Sequences   []string
+	Indexes     []IndexState
+}
+
+// ColumnState is the current state of a column read from the database.
+// The default is empty if the column has none.
+type ColumnState struct {
+	Name    string
+	Type    string
+	NotNull bool
+	Default string
+}
+
+// ConstraintState is the current state of a constraint read from the database.
+// The referenced table, columns and actions are set for foreign keys only, the expression for check constraints only.
+type ConstraintState struct {
+	Name       string
+	Type       ConstraintType
+	Columns    []string
+	Expression string
+	RefTable   string
+	RefColumns []string
+	OnDelete   string
+	OnUpdate   string
+	Deferrable bool
+	Deferred   bool
+}
+
+// IndexState is the current state of an index read from the database.
+// The method is empty for databases which do not support index methods or do not return the method used by the tags.
+type IndexState struct {
+	Name    string
+	Columns []string
+	Unique  bool
+	Method  string
+	Where   string
+}
+
+// ColumnSpec is a column declared by the tags of a field.
+// Id is set for the id tag, which implies the primary key and a generated default.
+// Sequence is set if the column uses a sequence, which is created for it.
+type ColumnSpec struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey bool
+	Id         bool
+	Unique     bool
+	Default    string
+	Sequence   *SequenceSpec
+	ForeignKey *ForeignKeySpec
+}
+
+// SequenceSpec is a sequence declared by the seq or id tag.
+// The minimum, maximum and cache are empty if they are not set.
+type SequenceSpec struct {
+	Start     string
+	Increment string
+	Min       string
+	Max       string
+	Cache     string
+}
+
+// ForeignKeySpec is a foreign key declared by a fk tag.
+// The actions are lower case, like "no action" or "set null".
+type ForeignKeySpec struct {
+	RefTable   string
+	RefColumn  string
+	OnDelete   string
+	OnUpdate   string
+	Deferrable bool
+	Deferred   bool
+	NotValid   bool
+}
+
+// IndexSpec is an index declared by the index tags of a model.
+// Field is the first field declaring the index.
+type IndexSpec struct {
+	Name    string
+	Field   string
+	Columns []string
+	Unique  bool
+	Method  string
+	Where   string
+}
+
+// Returns the column of given name or nil if it does not exist.
+func (t *TableState) column(name string) *ColumnState {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the constraint of given name or nil if it does not exist.
+func (t *TableState) constraint(name string) *ConstraintState {
+	for i := range t.Constraints {
+		if t.Constraints[i].Name == name {
+			return &t.Constraints[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns all constraints of given type.
+func (t *TableState) constraints(constraintType ConstraintType) []ConstraintState {
+	constraints := make([]ConstraintState, 0)
+
+	for _, constraint := range t.Constraints {
+		if constraint.Type == constraintType {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	return constraints
+}
+
+// Returns true if the sequence of given name exists.
+func (t *TableState) sequence(name string) bool {
+	return containsString(t.Sequences, name)
+}
+
+// Renames the sequence and updates the defaults using it.
+func (t *TableState) renameSequence(oldName, newName string) {
+	t.Sequences = replaceString(t.Sequences, oldName, newName)
+
+	for i := range t.Columns {
+		t.Columns[i].Default = strings.Replace(t.Columns[i].Default, "'"+oldName+"'", "'"+newName+"'", -1)
+	}
+}
@@ -0,0 +1,916 @@
+package gondolier
+
+import (
+	"strings"
+)
+
+// Source is the model and field an operation belongs to.
+// Field is empty if the operation belongs to the table.
+type Source struct {
+	Model string
+	Field string
+}
+
+// Origin returns the model and field the operation belongs to.
+func (s Source) Origin() Source {
+	return s
+}
+
+// Operation is a change of the schema found by SchemaDiff, which a Dialect turns into SQL.
+// It is one of CreateTable, AddColumn, DropColumn, AlterColumnType, AlterColumnNotNull,
+// AlterColumnDefault, AddPrimaryKey, AddUnique, AddForeignKey, AddCheck, DropConstraint,
+// CreateSequence, AlterSequenceOwner, DropSequence, CreateIndex, DropIndex,
+// RenameTable, RenameColumn, RenameConstraint, RenameSequence and RenameIndex.
+// Operations carry everything needed to build the statements, so that they do not depend on the data model.
+type Operation interface {
+	Origin() Source
+}
+
+// CreateTable creates the table of a model with all columns and the primary key.
+// Sequences are created by CreateSequence before and foreign keys by AddForeignKey after all tables were created.
+// The name of the primary key is empty if the model has none.
+type CreateTable struct {
+	Source
+	Table             string
+	Columns           []ColumnSpec
+	PrimaryKey        string
+	PrimaryKeyColumns []string
+}
+
+// AddColumn adds the column of a field to an existing table.
+// The foreign key of the column is added by AddForeignKey.
+type AddColumn struct {
+	Source
+	Table  string
+	Column ColumnSpec
+}
+
+// DropColumn drops a column which has no field in the model.
+type DropColumn struct {
+	Source
+	Table  string
+	Column string
+}
+
+// AlterColumnType changes the type of a column.
+type AlterColumnType struct {
+	Source
+	Table  string
+	Column string
+	Type   string
+}
+
+// AlterColumnNotNull sets or drops not null for a column.
+type AlterColumnNotNull struct {
+	Source
+	Table   string
+	Column  string
+	NotNull bool
+}
+
+// AlterColumnDefault sets the default of a column or drops it if empty.
+type AlterColumnDefault struct {
+	Source
+	Table   string
+	Column  string
+	Default string
+}
+
+// AddPrimaryKey adds the primary key to an existing table.
+type AddPrimaryKey struct {
+	Source
+	Table   string
+	Name    string
+	Columns []string
+}
+
+// AddUnique adds a unique constraint for a column.
+type AddUnique struct {
+	Source
+	Table  string
+	Name   string
+	Column string
+}
+
+// AddForeignKey adds a foreign key for a column.
+type AddForeignKey struct {
+	Source
+	Table      string
+	Name       string
+	Column     string
+	ForeignKey ForeignKeySpec
+}
+
+// AddCheck adds a check constraint to a table.
+type AddCheck struct {
+	Source
+	Table      string
+	Name       string
+	Expression string
+}
+
+// DropConstraint drops a primary key, unique constraint, foreign key or check constraint.
+type DropConstraint struct {
+	Source
+	Table string
+	Name  string
+	Type  ConstraintType
+}
+
+// CreateSequence creates the sequence of a column, before the column is created or its default is set.
+type CreateSequence struct {
+	Source
+	Table    string
+	Column   string
+	Name     string
+	Sequence SequenceSpec
+}
+
+// AlterSequenceOwner sets the column owning a sequence, after the column was created.
+type AlterSequenceOwner struct {
+	Source
+	Table  string
+	Column string
+	Name   string
+}
+
+// DropSequence drops the sequence of a column which does not use one anymore.
+type DropSequence struct {
+	Source
+	Table string
+	Name  string
+}
+
+// CreateIndex creates an index for a table.
+type CreateIndex struct {
+	Source
+	Table string
+	Index IndexSpec
+}
+
+// DropIndex drops an index of a table.
+type DropIndex struct {
+	Source
+	Table string
+	Name  string
+}
+
+// RenameTable renames the table of a previous name of a model.
+type RenameTable struct {
+	Source
+	Table string
+	Name  string
+}
+
+// RenameColumn renames the column of a previous name of a field.
+type RenameColumn struct {
+	Source
+	Table  string
+	Column string
+	Name   string
+}
+
+// RenameConstraint renames a constraint named after a renamed table or column.
+type RenameConstraint struct {
+	Source
+	Table   string
+	Name    string
+	NewName string
+	Type    ConstraintType
+}
+
+// RenameSequence renames a sequence named after a renamed table or column.
+type RenameSequence struct {
+	Source
+	Table   string
+	Name    string
+	NewName string
+}
+
+// RenameIndex renames an index named after a renamed table or column.
+type RenameIndex struct {
+	Source
+	Table   string
+	Name    string
+	NewName string
+}
+
+// SchemaDiff finds the operations to migrate the tables of a schema to the data model.
+// The current state of the tables is read and the operations are turned into SQL by the Dialect,
+// so that migrators for different databases can share the same diff logic.
+// Tables and columns of previous names are renamed, together with the sequences, constraints and indexes named after them.
+// Only unique constraints, primary keys, foreign keys, check constraints, sequences and indexes
+// named like the ones created by Gondolier are changed.
+//
+// Example:
+//  diff := &SchemaDiff{Dialect: dialect, Naming: &SnakeCase{}, DropColumns: true}
+//  ops, err := diff.Diff(models)
+type SchemaDiff struct {
+	Dialect     Dialect
+	Naming      NameSchema
+	DropColumns bool
+
+	createFK []Operation
+	dropFK   []Operation
+}
+
+// Diff returns the operations to migrate the tables of given models, followed by the operations for foreign keys.
+func (d *SchemaDiff) Diff(metaModels []MetaModel) ([]Operation, error) {
+	ops := make([]Operation, 0)
+
+	for i := range metaModels {
+		modelOps, err := d.Model(&metaModels[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		ops = append(ops, modelOps...)
+	}
+
+	return append(ops, d.ForeignKeys()...), nil
+}
+
+// Model returns the operations to create, rename or update the table of given model.
+// The operations for foreign keys are collected and returned by ForeignKeys.
+func (d *SchemaDiff) Model(model *MetaModel) ([]Operation, error) {
+	tableName := d.Naming.Get(model.ModelName)
+	table, err := d.Dialect.Table(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]Operation, 0)
+
+	// the table is updated if it was renamed from a previous name of the model
+	if table == nil {
+		if table, err = d.findPreviousTable(model); err != nil {
+			return nil, err
+		}
+
+		if table != nil {
+			ops = append(ops, d.renameTable(Source{model.ModelName, ""}, table, tableName)...)
+		}
+	}
+
+	// columns are renamed first, so that they are updated instead of added
+	if table != nil {
+		ops = append(ops, d.renameColumns(model, table)...)
+	}
+
+	columns := make([]ColumnSpec, 0, len(model.Fields))
+
+	for i := range model.Fields {
+		column, err := d.Dialect.Column(tableName, &model.Fields[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, *column)
+	}
+
+	if table == nil {
+		if len(columns) == 0 {
+			return nil, &ModelError{model.ModelName, "", "Model has no fields to migrate"}
+		}
+
+		ops = append(ops, d.createTable(model, tableName, columns)...)
+		table = &TableState{Name: tableName}
+	} else {
+		tableOps, err := d.updateTable(model, table, columns)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ops = append(ops, tableOps...)
+	}
+
+	checks, err := d.updateChecks(model, table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	indexes, err := d.updateIndexes(model, table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append(ops, checks...), indexes...), nil
+}
+
+// ForeignKeys returns the operations to create and drop foreign keys collected by Model and resets them.
+// They must be executed after all tables were migrated, so that models referencing each other in a cycle can be created.
+func (d *SchemaDiff) ForeignKeys() []Operation {
+	ops := append(d.createFK, d.dropFK...)
+	d.createFK, d.dropFK = nil, nil
+	return ops
+}
+
+// Returns the table of the first previous name of given model which exists or nil if there is none.
+func (d *SchemaDiff) findPreviousTable(model *MetaModel) (*TableState, error) {
+	for _, name := range model.PreviousNames {
+		table, err := d.Dialect.Table(d.Naming.Get(name))
+
+		if err != nil || table != nil {
+			return table, err
+		}
+	}
+
+	return nil, nil
+}
+
+// Returns the operations to rename given table and the sequences, constraints and indexes named after it.
+// The table is changed to the state after renaming it.
+func (d *SchemaDiff) renameTable(source Source, table *TableState, newName string) []Operation {
+	oldName := table.Name
+	ops := []Operation{&RenameTable{source, oldName, newName}}
+	table.Name = newName
+
+	for _, column := range table.Columns {
+		oldSeq := d.getSequenceName(oldName, column.Name)
+
+		if table.sequence(oldSeq) {
+			newSeq := d.getSequenceName(newName, column.Name)
+			ops = append(ops, &RenameSequence{source, newName, oldSeq, newSeq})
+			table.renameSequence(oldSeq, newSeq)
+		}
+	}
+
+	for i := range table.Constraints {
+		constraint := &table.Constraints[i]
+		name := d.getRenamedTableConstraintName(constraint, oldName, newName)
+
+		if name != "" && name != constraint.Name {
+			ops = append(ops, &RenameConstraint{source, newName, constraint.Name, name, constraint.Type})
+			constraint.Name = name
+		}
+
+		if constraint.RefTable == oldName {
+			constraint.RefTable = newName
+		}
+	}
+
+	for i := range table.Indexes {
+		index := &table.Indexes[i]
+
+		if d.matchName(index.Name, oldName+"_", "_idx") {
+			name := newName + strings.TrimPrefix(index.Name, oldName)
+			ops = append(ops, &RenameIndex{source, newName, index.Name, name})
+			index.Name = name
+		}
+	}
+
+	return ops
+}
+
+// Returns the name of given constraint after renaming the table or an empty string if it is not affected.
+func (d *SchemaDiff) getRenamedTableConstraintName(constraint *ConstraintState, oldName, newName string) string {
+	if constraint.Type == ConstraintForeignKey {
+		if len(constraint.Columns) != 1 || len(constraint.RefColumns) != 1 {
+			return ""
+		}
+
+		column, refTable, refColumn := constraint.Columns[0], constraint.RefTable, constraint.RefColumns[0]
+
+		if constraint.Name != d.getForeignKeyName(oldName, column, refTable, refColumn) {
+			return ""
+		}
+
+		if refTable == oldName {
+			refTable = newName
+		}
+
+		return d.getForeignKeyName(newName, column, refTable, refColumn)
+	}
+
+	if constraint.Name == oldName+"_pkey" ||
+		d.matchName(constraint.Name, oldName+"_", "_pkey") ||
+		d.matchName(constraint.Name, oldName+"_", "_key") ||
+		d.matchName(constraint.Name, oldName+"_", "_check") {
+		return newName + strings.TrimPrefix(constraint.Name, oldName)
+	}
+
+	return ""
+}
+
+// Returns the operations to rename the columns of previous field names, if the column does not exist yet.
+func (d *SchemaDiff) renameColumns(model *MetaModel, table *TableState) []Operation {
+	ops := make([]Operation, 0)
+
+	for _, field := range model.Fields {
+		columnName := d.Naming.Get(field.Name)
+
+		if table.column(columnName) != nil {
+			continue
+		}
+
+		for _, oldName := range getPreviousNames(&field, d.Naming) {
+			if table.column(oldName) != nil {
+				ops = append(ops, d.renameColumn(Source{model.ModelName, field.Name}, table, oldName, columnName)...)
+				break
+			}
+		}
+	}
+
+	return ops
+}
+
+// Returns the operations to rename given column and the sequence, constraints and indexes named after it.
+// The table is changed to the state after renaming the column.
+func (d *SchemaDiff) renameColumn(source Source, table *TableState, oldName, newName string) []Operation {
+	ops := []Operation{&RenameColumn{source, table.Name, oldName, newName}}
+	table.column(oldName).Name = newName
+	oldSeq := d.getSequenceName(table.Name, oldName)
+
+	if table.sequence(oldSeq) {
+		newSeq := d.getSequenceName(table.Name, newName)
+		ops = append(ops, &RenameSequence{source, table.Name, oldSeq, newSeq})
+		table.renameSequence(oldSeq, newSeq)
+	}
+
+	for i := range table.Constraints {
+		constraint := &table.Constraints[i]
+		name := d.getRenamedColumnConstraintName(constraint, table.Name, oldName, newName)
+
+		if name != "" && name != constraint.Name {
+			ops = append(ops, &RenameConstraint{source, table.Name, constraint.Name, name, constraint.Type})
+			constraint.Name = name
+		}
+
+		constraint.Columns = replaceString(constraint.Columns, oldName, newName)
+
+		if constraint.RefTable == table.Name {
+			constraint.RefColumns = replaceString(constraint.RefColumns, oldName, newName)
+		}
+	}
+
+	oldIndex := d.getIndexName(table.Name, oldName)
+
+	for i := range table.Indexes {
+		index := &table.Indexes[i]
+		index.Columns = replaceString(index.Columns, oldName, newName)
+
+		if index.Name == oldIndex {
+			index.Name = d.getIndexName(table.Name, newName)
+			ops = append(ops, &RenameIndex{source, table.Name, oldIndex, index.Name})
+		}
+	}
+
+	return ops
+}
+
+// Returns the name of given constraint after renaming the column or an empty string if it is not affected.
+func (d *SchemaDiff) getRenamedColumnConstraintName(constraint *ConstraintState, tableName, oldName, newName string) string {
+	switch constraint.Type {
+	case ConstraintUnique:
+		if constraint.Name == d.getUniqueName(tableName, oldName) {
+			return d.getUniqueName(tableName, newName)
+		}
+	case ConstraintPrimaryKey:
+		if containsString(constraint.Columns, oldName) && constraint.Name == d.getPrimaryKeyName(tableName, constraint.Columns) {
+			return d.getPrimaryKeyName(tableName, replaceString(constraint.Columns, oldName, newName))
+		}
+
+		// primary keys of ids were named after their column by previous versions
+		if len(constraint.Columns) == 1 && constraint.Name == tableName+"_"+oldName+"_pkey" {
+			return tableName + "_" + newName + "_pkey"
+		}
+	case ConstraintCheck:
+		if constraint.Name == d.getCheckName(tableName, oldName) {
+			return d.getCheckName(tableName, newName)
+		}
+	case ConstraintForeignKey:
+		if len(constraint.Columns) != 1 || len(constraint.RefColumns) != 1 {
+			return ""
+		}
+
+		column, refTable, refColumn := constraint.Columns[0], constraint.RefTable, constraint.RefColumns[0]
+
+		if constraint.Name != d.getForeignKeyName(tableName, column, refTable, refColumn) {
+			return ""
+		}
+
+		if column == oldName {
+			column = newName
+		}
+
+		if refTable == tableName && refColumn == oldName {
+			refColumn = newName
+		}
+
+		return d.getForeignKeyName(tableName, column, refTable, refColumn)
+	}
+
+	return ""
+}
+
+func (d *SchemaDiff) createTable(model *MetaModel, tableName string, columns []ColumnSpec) []Operation {
+	pkColumns := d.getPrimaryKeyColumns(columns)
+	pkName := ""
+
+	if len(pkColumns) > 0 {
+		pkName = d.getPrimaryKeyName(tableName, pkColumns)
+	}
+
+	// sequences are used by the defaults of the columns and owned by them after the table was created
+	ops := make([]Operation, 0)
+	owners := make([]Operation, 0)
+
+	for i, column := range columns {
+		source := Source{model.ModelName, model.Fields[i].Name}
+
+		if column.Sequence != nil {
+			name := d.getSequenceName(tableName, column.Name)
+			ops = append(ops, &CreateSequence{source, tableName, column.Name, name, *column.Sequence})
+			owners = append(owners, &AlterSequenceOwner{source, tableName, column.Name, name})
+		}
+
+		if column.ForeignKey != nil {
+			d.createFK = append(d.createFK, d.addForeignKey(source, tableName, &column))
+		}
+	}
+
+	ops = append(ops, &CreateTable{Source{model.ModelName, ""}, tableName, columns, pkName, pkColumns})
+	return append(ops, owners...)
+}
+
+func (d *SchemaDiff) updateTable(model *MetaModel, table *TableState, columns []ColumnSpec) ([]Operation, error) {
+	ops := make([]Operation, 0)
+	pkColumns := d.getPrimaryKeyColumns(columns)
+	pks := table.constraints(ConstraintPrimaryKey)
+	pkName, existingPkColumns := "", []string{}
+
+	if len(pks) > 0 {
+		pkName, existingPkColumns = pks[0].Name, pks[0].Columns
+	}
+
+	pkChanged := strings.Join(pkColumns, ",") != strings.Join(existingPkColumns, ",")
+
+	// drop primary key before the columns are updated, so that not null can be dropped
+	if pkChanged && pkName != "" {
+		ops = append(ops, &DropConstraint{Source{model.ModelName, ""}, table.Name, pkName, ConstraintPrimaryKey})
+	}
+
+	for i := range columns {
+		column := &columns[i]
+		source := Source{model.ModelName, model.Fields[i].Name}
+		state := table.column(column.Name)
+		seqName := d.getSequenceName(table.Name, column.Name)
+
+		// the sequence must exist before the column or default using it
+		if column.Sequence != nil && !table.sequence(seqName) {
+			ops = append(ops, &CreateSequence{source, table.Name, column.Name, seqName, *column.Sequence})
+		}
+
+		if state == nil {
+			ops = append(ops, &AddColumn{source, table.Name, *column})
+		} else {
+			ops = append(ops, d.updateColumn(source, table, column, state)...)
+		}
+
+		if column.Sequence != nil && !table.sequence(seqName) {
+			ops = append(ops, &AlterSequenceOwner{source, table.Name, column.Name, seqName})
+		} else if column.Sequence == nil && table.sequence(seqName) {
+			ops = append(ops, &DropSequence{source, table.Name, seqName})
+		}
+
+		if state == nil {
+			if column.ForeignKey != nil {
+				d.createFK = append(d.createFK, d.addForeignKey(source, table.Name, column))
+			}
+
+			continue
+		}
+
+		fkOps, err := d.updateForeignKey(source, table, column)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ops = append(ops, fkOps...)
+	}
+
+	// create primary key after the columns were added
+	if pkChanged && len(pkColumns) > 0 {
+		ops = append(ops, &AddPrimaryKey{Source{model.ModelName, ""}, table.Name, d.getPrimaryKeyName(table.Name, pkColumns), pkColumns})
+	}
+
+	if d.DropColumns {
+		for _, state := range table.Columns {
+			if !d.columnsContain(columns, state.Name) {
+				ops = append(ops, &DropColumn{Source{model.ModelName, state.Name}, table.Name, state.Name})
+			}
+		}
+	}
+
+	return ops, nil
+}
+
+func (d *SchemaDiff) updateColumn(source Source, table *TableState, column *ColumnSpec, state *ColumnState) []Operation {
+	ops := make([]Operation, 0)
+
+	// compare normalized types, as the type returned by the database differs from aliases used in tags
+	if d.Dialect.NormalizeType(column.Type) != d.Dialect.NormalizeType(state.Type) {
+		ops = append(ops, &AlterColumnType{source, table.Name, column.Name, column.Type})
+	}
+
+	uniqueName := d.getUniqueName(table.Name, column.Name)
+	unique := table.constraint(uniqueName) != nil
+
+	if column.Unique && !unique {
+		ops = append(ops, &AddUnique{source, table.Name, uniqueName, column.Name})
+	} else if !column.Unique && unique {
+		ops = append(ops, &DropConstraint{source, table.Name, uniqueName, ConstraintUnique})
+	}
+
+	if column.NotNull != state.NotNull {
+		ops = append(ops, &AlterColumnNotNull{source, table.Name, column.Name, column.NotNull})
+	}
+
+	if d.Dialect.NormalizeExpr(column.Default) != d.Dialect.NormalizeExpr(state.Default) {
+		ops = append(ops, &AlterColumnDefault{source, table.Name, column.Name, column.Default})
+	}
+
+	return ops
+}
+
+// Returns the operations to rename the foreign key of given column if it is named after a renamed table or column.
+// The operations to create and drop it are collected to be executed after all tables.
+func (d *SchemaDiff) updateForeignKey(source Source, table *TableState, column *ColumnSpec) ([]Operation, error) {
+	fkName := ""
+
+	if column.ForeignKey != nil {
+		fkName = d.getForeignKeyName(table.Name, column.Name, column.ForeignKey.RefTable, column.ForeignKey.RefColumn)
+	}
+
+	existing, err := d.findForeignKey(source, table, column.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if existing != nil && column.ForeignKey != nil && existing.Name != fkName &&
+		d.foreignKeyReferences(existing, column.ForeignKey) && !d.foreignKeyChanged(existing, column.ForeignKey) {
+		return []Operation{&RenameConstraint{source, table.Name, existing.Name, fkName, ConstraintForeignKey}}, nil
+	}
+
+	if existing != nil && existing.Name == fkName {
+		if !d.foreignKeyChanged(existing, column.ForeignKey) {
+			return nil, nil
+		}
+
+		// recreate on changed actions, the old one must be dropped first as the name is the same
+		d.createFK = append(d.createFK,
+			&DropConstraint{source, table.Name, existing.Name, ConstraintForeignKey},
+			d.addForeignKey(source, table.Name, column))
+		return nil, nil
+	}
+
+	// drop on change or when it was removed
+	if existing != nil {
+		d.dropFK = append(d.dropFK, &DropConstraint{source, table.Name, existing.Name, ConstraintForeignKey})
+	}
+
+	if column.ForeignKey != nil {
+		d.createFK = append(d.createFK, d.addForeignKey(source, table.Name, column))
+	}
+
+	return nil, nil
+}
+
+func (d *SchemaDiff) addForeignKey(source Source, tableName string, column *ColumnSpec) Operation {
+	fk := column.ForeignKey
+	name := d.getForeignKeyName(tableName, column.Name, fk.RefTable, fk.RefColumn)
+	return &AddForeignKey{source, tableName, name, column.Name, *fk}
+}
+
+// Returns the foreign key of given column named like the ones created by Gondolier or nil if there is none.
+func (d *SchemaDiff) findForeignKey(source Source, table *TableState, columnName string) (*ConstraintState, error) {
+	prefix := table.Name + "_" + columnName + "_"
+	var fk *ConstraintState
+
+	for _, constraint := range table.constraints(ConstraintForeignKey) {
+		if len(constraint.Columns) == 1 && constraint.Columns[0] == columnName && d.matchName(constraint.Name, prefix, "_fk") {
+			if fk != nil {
+				return nil, &ModelError{source.Model, source.Field, "No distinct foreign key found for column '" + columnName + "'"}
+			}
+
+			found := constraint
+			fk = &found
+		}
+	}
+
+	return fk, nil
+}
+
+// Returns true if the existing foreign key references the table and column of given one.
+func (d *SchemaDiff) foreignKeyReferences(existing *ConstraintState, fk *ForeignKeySpec) bool {
+	return existing.RefTable == fk.RefTable && len(existing.RefColumns) == 1 && existing.RefColumns[0] == fk.RefColumn
+}
+
+// Returns true if the referential actions or deferrability of the existing foreign key differ from given one.
+func (d *SchemaDiff) foreignKeyChanged(existing *ConstraintState, fk *ForeignKeySpec) bool {
+	return existing.OnDelete != fk.OnDelete ||
+		existing.OnUpdate != fk.OnUpdate ||
+		existing.Deferrable != fk.Deferrable ||
+		existing.Deferred != fk.Deferred
+}
+
+// Returns the operations to add, replace and drop check constraints of given table to match the check tags and model checks.
+func (d *SchemaDiff) updateChecks(model *MetaModel, table *TableState) ([]Operation, error) {
+	checks, err := getTagChecks(model, d.Naming)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]Operation, 0)
+	existing := d.getChecks(table)
+
+	for _, check := range checks {
+		source := Source{model.ModelName, check.field}
+		current := d.findConstraint(existing, check.name)
+
+		if current != nil && d.Dialect.NormalizeExpr(current.Expression) == d.Dialect.NormalizeExpr(check.expr) {
+			continue
+		}
+
+		if current != nil {
+			ops = append(ops, &DropConstraint{source, table.Name, check.name, ConstraintCheck})
+		}
+
+		ops = append(ops, &AddCheck{source, table.Name, check.name, check.expr})
+	}
+
+	for _, current := range existing {
+		if findModelCheck(checks, current.Name) == nil {
+			ops = append(ops, &DropConstraint{Source{model.ModelName, ""}, table.Name, current.Name, ConstraintCheck})
+		}
+	}
+
+	return ops, nil
+}
+
+// Returns the check constraints of given table named like the ones created by Gondolier.
+func (d *SchemaDiff) getChecks(table *TableState) []ConstraintState {
+	checks := make([]ConstraintState, 0)
+
+	for _, constraint := range table.constraints(ConstraintCheck) {
+		if d.matchName(constraint.Name, table.Name+"_", "_check") {
+			checks = append(checks, constraint)
+		}
+	}
+
+	return checks
+}
+
+func (d *SchemaDiff) findConstraint(constraints []ConstraintState, name string) *ConstraintState {
+	for i := range constraints {
+		if constraints[i].Name == name {
+			return &constraints[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the operations to create, recreate and drop indexes of given table to match the index tags.
+func (d *SchemaDiff) updateIndexes(model *MetaModel, table *TableState) ([]Operation, error) {
+	indexes, err := d.Dialect.Indexes(table.Name, model)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]Operation, 0)
+	existing := d.getIndexes(table)
+
+	for _, index := range indexes {
+		source := Source{model.ModelName, index.Field}
+		current := d.findIndex(existing, index.Name)
+
+		if current != nil && !d.indexChanged(current, &index) {
+			continue
+		}
+
+		if current != nil {
+			ops = append(ops, &DropIndex{source, table.Name, index.Name})
+		}
+
+		ops = append(ops, &CreateIndex{source, table.Name, index})
+	}
+
+	for _, current := range existing {
+		if !d.indexesContain(indexes, current.Name) {
+			ops = append(ops, &DropIndex{Source{model.ModelName, ""}, table.Name, current.Name})
+		}
+	}
+
+	return ops, nil
+}
+
+// Returns the indexes of given table named like the ones created by Gondolier.
+func (d *SchemaDiff) getIndexes(table *TableState) []IndexState {
+	indexes := make([]IndexState, 0)
+
+	for _, index := range table.Indexes {
+		if d.matchName(index.Name, table.Name+"_", "_idx") {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return indexes
+}
+
+// Returns true if the columns, uniqueness, method or where clause of the existing index differ from given one.
+// The method is not compared if the database does not return it.
+func (d *SchemaDiff) indexChanged(existing *IndexState, index *IndexSpec) bool {
+	return existing.Unique != index.Unique ||
+		(existing.Method != "" && existing.Method != index.Method) ||
+		strings.Join(existing.Columns, ",") != strings.Join(index.Columns, ",") ||
+		d.Dialect.NormalizeExpr(existing.Where) != d.Dialect.NormalizeExpr(index.Where)
+}
+
+func (d *SchemaDiff) findIndex(indexes []IndexState, name string) *IndexState {
+	for i := range indexes {
+		if indexes[i].Name == name {
+			return &indexes[i]
+		}
+	}
+
+	return nil
+}
+
+func (d *SchemaDiff) indexesContain(indexes []IndexSpec, name string) bool {
+	for _, index := range indexes {
+		if index.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the names of all primary key columns in field order.
+func (d *SchemaDiff) getPrimaryKeyColumns(columns []ColumnSpec) []string {
+	names := make([]string, 0)
+
+	for _, column := range columns {
+		if column.PrimaryKey || column.Id {
+			names = append(names, column.Name)
+		}
+	}
+
+	return names
+}
+
+func (d *SchemaDiff) columnsContain(columns []ColumnSpec, name string) bool {
+	for _, column := range columns {
+		if column.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns true if the name starts with given prefix and ends with given suffix, with something in between.
+func (d *SchemaDiff) matchName(name, prefix, suffix string) bool {
+	return len(name) > len(prefix)+len(suffix) && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix)
+}
+
+// Returns the name of the primary key for given columns.
+// Single column primary keys are named after the table, composite ones after their columns.
+func (d *SchemaDiff) getPrimaryKeyName(tableName string, columnNames []string) string {
+	if len(columnNames) == 1 {
+		return tableName + "_pkey"
+	}
+
+	return tableName + "_" + strings.Join(columnNames, "_") + "_pkey"
+}
+
+func (d *SchemaDiff) getUniqueName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_key"
+}
+
+func (d *SchemaDiff) getForeignKeyName(tableName, columnName, refTableName, refColumnName string) string {
+	return tableName + "_" + columnName + "_" + refTableName + "_" + refColumnName + "_fk"
+}
+
+func (d *SchemaDiff) getCheckName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_check"
+}
+
+func (d *SchemaDiff) getIndexName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_idx"
+}
+
+func (d *SchemaDiff) getSequenceName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_seq"
+}
@@ -0,0 +1,316 @@
+package gondolier
+
+import (
+	"strings"
+	"testing"
+)
+
+type testDiffUser struct {
+	Id      uint64 `gondolier:"type:bigint;id"`
+	Name    string `gondolier:"type:varchar(255);notnull;unique"`
+	Picture uint64 `gondolier:"type:bigint;fk:testDiffPicture.Id,ondelete:cascade"`
+}
+
+type testDiffPicture struct {
+	Id   uint64 `gondolier:"type:bigint;id"`
+	Path string `gondolier:"type:text;default:'none'"`
+}
+
+type testDiffRenamed struct {
+	Id   uint64 `gondolier:"type:bigint;id"`
+	Path string `gondolier:"type:text;was:File;check:path <> '';index"`
+}
+
+type testDiffIndex struct {
+	Name   string `gondolier:"type:text;check:name <> '';index"`
+	Status string `gondolier:"type:text;index"`
+}
+
+// testDialect is a minimal dialect reading the tables from a map, to test the schema diff without a database.
+type testDialect struct {
+	tables map[string]*TableState
+}
+
+func (d *testDialect) Table(name string) (*TableState, error) {
+	return d.tables[name], nil
+}
+
+func (d *testDialect) Column(tableName string, field *MetaField) (*ColumnSpec, error) {
+	column := &ColumnSpec{Name: (&SnakeCase{}).Get(field.Name)}
+
+	for _, tag := range field.Tags {
+		switch {
+		case tag.Name == "type":
+			column.Type = tag.Value
+		case tag.Name == "default":
+			column.Default = tag.Value
+		case tag.Name == "fk":
+			options := strings.Split(tag.Value, ",")
+			ref := strings.Split(options[0], ".")
+			column.ForeignKey = &ForeignKeySpec{RefTable: (&SnakeCase{}).Get(ref[0]),
+				RefColumn: (&SnakeCase{}).Get(ref[1]),
+				OnDelete:  "no action",
+				OnUpdate:  "no action"}
+
+			if len(options) > 1 {
+				column.ForeignKey.OnDelete = strings.TrimPrefix(options[1], "ondelete:")
+			}
+		case tag.Value == "id":
+			column.Id, column.NotNull, column.Default = true, true, "generated"
+			column.Sequence = &SequenceSpec{Start: "1", Increment: "1"}
+		case tag.Value == "notnull":
+			column.NotNull = true
+		case tag.Value == "unique":
+			column.Unique = true
+		}
+	}
+
+	return column, nil
+}
+
+func (d *testDialect) Indexes(tableName string, model *MetaModel) ([]IndexSpec, error) {
+	indexes := make([]IndexSpec, 0)
+
+	for _, field := range model.Fields {
+		for _, tag := range field.Tags {
+			if tag.Value == "index" {
+				column := (&SnakeCase{}).Get(field.Name)
+				indexes = append(indexes, IndexSpec{Name: tableName + "_" + column + "_idx", Field: field.Name, Columns: []string{column}})
+			}
+		}
+	}
+
+	return indexes, nil
+}
+
+func (d *testDialect) NormalizeType(columnType string) string {
+	return strings.ToLower(columnType)
+}
+
+func (d *testDialect) NormalizeExpr(expr string) string {
+	return strings.ToLower(expr)
+}
+
+func (d *testDialect) SQL(op Operation) ([]string, error) {
+	return nil, nil
+}
+
+func TestSchemaDiffCreateTable(t *testing.T) {
+	diff := &SchemaDiff{Dialect: &testDialect{}, Naming: &SnakeCase{}}
+	ops, err := diff.Diff(testBuildMetaModels(t, testDiffPicture{}, testDiffUser{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"CreateSequence test_diff_picture_id_seq",
+		"CreateTable test_diff_picture",
+		"AlterSequenceOwner test_diff_picture_id_seq",
+		"CreateSequence test_diff_user_id_seq",
+		"CreateTable test_diff_user",
+		"AlterSequenceOwner test_diff_user_id_seq",
+		"AddForeignKey test_diff_user_picture_test_diff_picture_id_fk"}
+	testExpectOperations(t, ops, expected)
+	picture := ops[1].(*CreateTable)
+
+	if len(picture.Columns) != 2 || picture.Columns[0].Sequence == nil ||
+		picture.PrimaryKey != "test_diff_picture_pkey" || strings.Join(picture.PrimaryKeyColumns, ",") != "id" ||
+		picture.Origin().Model != "testDiffPicture" {
+		t.Fatalf("Picture table not as expected: %v", ops[1])
+	}
+
+	fk := ops[6].(*AddForeignKey)
+
+	if fk.ForeignKey.OnDelete != "cascade" || fk.Origin().Field != "Picture" {
+		t.Fatalf("Foreign key not as expected: %v", ops[6])
+	}
+}
+
+func TestSchemaDiffUpdateTable(t *testing.T) {
+	table := &TableState{Name: "test_diff_user",
+		Columns: []ColumnState{{Name: "id", Type: "bigint", NotNull: true, Default: "generated"},
+			{Name: "name", Type: "VARCHAR(100)"},
+			{Name: "picture", Type: "bigint", Default: "0"},
+			{Name: "old", Type: "text"}},
+		Sequences: []string{"test_diff_user_id_seq"},
+		Constraints: []ConstraintState{{Name: "test_diff_user_name_pkey", Type: ConstraintPrimaryKey, Columns: []string{"name"}},
+			{Name: "test_diff_user_picture_test_diff_picture_id_fk", Type: ConstraintForeignKey, Columns: []string{"picture"},
+				RefTable: "test_diff_picture", RefColumns: []string{"id"}, OnDelete: "no action", OnUpdate: "no action"}}}
+	diff := &SchemaDiff{Dialect: &testDialect{map[string]*TableState{"test_diff_user": table}}, Naming: &SnakeCase{}, DropColumns: true}
+	ops, err := diff.Diff(testBuildMetaModels(t, testDiffUser{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"DropConstraint test_diff_user_name_pkey",
+		"AlterColumnType name",
+		"AddUnique name",
+		"AlterColumnNotNull name",
+		"AlterColumnDefault picture",
+		"AddPrimaryKey test_diff_user_pkey",
+		"DropColumn old",
+		"DropConstraint test_diff_user_picture_test_diff_picture_id_fk",
+		"AddForeignKey test_diff_user_picture_test_diff_picture_id_fk"}
+
+	testExpectOperations(t, ops, expected)
+
+	if ops[4].(*AlterColumnDefault).Default != "" {
+		t.Fatal("Default must have been dropped")
+	}
+}
+
+func TestSchemaDiffUnchanged(t *testing.T) {
+	table := &TableState{Name: "test_diff_picture",
+		Columns: []ColumnState{{Name: "id", Type: "BIGINT", NotNull: true, Default: "Generated"},
+			{Name: "path", Type: "text", Default: "'none'"}},
+		Sequences:   []string{"test_diff_picture_id_seq"},
+		Constraints: []ConstraintState{{Name: "test_diff_picture_pkey", Type: ConstraintPrimaryKey, Columns: []string{"id"}}}}
+	diff := &SchemaDiff{Dialect: &testDialect{map[string]*TableState{"test_diff_picture": table}}, Naming: &SnakeCase{}}
+	ops, err := diff.Diff(testBuildMetaModels(t, testDiffPicture{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ops) != 0 {
+		t.Fatalf("No operations expected, but was: %v", ops)
+	}
+}
+
+func TestSchemaDiffRenameTable(t *testing.T) {
+	table := &TableState{Name: "test_diff_old",
+		Columns: []ColumnState{{Name: "id", Type: "bigint", NotNull: true, Default: "generated"},
+			{Name: "file", Type: "text"}},
+		Constraints: []ConstraintState{{Name: "test_diff_old_pkey", Type: ConstraintPrimaryKey, Columns: []string{"id"}},
+			{Name: "test_diff_old_file_check", Type: ConstraintCheck, Columns: []string{"file"}, Expression: "path <> ''"}},
+		Sequences: []string{"test_diff_old_id_seq"},
+		Indexes:   []IndexState{{Name: "test_diff_old_file_idx", Columns: []string{"file"}}}}
+	diff := &SchemaDiff{Dialect: &testDialect{map[string]*TableState{"test_diff_old": table}}, Naming: &SnakeCase{}, DropColumns: true}
+	models := testBuildMetaModels(t, testDiffRenamed{})
+	models[0].PreviousNames = []string{"testDiffGone", "testDiffOld"}
+	ops, err := diff.Diff(models)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"RenameTable test_diff_renamed",
+		"RenameSequence test_diff_renamed_id_seq",
+		"RenameConstraint test_diff_renamed_pkey",
+		"RenameConstraint test_diff_renamed_file_check",
+		"RenameIndex test_diff_renamed_file_idx",
+		"RenameColumn path",
+		"RenameConstraint test_diff_renamed_path_check",
+		"RenameIndex test_diff_renamed_path_idx"}
+	testExpectOperations(t, ops, expected)
+}
+
+func TestSchemaDiffRenameForeignKey(t *testing.T) {
+	// the foreign key is still named after the previous name of the referenced table
+	table := &TableState{Name: "test_diff_user",
+		Columns: []ColumnState{{Name: "id", Type: "bigint", NotNull: true, Default: "generated"},
+			{Name: "name", Type: "varchar(255)", NotNull: true},
+			{Name: "picture", Type: "bigint"}},
+		Constraints: []ConstraintState{{Name: "test_diff_user_pkey", Type: ConstraintPrimaryKey, Columns: []string{"id"}},
+			{Name: "test_diff_user_name_key", Type: ConstraintUnique, Columns: []string{"name"}},
+			{Name: "test_diff_user_picture_test_diff_image_id_fk", Type: ConstraintForeignKey, Columns: []string{"picture"},
+				RefTable: "test_diff_picture", RefColumns: []string{"id"}, OnDelete: "cascade", OnUpdate: "no action"}},
+		Sequences: []string{"test_diff_user_id_seq"}}
+	diff := &SchemaDiff{Dialect: &testDialect{map[string]*TableState{"test_diff_user": table}}, Naming: &SnakeCase{}}
+	ops, err := diff.Diff(testBuildMetaModels(t, testDiffUser{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testExpectOperations(t, ops, []string{"RenameConstraint test_diff_user_picture_test_diff_picture_id_fk"})
+}
+
+func TestSchemaDiffSequenceCheckIndex(t *testing.T) {
+	table := &TableState{Name: "test_diff_index",
+		Columns: []ColumnState{{Name: "name", Type: "text"},
+			{Name: "status", Type: "text"}},
+		Constraints: []ConstraintState{{Name: "test_diff_index_name_check", Type: ConstraintCheck, Expression: "name <> 'none'"},
+			{Name: "test_diff_index_status_check", Type: ConstraintCheck, Expression: "status <> ''"},
+			{Name: "custom_check", Type: ConstraintCheck, Expression: "status <> 'custom'"}},
+		Sequences: []string{"test_diff_index_status_seq"},
+		Indexes: []IndexState{{Name: "test_diff_index_name_idx", Columns: []string{"name"}, Unique: true},
+			{Name: "test_diff_index_status_idx", Columns: []string{"status"}},
+			{Name: "test_diff_index_old_idx", Columns: []string{"status"}},
+			{Name: "custom_idx", Columns: []string{"name"}}}}
+	diff := &SchemaDiff{Dialect: &testDialect{map[string]*TableState{"test_diff_index": table}}, Naming: &SnakeCase{}}
+	ops, err := diff.Diff(testBuildMetaModels(t, testDiffIndex{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"DropSequence test_diff_index_status_seq",
+		"DropConstraint test_diff_index_name_check",
+		"AddCheck test_diff_index_name_check",
+		"DropConstraint test_diff_index_status_check",
+		"DropIndex test_diff_index_name_idx",
+		"CreateIndex test_diff_index_name_idx",
+		"DropIndex test_diff_index_old_idx"}
+	testExpectOperations(t, ops, expected)
+}
+
+func testExpectOperations(t *testing.T, ops []Operation, expected []string) {
+	if len(ops) != len(expected) {
+		t.Fatalf("Expected %v operations, but was: %v", len(expected), ops)
+	}
+
+	for i, op := range ops {
+		if actual := testDescribeOperation(op); actual != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], actual)
+		}
+	}
+}
+
+func testDescribeOperation(op Operation) string {
+	switch op := op.(type) {
+	case *CreateTable:
+		return "CreateTable " + op.Table
+	case *DropConstraint:
+		return "DropConstraint " + op.Name
+	case *AlterColumnType:
+		return "AlterColumnType " + op.Column
+	case *AddUnique:
+		return "AddUnique " + op.Column
+	case *AlterColumnNotNull:
+		return "AlterColumnNotNull " + op.Column
+	case *AlterColumnDefault:
+		return "AlterColumnDefault " + op.Column
+	case *AddPrimaryKey:
+		return "AddPrimaryKey " + op.Name
+	case *DropColumn:
+		return "DropColumn " + op.Column
+	case *AddForeignKey:
+		return "AddForeignKey " + op.Name
+	case *AddCheck:
+		return "AddCheck " + op.Name
+	case *CreateSequence:
+		return "CreateSequence " + op.Name
+	case *AlterSequenceOwner:
+		return "AlterSequenceOwner " + op.Name
+	case *DropSequence:
+		return "DropSequence " + op.Name
+	case *CreateIndex:
+		return "CreateIndex " + op.Index.Name
+	case *DropIndex:
+		return "DropIndex " + op.Name
+	case *RenameTable:
+		return "RenameTable " + op.Name
+	case *RenameColumn:
+		return "RenameColumn " + op.Name
+	case *RenameConstraint:
+		return "RenameConstraint " + op.NewName
+	case *RenameSequence:
+		return "RenameSequence " + op.NewName
+	case *RenameIndex:
+		return "RenameIndex " + op.NewName
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,65 @@
+package gondolier
+
+// ModelError is returned when an object cannot be used as a model for migration.
+type ModelError struct {
+	Model string
+	Field string
+	Msg   string
+}
+
+// Error returns the error message including the model and field if set.
+func (e *ModelError) Error() string {
+	msg := "Model"
+
+	if e.Model != "" {
+		msg += " '" + e.Model + "'"
+	}
+
+	if e.Field != "" {
+		msg += ", field '" + e.Field + "'"
+	}
+
+	return msg + ": " + e.Msg
+}
+
+// TagError is returned when a tag of a model field is invalid or unknown.
+type TagError struct {
+	Model string
+	Field string
+	Tag   string
+	Msg   string
+}
+
+// Error returns the error message including the model, field and tag.
+func (e *TagError) Error() string {
+	return "Tag '" + e.Tag + "' of model '" + e.Model + "', field '" + e.Field + "': " + e.Msg
+}
+
+// SQLError is returned when a statement executed for a model fails.
+// Model and Field are empty if the statement does not belong to a model or field.
+type SQLError struct {
+	Model string
+	Field string
+	Query string
+	Err   error
+}
+
+// Error returns the error message including the model, field and failing statement.
+func (e *SQLError) Error() string {
+	msg := "Statement"
+
+	if e.Model != "" {
+		msg += " for model '" + e.Model + "'"
+	}
+
+	if e.Field != "" {
+		msg += ", field '" + e.Field + "'"
+	}
+
+	return msg + " failed: " + e.Err.Error() + "\n" + e.Query
+}
+
+// Unwrap returns the error returned by the database driver.
+func (e *SQLError) Unwrap() error {
+	return e.Err
+}
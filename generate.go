@@ -0,0 +1,201 @@
+package gondolier
+
+import (
+	"bytes"
+	"errors"
+	"go/format"
+	"go/token"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WriteModels writes Go source code to w, declaring one struct with gondolier tags for each of given models.
+// Names of models and fields and references in fk tags are translated back to Go names using the naming,
+// which must implement the NameInverter interface. Fields without a Go type are declared as string.
+// The code is formatted using go/format.
+//
+// Example:
+//  models, _ := Inspect()
+//  WriteModels(os.Stdout, "model", models, &SnakeCase{})
+func WriteModels(w io.Writer, pkg string, models []MetaModel, naming NameSchema) error {
+	inverter, ok := naming.(NameInverter)
+
+	if !ok {
+		return errors.New("The naming does not support translating schema names back to model names")
+	}
+
+	var src bytes.Buffer
+	src.WriteString("package " + pkg + "\n\n")
+
+	if imports := getImports(models); len(imports) > 0 {
+		src.WriteString("import (\n")
+
+		for _, path := range imports {
+			src.WriteString(strconv.Quote(path) + "\n")
+		}
+
+		src.WriteString(")\n\n")
+	}
+
+	for _, model := range models {
+		if err := writeModel(&src, &model, naming, inverter); err != nil {
+			return err
+		}
+	}
+
+	code, err := format.Source(src.Bytes())
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(code)
+	return err
+}
+
+func writeModel(src *bytes.Buffer, model *MetaModel, naming NameSchema, inverter NameInverter) error {
+	name, err := invertName(model.ModelName, "", model.ModelName, naming, inverter)
+
+	if err != nil {
+		return err
+	}
+
+	src.WriteString("// " + name + " is generated from table " + model.ModelName + ".\n")
+	src.WriteString("type " + name + " struct {\n")
+
+	for _, field := range model.Fields {
+		fieldName, err := invertName(model.ModelName, field.Name, field.Name, naming, inverter)
+
+		if err != nil {
+			return err
+		}
+
+		tag, err := getGeneratedTag(model.ModelName, &field, naming, inverter)
+
+		if err != nil {
+			return err
+		}
+
+		src.WriteString(fieldName + " " + getTypeName(field.Type) + " " + tag + "\n")
+	}
+
+	src.WriteString("}\n\n")
+	return nil
+}
+
+// Returns the struct tag for given field, translating the reference of the fk tag.
+func getGeneratedTag(modelName string, field *MetaField, naming NameSchema, inverter NameInverter) (string, error) {
+	tags := make([]string, 0, len(field.Tags))
+
+	for _, tag := range field.Tags {
+		if tag.Name == "" {
+			tags = append(tags, tag.Value)
+			continue
+		}
+
+		value := tag.Value
+		key := strings.ToLower(tag.Name)
+
+		if key == "fk" || key == "foreign key" {
+			options := strings.SplitN(value, ",", 2)
+			ref := strings.Split(options[0], ".")
+
+			if len(ref) != 2 {
+				return "", &TagError{modelName, field.Name, tag.Name + ":" + tag.Value, "The reference must consist of model and field"}
+			}
+
+			refModel, err := invertName(modelName, field.Name, ref[0], naming, inverter)
+
+			if err != nil {
+				return "", err
+			}
+
+			refField, err := invertName(modelName, field.Name, ref[1], naming, inverter)
+
+			if err != nil {
+				return "", err
+			}
+
+			value = refModel + "." + refField
+
+			if len(options) > 1 {
+				value += "," + options[1]
+			}
+		}
+
+		tags = append(tags, tag.Name+":"+value)
+	}
+
+	tag := tagname + ":" + strconv.Quote(strings.Join(tags, ";"))
+
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag), nil
+	}
+
+	return "`" + tag + "`", nil
+}
+
+// Translates the schema name back to a Go identifier, which must be translated to the same schema name again.
+func invertName(modelName, fieldName, name string, naming NameSchema, inverter NameInverter) (string, error) {
+	inverted := inverter.Invert(name)
+
+	if !token.IsIdentifier(inverted) || !token.IsExported(inverted) || naming.Get(inverted) != name {
+		return "", &ModelError{modelName, fieldName, "The name '" + name + "' cannot be translated to an exported Go name"}
+	}
+
+	return inverted, nil
+}
+
+// Returns the sorted import paths of all field types.
+func getImports(models []MetaModel) []string {
+	paths := make(map[string]bool)
+
+	for _, model := range models {
+		for _, field := range model.Fields {
+			t := field.Type
+
+			for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+				t = t.Elem()
+			}
+
+			if t != nil && t.PkgPath() != "" {
+				paths[t.PkgPath()] = true
+			}
+		}
+	}
+
+	imports := make([]string, 0, len(paths))
+
+	for path := range paths {
+		imports = append(imports, path)
+	}
+
+	sort.Strings(imports)
+	return imports
+}
+
+// Returns the name of given type as used in Go source code. The name is string if no type is set.
+func getTypeName(t reflect.Type) string {
+	if t == nil {
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + getTypeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + getTypeName(t.Elem())
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + getTypeName(t.Elem())
+	}
+
+	// byte is an alias for uint8
+	if t.Name() == "uint8" && t.PkgPath() == "" {
+		return "byte"
+	}
+
+	return t.String()
+}
@@ -0,0 +1,94 @@
+package gondolier
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteModels(t *testing.T) {
+	models := []MetaModel{{ModelName: "blog_post",
+		Fields: []MetaField{{Name: "id", Tags: []MetaTag{{"type", "bigint"}, {"", "pk"}, {"seq", "1,1,-,-,1"}, {"default", "nextval(seq)"}}, Type: reflect.TypeOf(int64(0))},
+			{Name: "title", Tags: []MetaTag{{"type", "character varying(255)"}, {"default", `'"untitled"'::character varying`}}, Type: reflect.TypeOf(sql.NullString{})},
+			{Name: "author_id", Tags: []MetaTag{{"type", "bigint"}, {"fk", "blog_author.id,ondelete:cascade"}}, Type: reflect.TypeOf(new(int64))},
+			{Name: "published", Tags: []MetaTag{{"type", "timestamp with time zone"}}, Type: reflect.TypeOf(new(time.Time))},
+			{Name: "data", Tags: []MetaTag{{"type", "bytea"}}, Type: reflect.TypeOf([]byte{})},
+			{Name: "raw", Tags: []MetaTag{{"type", "jsonb"}}}}}}
+	var src bytes.Buffer
+
+	if err := WriteModels(&src, "model", models, &SnakeCase{}); err != nil {
+		t.Fatal(err)
+	}
+
+	code := src.String()
+	t.Log(code)
+	expected := []string{"package model",
+		"\"database/sql\"\n\t\"time\"",
+		"type BlogPost struct {",
+		"Id        int64          `gondolier:\"type:bigint;pk;seq:1,1,-,-,1;default:nextval(seq)\"`",
+		"Title     sql.NullString `gondolier:\"type:character varying(255);default:'\\\"untitled\\\"'::character varying\"`",
+		"AuthorId  *int64         `gondolier:\"type:bigint;fk:BlogAuthor.Id,ondelete:cascade\"`",
+		"Published *time.Time     `gondolier:\"type:timestamp with time zone\"`",
+		"Data      []byte         `gondolier:\"type:bytea\"`",
+		"Raw       string         `gondolier:\"type:jsonb\"`"}
+
+	for _, e := range expected {
+		if !strings.Contains(code, e) {
+			t.Fatalf("Code must contain: %v", e)
+		}
+	}
+}
+
+func TestWriteModelsInvalidName(t *testing.T) {
+	models := []MetaModel{{ModelName: "my-table", Fields: []MetaField{{Name: "id", Tags: []MetaTag{{"type", "bigint"}}}}}}
+
+	if err := WriteModels(ioutil.Discard, "model", models, &SnakeCase{}); err == nil {
+		t.Fatal("Names which cannot be translated must return an error")
+	}
+}
+
+func TestWriteModelsNotInvertible(t *testing.T) {
+	if err := WriteModels(ioutil.Discard, "model", []MetaModel{}, &dummyCase{}); err == nil {
+		t.Fatal("Naming which cannot be inverted must return an error")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestGenerate ---")
+
+	dir, err := ioutil.TempDir("", "gondolier")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testUser{}, testPost{}, testPicture{}, testArticle{})
+	Migrate()
+
+	if err := Generate(dir, "model"); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := ioutil.ReadFile(filepath.Join(dir, "test_post.go"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(string(code))
+
+	if !strings.Contains(string(code), "type TestPost struct") ||
+		!strings.Contains(string(code), "User    int64  `gondolier:\"type:bigint;notnull;fk:TestUser.Id\"`") {
+		t.Fatal("Code must contain generated model")
+	}
+}
@@ -0,0 +1,363 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Gondolier is a migration session with its own database connection, migrator, naming and models.
+// Use it instead of the package functions to migrate multiple databases within one process.
+// An instance must not be used by multiple goroutines at the same time, but different instances can migrate concurrently.
+// The migrators keep no state between calls, so one migrator can be shared by multiple instances.
+type Gondolier struct {
+	db       *sql.DB
+	migrator Migrator
+	naming   NameSchema
+	models   []MetaModel
+}
+
+// Option is used to configure a Gondolier instance created by New.
+type Option func(*Gondolier)
+
+// WithNaming sets the naming pattern used for migration. Default is snake case.
+// The option is ignored if nil is passed.
+func WithNaming(schema NameSchema) Option {
+	return func(g *Gondolier) {
+		if schema != nil {
+			g.naming = schema
+		}
+	}
+}
+
+// New creates a new migration session for given database connection and migrator.
+//
+// Example:
+//  g := New(db, &Postgres{Schema: "public"}, WithNaming(&SnakeCase{}))
+//  g.Model(MyModel{}, AnotherModel{})
+//  g.Migrate()
+func New(conn *sql.DB, m Migrator, options ...Option) *Gondolier {
+	g := &Gondolier{db: conn,
+		migrator: m,
+		naming:   &SnakeCase{},
+		models:   make([]MetaModel, 0)}
+
+	for _, option := range options {
+		option(g)
+	}
+
+	return g
+}
+
+// Use sets the database connection and migrator.
+func (g *Gondolier) Use(conn *sql.DB, m Migrator) {
+	g.db = conn
+	g.migrator = m
+}
+
+// Naming sets the naming pattern used for migration. Default is snake case.
+func (g *Gondolier) Naming(schema NameSchema) {
+	if schema == nil {
+		panic("Name schema must not be nil")
+	}
+
+	g.naming = schema
+}
+
+// Model adds one or more objects for migration.
+// The objects can be passed as references, values or mixed.
+// This function panics if an invalid model is used, use ModelE to handle the error instead.
+func (g *Gondolier) Model(models ...interface{}) {
+	if err := g.ModelE(models...); err != nil {
+		panic(err)
+	}
+}
+
+// ModelE adds one or more objects for migration.
+// The objects can be passed as references, values or mixed.
+// A *ModelError or *TagError is returned if an invalid model is used.
+// No model is added in that case.
+func (g *Gondolier) ModelE(models ...interface{}) error {
+	newModels := make([]MetaModel, 0, len(models))
+
+	for _, model := range models {
+		metaModel, err := buildMetaModel(model)
+
+		if err != nil {
+			return err
+		}
+
+		if !modelExists(g.models, metaModel.ModelName) && !modelExists(newModels, metaModel.ModelName) {
+			newModels = append(newModels, metaModel)
+		}
+	}
+
+	g.models = append(g.models, newModels...)
+	return nil
+}
+
+// Migrate migrates models added previously using Model().
+// This function panics if the migration fails, use MigrateE to handle the error instead.
+func (g *Gondolier) Migrate() {
+	if err := g.MigrateE(); err != nil {
+		panic(err)
+	}
+}
+
+// MigrateE migrates models added previously using Model() and returns an error if the migration fails.
+// The models are kept on failure, so that the migration can be retried by calling MigrateE again.
+func (g *Gondolier) MigrateE() error {
+	return g.MigrateContext(context.Background())
+}
+
+// MigrateContext migrates models added previously using Model() and returns an error if the migration fails.
+// The migration is canceled and rolled back when the context is canceled or its deadline is exceeded.
+// The models are kept on failure, so that the migration can be retried.
+// Models are migrated after the models they reference by fk tags.
+func (g *Gondolier) MigrateContext(ctx context.Context) error {
+	if err := g.checkSetup(); err != nil {
+		return err
+	}
+
+	if err := g.migrator.Migrate(ctx, g.db, g.naming, g.getMigrationOrder()); err != nil {
+		return err
+	}
+
+	g.reset()
+	return nil
+}
+
+// Plan returns the statements a migration of the models added previously using Model() would execute,
+// without executing them. The models are kept, so that they can be migrated afterwards.
+// The migrator must implement the Planner interface.
+func (g *Gondolier) Plan() (*Plan, error) {
+	return g.PlanContext(context.Background())
+}
+
+// PlanContext returns the statements a migration of the models added previously using Model() would execute,
+// without executing them. The models are kept, so that they can be migrated afterwards.
+// The migrator must implement the Planner interface.
+func (g *Gondolier) PlanContext(ctx context.Context) (*Plan, error) {
+	if err := g.checkSetup(); err != nil {
+		return nil, err
+	}
+
+	planner, ok := g.migrator.(Planner)
+
+	if !ok {
+		return nil, errors.New("The migrator does not support planning a migration")
+	}
+
+	return planner.Plan(ctx, g.db, g.naming, g.getMigrationOrder())
+}
+
+// ExportSQL writes the migration of the models added previously using Model() to an SQL script at given path,
+// without executing it. The file is created or truncated if it exists.
+// The migrator must implement the Planner interface.
+func (g *Gondolier) ExportSQL(path string) error {
+	return g.ExportSQLContext(context.Background(), path)
+}
+
+// ExportSQLContext writes the migration of the models added previously using Model() to an SQL script at given path,
+// without executing it. The file is created or truncated if it exists.
+// The migrator must implement the Planner interface.
+func (g *Gondolier) ExportSQLContext(ctx context.Context, path string) error {
+	plan, err := g.PlanContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+
+	if err != nil {
+		return err
+	}
+
+	if err := plan.WriteSQL(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Inspect reads the existing database schema into models, which can be used for comparison or to generate code.
+// The migrator must implement the Inspector interface.
+func (g *Gondolier) Inspect() ([]MetaModel, error) {
+	return g.InspectContext(context.Background())
+}
+
+// InspectContext reads the existing database schema into models, which can be used for comparison or to generate code.
+// The migrator must implement the Inspector interface.
+func (g *Gondolier) InspectContext(ctx context.Context) ([]MetaModel, error) {
+	if err := g.checkSetup(); err != nil {
+		return nil, err
+	}
+
+	inspector, ok := g.migrator.(Inspector)
+
+	if !ok {
+		return nil, errors.New("The migrator does not support inspecting a database")
+	}
+
+	return inspector.Inspect(ctx, g.db, g.naming)
+}
+
+// Generate inspects the database and writes one Go source file for each table to given directory,
+// declaring a struct with gondolier tags for the table. The files are named like the tables and overwritten if they exist.
+// The migrator must implement the Inspector interface and the naming the NameInverter interface.
+func (g *Gondolier) Generate(dir, pkg string) error {
+	return g.GenerateContext(context.Background(), dir, pkg)
+}
+
+// GenerateContext inspects the database and writes one Go source file for each table to given directory,
+// declaring a struct with gondolier tags for the table. The files are named like the tables and overwritten if they exist.
+// The migrator must implement the Inspector interface and the naming the NameInverter interface.
+func (g *Gondolier) GenerateContext(ctx context.Context, dir, pkg string) error {
+	models, err := g.InspectContext(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	for _, model := range models {
+		file, err := os.Create(filepath.Join(dir, model.ModelName+".go"))
+
+		if err != nil {
+			return err
+		}
+
+		if err := WriteModels(file, pkg, []MetaModel{model}, g.naming); err != nil {
+			file.Close()
+			return err
+		}
+
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Verify compares the models added previously using Model() to the database schema and returns the differences,
+// without changing the schema. The models are kept, so that they can be migrated afterwards.
+// The migrator must implement the Verifier interface.
+func (g *Gondolier) Verify() ([]Difference, error) {
+	return g.VerifyContext(context.Background())
+}
+
+// VerifyContext compares the models added previously using Model() to the database schema and returns the differences,
+// without changing the schema. The models are kept, so that they can be migrated afterwards.
+// The migrator must implement the Verifier interface.
+func (g *Gondolier) VerifyContext(ctx context.Context) ([]Difference, error) {
+	if err := g.checkSetup(); err != nil {
+		return nil, err
+	}
+
+	verifier, ok := g.migrator.(Verifier)
+
+	if !ok {
+		return nil, errors.New("The migrator does not support verifying a database")
+	}
+
+	return verifier.Verify(ctx, g.db, g.naming, g.models)
+}
+
+// Drop drops tables for given objects if they exist.
+// The objects can be passed as references, values or mixed.
+// This function panics if an invalid model is used or the tables cannot be dropped,
+// use DropE to handle the error instead.
+func (g *Gondolier) Drop(models ...interface{}) {
+	if err := g.DropE(models...); err != nil {
+		panic(err)
+	}
+}
+
+// DropE drops tables for given objects if they exist and returns an error if one of them cannot be dropped.
+// The objects can be passed as references, values or mixed.
+func (g *Gondolier) DropE(models ...interface{}) error {
+	return g.DropContext(context.Background(), models...)
+}
+
+// DropContext drops tables for given objects if they exist and returns an error if one of them cannot be dropped.
+// Dropping is canceled when the context is canceled or its deadline is exceeded.
+// The objects can be passed as references, values or mixed.
+// Tables are dropped before the tables they reference by fk tags. If objects reference each other,
+// the migrator must implement the CycleDropper interface, otherwise an error is returned before anything is dropped.
+func (g *Gondolier) DropContext(ctx context.Context, models ...interface{}) error {
+	if err := g.checkSetup(); err != nil {
+		return err
+	}
+
+	metaModels := make([]MetaModel, 0, len(models))
+
+	for _, model := range models {
+		metaModel, err := buildMetaModel(model)
+
+		if err != nil {
+			return err
+		}
+
+		metaModels = append(metaModels, metaModel)
+	}
+
+	// drop tables referencing others first
+	metaModels, cycles := sortModels(metaModels, g.naming, true)
+
+	if len(cycles) > 0 {
+		dropper, ok := g.migrator.(CycleDropper)
+
+		if !ok {
+			return &ModelError{Model: cycles[0][0], Msg: "The models " + strings.Join(cycles[0], ", ") + " reference each other and cannot be dropped one after another"}
+		}
+
+		names := make([]string, 0, len(metaModels))
+
+		for _, model := range metaModels {
+			names = append(names, model.ModelName)
+		}
+
+		return dropper.DropTables(ctx, g.db, g.naming, names)
+	}
+
+	for _, model := range metaModels {
+		if err := g.migrator.DropTable(ctx, g.db, g.naming, model.ModelName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the models sorted so that each model is migrated after the models it references by fk tags.
+// Models referencing each other keep their order, as foreign keys are created after the tables.
+// Referenced models which were not added are expected to exist already.
+func (g *Gondolier) getMigrationOrder() []MetaModel {
+	models, _ := sortModels(g.models, g.naming, false)
+	return models
+}
+
+func (g *Gondolier) checkSetup() error {
+	if g.db == nil {
+		return errors.New("No database connection was set, call Use(connection, migrator) to set one")
+	}
+
+	if g.migrator == nil {
+		return errors.New("No migrator was set, call Use(connection, migrator) to select one")
+	}
+
+	if g.naming == nil {
+		return errors.New("No naming was set, call Naming(naming) to set one")
+	}
+
+	return nil
+}
+
+func (g *Gondolier) reset() {
+	g.models = make([]MetaModel, 0)
+}
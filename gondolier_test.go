@@ -0,0 +1,82 @@
+package gondolier
+
+import (
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	dummy := &dummyMigrator{}
+	g := New(testdb, dummy, WithNaming(&dummyCase{}))
+
+	if g.db != testdb || g.migrator != dummy {
+		t.Fatal("Database connection and migrator must have been set")
+	}
+
+	if g.naming.Get("") != "works" {
+		t.Fatal("Name schema must have been set")
+	}
+
+	g = New(testdb, dummy, WithNaming(nil))
+
+	if g.naming == nil {
+		t.Fatal("Default name schema must be kept if nil was passed")
+	}
+}
+
+func TestGondolierInstances(t *testing.T) {
+	dummyA := &dummyMigrator{}
+	dummyB := &dummyMigrator{}
+	a := New(testdb, dummyA)
+	b := New(testdb, dummyB)
+	a.Model(testModelA{}, testModelB{})
+	b.Model(testModelB{})
+
+	if len(std.models) != 0 {
+		t.Fatal("Models must not be added to the default instance")
+	}
+
+	if err := a.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dummyA.models) != 2 || len(dummyB.models) != 1 {
+		t.Fatalf("Each instance must migrate its own models, but was: %v %v", len(dummyA.models), len(dummyB.models))
+	}
+}
+
+func TestGondolierNoConnection(t *testing.T) {
+	g := New(nil, &dummyMigrator{})
+
+	if err := g.MigrateE(); err == nil {
+		t.Fatal("MigrateE must return an error if no connection was set")
+	}
+
+	if err := g.DropE(testModelA{}); err == nil {
+		t.Fatal("DropE must return an error if no connection was set")
+	}
+}
+
+func TestInspectNotSupported(t *testing.T) {
+	g := New(testdb, &dummyMigrator{})
+
+	if _, err := g.Inspect(); err == nil {
+		t.Fatal("Inspect must return an error if the migrator does not support inspecting")
+	}
+}
+
+func TestVerifyNotSupported(t *testing.T) {
+	g := New(testdb, &dummyMigrator{})
+	g.Model(testModelA{})
+
+	if _, err := g.Verify(); err == nil {
+		t.Fatal("Verify must return an error if the migrator does not support verifying")
+	}
+
+	if len(g.models) != 1 {
+		t.Fatal("Models must be kept")
+	}
+}
@@ -2,13 +2,20 @@ package gondolier
 
 import (
 	"database/sql"
+	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/microsoft/go-mssqldb"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
 var (
-	testdb *sql.DB
+	testdb       *sql.DB
+	testmysqldb  *sql.DB
+	testsqlitedb *sql.DB
+	testmssqldb  *sql.DB
 )
 
 func TestMain(m *testing.M) {
@@ -24,8 +31,45 @@ func TestMain(m *testing.M) {
 		panic(err)
 	}
 
+	// MySQL tests are skipped if no MySQL database is configured
+	if os.Getenv("TEST_MYSQL_HOST") != "" {
+		testmysqldb, err = sql.Open("mysql", testGetMySQLDbString())
+
+		if err != nil {
+			panic(err)
+		}
+
+		if err := testmysqldb.Ping(); err != nil {
+			panic(err)
+		}
+	}
+
+	// SQL Server tests are skipped if no SQL Server database is configured
+	if os.Getenv("TEST_MSSQL_HOST") != "" {
+		testmssqldb, err = sql.Open("sqlserver", testGetSQLServerDbString())
+
+		if err != nil {
+			panic(err)
+		}
+
+		if err := testmssqldb.Ping(); err != nil {
+			panic(err)
+		}
+	}
+
+	// SQLite runs locally, a new database file is created for each run
+	sqlitePath := filepath.Join(os.TempDir(), "gondolier_test.db")
+	os.Remove(sqlitePath)
+	testsqlitedb, err = sql.Open("sqlite3", "file:"+sqlitePath+"?_foreign_keys=1")
+
+	if err != nil {
+		panic(err)
+	}
+
 	// run
 	code := m.Run()
+	testsqlitedb.Close()
+	os.Remove(sqlitePath)
 	os.Exit(code)
 }
 
@@ -37,3 +81,17 @@ func testGetDbString() string {
 		" dbname=" + os.Getenv("TEST_PG_DB") +
 		" sslmode=disable"
 }
+
+func testGetMySQLDbString() string {
+	return os.Getenv("TEST_MYSQL_USER") +
+		":" + os.Getenv("TEST_MYSQL_PASSWORD") +
+		"@tcp(" + os.Getenv("TEST_MYSQL_HOST") + ":" + os.Getenv("TEST_MYSQL_PORT") + ")" +
+		"/" + os.Getenv("TEST_MYSQL_DB")
+}
+
+func testGetSQLServerDbString() string {
+	return "sqlserver://" + os.Getenv("TEST_MSSQL_USER") +
+		":" + os.Getenv("TEST_MSSQL_PASSWORD") +
+		"@" + os.Getenv("TEST_MSSQL_HOST") + ":" + os.Getenv("TEST_MSSQL_PORT") +
+		"?database=" + os.Getenv("TEST_MSSQL_DB")
+}
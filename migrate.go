@@ -1,21 +1,33 @@
 package gondolier
 
 import (
+	"context"
 	"database/sql"
 	"strings"
 )
 
 var (
-	db         *sql.DB
-	migrator   Migrator
-	naming     = NameSchema(&SnakeCase{})
-	metaModels = make([]MetaModel, 0)
+	std = New(nil, nil)
 )
 
 // Migrator interface used to migrate a database schema for a specific database.
+// The database connection and naming are passed by the Gondolier instance calling the migrator.
+// The context must be honoured for all queries and statements executed.
 type Migrator interface {
-	Migrate([]MetaModel)
-	DropTable(string)
+	Migrate(context.Context, *sql.DB, NameSchema, []MetaModel) error
+	DropTable(context.Context, *sql.DB, NameSchema, string) error
+}
+
+// Inspector is implemented by migrators which can read an existing database schema back into models.
+// The returned models use the names of the database and tags the migrator understands.
+type Inspector interface {
+	Inspect(context.Context, *sql.DB, NameSchema) ([]MetaModel, error)
+}
+
+// CycleDropper is implemented by migrators which can drop tables of models referencing each other in a cycle.
+// The tables are dropped in given order, the foreign keys between them must not prevent it.
+type CycleDropper interface {
+	DropTables(context.Context, *sql.DB, NameSchema, []string) error
 }
 
 // NameSchema interface used to translate model names to schema names.
@@ -23,10 +35,15 @@ type NameSchema interface {
 	Get(string) string
 }
 
+// NameInverter is implemented by name schemas which can translate schema names back to model names.
+// Get must return the schema name again for the model name returned by Invert.
+type NameInverter interface {
+	Invert(string) string
+}
+
 // Use sets the database connection and migrator.
 func Use(conn *sql.DB, m Migrator) {
-	db = conn
-	migrator = m
+	std.Use(conn, m)
 }
 
 // Naming sets the naming pattern used for migration. Default is snake case.
@@ -34,60 +51,236 @@ func Use(conn *sql.DB, m Migrator) {
 // Example:
 //  Naming(SnakeCase)
 func Naming(schema NameSchema) {
-	if schema == nil {
-		panic("Name schema must not be nil")
-	}
-
-	naming = schema
+	std.Naming(schema)
 }
 
 // Model adds one or more objects for migration.
 // The objects can be passed as references, values or mixed.
-// This function might panic if an invalid model is used.
+// This function panics if an invalid model is used, use ModelE to handle the error instead.
 //
 // Example:
 //  Model(&MyModel{}, AnotherModel{})
 func Model(models ...interface{}) {
-	for _, model := range models {
-		if !modelExists(model) {
-			metaModels = append(metaModels, buildMetaModel(model))
-		}
-	}
+	std.Model(models...)
+}
+
+// ModelE adds one or more objects for migration.
+// The objects can be passed as references, values or mixed.
+// A *ModelError or *TagError is returned if an invalid model is used.
+// No model is added in that case.
+//
+// Example:
+//  if err := ModelE(&MyModel{}, AnotherModel{}); err != nil {
+//      // handle error
+//  }
+func ModelE(models ...interface{}) error {
+	return std.ModelE(models...)
 }
 
 // Migrate migrates models added previously using Model().
 // The database connection and migrator must be set before by calling Use().
+// Models are migrated after the models they reference by fk tags, which must have been added too.
+// This function panics if the migration fails, use MigrateE to handle the error instead.
 //
 // Example:
 //  Use(Postgres)
 //  Model(MyModel{}, AnotherModel{})
 //  Migrate()
 func Migrate() {
-	checkSetup()
-	migrator.Migrate(metaModels)
-	reset()
+	std.Migrate()
+}
+
+// MigrateE migrates models added previously using Model() and returns an error if the migration fails.
+// The database connection and migrator must be set before by calling Use().
+// The models are kept on failure, so that the migration can be retried by calling MigrateE again.
+//
+// Example:
+//  Use(Postgres)
+//  Model(MyModel{}, AnotherModel{})
+//
+//  if err := MigrateE(); err != nil {
+//      // handle error
+//  }
+func MigrateE() error {
+	return std.MigrateE()
+}
+
+// MigrateContext migrates models added previously using Model() and returns an error if the migration fails.
+// The migration is canceled and rolled back when the context is canceled or its deadline is exceeded.
+// The database connection and migrator must be set before by calling Use().
+//
+// Example:
+//  ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+//  defer cancel()
+//
+//  if err := MigrateContext(ctx); err != nil {
+//      // handle error
+//  }
+func MigrateContext(ctx context.Context) error {
+	return std.MigrateContext(ctx)
+}
+
+// PlanMigration returns the statements Migrate would execute for the models added previously using Model(),
+// without executing them. The models are kept, so that they can be migrated afterwards.
+// The database connection and migrator must be set before by calling Use().
+//
+// Example:
+//  Model(MyModel{}, AnotherModel{})
+//  plan, err := PlanMigration()
+//
+//  if err != nil {
+//      // handle error
+//  }
+//
+//  fmt.Println(plan)
+//  plan.Apply(db)
+func PlanMigration() (*Plan, error) {
+	return std.Plan()
+}
+
+// PlanMigrationContext returns the statements Migrate would execute for the models added previously using Model(),
+// without executing them. The models are kept, so that they can be migrated afterwards.
+// The database connection and migrator must be set before by calling Use().
+func PlanMigrationContext(ctx context.Context) (*Plan, error) {
+	return std.PlanContext(ctx)
+}
+
+// ExportSQL writes the migration of the models added previously using Model() to an SQL script at given path,
+// without executing it. The file is created or truncated if it exists.
+// The database connection and migrator must be set before by calling Use().
+//
+// Example:
+//  Model(MyModel{}, AnotherModel{})
+//
+//  if err := ExportSQL("migration.sql"); err != nil {
+//      // handle error
+//  }
+func ExportSQL(path string) error {
+	return std.ExportSQL(path)
+}
+
+// ExportSQLContext writes the migration of the models added previously using Model() to an SQL script at given path,
+// without executing it. The file is created or truncated if it exists.
+// The database connection and migrator must be set before by calling Use().
+func ExportSQLContext(ctx context.Context, path string) error {
+	return std.ExportSQLContext(ctx, path)
+}
+
+// Inspect reads the existing database schema into models, which can be used for comparison or to generate code.
+// The database connection and migrator must be set before by calling Use().
+// The migrator must implement the Inspector interface.
+//
+// Example:
+//  models, err := Inspect()
+//
+//  if err != nil {
+//      // handle error
+//  }
+//
+//  for _, model := range models {
+//      fmt.Println(model.ModelName)
+//  }
+func Inspect() ([]MetaModel, error) {
+	return std.Inspect()
+}
+
+// InspectContext reads the existing database schema into models, which can be used for comparison or to generate code.
+// The database connection and migrator must be set before by calling Use().
+// The migrator must implement the Inspector interface.
+func InspectContext(ctx context.Context) ([]MetaModel, error) {
+	return std.InspectContext(ctx)
+}
+
+// Generate inspects the database and writes one Go source file for each table to given directory,
+// declaring a struct with gondolier tags for the table. The files are named like the tables and overwritten if they exist.
+// The database connection and migrator must be set before by calling Use().
+// The migrator must implement the Inspector interface and the naming the NameInverter interface.
+//
+// Example:
+//  if err := Generate("model", "model"); err != nil {
+//      // handle error
+//  }
+func Generate(dir, pkg string) error {
+	return std.Generate(dir, pkg)
+}
+
+// GenerateContext inspects the database and writes one Go source file for each table to given directory,
+// declaring a struct with gondolier tags for the table. The files are named like the tables and overwritten if they exist.
+// The database connection and migrator must be set before by calling Use().
+// The migrator must implement the Inspector interface and the naming the NameInverter interface.
+func GenerateContext(ctx context.Context, dir, pkg string) error {
+	return std.GenerateContext(ctx, dir, pkg)
+}
+
+// Verify compares the models added previously using Model() to the database schema and returns the differences,
+// without changing the schema. The models are kept, so that they can be migrated afterwards.
+// The database connection and migrator must be set before by calling Use().
+// The migrator must implement the Verifier interface.
+//
+// Example:
+//  Model(MyModel{}, AnotherModel{})
+//  diffs, err := Verify()
+//
+//  if err != nil {
+//      // handle error
+//  }
+//
+//  for _, diff := range diffs {
+//      fmt.Println(diff)
+//  }
+func Verify() ([]Difference, error) {
+	return std.Verify()
+}
+
+// VerifyContext compares the models added previously using Model() to the database schema and returns the differences,
+// without changing the schema. The models are kept, so that they can be migrated afterwards.
+// The database connection and migrator must be set before by calling Use().
+// The migrator must implement the Verifier interface.
+func VerifyContext(ctx context.Context) ([]Difference, error) {
+	return std.VerifyContext(ctx)
 }
 
 // Drop drops tables for given objects if they exist.
 // The database connection and migrator must be set before by calling Use().
 // The objects can be passed as references, values or mixed.
-// This function might panic if an invalid model is used or the tables cannot be dropped.
+// Tables are dropped before the tables they reference by fk tags.
+// This function panics if an invalid model is used or the tables cannot be dropped,
+// use DropE to handle the error instead.
 //
 // Example:
 //  Drop(&MyModel{}, AnotherModel{})
 func Drop(models ...interface{}) {
-	checkSetup()
+	std.Drop(models...)
+}
 
-	for _, model := range models {
-		metaModel := buildMetaModel(model)
-		migrator.DropTable(metaModel.ModelName)
-	}
+// DropE drops tables for given objects if they exist and returns an error if one of them cannot be dropped.
+// The database connection and migrator must be set before by calling Use().
+// The objects can be passed as references, values or mixed.
+//
+// Example:
+//  if err := DropE(&MyModel{}, AnotherModel{}); err != nil {
+//      // handle error
+//  }
+func DropE(models ...interface{}) error {
+	return std.DropE(models...)
+}
+
+// DropContext drops tables for given objects if they exist and returns an error if one of them cannot be dropped.
+// Dropping is canceled when the context is canceled or its deadline is exceeded.
+// The database connection and migrator must be set before by calling Use().
+//
+// Example:
+//  if err := DropContext(ctx, &MyModel{}, AnotherModel{}); err != nil {
+//      // handle error
+//  }
+func DropContext(ctx context.Context, models ...interface{}) error {
+	return std.DropContext(ctx, models...)
 }
 
-func modelExists(model interface{}) bool {
-	name := strings.ToLower(getModelName(model))
+func modelExists(models []MetaModel, name string) bool {
+	name = strings.ToLower(name)
 
-	for _, metaModel := range metaModels {
+	for _, metaModel := range models {
 		if name == strings.ToLower(metaModel.ModelName) {
 			return true
 		}
@@ -95,21 +288,3 @@ func modelExists(model interface{}) bool {
 
 	return false
 }
-
-func checkSetup() {
-	if db == nil {
-		panic("No database connection was set, call Use(connection, migrator) to set one")
-	}
-
-	if migrator == nil {
-		panic("No migrator was set, call Use(connection, migrator) to select one")
-	}
-
-	if naming == nil {
-		panic("No naming was set, call Naming(naming) to set one")
-	}
-}
-
-func reset() {
-	metaModels = make([]MetaModel, 0)
-}
@@ -1,6 +1,9 @@
 package gondolier
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"testing"
 )
 
@@ -16,16 +19,22 @@ type testModelB struct {
 }
 
 type dummyMigrator struct {
+	ctx    context.Context
 	models []MetaModel
 	drop   []string
+	err    error
 }
 
-func (m *dummyMigrator) Migrate(metaModels []MetaModel) {
+func (m *dummyMigrator) Migrate(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) error {
+	m.ctx = ctx
 	m.models = metaModels
+	return m.err
 }
 
-func (m *dummyMigrator) DropTable(name string) {
+func (m *dummyMigrator) DropTable(ctx context.Context, conn *sql.DB, schema NameSchema, name string) error {
+	m.ctx = ctx
 	m.drop = append(m.drop, name)
+	return m.err
 }
 
 type dummyCase struct{}
@@ -35,13 +44,13 @@ func (n *dummyCase) Get(name string) string {
 }
 
 func TestUse(t *testing.T) {
-	if migrator != nil {
+	if std.migrator != nil {
 		t.Fatal("No migrator must be selected")
 	}
 
 	Use(testdb, &Postgres{})
 
-	if migrator == nil {
+	if std.migrator == nil {
 		t.Fatal("Postgres must be selected")
 	}
 }
@@ -49,7 +58,7 @@ func TestUse(t *testing.T) {
 func testNaming(t *testing.T) {
 	Naming(&dummyCase{})
 
-	if naming.Get("") != "works" {
+	if std.naming.Get("") != "works" {
 		t.Fatal("Name schema must have been set")
 	}
 }
@@ -67,7 +76,7 @@ func TestNamingNotNil(t *testing.T) {
 func TestModel(t *testing.T) {
 	Model(&testModelA{}, testModelB{}, &testModelB{})
 
-	if len(metaModels) != 2 {
+	if len(std.models) != 2 {
 		t.Fatal("Two models must have been added")
 	}
 }
@@ -84,7 +93,7 @@ func TestMigrate(t *testing.T) {
 }
 
 func TestMigrateNoMigrator(t *testing.T) {
-	migrator = nil
+	std.migrator = nil
 
 	defer func() {
 		if r := recover(); r == nil {
@@ -95,6 +104,99 @@ func TestMigrateNoMigrator(t *testing.T) {
 	Migrate()
 }
 
+func TestModelE(t *testing.T) {
+	std.reset()
+
+	if err := ModelE(testModelA{}, 42); err == nil {
+		t.Fatal("ModelE must return an error if an invalid model was passed")
+	}
+
+	if len(std.models) != 0 {
+		t.Fatal("No model must have been added")
+	}
+
+	if err := ModelE(testModelA{}, &testModelB{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(std.models) != 2 {
+		t.Fatal("Two models must have been added")
+	}
+
+	std.reset()
+}
+
+func TestMigrateE(t *testing.T) {
+	migrateErr := errors.New("migration failed")
+	dummy := &dummyMigrator{err: migrateErr}
+	Use(testdb, dummy)
+	Model(testModelA{}, testModelB{})
+
+	if err := MigrateE(); err != migrateErr {
+		t.Fatalf("MigrateE must return the error of the migrator, but was: %v", err)
+	}
+
+	if len(std.models) != 2 {
+		t.Fatal("Models must be kept if the migration failed")
+	}
+
+	dummy.err = nil
+
+	if err := MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(std.models) != 0 {
+		t.Fatal("Models must have been reset after migration")
+	}
+}
+
+func TestMigrateContext(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	dummy := &dummyMigrator{}
+	Use(testdb, dummy)
+	Model(testModelA{})
+
+	if err := MigrateContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if dummy.ctx != ctx {
+		t.Fatal("Context must have been passed to migrator")
+	}
+
+	if err := DropContext(ctx, testModelA{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if dummy.ctx != ctx || len(dummy.drop) != 1 {
+		t.Fatal("Context must have been passed to migrator on drop")
+	}
+}
+
+func TestMigrateENoMigrator(t *testing.T) {
+	std.migrator = nil
+
+	if err := MigrateE(); err == nil {
+		t.Fatal("MigrateE must return an error if no migrator was selected")
+	}
+}
+
+func TestDropE(t *testing.T) {
+	dropErr := errors.New("drop failed")
+	dummy := &dummyMigrator{err: dropErr}
+	Use(testdb, dummy)
+
+	if err := DropE(testModelA{}, testModelB{}); err != dropErr {
+		t.Fatalf("DropE must return the error of the migrator, but was: %v", err)
+	}
+
+	if len(dummy.drop) != 1 {
+		t.Fatal("Drop must stop on first error")
+	}
+}
+
 func TestDrop(t *testing.T) {
 	dummy := &dummyMigrator{}
 	Use(testdb, dummy)
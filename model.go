@@ -1,7 +1,12 @@
 package gondolier
 
 import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -12,21 +17,53 @@ const (
 var (
 	knownTypes = []string{"time.Time",
 		"sql.NullBool",
+		"sql.NullByte",
 		"sql.NullFloat64",
+		"sql.NullInt16",
+		"sql.NullInt32",
 		"sql.NullInt64",
-		"sql.NullString"}
+		"sql.NullString",
+		"sql.NullTime"}
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
 )
 
+// Checker is implemented by models declaring check constraints which are not bound to a single field.
+// The returned map contains the expression for each constraint name.
+//
+// Example:
+//  func (m MyModel) GondolierChecks() map[string]string {
+//      return map[string]string{"period": "start_date < end_date"}
+//  }
+type Checker interface {
+	GondolierChecks() map[string]string
+}
+
+// Renamer is implemented by models which were renamed.
+// The returned names are the previous model names, the table is renamed if it still uses one of them.
+//
+// Example:
+//  func (m Customer) GondolierPreviousNames() []string {
+//      return []string{"Client"}
+//  }
+type Renamer interface {
+	GondolierPreviousNames() []string
+}
+
 // MetaModel is the description of a model for migration.
+// PreviousNames are the names the model was known by before, in case it was renamed.
 type MetaModel struct {
-	ModelName string
-	Fields    []MetaField
+	ModelName     string
+	Fields        []MetaField
+	Checks        []MetaCheck
+	PreviousNames []string
 }
 
 // MetaField is the description of one field of a model for migration.
+// Type is the Go type of the field, which is used to infer the database type if no type tag is set.
 type MetaField struct {
 	Name string
 	Tags []MetaTag
+	Type reflect.Type
 }
 
 // MetaTag is the description of a tag for a model field.
@@ -35,13 +72,41 @@ type MetaTag struct {
 	Value string
 }
 
-func buildMetaModel(model interface{}) MetaModel {
-	return MetaModel{getModelName(model),
-		getModelFields(model)}
+// MetaCheck is the description of a check constraint declared by a model.
+type MetaCheck struct {
+	Name string
+	Expr string
+}
+
+func buildMetaModel(model interface{}) (MetaModel, error) {
+	name, err := getModelName(model)
+
+	if err != nil {
+		return MetaModel{}, err
+	}
+
+	fields, err := getModelFields(model)
+
+	if err != nil {
+		return MetaModel{}, err
+	}
+
+	checks, err := getModelChecks(model)
+
+	if err != nil {
+		return MetaModel{}, err
+	}
+
+	return MetaModel{name, fields, checks, getModelPreviousNames(model)}, nil
 }
 
-func getModelName(model interface{}) string {
+func getModelName(model interface{}) (string, error) {
 	t := reflect.TypeOf(model)
+
+	if t == nil {
+		return "", &ModelError{Msg: "Passed type is not a struct"}
+	}
+
 	kind := t.Kind()
 
 	if kind == reflect.Ptr {
@@ -50,17 +115,13 @@ func getModelName(model interface{}) string {
 	}
 
 	if kind != reflect.Struct {
-		panic("Passed type is not a struct")
-	}
-
-	if t.Kind() == reflect.Ptr {
-		return t.Elem().Name()
+		return "", &ModelError{Model: t.Name(), Msg: "Passed type is not a struct"}
 	}
 
-	return t.Name()
+	return t.Name(), nil
 }
 
-func getModelFields(model interface{}) []MetaField {
+func getModelFields(model interface{}) ([]MetaField, error) {
 	val := reflect.ValueOf(model)
 
 	if val.Kind() == reflect.Ptr {
@@ -72,24 +133,89 @@ func getModelFields(model interface{}) []MetaField {
 	for i := 0; i < val.NumField(); i++ {
 		field := val.Type().Field(i)
 		tag := field.Tag.Get(tagname)
-		kind := field.Type.Kind()
 
 		if tag == "" || tag == "-" {
 			continue
 		}
 
-		if (kind == reflect.Struct || kind == reflect.Ptr || kind == reflect.Interface) &&
-			!isKnownType(field.Type.String()) {
-			panic("The type for field '" + field.Name + "' is invalid")
+		if !isValidType(field.Type) {
+			return nil, &ModelError{val.Type().Name(), field.Name, "The type for field '" + field.Name + "' is invalid"}
+		}
+
+		tags, err := parseTag(tag)
+
+		if err != nil {
+			return nil, &TagError{val.Type().Name(), field.Name, tag, err.Error()}
+		}
+
+		fields = append(fields, MetaField{field.Name, tags, field.Type})
+	}
+
+	return fields, nil
+}
+
+// Returns the check constraints of given model sorted by name, if it implements the Checker interface.
+func getModelChecks(model interface{}) ([]MetaCheck, error) {
+	checker, ok := getModelPointer(model).(Checker)
+
+	if !ok {
+		return nil, nil
+	}
+
+	checks := make([]MetaCheck, 0)
+
+	for name, expr := range checker.GondolierChecks() {
+		name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+
+		if name == "" || expr == "" {
+			modelName, _ := getModelName(model)
+			return nil, &ModelError{Model: modelName, Msg: "Check constraints must have a name and expression"}
+		}
+
+		checks = append(checks, MetaCheck{name, expr})
+	}
+
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].Name < checks[j].Name
+	})
+
+	return checks, nil
+}
+
+// Returns the previous names of given model, if it implements the Renamer interface.
+func getModelPreviousNames(model interface{}) []string {
+	renamer, ok := getModelPointer(model).(Renamer)
+
+	if !ok {
+		return nil
+	}
+
+	names := make([]string, 0)
+
+	for _, name := range renamer.GondolierPreviousNames() {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
 		}
+	}
+
+	return names
+}
+
+// Returns a pointer to the model if it was passed by value,
+// so that methods declared for the pointer are found too.
+func getModelPointer(model interface{}) interface{} {
+	val := reflect.ValueOf(model)
 
-		fields = append(fields, MetaField{field.Name, parseTag(tag)})
+	if val.Kind() == reflect.Ptr {
+		return model
 	}
 
-	return fields
+	ptr := reflect.New(val.Type())
+	ptr.Elem().Set(val)
+	return ptr.Interface()
 }
 
-func parseTag(tag string) []MetaTag {
+func parseTag(tag string) ([]MetaTag, error) {
 	tags := make([]MetaTag, 0)
 	elements := strings.Split(tag, ";")
 
@@ -100,18 +226,44 @@ func parseTag(tag string) []MetaTag {
 			continue
 		}
 
-		nv := strings.Split(e, ":")
+		// split at the first separator only, so that values can contain separators (like casts in expressions)
+		nv := strings.SplitN(e, ":", 2)
 
 		if len(nv) == 1 {
 			tags = append(tags, MetaTag{"", strings.TrimSpace(nv[0])})
-		} else if len(nv) == 2 {
-			tags = append(tags, MetaTag{strings.TrimSpace(nv[0]), strings.TrimSpace(nv[1])})
+		} else if strings.TrimSpace(nv[0]) == "" {
+			return nil, errors.New("Meta field tag name must not be empty")
 		} else {
-			panic("Too many or too few meta field tag separators")
+			tags = append(tags, MetaTag{strings.TrimSpace(nv[0]), strings.TrimSpace(nv[1])})
+		}
+	}
+
+	return tags, nil
+}
+
+// Returns true if the type can be stored in a column.
+// Pointers are allowed to mark columns nullable, structs must be known or implement driver.Valuer.
+func isValidType(t reflect.Type) bool {
+	kind := t.Kind()
+
+	if kind == reflect.Ptr {
+		t = t.Elem()
+		kind = t.Kind()
+
+		if kind == reflect.Ptr {
+			return false
 		}
 	}
 
-	return tags
+	if kind == reflect.Interface || kind == reflect.Func || kind == reflect.Chan || kind == reflect.UnsafePointer {
+		return false
+	}
+
+	if kind == reflect.Struct {
+		return isKnownType(t.String()) || t.Implements(valuerType) || reflect.PtrTo(t).Implements(valuerType)
+	}
+
+	return true
 }
 
 func isKnownType(typename string) bool {
@@ -123,3 +275,59 @@ func isKnownType(typename string) bool {
 
 	return false
 }
+
+// Returns a hash of the given models, which changes whenever a model, field or tag is added, removed or changed.
+func hashMetaModels(metaModels []MetaModel) string {
+	hash := sha256.New()
+
+	for _, model := range metaModels {
+		hash.Write([]byte("model:" + model.ModelName + "\n"))
+
+		for _, field := range model.Fields {
+			hash.Write([]byte("field:" + field.Name + "\n"))
+
+			if field.Type != nil {
+				hash.Write([]byte("type:" + field.Type.String() + "\n"))
+			}
+
+			for _, tag := range field.Tags {
+				hash.Write([]byte("tag:" + tag.Name + ":" + tag.Value + "\n"))
+			}
+		}
+
+		for _, check := range model.Checks {
+			hash.Write([]byte("check:" + check.Name + ":" + check.Expr + "\n"))
+		}
+
+		for _, name := range model.PreviousNames {
+			hash.Write([]byte("previous:" + name + "\n"))
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func containsString(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a copy of the list with all entries equal to old replaced by new.
+func replaceString(list []string, old, new string) []string {
+	replaced := make([]string, len(list))
+
+	for i, entry := range list {
+		if entry == old {
+			entry = new
+		}
+
+		replaced[i] = entry
+	}
+
+	return replaced
+}
@@ -20,8 +20,37 @@ type testModelWhitespace struct {
 	Name string `gondolier:"	  type  :   character varying(100) ;; 	 "   `
 }
 
+type testModelChecks struct {
+	Start int `gondolier:"type:integer;check:start >= 0"`
+	End   int `gondolier:"type:integer"`
+}
+
+func (m *testModelChecks) GondolierChecks() map[string]string {
+	return map[string]string{"period": "start < \"end\"", "end": "\"end\" < 100"}
+}
+
+type testModelChecksInvalid struct {
+	Id uint64 `gondolier:"type:bigint"`
+}
+
+func (m testModelChecksInvalid) GondolierChecks() map[string]string {
+	return map[string]string{"empty": " "}
+}
+
+type testModelRenamed struct {
+	Id uint64 `gondolier:"type:bigint"`
+}
+
+func (m testModelRenamed) GondolierPreviousNames() []string {
+	return []string{"testModelOld", " "}
+}
+
 func TestBuildMetaModel(t *testing.T) {
-	meta := buildMetaModel(&testModel{})
+	meta, err := buildMetaModel(&testModel{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if meta.ModelName != "testModel" {
 		t.Fatal("Name must be testModel")
@@ -29,33 +58,41 @@ func TestBuildMetaModel(t *testing.T) {
 }
 
 func TestGetModelName(t *testing.T) {
-	name := getModelName(&testModel{})
+	name, err := getModelName(&testModel{})
 
-	if name != "testModel" {
+	if err != nil || name != "testModel" {
 		t.Fatalf("Model name must be testModel, but was %v", name)
 	}
 
-	name = getModelName(testModel{})
+	name, err = getModelName(testModel{})
 
-	if name != "testModel" {
+	if err != nil || name != "testModel" {
 		t.Fatalf("Model name must be testModel, but was %v", name)
 	}
 }
 
 func TestGetModelNameStructOnly(t *testing.T) {
-	defer func() {
-		if r := recover(); r == nil {
-			t.Fatal("Calling getModelName with invalid type must panic")
-		}
-	}()
-
 	val := 42
-	getModelName(val)
-	getModelName(&val)
+
+	if _, err := getModelName(val); err == nil {
+		t.Fatal("Calling getModelName with invalid type must return an error")
+	}
+
+	if _, err := getModelName(&val); err == nil {
+		t.Fatal("Calling getModelName with invalid type must return an error")
+	}
+
+	if _, err := getModelName(nil); err == nil {
+		t.Fatal("Calling getModelName with nil must return an error")
+	}
 }
 
 func TestGetModelFields(t *testing.T) {
-	fields := getModelFields(&testModel{})
+	fields, err := getModelFields(&testModel{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(fields) != 6 {
 		t.Fatalf("All fields must be returned: %v", len(fields))
@@ -70,7 +107,11 @@ func TestGetModelFields(t *testing.T) {
 		t.Fatal("Field names must be correct")
 	}
 
-	fields = getModelFields(testModel{})
+	fields, err = getModelFields(testModel{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(fields) != 6 {
 		t.Fatalf("All fields must be returned: %v", len(fields))
@@ -78,7 +119,11 @@ func TestGetModelFields(t *testing.T) {
 }
 
 func TestParseTag(t *testing.T) {
-	tags := parseTag("type:varchar(20);primarykey;notnull")
+	tags, err := parseTag("type:varchar(20);primarykey;notnull")
+
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(tags) != 3 {
 		t.Fatal("All elements must be returned")
@@ -92,7 +137,11 @@ func TestParseTag(t *testing.T) {
 }
 
 func TestModelWhitespace(t *testing.T) {
-	meta := buildMetaModel(testModelWhitespace{})
+	meta, err := buildMetaModel(testModelWhitespace{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if meta.ModelName != "testModelWhitespace" {
 		t.Fatal("Name must be testModelWhitespace")
@@ -128,3 +177,146 @@ func TestModelWhitespace(t *testing.T) {
 		t.Fatalf("First field must have type character varying(100): %v %v", fields[1].Tags[0].Name, fields[1].Tags[0].Value)
 	}
 }
+
+type testModelInvalidType struct {
+	Invalid struct{} `gondolier:"type:text"`
+}
+
+type testModelInvalidInterface struct {
+	Invalid interface{} `gondolier:"type:text"`
+}
+
+type testModelPointer struct {
+	Name    *string    `gondolier:"unique"`
+	Created *time.Time `gondolier:"notnull"`
+}
+
+type testModelInvalidTag struct {
+	Id uint64 `gondolier:"type:bigint;:pk"`
+}
+
+func TestParseTagInvalid(t *testing.T) {
+	if _, err := parseTag("type:varchar(20);:invalid"); err == nil {
+		t.Fatal("Tag without name must return an error")
+	}
+}
+
+func TestParseTagSeparatorInValue(t *testing.T) {
+	tags, err := parseTag("type:text;index:name,where:status::text = 'active'")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tags) != 2 || tags[1].Name != "index" || tags[1].Value != "name,where:status::text = 'active'" {
+		t.Fatalf("Value must contain separators after the first one, but was: %v", tags)
+	}
+}
+
+func TestBuildMetaModelInvalidType(t *testing.T) {
+	_, err := buildMetaModel(testModelInvalidType{})
+	modelErr, ok := err.(*ModelError)
+
+	if !ok {
+		t.Fatalf("Error must be of type ModelError, but was: %v", err)
+	}
+
+	if modelErr.Model != "testModelInvalidType" || modelErr.Field != "Invalid" {
+		t.Fatalf("Error must contain model and field, but was: %v %v", modelErr.Model, modelErr.Field)
+	}
+}
+
+func TestBuildMetaModelInvalidTag(t *testing.T) {
+	_, err := buildMetaModel(testModelInvalidTag{})
+	tagErr, ok := err.(*TagError)
+
+	if !ok {
+		t.Fatalf("Error must be of type TagError, but was: %v", err)
+	}
+
+	if tagErr.Model != "testModelInvalidTag" || tagErr.Field != "Id" || tagErr.Tag != "type:bigint;:pk" {
+		t.Fatalf("Error must contain model, field and tag, but was: %v %v %v", tagErr.Model, tagErr.Field, tagErr.Tag)
+	}
+}
+
+func TestHashMetaModels(t *testing.T) {
+	a, _ := buildMetaModel(testModel{})
+	b, _ := buildMetaModel(testModelWhitespace{})
+	hash := hashMetaModels([]MetaModel{a, b})
+
+	if len(hash) != 64 || hash != hashMetaModels([]MetaModel{a, b}) {
+		t.Fatalf("Hash must be stable, but was: %v", hash)
+	}
+
+	if hash == hashMetaModels([]MetaModel{b, a}) {
+		t.Fatal("Hash must change if the order of models changes")
+	}
+
+	b.Fields[0].Tags[0].Value = "integer"
+
+	if hash == hashMetaModels([]MetaModel{a, b}) {
+		t.Fatal("Hash must change if a tag changes")
+	}
+}
+
+func TestBuildMetaModelChecks(t *testing.T) {
+	for _, model := range []interface{}{testModelChecks{}, &testModelChecks{}} {
+		meta, err := buildMetaModel(model)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(meta.Checks) != 2 ||
+			meta.Checks[0].Name != "end" || meta.Checks[0].Expr != `"end" < 100` ||
+			meta.Checks[1].Name != "period" || meta.Checks[1].Expr != `start < "end"` {
+			t.Fatalf("Checks not as expected: %v", meta.Checks)
+		}
+	}
+
+	meta, err := buildMetaModel(testModel{})
+
+	if err != nil || len(meta.Checks) != 0 {
+		t.Fatalf("Model must not have checks, but was: %v %v", meta.Checks, err)
+	}
+
+	if _, err := buildMetaModel(testModelChecksInvalid{}); err == nil {
+		t.Fatal("Check without expression must return an error")
+	}
+}
+
+func TestBuildMetaModelPreviousNames(t *testing.T) {
+	for _, model := range []interface{}{testModelRenamed{}, &testModelRenamed{}} {
+		meta, err := buildMetaModel(model)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(meta.PreviousNames) != 1 || meta.PreviousNames[0] != "testModelOld" {
+			t.Fatalf("Previous names not as expected: %v", meta.PreviousNames)
+		}
+	}
+
+	meta, err := buildMetaModel(testModel{})
+
+	if err != nil || len(meta.PreviousNames) != 0 {
+		t.Fatalf("Model must not have previous names, but was: %v %v", meta.PreviousNames, err)
+	}
+}
+
+func TestBuildMetaModelPointer(t *testing.T) {
+	meta, err := buildMetaModel(testModelPointer{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(meta.Fields) != 2 || meta.Fields[0].Type.String() != "*string" || meta.Fields[1].Type.String() != "*time.Time" {
+		t.Fatalf("Fields must contain their type, but was: %v", meta.Fields)
+	}
+
+	if _, err := buildMetaModel(testModelInvalidInterface{}); err == nil {
+		t.Fatal("Interface fields must return an error")
+	}
+}
@@ -0,0 +1,505 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	mysqlTypes = map[reflect.Type]string{reflect.TypeOf(false): "tinyint(1)",
+		reflect.TypeOf(int(0)):            "bigint",
+		reflect.TypeOf(int8(0)):           "tinyint",
+		reflect.TypeOf(int16(0)):          "smallint",
+		reflect.TypeOf(int32(0)):          "int",
+		reflect.TypeOf(int64(0)):          "bigint",
+		reflect.TypeOf(uint(0)):           "bigint unsigned",
+		reflect.TypeOf(uint8(0)):          "tinyint unsigned",
+		reflect.TypeOf(uint16(0)):         "smallint unsigned",
+		reflect.TypeOf(uint32(0)):         "int unsigned",
+		reflect.TypeOf(uint64(0)):         "bigint unsigned",
+		reflect.TypeOf(float32(0)):        "float",
+		reflect.TypeOf(float64(0)):        "double",
+		reflect.TypeOf(""):                "varchar(255)",
+		reflect.TypeOf([]byte{}):          "blob",
+		reflect.TypeOf(time.Time{}):       "datetime(6)",
+		reflect.TypeOf(sql.NullBool{}):    "tinyint(1)",
+		reflect.TypeOf(sql.NullByte{}):    "tinyint unsigned",
+		reflect.TypeOf(sql.NullFloat64{}): "double",
+		reflect.TypeOf(sql.NullInt16{}):   "smallint",
+		reflect.TypeOf(sql.NullInt32{}):   "int",
+		reflect.TypeOf(sql.NullInt64{}):   "bigint",
+		reflect.TypeOf(sql.NullString{}):  "varchar(255)",
+		reflect.TypeOf(sql.NullTime{}):    "datetime"}
+	mysqlTypeAliases = map[string]string{"integer": "int",
+		"bool":              "tinyint(1)",
+		"boolean":           "tinyint(1)",
+		"dec":               "decimal",
+		"numeric":           "decimal",
+		"fixed":             "decimal",
+		"real":              "double",
+		"double precision":  "double",
+		"character":         "char",
+		"character varying": "varchar"}
+	mysqlIntTypes     = []string{"tinyint", "smallint", "mediumint", "int", "bigint"}
+	mysqlFkActions    = []string{"no action", "restrict", "cascade", "set null", "set default"}
+	mysqlIndexMethods = []string{"btree", "hash"}
+	mysqlIndexSupport = &indexSupport{"MySQL", mysqlIndexMethods, false}
+	mysqlTypeParts    = regexp.MustCompile(`^([a-z ]+?)\s*(\([\d\s,]+\))?((\s+(unsigned|signed|zerofill))*)$`)
+	mysqlExprSpace    = regexp.MustCompile("[\\s()`\"]+")
+)
+
+// MySQL migrator for MySQL (8.0 or newer) and MariaDB databases.
+// It accepts the same tags as the Postgres migrator, as far as MySQL supports them:
+//
+//  // The type must be the database type.
+//  // Optional. If omitted, the type is inferred from the Go type of the field (see RegisterType)
+//  // and the column is not null, unless the field is a pointer or sql.Null* type.
+//  type:database type
+//  // Sets the column as primary key.
+//  // Set it for multiple fields to create a composite primary key.
+//  pk/primary key
+//  // Sets the default value for column, strings must be escaped.
+//  default:default value
+//  // Sets not null constraint for column.
+//  not null/notnull
+//  // Optional. Drops not null constraint if set for column. Not null is also dropped if not null is not set.
+//  null
+//  // Sets unique constraint for column.
+//  unique
+//  // Shortcut for primary key, not null and AUTO_INCREMENT.
+//  id
+//  // Sets foreign key constraint for column.
+//  // It refers to the given model and column.
+//  // Referential actions can be added as options separated by comma.
+//  // Actions are: cascade, set null, set default, restrict and no action.
+//  // Example: fk:MyModel.Id,ondelete:cascade,onupdate:restrict
+//  fk/foreign key:Model.Column,ondelete:action,onupdate:action
+//  // Creates an index for the column. Fields with the same index name share a multi-column index.
+//  // Options are separated by comma: unique and the method (btree, hash).
+//  // Example: index:name,unique
+//  index/index:name,options
+//  // Renames the column of a previous field name, if the column does not exist yet.
+//  // Example: was:OldName
+//  was/renamed_from:previous field name
+//
+// Sequences (seq), check constraints, partial indexes and deferrable foreign keys are not supported
+// and return an error. Use id instead of seq for AUTO_INCREMENT columns.
+// Identifiers are quoted using backticks.
+//
+// Models which were renamed can declare their previous names by implementing the Renamer interface.
+// The table is renamed if it still uses a previous name, together with the constraints and indexes named after it.
+//
+// Schema is the database to migrate, the database of the connection is used if it is empty.
+// MySQL commits changes of the schema implicitly, so a migration cannot be rolled back if a statement fails.
+//
+// Tables are compared to the data model by the SchemaDiff. The state of a migration is kept for each call,
+// so that one MySQL migrator can be used by multiple Gondolier instances and goroutines,
+// as long as RegisterType is not called at the same time.
+type MySQL struct {
+	Schema      string
+	DropColumns bool
+	Log         bool
+
+	types map[reflect.Type]string
+}
+
+// mysqlRun is the state of a single call of the MySQL migrator, like a migration or plan.
+// It implements the Dialect interface, the tables are compared to the catalog read by the call.
+type mysqlRun struct {
+	*MySQL
+
+	ctx      context.Context
+	db       *sql.DB
+	naming   NameSchema
+	model    string
+	field    string
+	diff     *SchemaDiff
+	columns  map[string]ColumnSpec
+	modified map[string]bool
+	createFK []Operation
+	plan     *Plan
+	catalog  *mysqlCatalog
+}
+
+// mysqlColumnSpec is a column declared by the tags of a field.
+type mysqlColumnSpec struct {
+	columnType    string
+	notnull       bool
+	autoIncrement bool
+	primaryKey    bool
+	unique        bool
+	defaultValue  string
+	fk            string
+}
+
+// mysqlForeignKey is a foreign key declared by a fk tag.
+type mysqlForeignKey struct {
+	refTable  string
+	refColumn string
+	onDelete  string
+	onUpdate  string
+}
+
+// Migrate migrates the given data model.
+// The statements are executed one after another, as MySQL does not support transactions for schema changes.
+func (m *MySQL) Migrate(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) error {
+	return m.newRun(ctx, conn, schema).migrateModels(metaModels)
+}
+
+// Plan returns the statements Migrate would execute for the given data model, without executing them.
+// The database is read to find the differences between the data model and the schema.
+func (m *MySQL) Plan(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) (*Plan, error) {
+	run := m.newRun(ctx, conn, schema)
+	plan := &Plan{make([]Statement, 0)}
+	run.plan = plan
+
+	if err := run.migrateModels(metaModels); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// RegisterType sets the database type for fields of the same Go type as given value, which have no type tag.
+// It overrides the default mapping or adds custom types.
+//
+// Example:
+//  mysql.RegisterType("", "text")
+func (m *MySQL) RegisterType(value interface{}, dbType string) {
+	m.types = registerType(m.types, value, dbType)
+}
+
+// DropTable drops the given table.
+func (m *MySQL) DropTable(ctx context.Context, conn *sql.DB, schema NameSchema, name string) error {
+	return m.newRun(ctx, conn, schema).dropTable(name)
+}
+
+// DropTables drops the given tables after the foreign keys between them.
+func (m *MySQL) DropTables(ctx context.Context, conn *sql.DB, schema NameSchema, names []string) error {
+	run := m.newRun(ctx, conn, schema)
+	catalog, err := run.loadCatalog()
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		run.model, run.field = name, ""
+		tableName := run.naming.Get(name)
+
+		for _, fk := range catalog.tableConstraints(tableName, "FOREIGN KEY") {
+			if err := run.exec("ALTER TABLE " + run.quote(tableName) + " DROP FOREIGN KEY " + run.quote(fk.name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range names {
+		if err := run.dropTable(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the state of a new call of the migrator, so that calls do not share their connection and catalog.
+func (m *MySQL) newRun(ctx context.Context, conn *sql.DB, schema NameSchema) *mysqlRun {
+	return &mysqlRun{MySQL: m, ctx: ctx, db: conn, naming: schema}
+}
+
+func (m *mysqlRun) dropTable(name string) error {
+	m.model, m.field = name, ""
+	return m.exec("DROP TABLE IF EXISTS " + m.quote(m.naming.Get(name)))
+}
+
+func (m *mysqlRun) migrateModels(metaModels []MetaModel) error {
+	// read the schema once, the migration is compared to this snapshot
+	if m.catalog == nil {
+		catalog, err := m.loadCatalog()
+
+		if err != nil {
+			return err
+		}
+
+		m.catalog = catalog
+	}
+
+	m.diff = &SchemaDiff{Dialect: m, Naming: m.naming, DropColumns: m.DropColumns}
+
+	for _, model := range metaModels {
+		if err := m.migrate(&model); err != nil {
+			return err
+		}
+	}
+
+	// create foreign keys after all tables, so that models referencing each other in a cycle can be created
+	if err := m.execOperations(m.diff.ForeignKeys()); err != nil {
+		return err
+	}
+
+	// add the foreign keys again which were dropped to modify or rename them
+	createFK := m.createFK
+	m.createFK = nil
+	return m.execOperations(createFK)
+}
+
+func (m *mysqlRun) migrate(model *MetaModel) error {
+	m.model, m.field = model.ModelName, ""
+
+	if len(model.Checks) > 0 {
+		return &ModelError{model.ModelName, "", "Check constraints are not supported by MySQL"}
+	}
+
+	// create, rename or update the table, foreign keys are created after all tables
+	ops, err := m.diff.Model(model)
+
+	if err != nil {
+		return err
+	}
+
+	return m.execOperations(ops)
+}
+
+// Executes the statements of given operations found by the schema diff.
+func (m *mysqlRun) execOperations(ops []Operation) error {
+	for _, op := range ops {
+		source := op.Origin()
+		m.model, m.field = source.Model, source.Field
+		queries, err := m.SQL(op)
+
+		if err != nil {
+			return err
+		}
+
+		for _, query := range queries {
+			if err := m.exec(query); err != nil {
+				return err
+			}
+		}
+
+		m.apply(op)
+	}
+
+	return nil
+}
+
+// Returns the column declared by the tags of given field.
+// Returns an error for tags which are unknown or not supported by MySQL.
+func (m *mysqlRun) getColumnSpec(field *MetaField) (*mysqlColumnSpec, error) {
+	columnType, notnull, err := m.getFieldType(field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &mysqlColumnSpec{columnType: columnType, notnull: notnull}
+
+	for _, tag := range field.Tags {
+		key := strings.ToLower(tag.Name)
+		value := strings.ToLower(tag.Value)
+
+		if key == "type" || key == "index" || value == "index" || key == "was" || key == "renamed_from" {
+			// the type was read already, indexes are created for the table and columns renamed before
+			continue
+		} else if value == "notnull" || value == "not null" {
+			spec.notnull = true
+		} else if value == "null" {
+			spec.notnull = false
+		} else if key == "default" && value == "nextval(seq)" {
+			return nil, &TagError{m.model, m.field, tag.Name + ":" + tag.Value, "Sequences are not supported by MySQL, use id for AUTO_INCREMENT columns"}
+		} else if key == "default" {
+			// value must be case sensitive here
+			spec.defaultValue = tag.Value
+		} else if value == "id" {
+			spec.notnull = true
+			spec.autoIncrement = true
+		} else if value == "pk" || value == "primary key" {
+			// primary keys cannot be null
+			spec.notnull = true
+			spec.primaryKey = true
+		} else if value == "unique" {
+			spec.unique = true
+		} else if key == "seq" || key == "sequence" {
+			return nil, &TagError{m.model, m.field, tag.Name + ":" + tag.Value, "Sequences are not supported by MySQL, use id for AUTO_INCREMENT columns"}
+		} else if key == "check" {
+			return nil, &TagError{m.model, m.field, tag.Name + ":" + tag.Value, "Check constraints are not supported by MySQL"}
+		} else if key == "fk" || key == "foreign key" {
+			// value must be case sensitive here
+			spec.fk = tag.Value
+		} else {
+			return nil, unknownTag(m.model, m.field, key, value)
+		}
+	}
+
+	return spec, nil
+}
+
+// Returns the database type of given field and whether the column must be not null.
+func (m *mysqlRun) getFieldType(field *MetaField) (string, bool, error) {
+	return getFieldType(m.model, field, m.types, mysqlTypes, false)
+}
+
+// Parses the fk tag value. Returns nil if the value is empty.
+func (m *mysqlRun) getForeignKeyInfo(tableName, info string) (*mysqlForeignKey, error) {
+	if info == "" {
+		return nil, nil
+	}
+
+	options := strings.Split(info, ",")
+	infos := strings.Split(strings.TrimSpace(options[0]), ".")
+
+	if len(infos) != 2 {
+		return nil, &TagError{m.model,
+			m.field,
+			"fk:" + info,
+			"Two arguments must be specified for fk in model '" + m.model + "': ReferencedModel.ReferencedAttribute"}
+	}
+
+	fk := &mysqlForeignKey{refTable: m.naming.Get(infos[0]),
+		refColumn: m.naming.Get(infos[1]),
+		onDelete:  "no action",
+		onUpdate:  "no action"}
+
+	for _, option := range options[1:] {
+		option = strings.Join(strings.Fields(strings.ToLower(option)), " ")
+		var action *string
+
+		if strings.HasPrefix(option, "ondelete:") {
+			action, option = &fk.onDelete, option[len("ondelete:"):]
+		} else if strings.HasPrefix(option, "onupdate:") {
+			action, option = &fk.onUpdate, option[len("onupdate:"):]
+		} else if option == "deferrable" || option == "deferred" || option == "notvalid" || option == "not valid" {
+			return nil, &TagError{m.model, m.field, "fk:" + info, "Option '" + option + "' for fk is not supported by MySQL"}
+		} else {
+			return nil, &TagError{m.model, m.field, "fk:" + info, "Unknown option '" + option + "' for fk in model '" + m.model + "'"}
+		}
+
+		if *action = strings.TrimSpace(option); !containsString(mysqlFkActions, *action) {
+			return nil, &TagError{m.model,
+				m.field,
+				"fk:" + info,
+				"Unknown action '" + *action + "' for fk in model '" + m.model + "': cascade, set null, set default, restrict or no action"}
+		}
+	}
+
+	return fk, nil
+}
+
+func (m *mysqlRun) getUniqueName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_key"
+}
+
+func (m *mysqlRun) quote(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (m *mysqlRun) quoteColumns(columns []string) string {
+	quoted := make([]string, 0, len(columns))
+
+	for _, column := range columns {
+		quoted = append(quoted, m.quote(column))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// Executes the query with the schema as argument and calls scan for each row.
+func (m *mysqlRun) queryRows(query string, scan func(*sql.Rows) error) error {
+	rows, err := m.db.QueryContext(m.ctx, query, m.Schema)
+
+	if err != nil {
+		return &SQLError{m.model, m.field, query, err}
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (m *mysqlRun) exec(query string) error {
+	if m.plan != nil {
+		m.plan.add(m.model, m.field, query)
+		return nil
+	}
+
+	if m.Log {
+		log.Println(query)
+	}
+
+	if _, err := m.db.ExecContext(m.ctx, query); err != nil {
+		return &SQLError{m.model, m.field, query, err}
+	}
+
+	return nil
+}
+
+// Normalizes a column type to compare it with the type returned by MySQL,
+// which resolves aliases and omits the display width of integers since MySQL 8.0.19.
+func mysqlNormalizeType(t string) string {
+	t = strings.Join(strings.Fields(strings.ToLower(t)), " ")
+	parts := mysqlTypeParts.FindStringSubmatch(t)
+
+	if parts == nil {
+		return t
+	}
+
+	name, modifier := parts[1], strings.Replace(parts[2], " ", "", -1)
+	unsigned := ""
+
+	if strings.Contains(parts[3], "unsigned") {
+		unsigned = " unsigned"
+	}
+
+	if alias, ok := mysqlTypeAliases[name]; ok {
+		name = alias
+	}
+
+	// boolean is an alias for tinyint(1), which keeps its display width
+	if strings.HasSuffix(name, ")") {
+		return name + unsigned
+	}
+
+	if containsString(mysqlIntTypes, name) && !(name == "tinyint" && modifier == "(1)") {
+		modifier = ""
+	} else if name == "decimal" && modifier == "" {
+		modifier = "(10,0)"
+	} else if name == "decimal" && !strings.Contains(modifier, ",") {
+		modifier = strings.TrimSuffix(modifier, ")") + ",0)"
+	} else if (name == "char" || name == "binary") && modifier == "" {
+		modifier = "(1)"
+	}
+
+	return name + modifier + unsigned
+}
+
+// Returns the value of a quoted string or number and true, or the value and false if it is an expression.
+func mysqlLiteral(value string) (string, bool) {
+	if len(value) > 1 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), true
+	}
+
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value, true
+	}
+
+	return value, false
+}
+
+// Normalizes an SQL expression to compare it with the expression returned by MySQL,
+// which adds parentheses and backticks and changes the case of functions.
+func mysqlNormalizeExpr(expr string) string {
+	return mysqlExprSpace.ReplaceAllString(strings.ToLower(expr), "")
+}
@@ -0,0 +1,358 @@
+package gondolier
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// The schema is read from information_schema, using the database of the connection if no schema is set.
+const (
+	mysqlTablesQuery = `SELECT TABLE_NAME
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE())
+		AND TABLE_TYPE = 'BASE TABLE'
+		ORDER BY TABLE_NAME`
+	mysqlColumnsQuery = `SELECT TABLE_NAME, COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE = 'NO', COLUMN_DEFAULT, EXTRA
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE())
+		ORDER BY TABLE_NAME, ORDINAL_POSITION`
+	mysqlConstraintsQuery = `SELECT c.TABLE_NAME, c.CONSTRAINT_NAME, c.CONSTRAINT_TYPE, k.COLUMN_NAME,
+			COALESCE(k.REFERENCED_TABLE_NAME, ''), COALESCE(k.REFERENCED_COLUMN_NAME, ''),
+			COALESCE(r.DELETE_RULE, ''), COALESCE(r.UPDATE_RULE, '')
+		FROM information_schema.TABLE_CONSTRAINTS c
+		JOIN information_schema.KEY_COLUMN_USAGE k ON k.CONSTRAINT_SCHEMA = c.CONSTRAINT_SCHEMA
+			AND k.TABLE_NAME = c.TABLE_NAME
+			AND k.CONSTRAINT_NAME = c.CONSTRAINT_NAME
+		LEFT JOIN information_schema.REFERENTIAL_CONSTRAINTS r ON r.CONSTRAINT_SCHEMA = c.CONSTRAINT_SCHEMA
+			AND r.TABLE_NAME = c.TABLE_NAME
+			AND r.CONSTRAINT_NAME = c.CONSTRAINT_NAME
+		WHERE c.TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE())
+		AND c.CONSTRAINT_TYPE IN ('PRIMARY KEY', 'UNIQUE', 'FOREIGN KEY')
+		ORDER BY c.TABLE_NAME, c.CONSTRAINT_NAME, k.ORDINAL_POSITION`
+	mysqlIndexesQuery = `SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE = 0, INDEX_TYPE, COLUMN_NAME
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE())
+		ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`
+)
+
+// mysqlCatalog is a snapshot of the tables, columns, constraints and indexes of a database.
+// MariaDB is set if the database is MariaDB, which returns defaults in a different notation than MySQL.
+type mysqlCatalog struct {
+	mariaDB     bool
+	tables      []string
+	columns     []mysqlColumn
+	constraints []mysqlConstraint
+	indexes     []mysqlIndex
+}
+
+// mysqlColumn is a column read from the catalog.
+// The default value is only set if hasDefault is true, as the default might be an empty string.
+type mysqlColumn struct {
+	table         string
+	name          string
+	columnType    string
+	notnull       bool
+	hasDefault    bool
+	defaultValue  string
+	generated     bool
+	autoIncrement bool
+}
+
+// mysqlConstraint is a constraint read from the catalog.
+// The constraint type is PRIMARY KEY, UNIQUE or FOREIGN KEY.
+// The referenced table and column and the referential actions are set for foreign keys only.
+type mysqlConstraint struct {
+	table          string
+	name           string
+	constraintType string
+	columns        []string
+	refTable       string
+	refColumn      string
+	onDelete       string
+	onUpdate       string
+}
+
+// mysqlIndex is an index read from the catalog.
+type mysqlIndex struct {
+	table   string
+	name    string
+	unique  bool
+	method  string
+	columns []string
+}
+
+func (m *mysqlRun) loadCatalog() (*mysqlCatalog, error) {
+	catalog := new(mysqlCatalog)
+	query := `SELECT VERSION()`
+	var version string
+
+	if err := m.db.QueryRowContext(m.ctx, query).Scan(&version); err != nil {
+		return nil, &SQLError{m.model, m.field, query, err}
+	}
+
+	catalog.mariaDB = strings.Contains(strings.ToLower(version), "mariadb")
+	err := m.queryRows(mysqlTablesQuery, func(rows *sql.Rows) error {
+		var table string
+
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+
+		catalog.tables = append(catalog.tables, table)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mysqlColumnsQuery, func(rows *sql.Rows) error {
+		var column mysqlColumn
+		var defaultValue sql.NullString
+		var extra string
+
+		if err := rows.Scan(&column.table, &column.name, &column.columnType, &column.notnull, &defaultValue, &extra); err != nil {
+			return err
+		}
+
+		extra = strings.ToLower(extra)
+		column.hasDefault, column.defaultValue = defaultValue.Valid, defaultValue.String
+		column.generated = strings.Contains(extra, "default_generated")
+		column.autoIncrement = strings.Contains(extra, "auto_increment")
+		catalog.columns = append(catalog.columns, column)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mysqlConstraintsQuery, func(rows *sql.Rows) error {
+		var constraint mysqlConstraint
+		var column string
+
+		if err := rows.Scan(&constraint.table,
+			&constraint.name,
+			&constraint.constraintType,
+			&column,
+			&constraint.refTable,
+			&constraint.refColumn,
+			&constraint.onDelete,
+			&constraint.onUpdate); err != nil {
+			return err
+		}
+
+		// one row is returned for each column of the constraint
+		if existing := catalog.constraint(constraint.table, constraint.name); existing != nil {
+			existing.columns = append(existing.columns, column)
+			return nil
+		}
+
+		constraint.columns = []string{column}
+		constraint.onDelete = strings.ToLower(constraint.onDelete)
+		constraint.onUpdate = strings.ToLower(constraint.onUpdate)
+		catalog.constraints = append(catalog.constraints, constraint)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mysqlIndexesQuery, func(rows *sql.Rows) error {
+		var index mysqlIndex
+		var column string
+
+		if err := rows.Scan(&index.table, &index.name, &index.unique, &index.method, &column); err != nil {
+			return err
+		}
+
+		// one row is returned for each column of the index
+		if existing := catalog.index(index.table, index.name); existing != nil {
+			existing.columns = append(existing.columns, column)
+			return nil
+		}
+
+		index.method = strings.ToLower(index.method)
+		index.columns = []string{column}
+		catalog.indexes = append(catalog.indexes, index)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+func (c *mysqlCatalog) table(name string) bool {
+	for _, table := range c.tables {
+		if table == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the column or nil if it does not exist.
+func (c *mysqlCatalog) column(tableName, name string) *mysqlColumn {
+	for i := range c.columns {
+		if c.columns[i].table == tableName && c.columns[i].name == name {
+			return &c.columns[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns all columns of given table in order.
+func (c *mysqlCatalog) tableColumns(tableName string) []mysqlColumn {
+	columns := make([]mysqlColumn, 0)
+
+	for _, column := range c.columns {
+		if column.table == tableName {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// Returns the constraint of given table or nil if it does not exist.
+func (c *mysqlCatalog) constraint(tableName, name string) *mysqlConstraint {
+	for i := range c.constraints {
+		if c.constraints[i].table == tableName && c.constraints[i].name == name {
+			return &c.constraints[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the constraints of given type for given table, ordered by name.
+func (c *mysqlCatalog) tableConstraints(tableName, constraintType string) []mysqlConstraint {
+	constraints := make([]mysqlConstraint, 0)
+
+	for _, constraint := range c.constraints {
+		if constraint.table == tableName && constraint.constraintType == constraintType {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	return constraints
+}
+
+// Returns the columns of the primary key of given table, which are empty if it has none.
+func (c *mysqlCatalog) primaryKey(tableName string) []string {
+	if pk := c.tableConstraints(tableName, "PRIMARY KEY"); len(pk) > 0 {
+		return pk[0].columns
+	}
+
+	return []string{}
+}
+
+// Returns the index of given table or nil if it does not exist.
+func (c *mysqlCatalog) index(tableName, name string) *mysqlIndex {
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName && c.indexes[i].name == name {
+			return &c.indexes[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the indexes of given table, ordered by name.
+func (c *mysqlCatalog) tableIndexes(tableName string) []mysqlIndex {
+	indexes := make([]mysqlIndex, 0)
+
+	for _, index := range c.indexes {
+		if index.table == tableName {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return indexes
+}
+
+// Updates the catalog after a table was renamed.
+func (c *mysqlCatalog) renameTable(oldName, newName string) {
+	for i := range c.tables {
+		if c.tables[i] == oldName {
+			c.tables[i] = newName
+		}
+	}
+
+	for i := range c.columns {
+		if c.columns[i].table == oldName {
+			c.columns[i].table = newName
+		}
+	}
+
+	for i := range c.constraints {
+		if c.constraints[i].table == oldName {
+			c.constraints[i].table = newName
+		}
+
+		if c.constraints[i].refTable == oldName {
+			c.constraints[i].refTable = newName
+		}
+	}
+
+	for i := range c.indexes {
+		if c.indexes[i].table == oldName {
+			c.indexes[i].table = newName
+		}
+	}
+}
+
+// Updates the catalog after a column was renamed.
+func (c *mysqlCatalog) renameColumn(tableName, oldName, newName string) {
+	for i := range c.columns {
+		if c.columns[i].table == tableName && c.columns[i].name == oldName {
+			c.columns[i].name = newName
+		}
+	}
+
+	for i := range c.constraints {
+		if c.constraints[i].table == tableName {
+			c.constraints[i].columns = replaceString(c.constraints[i].columns, oldName, newName)
+		}
+
+		if c.constraints[i].refTable == tableName && c.constraints[i].refColumn == oldName {
+			c.constraints[i].refColumn = newName
+		}
+	}
+
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName {
+			c.indexes[i].columns = replaceString(c.indexes[i].columns, oldName, newName)
+		}
+	}
+}
+
+// Removes the constraint from the catalog after it was dropped.
+func (c *mysqlCatalog) dropConstraint(tableName, name string) {
+	constraints := make([]mysqlConstraint, 0, len(c.constraints))
+
+	for _, constraint := range c.constraints {
+		if constraint.table != tableName || constraint.name != name {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	c.constraints = constraints
+}
+
+// Updates the catalog after an index was renamed, including the unique constraint backed by it.
+func (c *mysqlCatalog) renameIndex(tableName, oldName, newName string) {
+	if index := c.index(tableName, oldName); index != nil {
+		index.name = newName
+	}
+
+	if constraint := c.constraint(tableName, oldName); constraint != nil {
+		constraint.name = newName
+	}
+}
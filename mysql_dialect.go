@@ -0,0 +1,482 @@
+package gondolier
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mysqlAutoIncrement is the default of AUTO_INCREMENT columns, which are declared by the id tag.
+const mysqlAutoIncrement = "AUTO_INCREMENT"
+
+// Table returns the current state of given table or nil if it does not exist.
+// It implements the Dialect interface and reads the catalog of the running migration.
+// AUTO_INCREMENT columns have the default AUTO_INCREMENT, like the columns declared by the id tag.
+// The primary key is named PRIMARY and the method of indexes is empty, as InnoDB uses btree for hash indexes.
+func (m *mysqlRun) Table(name string) (*TableState, error) {
+	if !m.catalog.table(name) {
+		return nil, nil
+	}
+
+	table := &TableState{Name: name}
+
+	for _, column := range m.catalog.tableColumns(name) {
+		table.Columns = append(table.Columns, ColumnState{column.name, column.columnType, column.notnull, mysqlColumnDefault(&column, m.catalog.mariaDB)})
+	}
+
+	constraintTypes := map[string]ConstraintType{"PRIMARY KEY": ConstraintPrimaryKey, "UNIQUE": ConstraintUnique, "FOREIGN KEY": ConstraintForeignKey}
+
+	for _, constraint := range m.catalog.constraints {
+		constraintType, ok := constraintTypes[constraint.constraintType]
+
+		if !ok || constraint.table != name {
+			continue
+		}
+
+		state := ConstraintState{Name: constraint.name, Type: constraintType, Columns: constraint.columns}
+
+		if constraintType == ConstraintForeignKey {
+			state.RefTable, state.RefColumns = constraint.refTable, []string{constraint.refColumn}
+			state.OnDelete, state.OnUpdate = constraint.onDelete, constraint.onUpdate
+		}
+
+		table.Constraints = append(table.Constraints, state)
+	}
+
+	// the indexes backing constraints are named like the constraint
+	for _, index := range m.catalog.tableIndexes(name) {
+		if m.catalog.constraint(name, index.name) == nil {
+			table.Indexes = append(table.Indexes, IndexState{Name: index.name, Columns: index.columns, Unique: index.unique})
+		}
+	}
+
+	return table, nil
+}
+
+// Column returns the column declared by the tags of given field for a table.
+// It implements the Dialect interface.
+// The column is kept to modify it, as MySQL sets the type, not null and default in one statement.
+func (m *mysqlRun) Column(tableName string, field *MetaField) (*ColumnSpec, error) {
+	m.field = field.Name
+	spec, err := m.getColumnSpec(field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fk, err := m.getForeignKeyInfo(tableName, spec.fk)
+
+	if err != nil {
+		return nil, err
+	}
+
+	column := &ColumnSpec{Name: m.naming.Get(field.Name),
+		Type:       spec.columnType,
+		NotNull:    spec.notnull,
+		PrimaryKey: spec.primaryKey,
+		Id:         spec.autoIncrement,
+		Unique:     spec.unique,
+		Default:    spec.defaultValue}
+
+	if spec.autoIncrement {
+		column.Default = mysqlAutoIncrement
+	}
+
+	if fk != nil {
+		column.ForeignKey = &ForeignKeySpec{RefTable: fk.refTable,
+			RefColumn: fk.refColumn,
+			OnDelete:  fk.onDelete,
+			OnUpdate:  fk.onUpdate}
+	}
+
+	if m.columns == nil {
+		m.columns = make(map[string]ColumnSpec)
+	}
+
+	m.columns[tableName+"."+column.Name] = *column
+	return column, nil
+}
+
+// Indexes returns the indexes declared by the index tags of given model for a table.
+// It implements the Dialect interface.
+func (m *mysqlRun) Indexes(tableName string, model *MetaModel) ([]IndexSpec, error) {
+	indexes, err := getTagIndexes(model, m.naming, mysqlIndexSupport)
+
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]IndexSpec, 0, len(indexes))
+
+	for _, index := range indexes {
+		specs = append(specs, IndexSpec{index.name, index.field, index.columns, index.unique, index.method, index.where})
+	}
+
+	return specs, nil
+}
+
+// NormalizeType returns given type in the form used by MySQL.
+// It implements the Dialect interface.
+func (m *mysqlRun) NormalizeType(columnType string) string {
+	return mysqlNormalizeType(columnType)
+}
+
+// NormalizeExpr returns given expression in the form used by MySQL.
+// It implements the Dialect interface.
+// Literals are compared as they are, expressions are normalized, as MySQL changes their notation.
+func (m *mysqlRun) NormalizeExpr(expr string) string {
+	expr = strings.TrimSpace(expr)
+
+	if strings.ToLower(expr) == "null" {
+		return ""
+	}
+
+	if literal, ok := mysqlLiteral(expr); ok {
+		return "'" + literal
+	}
+
+	return mysqlNormalizeExpr(expr)
+}
+
+// SQL returns the statements for given operation.
+// It implements the Dialect interface.
+// Foreign keys which must be dropped to modify or rename them are added again after all tables were migrated.
+func (m *mysqlRun) SQL(op Operation) ([]string, error) {
+	switch op := op.(type) {
+	case *CreateTable:
+		columns := make([]string, 0, len(op.Columns)+1)
+		uniques := make([]string, 0)
+
+		for i := range op.Columns {
+			column := &op.Columns[i]
+			columns = append(columns, m.quote(column.Name)+" "+m.getColumnDefinition(column, true))
+
+			if column.Unique {
+				uniques = append(uniques, "CONSTRAINT "+m.quote(m.getUniqueName(op.Table, column.Name))+" UNIQUE ("+m.quote(column.Name)+")")
+			}
+		}
+
+		if len(op.PrimaryKeyColumns) > 0 {
+			columns = append(columns, "PRIMARY KEY ("+m.quoteColumns(op.PrimaryKeyColumns)+")")
+		}
+
+		columns = append(columns, uniques...)
+		return []string{"CREATE TABLE IF NOT EXISTS " + m.quote(op.Table) + " (" + strings.Join(columns, ", ") + ")"}, nil
+	case *AddColumn:
+		// AUTO_INCREMENT is set after the primary key was created
+		autoIncrement := containsString(m.catalog.primaryKey(op.Table), op.Column.Name)
+		queries := []string{"ALTER TABLE " + m.quote(op.Table) + " ADD COLUMN " + m.quote(op.Column.Name) + " " + m.getColumnDefinition(&op.Column, autoIncrement)}
+
+		if op.Column.Unique {
+			queries = append(queries, m.getAddUnique(op.Table, m.getUniqueName(op.Table, op.Column.Name), op.Column.Name))
+		}
+
+		return queries, nil
+	case *DropColumn:
+		queries := make([]string, 0)
+
+		// foreign keys must be dropped before the column
+		for _, constraint := range m.catalog.tableConstraints(op.Table, "FOREIGN KEY") {
+			if containsString(constraint.columns, op.Column) {
+				queries = append(queries, m.getDropForeignKey(op.Table, constraint.name))
+			}
+		}
+
+		return append(queries, "ALTER TABLE "+m.quote(op.Table)+" DROP COLUMN "+m.quote(op.Column)), nil
+	case *AlterColumnType:
+		return m.getModifyColumn(op.Table, op.Column)
+	case *AlterColumnNotNull:
+		return m.getModifyColumn(op.Table, op.Column)
+	case *AlterColumnDefault:
+		return m.getModifyColumn(op.Table, op.Column)
+	case *AddPrimaryKey:
+		queries := []string{"ALTER TABLE " + m.quote(op.Table) + " ADD PRIMARY KEY (" + m.quoteColumns(op.Columns) + ")"}
+
+		for _, name := range op.Columns {
+			if column := m.columns[op.Table+"."+name]; column.Default == mysqlAutoIncrement {
+				queries = append(queries, m.getModifyColumnDefinition(op.Table, &column, true))
+			}
+		}
+
+		return queries, nil
+	case *AddUnique:
+		return []string{m.getAddUnique(op.Table, op.Name, op.Column)}, nil
+	case *AddForeignKey:
+		return []string{m.getCreateForeignKey(op)}, nil
+	case *AddCheck:
+		return nil, &ModelError{m.model, m.field, "Check constraints are not supported by MySQL"}
+	case *DropConstraint:
+		return m.getDropConstraint(op)
+	case *CreateIndex:
+		return []string{m.getCreateIndex(op.Table, &op.Index)}, nil
+	case *DropIndex:
+		return []string{"DROP INDEX " + m.quote(op.Name) + " ON " + m.quote(op.Table)}, nil
+	case *RenameTable:
+		return []string{"RENAME TABLE " + m.quote(op.Table) + " TO " + m.quote(op.Name)}, nil
+	case *RenameColumn:
+		return []string{"ALTER TABLE " + m.quote(op.Table) + " RENAME COLUMN " + m.quote(op.Column) + " TO " + m.quote(op.Name)}, nil
+	case *RenameConstraint:
+		if op.Type == ConstraintUnique {
+			return []string{m.getRenameIndex(op.Table, op.Name, op.NewName)}, nil
+		}
+
+		if op.Type != ConstraintForeignKey {
+			return nil, nil
+		}
+
+		// foreign keys cannot be renamed, the index MySQL created for it is renamed to be used by the new one
+		queries := []string{m.getDropForeignKey(op.Table, op.Name)}
+
+		if m.catalog.index(op.Table, op.Name) != nil {
+			queries = append(queries, m.getRenameIndex(op.Table, op.Name, op.NewName))
+		}
+
+		return queries, nil
+	case *RenameIndex:
+		return []string{m.getRenameIndex(op.Table, op.Name, op.NewName)}, nil
+	case *CreateSequence, *AlterSequenceOwner, *DropSequence, *RenameSequence:
+		return nil, &ModelError{m.model, m.field, "Sequences are not supported by MySQL, use id for AUTO_INCREMENT columns"}
+	}
+
+	return nil, &ModelError{m.model, m.field, "Unknown operation"}
+}
+
+// Updates the catalog after the statements of given operation were executed,
+// as the statements of the following operations depend on the foreign keys, primary keys and indexes.
+func (m *mysqlRun) apply(op Operation) {
+	switch op := op.(type) {
+	case *AlterColumnType:
+		m.modifiedColumn(op.Table, op.Column)
+	case *AlterColumnNotNull:
+		m.modifiedColumn(op.Table, op.Column)
+	case *AlterColumnDefault:
+		m.modifiedColumn(op.Table, op.Column)
+	case *DropColumn:
+		for _, constraint := range m.catalog.tableConstraints(op.Table, "FOREIGN KEY") {
+			if containsString(constraint.columns, op.Column) {
+				m.catalog.dropConstraint(op.Table, constraint.name)
+			}
+		}
+	case *AddPrimaryKey:
+		m.catalog.constraints = append(m.catalog.constraints, mysqlConstraint{table: op.Table, name: "PRIMARY", constraintType: "PRIMARY KEY", columns: op.Columns})
+	case *AddForeignKey:
+		m.keepForeignKey(op.Name)
+	case *DropConstraint:
+		m.catalog.dropConstraint(op.Table, op.Name)
+
+		if op.Type == ConstraintForeignKey {
+			m.keepForeignKey(op.Name)
+		}
+	case *RenameTable:
+		m.catalog.renameTable(op.Table, op.Name)
+	case *RenameColumn:
+		m.catalog.renameColumn(op.Table, op.Column, op.Name)
+	case *RenameConstraint:
+		if op.Type == ConstraintForeignKey {
+			if fk := m.catalog.constraint(op.Table, op.Name); fk != nil {
+				m.restoreForeignKey(fk, op.NewName)
+				m.catalog.dropConstraint(op.Table, op.Name)
+			}
+		}
+
+		m.catalog.renameIndex(op.Table, op.Name, op.NewName)
+	case *RenameIndex:
+		m.catalog.renameIndex(op.Table, op.Name, op.NewName)
+	}
+}
+
+// Returns the statements to set the type, not null, default and AUTO_INCREMENT of a column in one statement.
+// The column is modified once, no matter how many of them changed.
+func (m *mysqlRun) getModifyColumn(tableName, columnName string) ([]string, error) {
+	if m.modified[tableName+"."+columnName] {
+		return nil, nil
+	}
+
+	column, ok := m.columns[tableName+"."+columnName]
+
+	if !ok {
+		return nil, &ModelError{m.model, m.field, "No field found for column '" + columnName + "'"}
+	}
+
+	queries := make([]string, 0, 2)
+
+	// the foreign key must be dropped before the column is modified, it is added again after all tables were migrated
+	if fk := m.getColumnFk(tableName, columnName); fk != nil {
+		queries = append(queries, m.getDropForeignKey(tableName, fk.name))
+	}
+
+	// AUTO_INCREMENT columns must be part of a key, it is set after the primary key was created otherwise
+	autoIncrement := containsString(m.catalog.primaryKey(tableName), columnName)
+	return append(queries, m.getModifyColumnDefinition(tableName, &column, autoIncrement)), nil
+}
+
+func (m *mysqlRun) getModifyColumnDefinition(tableName string, column *ColumnSpec, autoIncrement bool) string {
+	return "ALTER TABLE " + m.quote(tableName) + " MODIFY COLUMN " + m.quote(column.Name) + " " + m.getColumnDefinition(column, autoIncrement)
+}
+
+func (m *mysqlRun) modifiedColumn(tableName, columnName string) {
+	if m.modified == nil {
+		m.modified = make(map[string]bool)
+	}
+
+	m.modified[tableName+"."+columnName] = true
+
+	if fk := m.getColumnFk(tableName, columnName); fk != nil {
+		m.restoreForeignKey(fk, fk.name)
+		m.catalog.dropConstraint(tableName, fk.name)
+	}
+}
+
+func (m *mysqlRun) getDropConstraint(op *DropConstraint) ([]string, error) {
+	switch op.Type {
+	case ConstraintPrimaryKey:
+		queries := make([]string, 0)
+
+		// AUTO_INCREMENT columns must be part of a key, so it is removed before the primary key is dropped
+		for _, column := range m.catalog.tableColumns(op.Table) {
+			if column.autoIncrement && containsString(m.catalog.primaryKey(op.Table), column.name) {
+				spec := &ColumnSpec{Name: column.name, Type: column.columnType, NotNull: column.notnull}
+				queries = append(queries, m.getModifyColumnDefinition(op.Table, spec, false))
+			}
+		}
+
+		return append(queries, "ALTER TABLE "+m.quote(op.Table)+" DROP PRIMARY KEY"), nil
+	case ConstraintUnique:
+		if m.catalog.constraint(op.Table, op.Name) == nil {
+			return nil, nil
+		}
+
+		return []string{"ALTER TABLE " + m.quote(op.Table) + " DROP INDEX " + m.quote(op.Name)}, nil
+	case ConstraintForeignKey:
+		// the foreign key might have been dropped already to modify its column
+		if m.catalog.constraint(op.Table, op.Name) == nil {
+			return nil, nil
+		}
+
+		return []string{m.getDropForeignKey(op.Table, op.Name)}, nil
+	}
+
+	return nil, &ModelError{m.model, m.field, "Check constraints are not supported by MySQL"}
+}
+
+// Returns the foreign key of given column or nil if there is none.
+func (m *mysqlRun) getColumnFk(tableName, columnName string) *mysqlConstraint {
+	for _, constraint := range m.catalog.tableConstraints(tableName, "FOREIGN KEY") {
+		if len(constraint.columns) == 1 && constraint.columns[0] == columnName && strings.HasSuffix(constraint.name, "_fk") {
+			return &constraint
+		}
+	}
+
+	return nil
+}
+
+// Adds the foreign key again with given name after all tables were migrated.
+func (m *mysqlRun) restoreForeignKey(fk *mysqlConstraint, name string) {
+	m.createFK = append(m.createFK, &AddForeignKey{Source{m.model, m.field},
+		fk.table,
+		name,
+		fk.columns[0],
+		ForeignKeySpec{RefTable: fk.refTable, RefColumn: fk.refColumn, OnDelete: fk.onDelete, OnUpdate: fk.onUpdate}})
+}
+
+// Removes the foreign key of given name from the ones added again, as it was dropped or added by the schema diff.
+func (m *mysqlRun) keepForeignKey(name string) {
+	createFK := make([]Operation, 0, len(m.createFK))
+
+	for _, op := range m.createFK {
+		if op.(*AddForeignKey).Name != name {
+			createFK = append(createFK, op)
+		}
+	}
+
+	m.createFK = createFK
+}
+
+// Returns the definition of a column to create or modify it.
+// AUTO_INCREMENT is only set if autoIncrement is true, as the column must be part of the primary key.
+func (m *mysqlRun) getColumnDefinition(column *ColumnSpec, autoIncrement bool) string {
+	definition := column.Type
+
+	if column.NotNull {
+		definition += " NOT NULL"
+	} else {
+		definition += " NULL"
+	}
+
+	if column.Default != "" && column.Default != mysqlAutoIncrement {
+		definition += " DEFAULT " + column.Default
+	}
+
+	if column.Default == mysqlAutoIncrement && autoIncrement {
+		definition += " AUTO_INCREMENT"
+	}
+
+	return definition
+}
+
+func (m *mysqlRun) getAddUnique(tableName, name, columnName string) string {
+	return "ALTER TABLE " + m.quote(tableName) + " ADD CONSTRAINT " + m.quote(name) + " UNIQUE (" + m.quote(columnName) + ")"
+}
+
+func (m *mysqlRun) getDropForeignKey(tableName, name string) string {
+	return "ALTER TABLE " + m.quote(tableName) + " DROP FOREIGN KEY " + m.quote(name)
+}
+
+func (m *mysqlRun) getRenameIndex(tableName, oldName, newName string) string {
+	return "ALTER TABLE " + m.quote(tableName) + " RENAME INDEX " + m.quote(oldName) + " TO " + m.quote(newName)
+}
+
+func (m *mysqlRun) getCreateForeignKey(op *AddForeignKey) string {
+	fk := op.ForeignKey
+	query := "ALTER TABLE " + m.quote(op.Table) +
+		" ADD CONSTRAINT " + m.quote(op.Name) +
+		" FOREIGN KEY (" + m.quote(op.Column) + ")" +
+		" REFERENCES " + m.quote(fk.RefTable) + " (" + m.quote(fk.RefColumn) + ")"
+
+	if fk.OnDelete != "no action" {
+		query += " ON DELETE " + strings.ToUpper(fk.OnDelete)
+	}
+
+	if fk.OnUpdate != "no action" {
+		query += " ON UPDATE " + strings.ToUpper(fk.OnUpdate)
+	}
+
+	return query
+}
+
+func (m *mysqlRun) getCreateIndex(tableName string, index *IndexSpec) string {
+	query := "CREATE "
+
+	if index.Unique {
+		query += "UNIQUE "
+	}
+
+	query += "INDEX " + m.quote(index.Name) + " ON " + m.quote(tableName) + " (" + m.quoteColumns(index.Columns) + ")"
+
+	if index.Method != "btree" {
+		query += " USING " + strings.ToUpper(index.Method)
+	}
+
+	return query
+}
+
+// Returns the default of given column as it would be declared by a default tag or an empty string if it has none.
+// MySQL returns string literals unquoted and marks expressions as generated, MariaDB returns string literals quoted.
+func mysqlColumnDefault(column *mysqlColumn, mariaDB bool) string {
+	if column.autoIncrement {
+		return mysqlAutoIncrement
+	}
+
+	if !column.hasDefault || strings.ToLower(column.defaultValue) == "null" {
+		return ""
+	}
+
+	if column.generated || mariaDB {
+		return column.defaultValue
+	}
+
+	if _, err := strconv.ParseFloat(column.defaultValue, 64); err == nil {
+		return column.defaultValue
+	}
+
+	return "'" + strings.Replace(column.defaultValue, "'", "''", -1) + "'"
+}
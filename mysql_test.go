@@ -0,0 +1,426 @@
+package gondolier
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type testMySQLUser struct {
+	Id      uint64 `gondolier:"id"`
+	Name    string `gondolier:"type:varchar(100);notnull;unique"`
+	Age     uint   `gondolier:"type:integer;notnull;default:0"`
+	Picture uint64 `gondolier:"type:bigint unsigned;fk:testMySQLPicture.Id,ondelete:set null;null;index"`
+}
+
+type testMySQLPicture struct {
+	Id       uint64 `gondolier:"id"`
+	FileName string `gondolier:"type:varchar(255);notnull"`
+}
+
+type testMySQLUpdate struct {
+	Id   uint64 `gondolier:"id"`
+	Name string `gondolier:"type:varchar(200);notnull;default:'unknown';was:Title"`
+	Age  *uint  `gondolier:"index:age,unique"`
+}
+
+type testMySQLRenameFk struct {
+	Id    uint64 `gondolier:"id"`
+	Image uint64 `gondolier:"type:bigint unsigned;fk:testMySQLPicture.Id;was:Picture"`
+}
+
+type testMySQLSeq struct {
+	Id uint64 `gondolier:"type:bigint;pk;seq:1,1,-,-,1;default:nextval(seq)"`
+}
+
+type testMySQLCheck struct {
+	Id  uint64 `gondolier:"id"`
+	Age uint   `gondolier:"check:age >= 0"`
+}
+
+type testMySQLDeferrable struct {
+	Id      uint64 `gondolier:"id"`
+	Picture uint64 `gondolier:"fk:testMySQLPicture.Id,deferrable"`
+}
+
+type testMySQLPartialIndex struct {
+	Id   uint64 `gondolier:"id"`
+	Name string `gondolier:"index:name,where:name <> ''"`
+}
+
+func TestMySQLNormalizeType(t *testing.T) {
+	types := [][]string{
+		{"int(11)", "int"},
+		{"INTEGER", "int"},
+		{"bigint(20) unsigned", "bigint unsigned"},
+		{"BIGINT UNSIGNED", "bigint unsigned"},
+		{"bool", "tinyint(1)"},
+		{"boolean", "tinyint(1)"},
+		{"tinyint(1)", "tinyint(1)"},
+		{"tinyint(4)", "tinyint"},
+		{"varchar(255)", "varchar(255)"},
+		{"VARCHAR (255)", "varchar(255)"},
+		{"character varying(100)", "varchar(100)"},
+		{"char", "char(1)"},
+		{"decimal", "decimal(10,0)"},
+		{"numeric(10, 2)", "decimal(10,2)"},
+		{"dec(5)", "decimal(5,0)"},
+		{"double precision", "double"},
+		{"datetime(6)", "datetime(6)"},
+		{"text", "text"},
+	}
+
+	for _, typ := range types {
+		if mysqlNormalizeType(typ[0]) != typ[1] || mysqlNormalizeType(typ[1]) != typ[1] {
+			t.Fatalf("Type not normalized as expected: %v (%v) %v (%v)", typ[0], mysqlNormalizeType(typ[0]), typ[1], mysqlNormalizeType(typ[1]))
+		}
+	}
+
+	if mysqlNormalizeType("varchar(100)") == mysqlNormalizeType("varchar(200)") {
+		t.Fatal("Types must not be equal")
+	}
+
+	if mysqlNormalizeType("bigint") == mysqlNormalizeType("bigint unsigned") {
+		t.Fatal("Signed and unsigned types must not be equal")
+	}
+}
+
+func TestMySQLColumnDefault(t *testing.T) {
+	mysql := &mysqlRun{MySQL: &MySQL{}}
+	defaults := []struct {
+		value   string
+		column  mysqlColumn
+		mariaDB bool
+		equals  bool
+	}{
+		{"", mysqlColumn{}, false, true},
+		{"", mysqlColumn{hasDefault: true, defaultValue: "NULL"}, true, true},
+		{"'active'", mysqlColumn{hasDefault: true, defaultValue: "active"}, false, true},
+		{"'active'", mysqlColumn{hasDefault: true, defaultValue: "'active'"}, true, true},
+		{"'it''s'", mysqlColumn{hasDefault: true, defaultValue: "it's"}, false, true},
+		{"0", mysqlColumn{hasDefault: true, defaultValue: "0"}, false, true},
+		{"CURRENT_TIMESTAMP", mysqlColumn{hasDefault: true, defaultValue: "CURRENT_TIMESTAMP", generated: true}, false, true},
+		{"CURRENT_TIMESTAMP", mysqlColumn{hasDefault: true, defaultValue: "current_timestamp()"}, true, true},
+		{"now()", mysqlColumn{hasDefault: true, defaultValue: "now()", generated: true}, false, true},
+		{"(uuid())", mysqlColumn{hasDefault: true, defaultValue: "uuid()", generated: true}, false, true},
+		{mysqlAutoIncrement, mysqlColumn{autoIncrement: true}, false, true},
+		{"'active'", mysqlColumn{hasDefault: true, defaultValue: "deleted"}, false, false},
+		{"'now()'", mysqlColumn{hasDefault: true, defaultValue: "now()", generated: true}, false, false},
+		{"0", mysqlColumn{}, false, false},
+		{"", mysqlColumn{hasDefault: true, defaultValue: "0"}, false, false},
+	}
+
+	for _, d := range defaults {
+		existing := mysqlColumnDefault(&d.column, d.mariaDB)
+
+		if (mysql.NormalizeExpr(d.value) == mysql.NormalizeExpr(existing)) != d.equals {
+			t.Fatalf("Default %v must be equal to %v: %v", d.value, existing, d.equals)
+		}
+	}
+}
+
+func TestMySQLColumnDefinition(t *testing.T) {
+	mysql := &mysqlRun{MySQL: &MySQL{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testMySQLUser{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"bigint unsigned NOT NULL AUTO_INCREMENT",
+		"varchar(100) NOT NULL",
+		"integer NOT NULL DEFAULT 0",
+		"bigint unsigned NULL"}
+
+	for i, field := range model.Fields {
+		column, err := mysql.Column("t", &field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if definition := mysql.getColumnDefinition(column, true); definition != expected[i] {
+			t.Fatalf("Definition of field %v must be '%v', but was: %v", field.Name, expected[i], definition)
+		}
+	}
+
+	if pk := getPrimaryKeyColumns(&model, mysql.naming); strings.Join(pk, ",") != "id" {
+		t.Fatalf("Primary key must be id, but was: %v", pk)
+	}
+
+	if column := mysql.columns["t.id"]; mysql.getColumnDefinition(&column, false) != "bigint unsigned NOT NULL" {
+		t.Fatal("AUTO_INCREMENT must only be set for columns of the primary key")
+	}
+
+	if quoted := mysql.quote("my`table"); quoted != "`my``table`" {
+		t.Fatalf("Identifier must be quoted with backticks, but was: %v", quoted)
+	}
+}
+
+func TestMySQLNullFieldType(t *testing.T) {
+	mysql := &mysqlRun{MySQL: &MySQL{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testNullTypes{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"datetime", "int", "smallint", "tinyint unsigned"}
+
+	for i, field := range model.Fields {
+		columnType, notnull, err := mysql.getFieldType(&field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if columnType != expected[i] || notnull {
+			t.Fatalf("Type of field %v not as expected: %v %v", field.Name, columnType, notnull)
+		}
+	}
+}
+
+func TestMySQLUnsupportedTags(t *testing.T) {
+	mysql := &mysqlRun{MySQL: &MySQL{}, naming: &SnakeCase{}}
+	models := []interface{}{testMySQLSeq{}, testMySQLCheck{}, testMySQLDeferrable{}, testMySQLPartialIndex{}}
+	messages := []string{"Sequences are not supported", "Check constraints are not supported", "not supported", "not supported"}
+
+	for i, model := range models {
+		metaModel, err := buildMetaModel(model)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mysql.model = metaModel.ModelName
+		_, err = mysql.Indexes("", &metaModel)
+
+		for _, field := range metaModel.Fields {
+			if err != nil {
+				break
+			}
+
+			_, err = mysql.Column("", &field)
+		}
+
+		if _, ok := err.(*TagError); !ok || !strings.Contains(err.Error(), messages[i]) {
+			t.Fatalf("Unsupported tag must return a TagError for model %v, but was: %v", metaModel.ModelName, err)
+		}
+	}
+}
+
+func TestMySQLRenameColumnForeignKeyPlan(t *testing.T) {
+	table := "test_my_sql_rename_fk"
+	oldFk, newFk := table+"_picture_test_my_sql_picture_id_fk", table+"_image_test_my_sql_picture_id_fk"
+	catalog := &mysqlCatalog{tables: []string{table, "test_my_sql_picture"},
+		columns: []mysqlColumn{{table: table, name: "id", columnType: "bigint unsigned", notnull: true, autoIncrement: true},
+			{table: table, name: "picture", columnType: "int unsigned"}},
+		constraints: []mysqlConstraint{{table: table, name: "PRIMARY", constraintType: "PRIMARY KEY", columns: []string{"id"}},
+			{table: table, name: oldFk, constraintType: "FOREIGN KEY", columns: []string{"picture"},
+				refTable: "test_my_sql_picture", refColumn: "id", onDelete: "no action", onUpdate: "no action"}},
+		indexes: []mysqlIndex{{table: table, name: oldFk, method: "BTREE", columns: []string{"picture"}}}}
+	mysql := &mysqlRun{MySQL: &MySQL{}, naming: &SnakeCase{}, catalog: catalog, plan: &Plan{}}
+	model, err := buildMetaModel(testMySQLRenameFk{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mysql.migrateModels([]MetaModel{model}); err != nil {
+		t.Fatal(err)
+	}
+
+	statements := mysql.plan.Statements
+	expected := []string{"ALTER TABLE `" + table + "` RENAME COLUMN `picture` TO `image`",
+		"ALTER TABLE `" + table + "` DROP FOREIGN KEY `" + oldFk + "`",
+		"ALTER TABLE `" + table + "` RENAME INDEX `" + oldFk + "` TO `" + newFk + "`",
+		"ALTER TABLE `" + table + "` MODIFY COLUMN `image` bigint unsigned NULL",
+		"ALTER TABLE `" + table + "` ADD CONSTRAINT `" + newFk + "` FOREIGN KEY (`image`) REFERENCES `test_my_sql_picture` (`id`)"}
+
+	if len(statements) != len(expected) {
+		t.Fatalf("Expected %v statements, but was: %v", len(expected), statements)
+	}
+
+	for i, statement := range statements {
+		if statement.Query != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], statement.Query)
+		}
+	}
+}
+
+func TestMySQLUpdateTablePlan(t *testing.T) {
+	table := "test_my_sql_update"
+	catalog := &mysqlCatalog{tables: []string{table},
+		columns: []mysqlColumn{{table: table, name: "id", columnType: "int", notnull: true},
+			{table: table, name: "title", columnType: "varchar(100)"},
+			{table: table, name: "drop_me", columnType: "text"}},
+		constraints: []mysqlConstraint{{table: table, name: "PRIMARY", constraintType: "PRIMARY KEY", columns: []string{"id"}}},
+		indexes:     []mysqlIndex{{table: table, name: "PRIMARY", unique: true, method: "btree", columns: []string{"id"}}}}
+	mysql := &mysqlRun{MySQL: &MySQL{DropColumns: true}, naming: &SnakeCase{}, catalog: catalog, plan: &Plan{}}
+	model, err := buildMetaModel(testMySQLUpdate{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mysql.migrateModels([]MetaModel{model}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"ALTER TABLE `" + table + "` RENAME COLUMN `title` TO `name`",
+		"ALTER TABLE `" + table + "` MODIFY COLUMN `id` bigint unsigned NOT NULL AUTO_INCREMENT",
+		"ALTER TABLE `" + table + "` MODIFY COLUMN `name` varchar(200) NOT NULL DEFAULT 'unknown'",
+		"ALTER TABLE `" + table + "` ADD COLUMN `age` bigint unsigned NULL",
+		"ALTER TABLE `" + table + "` DROP COLUMN `drop_me`",
+		"CREATE UNIQUE INDEX `" + table + "_age_idx` ON `" + table + "` (`age`)"}
+
+	if len(mysql.plan.Statements) != len(expected) {
+		t.Fatalf("Expected %v statements, but was: %v", len(expected), mysql.plan.Statements)
+	}
+
+	for i, statement := range mysql.plan.Statements {
+		if statement.Query != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], statement.Query)
+		}
+	}
+}
+
+func TestMySQLCreateTable(t *testing.T) {
+	if testmysqldb == nil {
+		t.Skip("No MySQL database configured")
+	}
+
+	testCleanMySQLDb()
+	t.Log("--- TestMySQLCreateTable ---")
+
+	mysql := &MySQL{Log: true}
+	g := New(testmysqldb, mysql)
+	g.Model(testMySQLUser{}, testMySQLPicture{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := testMySQLCatalog(t, mysql)
+
+	if !catalog.table("test_my_sql_user") || !catalog.table("test_my_sql_picture") {
+		t.Fatalf("Tables must have been created: %v", catalog.tables)
+	}
+
+	if id := catalog.column("test_my_sql_user", "id"); id == nil || !id.autoIncrement || !id.notnull {
+		t.Fatal("Column id must be not null and AUTO_INCREMENT")
+	}
+
+	if pk := catalog.primaryKey("test_my_sql_user"); strings.Join(pk, ",") != "id" {
+		t.Fatalf("Primary key must have been created, but was: %v", pk)
+	}
+
+	if catalog.constraint("test_my_sql_user", "test_my_sql_user_name_key") == nil {
+		t.Fatal("Unique constraint must have been created")
+	}
+
+	fk := catalog.constraint("test_my_sql_user", "test_my_sql_user_picture_test_my_sql_picture_id_fk")
+
+	if fk == nil || fk.onDelete != "set null" {
+		t.Fatalf("Foreign key must have been created, but was: %v", fk)
+	}
+
+	if catalog.index("test_my_sql_user", "test_my_sql_user_picture_idx") == nil {
+		t.Fatal("Index must have been created")
+	}
+
+	// migrating again must not change anything
+	g.Model(testMySQLUser{}, testMySQLPicture{})
+	plan, err := g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Statements) != 0 {
+		t.Fatalf("Plan must be empty, but was: %v", plan)
+	}
+}
+
+func TestMySQLUpdateTable(t *testing.T) {
+	if testmysqldb == nil {
+		t.Skip("No MySQL database configured")
+	}
+
+	testCleanMySQLDb()
+	t.Log("--- TestMySQLUpdateTable ---")
+
+	if _, err := testmysqldb.Exec("CREATE TABLE `test_my_sql_update` (`id` int NOT NULL, `title` varchar(100) NULL, `drop_me` text, PRIMARY KEY (`id`))"); err != nil {
+		t.Fatal(err)
+	}
+
+	mysql := &MySQL{DropColumns: true, Log: true}
+	g := New(testmysqldb, mysql)
+	g.Model(testMySQLUpdate{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := testMySQLCatalog(t, mysql)
+
+	if catalog.column("test_my_sql_update", "title") != nil || catalog.column("test_my_sql_update", "drop_me") != nil {
+		t.Fatal("Column must have been renamed and dropped")
+	}
+
+	id := catalog.column("test_my_sql_update", "id")
+	name := catalog.column("test_my_sql_update", "name")
+
+	if id == nil || mysqlNormalizeType(id.columnType) != "bigint unsigned" || !id.autoIncrement {
+		t.Fatalf("Column id must have been updated, but was: %v", id)
+	}
+
+	if name == nil || mysqlNormalizeType(name.columnType) != "varchar(200)" || !name.notnull || mysqlColumnDefault(name, catalog.mariaDB) != "'unknown'" {
+		t.Fatalf("Column name must have been updated, but was: %v", name)
+	}
+
+	if index := catalog.index("test_my_sql_update", "test_my_sql_update_age_idx"); index == nil || !index.unique {
+		t.Fatal("Unique index must have been created")
+	}
+}
+
+func TestMySQLDropTable(t *testing.T) {
+	if testmysqldb == nil {
+		t.Skip("No MySQL database configured")
+	}
+
+	testCleanMySQLDb()
+	t.Log("--- TestMySQLDropTable ---")
+
+	mysql := &MySQL{Log: true}
+	g := New(testmysqldb, mysql)
+	g.Model(testMySQLUser{}, testMySQLPicture{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.DropE(testMySQLPicture{}, testMySQLUser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if catalog := testMySQLCatalog(t, mysql); catalog.table("test_my_sql_user") || catalog.table("test_my_sql_picture") {
+		t.Fatal("Tables must have been dropped")
+	}
+}
+
+func testMySQLCatalog(t *testing.T, mysql *MySQL) *mysqlCatalog {
+	catalog, err := mysql.newRun(context.Background(), testmysqldb, &SnakeCase{}).loadCatalog()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return catalog
+}
+
+func testCleanMySQLDb() {
+	testmysqldb.Exec("DROP TABLE IF EXISTS `test_my_sql_user`")
+	testmysqldb.Exec("DROP TABLE IF EXISTS `test_my_sql_picture`")
+	testmysqldb.Exec("DROP TABLE IF EXISTS `test_my_sql_update`")
+}
@@ -1,6 +1,7 @@
 package gondolier
 
 import (
+	"strings"
 	"unicode"
 )
 
@@ -42,3 +43,31 @@ func (n *SnakeCase) Get(name string) string {
 
 	return string(snake)
 }
+
+// Invert returns the given snake case name in camel case, starting with an upper case letter.
+// Underscores are kept in front of parts not starting with a letter, so that Get returns the name again.
+//
+// Example:
+//  my_model -> MyModel
+//  address_2 -> Address_2
+func (n *SnakeCase) Invert(name string) string {
+	var camel strings.Builder
+
+	for i, part := range strings.Split(name, "_") {
+		runes := []rune(part)
+
+		if len(runes) == 0 || !unicode.IsLetter(runes[0]) {
+			if i > 0 {
+				camel.WriteRune('_')
+			}
+
+			camel.WriteString(part)
+			continue
+		}
+
+		camel.WriteRune(unicode.ToUpper(runes[0]))
+		camel.WriteString(string(runes[1:]))
+	}
+
+	return camel.String()
+}
@@ -31,3 +31,29 @@ func TestToSnakeCase(t *testing.T) {
 		}
 	}
 }
+
+func TestSnakeCaseInvert(t *testing.T) {
+	names := [][]string{
+		{"", ""},
+		{"a", "A"},
+		{"my_model_name", "MyModelName"},
+		{"api_snake_name", "ApiSnakeName"},
+		{"s_nake", "SNake"},
+		{"snake_id", "SnakeId"},
+		{"address2", "Address2"},
+		{"address_2", "Address_2"},
+	}
+	namesake := SnakeCase{}
+
+	for _, name := range names {
+		got := namesake.Invert(name[0])
+
+		if got != name[1] {
+			t.Fatalf("Expected camel case name %v but got %v for input %v", name[1], got, name[0])
+		}
+
+		if namesake.Get(got) != name[0] {
+			t.Fatalf("Expected inverted name %v to translate back to %v but got %v", got, name[0], namesake.Get(got))
+		}
+	}
+}
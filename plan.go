@@ -0,0 +1,148 @@
+package gondolier
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Planner is implemented by migrators which can return the statements of a migration without executing them.
+type Planner interface {
+	Plan(context.Context, *sql.DB, NameSchema, []MetaModel) (*Plan, error)
+}
+
+// Statement is a single SQL statement of a migration.
+// Model and Field are empty if the statement does not belong to a model or field.
+// NoTransaction is set for statements which cannot be executed inside a transaction,
+// they are executed after the transaction was committed.
+type Statement struct {
+	Model         string
+	Field         string
+	Query         string
+	NoTransaction bool
+}
+
+// Plan is the ordered list of statements a migration executes.
+// It can be printed for review and applied later.
+type Plan struct {
+	Statements []Statement
+}
+
+// Empty returns true if the plan has no statements to execute.
+func (p *Plan) Empty() bool {
+	return len(p.Statements) == 0
+}
+
+// String returns all statements of the plan, each terminated by a semicolon and new line.
+func (p *Plan) String() string {
+	var sb strings.Builder
+
+	for _, statement := range p.Statements {
+		sb.WriteString(statement.Query)
+		sb.WriteString(";\n")
+	}
+
+	return sb.String()
+}
+
+// WriteSQL writes the plan as an SQL script to given writer, so that it can be reviewed and executed manually.
+// The script starts with a header, wraps all statements in a transaction
+// and names the model and field behind each statement in a comment.
+// Statements which cannot be executed inside a transaction follow after it was committed.
+func (p *Plan) WriteSQL(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	out.WriteString("-- Migration generated by Gondolier\n")
+	out.WriteString("-- Created: " + time.Now().UTC().Format(time.RFC3339) + "\n")
+	out.WriteString("-- Statements: " + strconv.Itoa(len(p.Statements)) + "\n\n")
+	out.WriteString("BEGIN;\n\n")
+
+	for _, statement := range p.Statements {
+		if !statement.NoTransaction {
+			out.WriteString(statement.comment())
+			out.WriteString(statement.Query)
+			out.WriteString(";\n\n")
+		}
+	}
+
+	out.WriteString("COMMIT;\n")
+
+	for _, statement := range p.Statements {
+		if statement.NoTransaction {
+			out.WriteString("\n")
+			out.WriteString(statement.comment())
+			out.WriteString(statement.Query)
+			out.WriteString(";\n")
+		}
+	}
+
+	return out.Flush()
+}
+
+// Apply executes the plan within a transaction.
+// The transaction is rolled back if one of the statements fails.
+func (p *Plan) Apply(conn *sql.DB) error {
+	return p.ApplyContext(context.Background(), conn)
+}
+
+// ApplyContext executes the plan within a transaction.
+// The transaction is rolled back if one of the statements fails or the context is canceled.
+// Statements which cannot be executed inside a transaction are executed after it was committed.
+func (p *Plan) ApplyContext(ctx context.Context, conn *sql.DB) error {
+	tx, err := conn.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range p.Statements {
+		if statement.NoTransaction {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, statement.Query); err != nil {
+			tx.Rollback()
+			return &SQLError{statement.Model, statement.Field, statement.Query, err}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, statement := range p.Statements {
+		if !statement.NoTransaction {
+			continue
+		}
+
+		if _, err := conn.ExecContext(ctx, statement.Query); err != nil {
+			return &SQLError{statement.Model, statement.Field, statement.Query, err}
+		}
+	}
+
+	return nil
+}
+
+func (s Statement) comment() string {
+	if s.Model == "" {
+		return ""
+	}
+
+	if s.Field == "" {
+		return "-- Model " + s.Model + "\n"
+	}
+
+	return "-- Model " + s.Model + ", field " + s.Field + "\n"
+}
+
+func (p *Plan) add(model, field, query string) {
+	p.Statements = append(p.Statements, Statement{model, field, query, false})
+}
+
+// Adds a statement which must be executed after the transaction was committed.
+func (p *Plan) addNoTransaction(model, field, query string) {
+	p.Statements = append(p.Statements, Statement{model, field, query, true})
+}
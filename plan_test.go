@@ -0,0 +1,103 @@
+package gondolier
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPlanString(t *testing.T) {
+	plan := &Plan{}
+
+	if !plan.Empty() || plan.String() != "" {
+		t.Fatal("Plan must be empty")
+	}
+
+	plan.add("MyModel", "", `CREATE TABLE "my_model" ("id" bigint)`)
+	plan.add("MyModel", "Id", `ALTER TABLE "my_model" ALTER COLUMN "id" SET NOT NULL`)
+	expected := `CREATE TABLE "my_model" ("id" bigint);
+ALTER TABLE "my_model" ALTER COLUMN "id" SET NOT NULL;
+`
+
+	if plan.Empty() || plan.String() != expected {
+		t.Fatalf("Plan must contain statements in order, but was: %v", plan.String())
+	}
+
+	if plan.Statements[1].Model != "MyModel" || plan.Statements[1].Field != "Id" {
+		t.Fatal("Statements must contain model and field")
+	}
+}
+
+func TestPlanNotSupported(t *testing.T) {
+	g := New(testdb, &dummyMigrator{})
+
+	if _, err := g.Plan(); err == nil {
+		t.Fatal("Plan must return an error if the migrator does not support planning")
+	}
+}
+
+func TestPlanWriteSQL(t *testing.T) {
+	plan := &Plan{}
+	plan.add("MyModel", "", `CREATE TABLE "my_model" ("id" bigint)`)
+	plan.add("MyModel", "Id", `ALTER TABLE "my_model" ALTER COLUMN "id" SET NOT NULL`)
+	var sql bytes.Buffer
+
+	if err := plan.WriteSQL(&sql); err != nil {
+		t.Fatal(err)
+	}
+
+	script := sql.String()
+	t.Log(script)
+
+	if !strings.HasPrefix(script, "-- Migration generated by Gondolier\n") ||
+		!strings.Contains(script, "-- Statements: 2\n") {
+		t.Fatal("Script must start with a header")
+	}
+
+	if !strings.Contains(script, "\nBEGIN;\n") || !strings.HasSuffix(script, "\nCOMMIT;\n") {
+		t.Fatal("Script must be wrapped in a transaction")
+	}
+
+	expected := `-- Model MyModel
+CREATE TABLE "my_model" ("id" bigint);
+
+-- Model MyModel, field Id
+ALTER TABLE "my_model" ALTER COLUMN "id" SET NOT NULL;
+`
+
+	if !strings.Contains(script, expected) {
+		t.Fatal("Script must contain statements with comments naming model and field")
+	}
+}
+
+func TestPlanWriteSQLNoTransaction(t *testing.T) {
+	plan := &Plan{}
+	plan.add("MyModel", "", `ALTER TABLE "my_model" ADD COLUMN "name" text`)
+	plan.addNoTransaction("MyModel", "Id", `ALTER TABLE "my_model" ALTER COLUMN "id" TYPE uuid`)
+	plan.add("Other", "", `CREATE TABLE "other" ("id" bigint)`)
+	var sql bytes.Buffer
+
+	if err := plan.WriteSQL(&sql); err != nil {
+		t.Fatal(err)
+	}
+
+	script := sql.String()
+	t.Log(script)
+	expected := `BEGIN;
+
+-- Model MyModel
+ALTER TABLE "my_model" ADD COLUMN "name" text;
+
+-- Model Other
+CREATE TABLE "other" ("id" bigint);
+
+COMMIT;
+
+-- Model MyModel, field Id
+ALTER TABLE "my_model" ALTER COLUMN "id" TYPE uuid;
+`
+
+	if !strings.HasSuffix(script, expected) {
+		t.Fatal("Statements which cannot be executed inside a transaction must follow after it was committed")
+	}
+}
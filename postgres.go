@@ -1,17 +1,89 @@
 package gondolier
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	pgHistoryTable = "gondolier_migrations"
+	pgLockKey      = 4742295913254739137
+)
+
+var (
+	pgFkActions = map[string]string{"no action": "a",
+		"restrict":    "r",
+		"cascade":     "c",
+		"set null":    "n",
+		"set default": "d"}
+	pgTypes = map[reflect.Type]string{reflect.TypeOf(false): "boolean",
+		reflect.TypeOf(int(0)):            "bigint",
+		reflect.TypeOf(int8(0)):           "smallint",
+		reflect.TypeOf(int16(0)):          "smallint",
+		reflect.TypeOf(int32(0)):          "integer",
+		reflect.TypeOf(int64(0)):          "bigint",
+		reflect.TypeOf(uint(0)):           "bigint",
+		reflect.TypeOf(uint8(0)):          "smallint",
+		reflect.TypeOf(uint16(0)):         "integer",
+		reflect.TypeOf(uint32(0)):         "bigint",
+		reflect.TypeOf(uint64(0)):         "bigint",
+		reflect.TypeOf(float32(0)):        "real",
+		reflect.TypeOf(float64(0)):        "double precision",
+		reflect.TypeOf(""):                "text",
+		reflect.TypeOf([]byte{}):          "bytea",
+		reflect.TypeOf(time.Time{}):       "timestamptz",
+		reflect.TypeOf(sql.NullBool{}):    "boolean",
+		reflect.TypeOf(sql.NullByte{}):    "smallint",
+		reflect.TypeOf(sql.NullFloat64{}): "double precision",
+		reflect.TypeOf(sql.NullInt16{}):   "smallint",
+		reflect.TypeOf(sql.NullInt32{}):   "integer",
+		reflect.TypeOf(sql.NullInt64{}):   "bigint",
+		reflect.TypeOf(sql.NullString{}):  "text",
+		reflect.TypeOf(sql.NullTime{}):    "timestamptz"}
+	pgTypeAliases = map[string]string{"int": "integer",
+		"int4":        "integer",
+		"serial":      "integer",
+		"serial4":     "integer",
+		"int2":        "smallint",
+		"smallserial": "smallint",
+		"serial2":     "smallint",
+		"int8":        "bigint",
+		"bigserial":   "bigint",
+		"serial8":     "bigint",
+		"bool":        "boolean",
+		"float4":      "real",
+		"float8":      "double precision",
+		"float":       "double precision",
+		"decimal":     "numeric",
+		"varchar":     "character varying",
+		"char":        "character",
+		"bpchar":      "character",
+		"varbit":      "bit varying"}
+	pgIndexMethods = []string{"btree", "hash", "gist", "gin", "spgist", "brin"}
+	pgIndexSupport = &indexSupport{"Postgres", pgIndexMethods, true}
+	pgExprCast     = regexp.MustCompile(`::(character varying|double precision|(timestamp|time) with(out)? time zone|[a-z_][a-z0-9_]*)(\(\d+(,\s*\d+)?\))?(\[\])*`)
+	pgExprSpace    = regexp.MustCompile(`[\s()"]+`)
+	pgExprNumber   = regexp.MustCompile(`^'[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?'$`)
+	pgTypeArray    = regexp.MustCompile(`(\s*\[\s*\d*\s*\])+$|\s+array(\s*\[\s*\d*\s*\])?$`)
+	pgTypeParts    = regexp.MustCompile(`^(.+?)\s*(\(\s*\d+\s*(,\s*\d+\s*)?\))?(\s+with(out)?\s+time\s+zone)?$`)
 )
 
 // Postgres migrator for Postgres databases.
 // You can use the following options to configure your data model:
 //
 //  // The type must be the database type.
+//  // Optional. If omitted, the type is inferred from the Go type of the field (see RegisterType)
+//  // and the column is not null, unless the field is a pointer or sql.Null* type.
 //  type:database type
 //  // Sets the column as primary key.
+//  // Set it for multiple fields to create a composite primary key.
 //  pk/primary key
 //  // Creates and sets a sequence with given parameters for the column.
 //  seq:start,increment,minvalue,maxvalue,cache
@@ -29,660 +101,824 @@ import (
 //  // Sets foreign key constraint for column.
 //  // It refers to the given model and column.
 //  // Example: fk:MyModel.Id
-//  fk/foreign key:Model.Column
+//  // Referential actions and deferrability can be added as options separated by comma.
+//  // Actions are: cascade, set null, set default, restrict and no action.
+//  // Example: fk:MyModel.Id,ondelete:cascade,onupdate:restrict,deferred,notvalid
+//  fk/foreign key:Model.Column,ondelete:action,onupdate:action,deferrable/deferred,notvalid
+//  // Creates an index for the column. Fields with the same index name share a multi-column index.
+//  // Options are separated by comma: unique, the method (btree, hash, gist, gin, spgist, brin)
+//  // and a where clause for partial indexes, which must be the last option.
+//  // Example: index:name,unique,gin,where:deleted IS NULL
+//  index/index:name,options
+//  // Creates a check constraint for the column named table_column_check.
+//  // Example: check:age >= 0
+//  check:expression
+//  // Renames the column of a previous field name, if the column does not exist yet.
+//  // The sequence, constraints and indexes named after the column are renamed too.
+//  // Example: was:OldName
+//  was/renamed_from:previous field name
+//
+// Check constraints which are not bound to a single field can be declared by implementing the Checker interface.
+// They are named table_name_check. Check constraints are replaced when the expression changes
+// and dropped when they are no longer declared.
+//
+// Models which were renamed can declare their previous names by implementing the Renamer interface.
+// The table is renamed if it still uses a previous name, together with the sequences, constraints and indexes named after it.
+//
+// If History is set, every migration is recorded in the gondolier_migrations table,
+// including a hash of the data model, the executed statements and the duration.
+// If SkipUnchanged is set too, the migration is skipped when the hash of the data model
+// equals the hash of the last recorded migration.
+//
+// If Lock is set, a transaction level advisory lock is taken before the schema is read,
+// so that only one process migrates at a time and others wait for it to finish.
+// LockKey sets the key of the advisory lock, a default is used if it is zero.
+// LockTimeout sets how long to wait for the lock, no timeout is used if it is zero.
+//
+// If CockroachDB is set, the statements are adjusted for CockroachDB, which speaks the Postgres protocol
+// but does not support some of the statements used for Postgres.
+// The id tag uses unique_rowid() for bigint and gen_random_uuid() for uuid columns instead of a sequence.
+// Sequences are not owned by their column and dropped together with the table by DropTable.
+// Primary keys are not renamed together with their table or columns.
+// Column types are changed after the transaction was committed, as CockroachDB cannot change them
+// inside an explicit transaction. These statements are not recorded in the history
+// and are returned by Plan as statements with NoTransaction set.
+// Lock cannot be used, as CockroachDB does not support advisory locks.
+//
+// Tables are compared to the data model by the SchemaDiff.
+// The state of a migration is kept for each call, so that one Postgres migrator can be used by multiple Gondolier instances
+// and goroutines, as long as RegisterType is not called at the same time.
 type Postgres struct {
-	Schema      string
-	DropColumns bool
-	Log         bool
-
+	Schema        string
+	DropColumns   bool
+	Log           bool
+	History       bool
+	SkipUnchanged bool
+	Lock          bool
+	LockKey       int64
+	LockTimeout   time.Duration
+	CockroachDB   bool
+
+	types map[reflect.Type]string
+}
+
+// pgRun is the state of a single call of the Postgres migrator, like a migration or plan.
+// It implements the Dialect interface, the tables are compared to the catalog read by the call.
+type pgRun struct {
+	*Postgres
+
+	ctx       context.Context
+	db        *sql.DB
+	naming    NameSchema
 	tx        *sql.Tx
-	createSeq []string
-	alterSeq  []string
-	createFK  []string
-	dropFK    []string
-	alterPK   string
+	model     string
+	field     string
+	diff      *SchemaDiff
+	alterType []Statement
+	plan      *Plan
+	executed  *Plan
+	catalog   *pgCatalog
+}
+
+// pgForeignKey is a foreign key declared by a fk tag.
+type pgForeignKey struct {
+	refTable   string
+	refColumn  string
+	onDelete   string
+	onUpdate   string
+	deferrable bool
+	deferred   bool
+	notValid   bool
+}
+
+// pgColumnSpec is a column declared by the tags of a field.
+type pgColumnSpec struct {
+	columnType   string
+	notnull      bool
+	isId         bool
+	primaryKey   bool
+	unique       bool
+	defaultValue string
+	seq          string
+	fk           string
 }
 
 // Migrate migrates the given data model.
-func (m *Postgres) Migrate(metaModels []MetaModel) {
-	defer func() {
-		if r := recover(); r != nil {
-			m.tx.Rollback()
-			panic(r)
-		}
-	}()
-
-	tx, err := db.Begin()
+// The migration is rolled back if one of the statements fails or the context is canceled.
+func (m *Postgres) Migrate(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) error {
+	run := m.newRun(ctx, conn, schema)
+	tx, err := run.db.BeginTx(ctx, nil)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	m.tx = tx
+	run.tx = tx
 
-	// create or update table
-	for _, model := range metaModels {
-		m.migrate(&model)
-	}
-
-	// create foreign keys
-	for _, fk := range m.createFK {
-		m.exec(fk, true)
+	if err := run.lock(); err != nil {
+		tx.Rollback()
+		return err
 	}
 
-	// drop foreign keys
-	for _, fk := range m.dropFK {
-		m.exec(fk, true)
+	if err := run.migrateWithHistory(metaModels); err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	if err := tx.Commit(); err != nil {
-		panic(err)
+		return err
 	}
 
-	// reset
-	m.createFK = make([]string, 0)
-	m.dropFK = make([]string, 0)
+	return run.alterColumnTypes()
 }
 
-// DropTable drops the given table.
-func (m *Postgres) DropTable(name string) {
-	name = naming.Get(name)
-	m.exec(`DROP TABLE IF EXISTS "`+name+`"`, false)
-}
+// Plan returns the statements Migrate would execute for the given data model, without executing them.
+// The database is read to find the differences between the data model and the schema.
+func (m *Postgres) Plan(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) (*Plan, error) {
+	run := m.newRun(ctx, conn, schema)
+	plan := &Plan{make([]Statement, 0)}
+	run.plan = plan
+	catalog, err := run.loadCatalog()
 
-func (m *Postgres) migrate(model *MetaModel) {
-	if !m.tableExists(model.ModelName) {
-		m.createTable(model)
-	} else {
-		m.updateTable(model)
+	if err != nil {
+		return nil, err
+	}
+
+	run.catalog = catalog
+
+	if m.History && m.SkipUnchanged {
+		unchanged, err := run.modelsUnchanged(metaModels)
+
+		if err != nil {
+			return nil, err
+		}
 
-		if m.DropColumns {
-			m.dropColumns(model)
+		if unchanged {
+			return plan, nil
 		}
 	}
-}
 
-func (m *Postgres) tableExists(name string) bool {
-	name = naming.Get(name)
+	if err := run.migrateModels(metaModels); err != nil {
+		return nil, err
+	}
 
-	rows, err := db.Query(`SELECT EXISTS (SELECT 1
-	   FROM information_schema.tables
-	   WHERE table_schema = $1
-	   AND table_name = $2)`, m.Schema, name)
+	if err := run.alterColumnTypes(); err != nil {
+		return nil, err
+	}
 
-	return m.scanBool(rows, err)
+	return plan, nil
 }
 
-func (m *Postgres) columnExists(tableName, columnName string) bool {
-	tableName = naming.Get(tableName)
-	columnName = naming.Get(columnName)
+// RegisterType sets the database type for fields of the same Go type as given value, which have no type tag.
+// It overrides the default mapping or adds custom types.
+// Named types (like type Status string) use the type registered for their underlying type,
+// unless they are registered themselves.
+//
+// Example:
+//  postgres.RegisterType("", "varchar(255)")
+//  postgres.RegisterType(uuid.UUID{}, "uuid")
+func (m *Postgres) RegisterType(value interface{}, dbType string) {
+	m.types = registerType(m.types, value, dbType)
+}
 
-	rows, err := db.Query(`SELECT EXISTS (SELECT 1
-	   FROM information_schema.columns
-	   WHERE table_schema = $1
-	   AND table_name = $2
-	   AND column_name = $3)`, m.Schema, tableName, columnName)
+// DropTable drops the given table.
+func (m *Postgres) DropTable(ctx context.Context, conn *sql.DB, schema NameSchema, name string) error {
+	return m.newRun(ctx, conn, schema).dropTable(name)
+}
 
-	return m.scanBool(rows, err)
+// Returns the state of a new call of the migrator, so that calls do not share their connection, transaction and catalog.
+func (m *Postgres) newRun(ctx context.Context, conn *sql.DB, schema NameSchema) *pgRun {
+	return &pgRun{Postgres: m, ctx: ctx, db: conn, naming: schema}
 }
 
-func (m *Postgres) sequenceExists(name string) bool {
-	name = naming.Get(name)
+func (m *pgRun) dropTable(name string) error {
+	m.model, m.field = name, ""
+	name = m.naming.Get(name)
 
-	rows, err := db.Query(`SELECT EXISTS (SELECT 1
-	   FROM pg_class
-	   WHERE relkind = 'S'
-	   AND oid::regclass::text = quote_ident($1))`, name)
+	if !m.CockroachDB {
+		return m.exec(`DROP TABLE IF EXISTS "`+name+`"`, false)
+	}
 
-	return m.scanBool(rows, err)
-}
+	// sequences are not owned by the table on CockroachDB and must be dropped separately
+	catalog, err := m.loadCatalog()
 
-func (m *Postgres) foreignKeyExists(tableName, fkName string) bool {
-	tableName = naming.Get(tableName)
-	fkName = naming.Get(fkName)
+	if err != nil {
+		return err
+	}
 
-	rows, err := db.Query(`SELECT EXISTS (SELECT 1
-		FROM information_schema.table_constraints
-		WHERE table_schema = $1
-		AND constraint_name = $2
-		AND table_name = $3)`, m.Schema, fkName, tableName)
+	if err := m.exec(`DROP TABLE IF EXISTS "`+name+`"`, false); err != nil {
+		return err
+	}
 
-	return m.scanBool(rows, err)
+	for _, column := range catalog.tableColumns(name) {
+		seq := m.getSequenceName(name, column.Name)
+
+		if catalog.sequence(seq) != nil {
+			if err := m.exec(`DROP SEQUENCE IF EXISTS "`+seq+`"`, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
-func (m *Postgres) isNullable(tableName, columnName string) bool {
-	tableName = naming.Get(tableName)
-	columnName = naming.Get(columnName)
+// Takes the advisory lock, which is released when the transaction ends.
+func (m *pgRun) lock() error {
+	if !m.Lock {
+		return nil
+	}
 
-	rows, err := db.Query(`SELECT is_nullable::boolean
-		FROM information_schema.columns
-		WHERE table_schema = $1
-		AND column_name = $2
-		AND table_name = $3`, m.Schema, columnName, tableName)
+	if m.CockroachDB {
+		return errors.New("Advisory locks are not supported by CockroachDB")
+	}
 
-	return m.scanBool(rows, err)
-}
+	key := m.LockKey
 
-func (m *Postgres) constraintExists(name string) bool {
-	name = naming.Get(name)
+	if key == 0 {
+		key = pgLockKey
+	}
 
-	rows, err := db.Query(`SELECT EXISTS (SELECT 1
-		FROM pg_constraint WHERE conname = $1)`, name)
+	if m.LockTimeout > 0 {
+		if err := m.exec(pgLockTimeout(m.LockTimeout), true); err != nil {
+			return err
+		}
+	}
 
-	return m.scanBool(rows, err)
-}
+	query := `SELECT pg_advisory_xact_lock($1)`
 
-func (m *Postgres) scanBool(rows *sql.Rows, err error) bool {
-	if err != nil {
-		panic(err)
+	if m.Log {
+		log.Println(query)
 	}
 
-	var exists bool
-	rows.Next()
+	if _, err := m.tx.ExecContext(m.ctx, query, key); err != nil {
+		return &SQLError{Query: query, Err: err}
+	}
 
-	if err := rows.Scan(&exists); err != nil {
-		panic(err)
+	if m.LockTimeout > 0 {
+		return m.exec(`SET LOCAL lock_timeout TO DEFAULT`, true)
 	}
 
-	m.closeRows(rows)
-	return exists
+	return nil
 }
 
-func (m *Postgres) getColumnNames(tableName string) []string {
-	tableName = naming.Get(tableName)
-
-	rows, err := db.Query(`SELECT column_name
-		FROM information_schema.columns
-		WHERE table_schema = $1
-		AND table_name = $2`, m.Schema, tableName)
+func (m *pgRun) migrateWithHistory(metaModels []MetaModel) error {
+	if !m.History {
+		return m.migrateModels(metaModels)
+	}
 
-	if err != nil {
-		panic(err)
+	if err := m.createHistoryTable(); err != nil {
+		return err
 	}
 
-	names := make([]string, 0)
+	if m.SkipUnchanged {
+		unchanged, err := m.modelsUnchanged(metaModels)
+
+		if err != nil {
+			return err
+		}
 
-	for rows.Next() {
-		var name string
+		if unchanged {
+			if m.Log {
+				log.Println("Data model unchanged, skipping migration")
+			}
 
-		if err := rows.Scan(&name); err != nil {
-			panic(err)
+			return nil
 		}
+	}
+
+	start := time.Now()
+	m.executed = &Plan{make([]Statement, 0)}
 
-		names = append(names, name)
+	if err := m.migrateModels(metaModels); err != nil {
+		return err
 	}
 
-	m.closeRows(rows)
-	return names
+	return m.recordMigration(hashMetaModels(metaModels), time.Since(start))
 }
 
-func (m *Postgres) getColumnType(tableName, columnName string) string {
-	tableName = naming.Get(tableName)
-	columnName = naming.Get(columnName)
+func (m *pgRun) createHistoryTable() error {
+	m.model, m.field = "", ""
+	return m.exec(`CREATE TABLE IF NOT EXISTS "`+pgHistoryTable+`" (
+		"id" bigserial PRIMARY KEY,
+		"applied_at" timestamp with time zone NOT NULL DEFAULT now(),
+		"hash" character varying(64) NOT NULL,
+		"statements" text NOT NULL,
+		"duration_ms" bigint NOT NULL)`, true)
+}
 
-	rows, err := db.Query(`SELECT data_type FROM information_schema.columns
-		WHERE table_name = $1 AND column_name = $2`, tableName, columnName)
+func (m *pgRun) modelsUnchanged(metaModels []MetaModel) (bool, error) {
+	hash, err := m.getLastMigrationHash()
 
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 
-	var typeName string
-	rows.Next()
+	return hash == hashMetaModels(metaModels), nil
+}
 
-	if err := rows.Scan(&typeName); err != nil {
-		panic(err)
-	}
+// Returns the hash of the last recorded migration or an empty string if there is none.
+func (m *pgRun) getLastMigrationHash() (string, error) {
+	query := `SELECT "hash" FROM "` + pgHistoryTable + `" ORDER BY "id" DESC LIMIT 1`
+	var rows *sql.Rows
+	var err error
 
-	m.closeRows(rows)
-	return typeName
-}
+	// read within the transaction to see the table if it has just been created
+	if m.tx != nil {
+		rows, err = m.tx.QueryContext(m.ctx, query)
+	} else {
+		exists, existsErr := m.historyTableExists()
 
-func (m *Postgres) getConstraintName(name string) string {
-	name = naming.Get(name)
+		if existsErr != nil || !exists {
+			return "", existsErr
+		}
 
-	rows, err := db.Query(`SELECT conname
-		FROM pg_constraint WHERE conname LIKE $1`, name)
+		rows, err = m.db.QueryContext(m.ctx, query)
+	}
 
 	if err != nil {
-		panic(err)
+		return "", &SQLError{Query: query, Err: err}
 	}
 
-	var constraintName string
-	one := false
+	defer rows.Close()
+	var hash string
 
-	for rows.Next() {
-		if err := rows.Scan(&constraintName); err != nil {
-			panic(err)
+	if rows.Next() {
+		if err := rows.Scan(&hash); err != nil {
+			return "", err
 		}
+	}
 
-		if one {
-			panic("No distinct constraint found for name '" + name + "'")
-		}
+	return hash, rows.Err()
+}
+
+// Returns true if the history table exists. Its name is fixed and must not be passed through the naming schema.
+func (m *pgRun) historyTableExists() (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM "information_schema"."tables" WHERE "table_schema" = $1 AND "table_name" = $2)`
+	var exists bool
 
-		one = true
+	if err := m.db.QueryRowContext(m.ctx, query, m.Schema, pgHistoryTable).Scan(&exists); err != nil {
+		return false, &SQLError{Query: query, Err: err}
 	}
 
-	m.closeRows(rows)
-	return constraintName
+	return exists, nil
 }
 
-func (m *Postgres) closeRows(rows *sql.Rows) {
-	if err := rows.Close(); err != nil {
-		panic(err)
+func (m *pgRun) recordMigration(hash string, duration time.Duration) error {
+	query := `INSERT INTO "` + pgHistoryTable + `" ("hash", "statements", "duration_ms") VALUES ($1, $2, $3)`
+
+	if _, err := m.tx.ExecContext(m.ctx, query, hash, m.executed.String(), duration.Nanoseconds()/int64(time.Millisecond)); err != nil {
+		return &SQLError{Query: query, Err: err}
 	}
+
+	return nil
 }
 
-func (m *Postgres) createTable(model *MetaModel) {
-	name := naming.Get(model.ModelName)
-	sql := `CREATE TABLE IF NOT EXISTS "` + name + `" (` + m.getColumns(model) + `)`
+// DropTables drops the given tables after the foreign keys between them.
+func (m *Postgres) DropTables(ctx context.Context, conn *sql.DB, schema NameSchema, names []string) error {
+	run := m.newRun(ctx, conn, schema)
+	catalog, err := run.loadCatalog()
 
-	// create sequences if required
-	for _, seq := range m.createSeq {
-		m.exec(seq, true)
+	if err != nil {
+		return err
 	}
 
-	// create table
-	m.exec(sql, true)
+	for _, name := range names {
+		run.model, run.field = name, ""
+		tableName := run.naming.Get(name)
 
-	// alter sequence if required
-	for _, seq := range m.alterSeq {
-		m.exec(seq, true)
+		for _, fk := range catalog.tableConstraints(tableName, "f") {
+			if err := run.exec(`ALTER TABLE "`+tableName+`" DROP CONSTRAINT IF EXISTS "`+fk.Name+`"`, false); err != nil {
+				return err
+			}
+		}
 	}
 
-	// alter primary key if required
-	if m.alterPK != "" {
-		m.exec(m.alterPK, true)
+	for _, name := range names {
+		if err := run.dropTable(name); err != nil {
+			return err
+		}
 	}
 
-	// reset
-	m.createSeq = make([]string, 0)
-	m.alterSeq = make([]string, 0)
-	m.alterPK = ""
+	return nil
 }
 
-func (m *Postgres) updateTable(model *MetaModel) {
-	for _, field := range model.Fields {
-		if m.columnExists(model.ModelName, field.Name) {
-			// update existing column
-			m.updateColumn(model, &field)
-		} else {
-			// create new column
-			tableName := naming.Get(model.ModelName)
-			columnName := naming.Get(field.Name)
-			query := `ALTER TABLE "` + tableName + `" ADD COLUMN "` + columnName + `" ` + m.getTags(tableName, &field)
-			m.exec(query, true)
+func (m *pgRun) migrateModels(metaModels []MetaModel) error {
+	// read the schema once, the migration is compared to this snapshot
+	if m.catalog == nil {
+		catalog, err := m.loadCatalog()
+
+		if err != nil {
+			return err
 		}
+
+		m.catalog = catalog
 	}
-}
 
-func (m *Postgres) updateColumn(model *MetaModel, field *MetaField) {
-	tableName := naming.Get(model.ModelName)
-	columnName := naming.Get(field.Name)
-	notnull, isId, pk, unique := false, false, false, false
-	defaultValue, seq, fk := "", "", ""
+	m.diff = &SchemaDiff{Dialect: m, Naming: m.naming, DropColumns: m.DropColumns}
 
-	for _, tag := range field.Tags {
-		key := strings.ToLower(tag.Name)
-		value := strings.ToLower(tag.Value)
-
-		if key == "type" {
-			m.updateColumnType(tableName, columnName, value)
-		} else if value == "notnull" || value == "not null" {
-			notnull = true
-		} else if value == "null" {
-			notnull = false
-		} else if key == "default" {
-			defaultValue = value
-		} else if value == "id" {
-			notnull = true
-			isId = true
-			pk = true
-		} else if value == "pk" || value == "primary key" {
-			pk = true
-		} else if value == "unique" {
-			unique = true
-		} else if key == "seq" || key == "sequence" {
-			seq = value
-		} else if key == "fk" || key == "foreign key" {
-			fk = tag.Value
+	// create or update table
+	for _, model := range metaModels {
+		if err := m.migrate(&model); err != nil {
+			return err
 		}
 	}
 
-	m.updateColumnSeq(tableName, columnName, seq, isId)
-	m.updateColumnPK(tableName, columnName, pk)
-	m.updateColumnUnique(tableName, columnName, unique)
-	m.updateColumnNotNull(tableName, columnName, notnull)
-	m.updateColumnDefault(tableName, columnName, defaultValue, isId)
-	m.updateColumnFk(tableName, columnName, fk)
+	// create foreign keys after all tables, so that models referencing each other in a cycle can be created
+	return m.execOperations(m.diff.ForeignKeys())
 }
 
-func (m *Postgres) updateColumnType(tableName, columnName, newtype string) {
-	istype := m.getColumnType(tableName, columnName)
+// Changes the column types collected during the migration outside of the transaction.
+func (m *pgRun) alterColumnTypes() error {
+	for _, statement := range m.alterType {
+		m.model, m.field = statement.Model, statement.Field
 
-	if istype != newtype {
-		query := `ALTER TABLE "` + tableName + `" ALTER COLUMN "` + columnName + `"
-					TYPE ` + newtype
-		m.exec(query, true)
+		if err := m.exec(statement.Query, false); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
-func (m *Postgres) updateColumnNotNull(tableName, columnName string, notnull bool) {
-	query := `ALTER TABLE "` + tableName + `" ALTER COLUMN "` + columnName + `"`
+func (m *pgRun) migrate(model *MetaModel) error {
+	m.model, m.field = model.ModelName, ""
 
-	if notnull {
-		query += " SET NOT NULL"
-	} else {
-		query += " DROP NOT NULL"
+	// create, rename or update the table, foreign keys are created after all tables
+	ops, err := m.diff.Model(model)
+
+	if err != nil {
+		return err
 	}
 
-	m.exec(query, true)
+	return m.execOperations(ops)
 }
 
-func (m *Postgres) updateColumnDefault(tableName, columnName, value string, isId bool) {
-	query := ""
+// Executes the statements of given operations found by the schema diff.
+func (m *pgRun) execOperations(ops []Operation) error {
+	for _, op := range ops {
+		source := op.Origin()
+		m.model, m.field = source.Model, source.Field
+		queries, err := m.SQL(op)
 
-	if value != "" || isId {
-		// set default
-		if isId {
-			m.addSequence(tableName, columnName, "1,1,-,-,1")
-			m.exec(m.createSeq[0], true)
-			m.exec(m.alterSeq[0], true)
-			m.createSeq = make([]string, 0)
-			m.alterSeq = make([]string, 0)
-			query = `ALTER TABLE "` + tableName + `" ALTER COLUMN "` + columnName + `" SET DEFAULT nextval('` + m.getSequenceName(tableName, columnName) + `'::regclass)`
-		} else {
-			if value == "nextval(seq)" {
-				value = "nextval('" + m.getSequenceName(tableName, columnName) + "'::regclass)"
+		if err != nil {
+			return err
+		}
+
+		for _, query := range queries {
+			// CockroachDB cannot change column types inside an explicit transaction
+			if _, ok := op.(*AlterColumnType); ok && m.CockroachDB {
+				m.alterType = append(m.alterType, Statement{m.model, m.field, query, true})
+				continue
 			}
 
-			query = `ALTER TABLE "` + tableName + `" ALTER COLUMN "` + columnName + `" SET DEFAULT ` + value
+			if err := m.exec(query, true); err != nil {
+				return err
+			}
+		}
+
+		// the tables migrated later are compared to the catalog, which must reflect the renaming
+		if len(queries) > 0 {
+			m.catalog.rename(op)
 		}
-	} else {
-		// drop default
-		query = `ALTER TABLE "` + tableName + `" ALTER COLUMN "` + columnName + `" DROP DEFAULT`
 	}
 
-	m.exec(query, true)
+	return nil
 }
 
-func (m *Postgres) updateColumnPK(tableName, columnName string, pk bool) {
-	pkName := m.getPrimaryKeyName(tableName, columnName)
+// Returns the column declared by the tags of given field.
+func (m *pgRun) getColumnSpec(field *MetaField) (*pgColumnSpec, error) {
+	columnType, notnull, err := m.getFieldType(field)
 
-	if !pk && m.constraintExists(pkName) {
-		m.exec(`ALTER TABLE "`+tableName+`" DROP CONSTRAINT IF EXISTS "`+pkName+`"`, true)
-	} else if pk && !m.constraintExists(pkName) {
-		m.exec(`ALTER TABLE "`+tableName+`" ADD PRIMARY KEY ("`+columnName+`")`, true)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (m *Postgres) updateColumnUnique(tableName, columnName string, unique bool) {
-	query := ""
-	constraintName := m.getUniqueName(tableName, columnName)
+	spec := &pgColumnSpec{columnType: columnType, notnull: notnull}
 
-	if unique && !m.constraintExists(constraintName) {
-		query = `ALTER TABLE "` + tableName + `" ADD CONSTRAINT "` + constraintName + `" UNIQUE ("` + columnName + `")`
-	} else if !unique && m.constraintExists(constraintName) {
-		query = `ALTER TABLE "` + tableName + `" DROP CONSTRAINT IF EXISTS "` + constraintName + `"`
-	}
-
-	m.exec(query, true)
-}
+	for _, tag := range field.Tags {
+		key := strings.ToLower(tag.Name)
+		value := strings.ToLower(tag.Value)
 
-func (m *Postgres) updateColumnSeq(tableName, columnName, seq string, isId bool) {
-	if isId {
-		return
+		if key == "type" || key == "index" || value == "index" || key == "check" || key == "was" || key == "renamed_from" {
+			// the type was read already, indexes and check constraints are created for the table and columns renamed before
+			continue
+		} else if value == "notnull" || value == "not null" {
+			spec.notnull = true
+		} else if value == "null" {
+			spec.notnull = false
+		} else if key == "default" {
+			spec.defaultValue = value
+		} else if value == "id" {
+			spec.notnull = true
+			spec.isId = true
+		} else if value == "pk" || value == "primary key" {
+			// primary keys cannot be null
+			spec.notnull = true
+			spec.primaryKey = true
+		} else if value == "unique" {
+			spec.unique = true
+		} else if key == "seq" || key == "sequence" {
+			spec.seq = value
+		} else if key == "fk" || key == "foreign key" {
+			// value must be case sensitive here
+			spec.fk = tag.Value
+		} else {
+			return nil, unknownTag(m.model, field.Name, key, value)
+		}
 	}
 
-	seqName := m.getSequenceName(tableName, columnName)
-
-	if seq != "" && !m.sequenceExists(seqName) {
-		// create sequence
-		m.addSequence(tableName, columnName, seq)
-		m.exec(m.createSeq[0], true)
-		m.exec(m.alterSeq[0], true)
-		m.createSeq = make([]string, 0)
-		m.alterSeq = make([]string, 0)
-	} else if seq == "" && m.sequenceExists(seqName) {
-		// drop sequence
-		query := `DROP SEQUENCE IF EXISTS "` + seqName + `" CASCADE`
-		m.exec(query, true)
-	}
+	return spec, nil
 }
 
-func (m *Postgres) updateColumnFk(tableName, columnName, fk string) {
-	// read existing fk
-	refTableName, refColumnName := m.getForeignKeyInfo(tableName, fk)
-	fkName := m.getForeignKeyName(tableName, columnName, refTableName, refColumnName)
-	existingFk := m.getConstraintName(tableName + "_" + columnName + "_%_fk")
+// Parses the seq tag value for a column of given table.
+func (m *pgRun) getSequenceSpec(tableName, info string) (*SequenceSpec, error) {
+	infos := strings.Split(info, ",")
 
-	if fkName != existingFk {
-		// drop on change or when it was removed if exists
-		if existingFk != "" {
-			m.dropFK = append(m.dropFK, `ALTER TABLE "`+tableName+`" DROP CONSTRAINT IF EXISTS "`+existingFk+`"`)
-		}
+	if len(infos) != 5 {
+		return nil, &TagError{m.model,
+			m.field,
+			"seq:" + info,
+			"Five arguments must be specified for seq in model '" + tableName + "': start, increment, min, max, cache"}
+	}
 
-		// create new
-		if fk != "" {
-			m.addForeignKey(tableName, columnName, fk)
+	for i := range infos {
+		if infos[i] == "-" {
+			infos[i] = ""
 		}
 	}
+
+	return &SequenceSpec{infos[0], infos[1], infos[2], infos[3], infos[4]}, nil
 }
 
-// Drops all columns that are no longer needed.
-func (m *Postgres) dropColumns(model *MetaModel) {
-	tableName := naming.Get(model.ModelName)
-	columns := m.getColumnNames(model.ModelName)
+func (m *pgRun) quoteColumns(columns []string) string {
+	return `"` + strings.Join(columns, `", "`) + `"`
+}
 
-	for _, column := range columns {
-		if !m.fieldsContainsColumn(model.Fields, column) {
-			query := `ALTER TABLE "` + tableName + `"
-				DROP COLUMN IF EXISTS "` + column + `"`
-			m.exec(query, true)
-		}
-	}
+// Returns the database type of given field and whether the column must be not null.
+func (m *pgRun) getFieldType(field *MetaField) (string, bool, error) {
+	return getFieldType(m.model, field, m.types, pgTypes, true)
 }
 
-func (m *Postgres) fieldsContainsColumn(fields []MetaField, column string) bool {
-	for _, field := range fields {
-		if naming.Get(field.Name) == column {
-			return true
-		}
+// Returns the function generating ids for given column type on CockroachDB.
+func (m *pgRun) getCockroachIdDefault(columnType string) (string, error) {
+	switch pgNormalizeType(columnType) {
+	case "bigint":
+		return "unique_rowid()", nil
+	case "uuid":
+		return "gen_random_uuid()", nil
 	}
 
-	return false
+	return "", &ModelError{m.model, m.field, "The id of CockroachDB must be of type bigint or uuid, but was '" + columnType + "'"}
 }
 
-func (m *Postgres) getColumns(model *MetaModel) string {
-	columns := ""
+// Normalizes an SQL expression to compare it with the expression returned by Postgres,
+// which adds parentheses and casts and rewrites IN lists.
+// String literals are kept as they are, except for numbers, which Postgres quotes and casts if they are negative.
+func pgNormalizeExpr(expr string) string {
+	var normalized strings.Builder
+	start := 0
 
-	for _, field := range model.Fields {
-		columns += `"` + naming.Get(field.Name) + `" ` + m.getTags(model.ModelName, &field) + `,`
-	}
+	for start < len(expr) {
+		i := strings.IndexByte(expr[start:], '\'')
 
-	return columns[:len(columns)-1]
-}
+		if i == -1 {
+			normalized.WriteString(pgNormalizeCode(expr[start:]))
+			break
+		}
 
-func (m *Postgres) getTags(modelName string, field *MetaField) string {
-	tags := make([]string, 5)
+		i += start
+		end := pgLiteralEnd(expr, i)
+		literal := expr[i:end]
 
-	for _, tag := range field.Tags {
-		key := strings.ToLower(tag.Name)
-		value := strings.ToLower(tag.Value)
-		m.buildTag(tags, modelName, key, value, field, tag)
-	}
-
-	return strings.Join(tags, " ")
-}
-
-func (m *Postgres) buildTag(tags []string, modelName, key, value string, field *MetaField, tag MetaTag) {
-	if key == "type" {
-		tags[0] = tag.Value
-	} else if key == "default" {
-		tags[1] = m.buildDefaultTag(modelName, value, field.Name)
-	} else if value == "notnull" || value == "not null" {
-		tags[2] = "NOT NULL"
-	} else if value == "null" {
-		tags[2] = "NULL"
-	} else if key == "seq" || key == "sequence" {
-		m.addSequence(modelName, field.Name, value)
-	} else if value == "id" {
-		// id is a shortcut for seq + default + pk
-		tags[1], tags[3] = m.buildIdTag(modelName, field.Name)
-	} else if value == "pk" || value == "primary key" {
-		tags[3] = "PRIMARY KEY"
-		m.alterPrimaryKey(modelName, field.Name)
-	} else if value == "unique" {
-		tags[4] = "UNIQUE"
-	} else if key == "fk" || key == "foreign key" {
-		// value must be case sensitive here
-		m.addForeignKey(modelName, field.Name, tag.Value)
-	} else {
-		m.panicUnknownTag(modelName, key, value)
+		if pgExprNumber.MatchString(literal) {
+			literal = strings.Trim(literal, "'")
+		}
+
+		normalized.WriteString(pgNormalizeCode(expr[start:i]))
+		normalized.WriteString(literal)
+		start = end
 	}
+
+	return normalized.String()
 }
 
-func (m *Postgres) buildDefaultTag(modelName, value, fieldName string) string {
-	query := "DEFAULT "
+// Returns the index after the string literal starting at given index. Quotes are escaped by doubling them.
+func pgLiteralEnd(expr string, start int) int {
+	for i := start + 1; i < len(expr); i++ {
+		if expr[i] != '\'' {
+			continue
+		}
 
-	if value == "nextval(seq)" {
-		query += "nextval('" + m.getSequenceName(modelName, fieldName) + "'::regclass)"
-	} else {
-		query += value
+		if i+1 < len(expr) && expr[i+1] == '\'' {
+			i++
+			continue
+		}
+
+		return i + 1
 	}
 
-	return query
+	return len(expr)
 }
 
-func (m *Postgres) buildIdTag(modelName, fieldName string) (string, string) {
-	m.addSequence(modelName, fieldName, "1,1,-,-,1")
-	tag1 := "DEFAULT nextval('" + m.getSequenceName(modelName, fieldName) + "'::regclass)"
-	tag3 := "PRIMARY KEY"
-	m.alterPrimaryKey(modelName, fieldName)
-	return tag1, tag3
+// Normalizes the part of an expression between string literals.
+func pgNormalizeCode(code string) string {
+	code = strings.ToLower(code)
+	code = pgExprCast.ReplaceAllString(code, "")
+	code = pgExprSpace.ReplaceAllString(code, "")
+	code = strings.Replace(code, "!=", "<>", -1)
+	code = strings.Replace(code, "<>allarray[", "notin", -1)
+	code = strings.Replace(code, "=anyarray[", "in", -1)
+	return strings.Replace(code, "]", "", -1)
 }
 
-func (m *Postgres) panicUnknownTag(modelName, key, value string) {
-	name := ""
-
-	if key == "" {
-		name = value
-	} else {
-		name = key + ":" + value
-	}
-
-	panic("Unknown tag '" + name + "' for model '" + modelName + "'")
+// Returns the statement setting the lock timeout for the transaction.
+// The timeout is rounded up to full milliseconds, as zero would disable it.
+func pgLockTimeout(timeout time.Duration) string {
+	ms := (timeout.Nanoseconds() + int64(time.Millisecond) - 1) / int64(time.Millisecond)
+	return `SET LOCAL lock_timeout = '` + strconv.FormatInt(ms, 10) + `ms'`
 }
 
-func (m *Postgres) addSequence(modelName, columnName, info string) {
-	// create sequence
-	infos := strings.Split(info, ",")
+// Normalizes a Postgres type name to the form returned by format_type, resolving aliases
+// like int4 or varchar(255), so that types can be compared.
+func pgNormalizeType(t string) string {
+	t = strings.ToLower(strings.TrimSpace(t))
+	array := ""
 
-	if len(infos) != 5 {
-		panic("Five arguments must be specified for seq in model '" + modelName + "': start, increment, min, max, cache")
+	// the number of dimensions and size of arrays is not enforced by Postgres
+	if pgTypeArray.MatchString(t) {
+		t = pgTypeArray.ReplaceAllString(t, "")
+		array = "[]"
 	}
 
-	name := m.getSequenceName(modelName, columnName)
-	seq := `CREATE SEQUENCE IF NOT EXISTS "` + name + `"
-		START WITH ` + infos[0] + `
-		INCREMENT BY ` + infos[1]
+	parts := pgTypeParts.FindStringSubmatch(t)
 
-	if infos[2] == "-" {
-		seq += " NO MINVALUE"
-	} else {
-		seq += " MINVALUE " + infos[2]
+	if parts == nil {
+		return strings.Join(strings.Fields(t), " ") + array
 	}
 
-	if infos[3] == "-" {
-		seq += " NO MAXVALUE"
-	} else {
-		seq += " MAXVALUE " + infos[3]
+	name := strings.Join(strings.Fields(parts[1]), " ")
+	modifier := strings.Join(strings.Fields(parts[2]), "")
+	zone := strings.Join(strings.Fields(parts[4]), " ")
+
+	if alias, ok := pgTypeAliases[name]; ok {
+		name = alias
 	}
 
-	if infos[4] != "-" {
-		seq += " CACHE " + infos[4]
+	switch name {
+	case "timestamptz", "timetz":
+		name = strings.TrimSuffix(name, "tz")
+		zone = "with time zone"
+	case "double precision":
+		// float(p) is real up to a precision of 24 bits
+		if modifier != "" {
+			if p, err := strconv.Atoi(strings.Trim(modifier, "()")); err == nil && p <= 24 {
+				name = "real"
+			}
+
+			modifier = ""
+		}
+	case "character", "bit":
+		if modifier == "" {
+			modifier = "(1)"
+		}
 	}
 
-	m.createSeq = append(m.createSeq, seq)
+	if name == "timestamp" || name == "time" {
+		if zone == "" {
+			zone = "without time zone"
+		}
 
-	// create owned by table
-	modelName = naming.Get(modelName)
-	columnName = naming.Get(columnName)
-	alterSeq := `ALTER SEQUENCE "` + name + `"
-		OWNED BY "` + modelName + `"."` + columnName + `"`
-	m.alterSeq = append(m.alterSeq, alterSeq)
-}
+		return name + modifier + " " + zone + array
+	}
 
-func (m *Postgres) alterPrimaryKey(modelName, columnName string) {
-	tableName := naming.Get(modelName)
-	m.alterPK = `ALTER TABLE "` + tableName + `"
-		RENAME CONSTRAINT "` + tableName + `_pkey"
-		TO "` + m.getPrimaryKeyName(modelName, columnName) + `"`
-}
+	if zone != "" {
+		return name + modifier + " " + zone + array
+	}
 
-func (m *Postgres) getSequenceName(modelName, columnName string) string {
-	modelName = naming.Get(modelName)
-	columnName = naming.Get(columnName)
-	return modelName + "_" + columnName + "_seq"
+	return name + modifier + array
 }
 
-func (m *Postgres) addForeignKey(modelName, columnName, info string) {
-	refTableName, refColumnName := m.getForeignKeyInfo(modelName, info)
-	tableName := naming.Get(modelName)
-	columnName = naming.Get(columnName)
-	fkName := m.getForeignKeyName(modelName, columnName, refTableName, refColumnName)
-	alterFk := `ALTER TABLE "` + tableName + `"
-		ADD CONSTRAINT "` + fkName + `"
-		FOREIGN KEY ("` + columnName + `")
-		REFERENCES "` + refTableName + `"("` + refColumnName + `")`
-	m.createFK = append(m.createFK, alterFk)
+func (m *pgRun) getSequenceName(modelName, columnName string) string {
+	modelName = m.naming.Get(modelName)
+	columnName = m.naming.Get(columnName)
+	return modelName + "_" + columnName + "_seq"
 }
 
-func (m *Postgres) getForeignKeyInfo(modelName, info string) (string, string) {
+// Parses the fk tag value. Returns nil if the value is empty.
+func (m *pgRun) getForeignKeyInfo(modelName, info string) (*pgForeignKey, error) {
 	if info == "" {
-		return "", ""
+		return nil, nil
 	}
 
-	infos := strings.Split(info, ".")
+	options := strings.Split(info, ",")
+	infos := strings.Split(strings.TrimSpace(options[0]), ".")
 
 	if len(infos) != 2 {
-		panic("Two arguments must be specified for fk in model '" + modelName + "': ReferencedModel.ReferencedAttribute")
+		return nil, &TagError{m.model,
+			m.field,
+			"fk:" + info,
+			"Two arguments must be specified for fk in model '" + modelName + "': ReferencedModel.ReferencedAttribute"}
+	}
+
+	fk := &pgForeignKey{refTable: m.naming.Get(infos[0]),
+		refColumn: m.naming.Get(infos[1]),
+		onDelete:  "no action",
+		onUpdate:  "no action"}
+
+	for _, option := range options[1:] {
+		option = strings.Join(strings.Fields(strings.ToLower(option)), " ")
+		var err error
+
+		if strings.HasPrefix(option, "ondelete:") {
+			fk.onDelete, err = m.getForeignKeyAction(modelName, info, option[len("ondelete:"):])
+		} else if strings.HasPrefix(option, "onupdate:") {
+			fk.onUpdate, err = m.getForeignKeyAction(modelName, info, option[len("onupdate:"):])
+		} else if option == "deferrable" {
+			fk.deferrable = true
+		} else if option == "deferred" {
+			fk.deferrable = true
+			fk.deferred = true
+		} else if option == "notvalid" || option == "not valid" {
+			fk.notValid = true
+		} else {
+			err = &TagError{m.model, m.field, "fk:" + info, "Unknown option '" + option + "' for fk in model '" + modelName + "'"}
+		}
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return naming.Get(infos[0]), naming.Get(infos[1])
+	return fk, nil
 }
 
-func (m *Postgres) getForeignKeyName(modelName, columnName, refObjName, refColumnName string) string {
-	modelName = naming.Get(modelName)
-	refObjName = naming.Get(refObjName)
-	refColumnName = naming.Get(refColumnName)
-	return modelName + "_" + columnName + "_" + refObjName + "_" + refColumnName + "_fk"
+func (m *pgRun) getForeignKeyAction(modelName, info, action string) (string, error) {
+	action = strings.TrimSpace(action)
+
+	if _, ok := pgFkActions[action]; !ok {
+		return "", &TagError{m.model,
+			m.field,
+			"fk:" + info,
+			"Unknown action '" + action + "' for fk in model '" + modelName + "': cascade, set null, set default, restrict or no action"}
+	}
+
+	return action, nil
 }
 
-func (m *Postgres) getPrimaryKeyName(modelName, columnName string) string {
-	modelName = naming.Get(modelName)
-	columnName = naming.Get(columnName)
-	return modelName + "_" + columnName + "_pkey"
+func (m *pgRun) getForeignKeyName(modelName, columnName, refObjName, refColumnName string) string {
+	modelName = m.naming.Get(modelName)
+	refObjName = m.naming.Get(refObjName)
+	refColumnName = m.naming.Get(refColumnName)
+	return modelName + "_" + columnName + "_" + refObjName + "_" + refColumnName + "_fk"
 }
 
-func (m *Postgres) getUniqueName(modelName, columnName string) string {
-	modelName = naming.Get(modelName)
-	columnName = naming.Get(columnName)
-	return modelName + "_" + columnName + "_key"
+func (m *pgRun) query(query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := m.db.QueryContext(m.ctx, query, args...)
+
+	if err != nil {
+		return nil, &SQLError{m.model, m.field, query, err}
+	}
+
+	return rows, nil
 }
 
-func (m *Postgres) exec(query string, tx bool) {
+func (m *pgRun) exec(query string, tx bool) error {
+	if query == "" {
+		return nil
+	}
+
+	if m.plan != nil && !tx {
+		m.plan.addNoTransaction(m.model, m.field, query)
+		return nil
+	} else if m.plan != nil {
+		m.plan.add(m.model, m.field, query)
+		return nil
+	}
+
 	if m.Log {
 		log.Println(query)
 	}
 
+	var err error
+
 	if tx {
-		if _, err := m.tx.Exec(query); err != nil {
-			panic(err)
+		if m.tx == nil {
+			return errors.New("No transaction was started to execute statement")
 		}
+
+		_, err = m.tx.ExecContext(m.ctx, query)
 	} else {
-		if _, err := db.Exec(query); err != nil {
-			panic(err)
-		}
+		_, err = m.db.ExecContext(m.ctx, query)
 	}
+
+	if err != nil {
+		return &SQLError{m.model, m.field, query, err}
+	}
+
+	if m.executed != nil && tx {
+		m.executed.add(m.model, m.field, query)
+	}
+
+	return nil
 }
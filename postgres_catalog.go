@@ -0,0 +1,350 @@
+package gondolier
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// pgCatalogQuery reads all tables, columns, constraints, sequences and indexes of a schema as one JSON document,
+// so that the schema can be compared to the data model in one round trip.
+const pgCatalogQuery = `SELECT json_build_object(
+	'tables', COALESCE((SELECT json_agg(t.relname ORDER BY t.relname)
+		FROM pg_class t
+		JOIN pg_namespace s ON s.oid = t.relnamespace
+		WHERE s.nspname = $1
+		AND t.relkind IN ('r', 'p')), '[]'),
+	'columns', COALESCE((SELECT json_agg(json_build_object('table', t.relname,
+			'name', a.attname,
+			'type', format_type(a.atttypid, a.atttypmod),
+			'notnull', a.attnotnull,
+			'default', COALESCE(pg_get_expr(d.adbin, d.adrelid), '')) ORDER BY t.relname, a.attnum)
+		FROM pg_attribute a
+		JOIN pg_class t ON t.oid = a.attrelid
+		JOIN pg_namespace s ON s.oid = t.relnamespace
+		LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+		WHERE s.nspname = $1
+		AND t.relkind IN ('r', 'p')
+		AND a.attnum > 0
+		AND NOT a.attisdropped), '[]'),
+	'constraints', COALESCE((SELECT json_agg(json_build_object('table', t.relname,
+			'name', c.conname,
+			'type', c.contype,
+			'columns', COALESCE((SELECT json_agg(a.attname ORDER BY k.n)
+				FROM unnest(c.conkey) WITH ORDINALITY AS k(attnum, n)
+				JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum), '[]'),
+			'definition', pg_get_constraintdef(c.oid),
+			'ref_table', COALESCE(r.relname, ''),
+			'ref_columns', COALESCE((SELECT json_agg(a.attname ORDER BY k.n)
+				FROM unnest(c.confkey) WITH ORDINALITY AS k(attnum, n)
+				JOIN pg_attribute a ON a.attrelid = c.confrelid AND a.attnum = k.attnum), '[]'),
+			'on_delete', c.confdeltype,
+			'on_update', c.confupdtype,
+			'deferrable', c.condeferrable,
+			'deferred', c.condeferred) ORDER BY t.relname, c.conname)
+		FROM pg_constraint c
+		JOIN pg_class t ON t.oid = c.conrelid
+		JOIN pg_namespace s ON s.oid = t.relnamespace
+		LEFT JOIN pg_class r ON r.oid = c.confrelid
+		WHERE s.nspname = $1), '[]'),
+	'sequences', COALESCE((SELECT json_agg(json_build_object('name', q.relname,
+			'start', p.seqstart,
+			'increment', p.seqincrement,
+			'min', p.seqmin,
+			'max', p.seqmax,
+			'cache', p.seqcache) ORDER BY q.relname)
+		FROM pg_class q
+		JOIN pg_namespace s ON s.oid = q.relnamespace
+		JOIN pg_sequence p ON p.seqrelid = q.oid
+		WHERE s.nspname = $1
+		AND q.relkind = 'S'), '[]'),
+	'indexes', COALESCE((SELECT json_agg(json_build_object('table', t.relname,
+			'name', i.relname,
+			'unique', ix.indisunique,
+			'method', am.amname,
+			'columns', COALESCE((SELECT json_agg(a.attname ORDER BY k.n)
+				FROM unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, n)
+				JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum), '[]'),
+			'where', COALESCE(pg_get_expr(ix.indpred, ix.indrelid), '')) ORDER BY t.relname, i.relname)
+		FROM pg_index ix
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_namespace s ON s.oid = t.relnamespace
+		JOIN pg_am am ON am.oid = i.relam
+		WHERE s.nspname = $1
+		AND NOT EXISTS (SELECT 1 FROM pg_constraint c WHERE c.contype IN ('p', 'u', 'x') AND c.conindid = ix.indexrelid)), '[]'))`
+
+// pgCatalog is a snapshot of the tables, columns, constraints, sequences and indexes of a schema.
+type pgCatalog struct {
+	Tables      []string         `json:"tables"`
+	Columns     []pgColumn       `json:"columns"`
+	Constraints []pgConstraint   `json:"constraints"`
+	Sequences   []pgSequence     `json:"sequences"`
+	Indexes     []pgCatalogIndex `json:"indexes"`
+
+	tables      map[string]bool
+	columns     map[string]*pgColumn
+	constraints map[string]*pgConstraint
+	sequences   map[string]*pgSequence
+}
+
+// pgColumn is a column read from the catalog.
+type pgColumn struct {
+	Table   string `json:"table"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	NotNull bool   `json:"notnull"`
+	Default string `json:"default"`
+}
+
+// pgConstraint is a constraint read from the catalog.
+// Type is p for primary keys, u for unique, f for foreign keys and c for check constraints.
+// The referenced table and columns and the referential actions are set for foreign keys only.
+type pgConstraint struct {
+	Table      string   `json:"table"`
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Columns    []string `json:"columns"`
+	Definition string   `json:"definition"`
+	RefTable   string   `json:"ref_table"`
+	RefColumns []string `json:"ref_columns"`
+	OnDelete   string   `json:"on_delete"`
+	OnUpdate   string   `json:"on_update"`
+	Deferrable bool     `json:"deferrable"`
+	Deferred   bool     `json:"deferred"`
+}
+
+// pgSequence is a sequence read from the catalog.
+type pgSequence struct {
+	Name      string `json:"name"`
+	Start     int64  `json:"start"`
+	Increment int64  `json:"increment"`
+	Min       int64  `json:"min"`
+	Max       int64  `json:"max"`
+	Cache     int64  `json:"cache"`
+}
+
+// pgCatalogIndex is an index read from the catalog, which does not back a constraint.
+type pgCatalogIndex struct {
+	Table   string   `json:"table"`
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Method  string   `json:"method"`
+	Columns []string `json:"columns"`
+	Where   string   `json:"where"`
+}
+
+// Returns the catalog read at the beginning of the migration.
+// The catalog is read on each call outside of a migration.
+func (m *pgRun) getCatalog() (*pgCatalog, error) {
+	if m.catalog != nil {
+		return m.catalog, nil
+	}
+
+	return m.loadCatalog()
+}
+
+func (m *pgRun) loadCatalog() (*pgCatalog, error) {
+	rows, err := m.query(pgCatalogQuery, m.Schema)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	var data []byte
+
+	if rows.Next() {
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	catalog := new(pgCatalog)
+
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, err
+	}
+
+	catalog.index()
+	return catalog, nil
+}
+
+// Builds the lookup maps after the catalog was read.
+func (c *pgCatalog) index() {
+	c.tables = make(map[string]bool)
+	c.columns = make(map[string]*pgColumn)
+	c.constraints = make(map[string]*pgConstraint)
+	c.sequences = make(map[string]*pgSequence)
+
+	for _, table := range c.Tables {
+		c.tables[table] = true
+	}
+
+	for i := range c.Columns {
+		c.columns[c.Columns[i].Table+"."+c.Columns[i].Name] = &c.Columns[i]
+	}
+
+	for i := range c.Constraints {
+		c.constraints[c.Constraints[i].Name] = &c.Constraints[i]
+	}
+
+	for i := range c.Sequences {
+		c.sequences[c.Sequences[i].Name] = &c.Sequences[i]
+	}
+}
+
+func (c *pgCatalog) table(name string) bool {
+	return c.tables[name]
+}
+
+// Returns the column or nil if it does not exist.
+func (c *pgCatalog) column(tableName, name string) *pgColumn {
+	return c.columns[tableName+"."+name]
+}
+
+// Returns all columns of given table in order.
+func (c *pgCatalog) tableColumns(tableName string) []pgColumn {
+	columns := make([]pgColumn, 0)
+
+	for _, column := range c.Columns {
+		if column.Table == tableName {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// Returns the constraint or nil if it does not exist.
+func (c *pgCatalog) constraint(name string) *pgConstraint {
+	return c.constraints[name]
+}
+
+// Returns the constraints of given type for given table, ordered by name.
+func (c *pgCatalog) tableConstraints(tableName, constraintType string) []pgConstraint {
+	constraints := make([]pgConstraint, 0)
+
+	for _, constraint := range c.Constraints {
+		if constraint.Table == tableName && constraint.Type == constraintType {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	return constraints
+}
+
+// Returns the sequence or nil if it does not exist.
+func (c *pgCatalog) sequence(name string) *pgSequence {
+	return c.sequences[name]
+}
+
+// Returns the indexes of given table, ordered by name.
+func (c *pgCatalog) tableIndexes(tableName string) []pgCatalogIndex {
+	indexes := make([]pgCatalogIndex, 0)
+
+	for _, index := range c.Indexes {
+		if index.Table == tableName {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return indexes
+}
+
+// Updates the catalog after given operation renamed a table, column, sequence, constraint or index.
+// Other operations do not change the catalog.
+func (c *pgCatalog) rename(op Operation) {
+	switch op := op.(type) {
+	case *RenameTable:
+		c.renameTable(op.Table, op.Name)
+	case *RenameColumn:
+		c.renameColumn(op.Table, op.Column, op.Name)
+	case *RenameSequence:
+		c.renameSequence(op.Name, op.NewName)
+	case *RenameConstraint:
+		if constraint := c.constraint(op.Name); constraint != nil {
+			constraint.Name = op.NewName
+		}
+	case *RenameIndex:
+		for i := range c.Indexes {
+			if c.Indexes[i].Name == op.Name {
+				c.Indexes[i].Name = op.NewName
+			}
+		}
+	default:
+		return
+	}
+
+	c.index()
+}
+
+func (c *pgCatalog) renameTable(oldName, newName string) {
+	c.Tables = replaceString(c.Tables, oldName, newName)
+
+	for i := range c.Columns {
+		if c.Columns[i].Table == oldName {
+			c.Columns[i].Table = newName
+		}
+	}
+
+	for i := range c.Constraints {
+		constraint := &c.Constraints[i]
+
+		if constraint.Table == oldName {
+			constraint.Table = newName
+		}
+
+		if constraint.RefTable == oldName {
+			constraint.RefTable = newName
+		}
+	}
+
+	for i := range c.Indexes {
+		if c.Indexes[i].Table == oldName {
+			c.Indexes[i].Table = newName
+		}
+	}
+}
+
+func (c *pgCatalog) renameColumn(tableName, oldName, newName string) {
+	for i := range c.Columns {
+		if c.Columns[i].Table == tableName && c.Columns[i].Name == oldName {
+			c.Columns[i].Name = newName
+		}
+	}
+
+	for i := range c.Constraints {
+		constraint := &c.Constraints[i]
+
+		if constraint.Table == tableName {
+			constraint.Columns = replaceString(constraint.Columns, oldName, newName)
+		}
+
+		if constraint.RefTable == tableName {
+			constraint.RefColumns = replaceString(constraint.RefColumns, oldName, newName)
+		}
+	}
+
+	for i := range c.Indexes {
+		if c.Indexes[i].Table == tableName {
+			c.Indexes[i].Columns = replaceString(c.Indexes[i].Columns, oldName, newName)
+		}
+	}
+}
+
+// Renames the sequence and updates the defaults using it.
+func (c *pgCatalog) renameSequence(oldName, newName string) {
+	for i := range c.Sequences {
+		if c.Sequences[i].Name == oldName {
+			c.Sequences[i].Name = newName
+		}
+	}
+
+	for i := range c.Columns {
+		c.Columns[i].Default = strings.Replace(c.Columns[i].Default, "'"+oldName+"'", "'"+newName+"'", -1)
+	}
+}
@@ -0,0 +1,173 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/lib/pq"
+	"sync/atomic"
+	"testing"
+)
+
+var (
+	testQueries int64
+)
+
+func init() {
+	sql.Register("postgres-counting", &testCountingDriver{})
+}
+
+// testCountingDriver wraps the Postgres driver to count the queries sent to the database.
+type testCountingDriver struct{}
+
+type testCountingConn struct {
+	driver.Conn
+}
+
+func (d *testCountingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := pq.Open(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &testCountingConn{conn}, nil
+}
+
+func (c *testCountingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	atomic.AddInt64(&testQueries, 1)
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c *testCountingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c *testCountingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func TestPostgresCatalogLookup(t *testing.T) {
+	catalog := &pgCatalog{Tables: []string{"a", "b"},
+		Columns: []pgColumn{{Table: "a", Name: "id", Type: "bigint", NotNull: true},
+			{Table: "b", Name: "id", Type: "bigint"},
+			{Table: "b", Name: "a", Type: "bigint"}},
+		Constraints: []pgConstraint{{Table: "a", Name: "a_id_pkey", Type: "p", Columns: []string{"id"}},
+			{Table: "b", Name: "b_a_a_id_fk", Type: "f", Columns: []string{"a"}, RefTable: "a", RefColumns: []string{"id"}}},
+		Sequences: []pgSequence{{Name: "a_id_seq", Start: 1, Increment: 1, Min: 1, Max: 9223372036854775807, Cache: 1}},
+		Indexes:   []pgCatalogIndex{{Table: "b", Name: "b_a_idx", Method: "btree", Columns: []string{"a"}}}}
+	catalog.index()
+
+	if !catalog.table("a") || catalog.table("c") {
+		t.Fatal("Table lookup not as expected")
+	}
+
+	if catalog.column("a", "id") == nil || !catalog.column("a", "id").NotNull || catalog.column("a", "a") != nil {
+		t.Fatal("Column lookup not as expected")
+	}
+
+	if len(catalog.tableColumns("b")) != 2 || catalog.tableColumns("b")[1].Name != "a" {
+		t.Fatal("Columns of table must be returned in order")
+	}
+
+	if catalog.constraint("b_a_a_id_fk") == nil || catalog.constraint("b_a_a_id_fk").RefTable != "a" {
+		t.Fatal("Constraint lookup not as expected")
+	}
+
+	if len(catalog.tableConstraints("a", "p")) != 1 || len(catalog.tableConstraints("a", "f")) != 0 {
+		t.Fatal("Constraints of table not as expected")
+	}
+
+	if catalog.sequence("a_id_seq") == nil || catalog.sequence("b_id_seq") != nil || len(catalog.tableIndexes("b")) != 1 || len(catalog.tableIndexes("a")) != 0 {
+		t.Fatal("Sequence or index lookup not as expected")
+	}
+}
+
+func TestPostgresCatalog(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresCatalog ---")
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testUser{}, testPost{}, testPicture{}, testArticle{}, testIndex{})
+	Migrate()
+	catalog, err := postgres.newRun(context.Background(), testdb, &SnakeCase{}).loadCatalog()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !catalog.table("test_post") || catalog.column("test_post", "post") == nil || catalog.sequence("test_post_id_seq") == nil {
+		t.Fatal("Catalog must contain tables, columns and sequences")
+	}
+
+	fk := catalog.constraint("test_post_user_test_user_id_fk")
+
+	if fk == nil || fk.Type != "f" || fk.RefTable != "test_user" || len(fk.RefColumns) != 1 || fk.RefColumns[0] != "id" || fk.OnDelete != "a" {
+		t.Fatalf("Catalog must contain foreign keys, but was: %v", fk)
+	}
+
+	if len(catalog.tableIndexes("test_index")) != 4 {
+		t.Fatalf("Catalog must contain indexes not backing a constraint, but was: %v", catalog.tableIndexes("test_index"))
+	}
+}
+
+func TestPostgresCatalogQueries(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresCatalogQueries ---")
+
+	db, err := sql.Open("postgres-counting", testGetDbString())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer db.Close()
+	g := New(db, &Postgres{Schema: "public"})
+	g.Model(testUser{}, testPost{}, testPicture{}, testArticle{}, testIndex{}, testCheck{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	g.Model(testUser{}, testPost{}, testPicture{}, testArticle{}, testIndex{}, testCheck{})
+	atomic.StoreInt64(&testQueries, 0)
+
+	if _, err := g.Plan(); err != nil {
+		t.Fatal(err)
+	}
+
+	if queries := atomic.LoadInt64(&testQueries); queries != 1 {
+		t.Fatalf("The schema must be read in one query, but was: %v", queries)
+	}
+}
+
+func BenchmarkPostgresPlan(b *testing.B) {
+	testCleanDb()
+	db, err := sql.Open("postgres-counting", testGetDbString())
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer db.Close()
+	g := New(db, &Postgres{Schema: "public"})
+	models := []interface{}{testUser{}, testPost{}, testPicture{}, testArticle{}, testIndex{}, testCheck{}}
+	g.Model(models...)
+
+	if err := g.MigrateE(); err != nil {
+		b.Fatal(err)
+	}
+
+	g.Model(models...)
+	atomic.StoreInt64(&testQueries, 0)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Plan(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(atomic.LoadInt64(&testQueries))/float64(b.N), "queries/op")
+}
@@ -0,0 +1,325 @@
+package gondolier
+
+import (
+	"strings"
+)
+
+// Table returns the current state of given table or nil if it does not exist.
+// It implements the Dialect interface and reads the catalog of the running migration.
+func (m *pgRun) Table(name string) (*TableState, error) {
+	catalog, err := m.getCatalog()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !catalog.table(name) {
+		return nil, nil
+	}
+
+	table := &TableState{Name: name}
+
+	for _, column := range catalog.tableColumns(name) {
+		table.Columns = append(table.Columns, ColumnState{column.Name, column.Type, column.NotNull, column.Default})
+
+		if seq := m.getSequenceName(name, column.Name); catalog.sequence(seq) != nil {
+			table.Sequences = append(table.Sequences, seq)
+		}
+	}
+
+	constraintTypes := map[string]ConstraintType{"p": ConstraintPrimaryKey, "u": ConstraintUnique, "f": ConstraintForeignKey, "c": ConstraintCheck}
+
+	for _, constraint := range catalog.Constraints {
+		constraintType, ok := constraintTypes[constraint.Type]
+
+		if !ok || constraint.Table != name {
+			continue
+		}
+
+		state := ConstraintState{Name: constraint.Name,
+			Type:       constraintType,
+			Columns:    constraint.Columns,
+			RefTable:   constraint.RefTable,
+			RefColumns: constraint.RefColumns,
+			OnDelete:   pgFkAction(constraint.OnDelete),
+			OnUpdate:   pgFkAction(constraint.OnUpdate),
+			Deferrable: constraint.Deferrable,
+			Deferred:   constraint.Deferred}
+
+		// the definition looks like: CHECK ((expression)) [NOT VALID]
+		if constraintType == ConstraintCheck {
+			state.Expression = strings.TrimSuffix(strings.TrimPrefix(constraint.Definition, "CHECK "), " NOT VALID")
+		}
+
+		table.Constraints = append(table.Constraints, state)
+	}
+
+	for _, index := range catalog.tableIndexes(name) {
+		table.Indexes = append(table.Indexes, IndexState{index.Name, index.Columns, index.Unique, index.Method, index.Where})
+	}
+
+	return table, nil
+}
+
+// Column returns the column declared by the tags of given field for a table.
+// It implements the Dialect interface.
+func (m *pgRun) Column(tableName string, field *MetaField) (*ColumnSpec, error) {
+	m.field = field.Name
+	spec, err := m.getColumnSpec(field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fk, err := m.getForeignKeyInfo(tableName, spec.fk)
+
+	if err != nil {
+		return nil, err
+	}
+
+	column := &ColumnSpec{Name: m.naming.Get(field.Name),
+		Type:       strings.ToLower(spec.columnType),
+		NotNull:    spec.notnull,
+		PrimaryKey: spec.primaryKey,
+		Id:         spec.isId,
+		Unique:     spec.unique,
+		Default:    spec.defaultValue}
+
+	if spec.isId && m.CockroachDB {
+		// ids are generated by a function on CockroachDB instead of a sequence
+		column.Default, err = m.getCockroachIdDefault(spec.columnType)
+
+		if err != nil {
+			return nil, err
+		}
+	} else if spec.isId {
+		column.Sequence = &SequenceSpec{Start: "1", Increment: "1", Cache: "1"}
+	}
+
+	if spec.seq != "" {
+		if column.Sequence, err = m.getSequenceSpec(tableName, spec.seq); err != nil {
+			return nil, err
+		}
+	}
+
+	if column.Sequence != nil || spec.defaultValue == "nextval(seq)" {
+		column.Default = "nextval('" + m.getSequenceName(tableName, field.Name) + "'::regclass)"
+	}
+
+	if fk != nil {
+		column.ForeignKey = &ForeignKeySpec{RefTable: fk.refTable,
+			RefColumn:  fk.refColumn,
+			OnDelete:   fk.onDelete,
+			OnUpdate:   fk.onUpdate,
+			Deferrable: fk.deferrable,
+			Deferred:   fk.deferred,
+			NotValid:   fk.notValid}
+	}
+
+	return column, nil
+}
+
+// Indexes returns the indexes declared by the index tags of given model for a table.
+// It implements the Dialect interface.
+func (m *pgRun) Indexes(tableName string, model *MetaModel) ([]IndexSpec, error) {
+	indexes, err := getTagIndexes(model, m.naming, pgIndexSupport)
+
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]IndexSpec, 0, len(indexes))
+
+	for _, index := range indexes {
+		specs = append(specs, IndexSpec{index.name, index.field, index.columns, index.unique, index.method, index.where})
+	}
+
+	return specs, nil
+}
+
+// NormalizeType returns given type in the form used by Postgres.
+// It implements the Dialect interface.
+func (m *pgRun) NormalizeType(columnType string) string {
+	return pgNormalizeType(columnType)
+}
+
+// NormalizeExpr returns given expression in the form used by Postgres.
+// It implements the Dialect interface.
+func (m *pgRun) NormalizeExpr(expr string) string {
+	return pgNormalizeExpr(expr)
+}
+
+// SQL returns the statements for given operation.
+// It implements the Dialect interface.
+func (m *pgRun) SQL(op Operation) ([]string, error) {
+	switch op := op.(type) {
+	case *CreateTable:
+		columns := make([]string, 0, len(op.Columns)+1)
+
+		for i := range op.Columns {
+			columns = append(columns, `"`+op.Columns[i].Name+`" `+m.getColumnDefinition(&op.Columns[i]))
+		}
+
+		if op.PrimaryKey != "" {
+			columns = append(columns, `CONSTRAINT "`+op.PrimaryKey+`" PRIMARY KEY (`+m.quoteColumns(op.PrimaryKeyColumns)+`)`)
+		}
+
+		return []string{`CREATE TABLE IF NOT EXISTS "` + op.Table + `" (` + strings.Join(columns, ",") + `)`}, nil
+	case *AddColumn:
+		return []string{`ALTER TABLE "` + op.Table + `" ADD COLUMN "` + op.Column.Name + `" ` + m.getColumnDefinition(&op.Column)}, nil
+	case *DropColumn:
+		return []string{`ALTER TABLE "` + op.Table + `"
+			DROP COLUMN IF EXISTS "` + op.Column + `"`}, nil
+	case *AlterColumnType:
+		return []string{`ALTER TABLE "` + op.Table + `" ALTER COLUMN "` + op.Column + `"
+			TYPE ` + op.Type}, nil
+	case *AlterColumnNotNull:
+		query := `ALTER TABLE "` + op.Table + `" ALTER COLUMN "` + op.Column + `"`
+
+		if op.NotNull {
+			return []string{query + " SET NOT NULL"}, nil
+		}
+
+		return []string{query + " DROP NOT NULL"}, nil
+	case *AlterColumnDefault:
+		query := `ALTER TABLE "` + op.Table + `" ALTER COLUMN "` + op.Column + `"`
+
+		if op.Default == "" {
+			return []string{query + " DROP DEFAULT"}, nil
+		}
+
+		return []string{query + " SET DEFAULT " + op.Default}, nil
+	case *AddPrimaryKey:
+		return []string{`ALTER TABLE "` + op.Table + `" ADD CONSTRAINT "` + op.Name + `"
+			PRIMARY KEY (` + m.quoteColumns(op.Columns) + `)`}, nil
+	case *AddUnique:
+		return []string{`ALTER TABLE "` + op.Table + `" ADD CONSTRAINT "` + op.Name + `" UNIQUE ("` + op.Column + `")`}, nil
+	case *AddForeignKey:
+		return []string{m.getCreateForeignKey(op)}, nil
+	case *AddCheck:
+		return []string{`ALTER TABLE "` + op.Table + `" ADD CONSTRAINT "` + op.Name + `" CHECK (` + op.Expression + `)`}, nil
+	case *DropConstraint:
+		return []string{`ALTER TABLE "` + op.Table + `" DROP CONSTRAINT IF EXISTS "` + op.Name + `"`}, nil
+	case *CreateSequence:
+		return []string{m.getCreateSequence(op.Name, &op.Sequence)}, nil
+	case *AlterSequenceOwner:
+		// CockroachDB does not support sequences owned by a column
+		if m.CockroachDB {
+			return nil, nil
+		}
+
+		return []string{`ALTER SEQUENCE "` + op.Name + `"
+		OWNED BY "` + op.Table + `"."` + op.Column + `"`}, nil
+	case *DropSequence:
+		return []string{`DROP SEQUENCE IF EXISTS "` + op.Name + `" CASCADE`}, nil
+	case *CreateIndex:
+		return []string{m.getCreateIndex(op.Table, &op.Index)}, nil
+	case *DropIndex:
+		return []string{`DROP INDEX IF EXISTS "` + op.Name + `"`}, nil
+	case *RenameTable:
+		return []string{`ALTER TABLE "` + op.Table + `" RENAME TO "` + op.Name + `"`}, nil
+	case *RenameColumn:
+		return []string{`ALTER TABLE "` + op.Table + `" RENAME COLUMN "` + op.Column + `" TO "` + op.Name + `"`}, nil
+	case *RenameConstraint:
+		// CockroachDB cannot rename primary keys, they keep their name
+		if m.CockroachDB && op.Type == ConstraintPrimaryKey {
+			return nil, nil
+		}
+
+		return []string{`ALTER TABLE "` + op.Table + `" RENAME CONSTRAINT "` + op.Name + `" TO "` + op.NewName + `"`}, nil
+	case *RenameSequence:
+		return []string{`ALTER SEQUENCE "` + op.Name + `" RENAME TO "` + op.NewName + `"`}, nil
+	case *RenameIndex:
+		return []string{`ALTER INDEX "` + op.Name + `" RENAME TO "` + op.NewName + `"`}, nil
+	}
+
+	return nil, &ModelError{m.model, m.field, "Unknown operation"}
+}
+
+// Returns the type, default and constraints of given column.
+func (m *pgRun) getColumnDefinition(column *ColumnSpec) string {
+	definition := column.Type
+
+	if column.Default != "" {
+		definition += " DEFAULT " + column.Default
+	}
+
+	if column.NotNull {
+		definition += " NOT NULL"
+	}
+
+	if column.Unique {
+		definition += " UNIQUE"
+	}
+
+	return definition
+}
+
+func (m *pgRun) getCreateSequence(name string, seq *SequenceSpec) string {
+	query := `CREATE SEQUENCE IF NOT EXISTS "` + name + `"
+		START WITH ` + seq.Start + `
+		INCREMENT BY ` + seq.Increment
+
+	if seq.Min == "" {
+		query += " NO MINVALUE"
+	} else {
+		query += " MINVALUE " + seq.Min
+	}
+
+	if seq.Max == "" {
+		query += " NO MAXVALUE"
+	} else {
+		query += " MAXVALUE " + seq.Max
+	}
+
+	if seq.Cache != "" {
+		query += " CACHE " + seq.Cache
+	}
+
+	return query
+}
+
+func (m *pgRun) getCreateIndex(tableName string, index *IndexSpec) string {
+	query := "CREATE "
+
+	if index.Unique {
+		query += "UNIQUE "
+	}
+
+	query += `INDEX IF NOT EXISTS "` + index.Name + `" ON "` + tableName + `"
+		USING ` + index.Method + ` (` + m.quoteColumns(index.Columns) + `)`
+
+	if index.Where != "" {
+		query += " WHERE " + index.Where
+	}
+
+	return query
+}
+
+func (m *pgRun) getCreateForeignKey(op *AddForeignKey) string {
+	fk := op.ForeignKey
+	query := `ALTER TABLE "` + op.Table + `"
+		ADD CONSTRAINT "` + op.Name + `"
+		FOREIGN KEY ("` + op.Column + `")
+		REFERENCES "` + fk.RefTable + `"("` + fk.RefColumn + `")`
+
+	if fk.OnDelete != "no action" {
+		query += " ON DELETE " + strings.ToUpper(fk.OnDelete)
+	}
+
+	if fk.OnUpdate != "no action" {
+		query += " ON UPDATE " + strings.ToUpper(fk.OnUpdate)
+	}
+
+	if fk.Deferred {
+		query += " DEFERRABLE INITIALLY DEFERRED"
+	} else if fk.Deferrable {
+		query += " DEFERRABLE INITIALLY IMMEDIATE"
+	}
+
+	if fk.NotValid {
+		query += " NOT VALID"
+	}
+
+	return query
+}
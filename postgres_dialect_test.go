@@ -0,0 +1,161 @@
+package gondolier
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPostgresDialectTable(t *testing.T) {
+	catalog := &pgCatalog{Tables: []string{"a"},
+		Columns: []pgColumn{{Table: "a", Name: "id", Type: "bigint", NotNull: true}},
+		Constraints: []pgConstraint{{Table: "a", Name: "a_id_pkey", Type: "p", Columns: []string{"id"}},
+			{Table: "a", Name: "a_id_check", Type: "c", Columns: []string{"id"}, Definition: "CHECK ((id > 0)) NOT VALID"},
+			{Table: "a", Name: "a_id_b_id_fk", Type: "f", Columns: []string{"id"}, RefTable: "b", RefColumns: []string{"id"}, OnDelete: "c", OnUpdate: "a", Deferrable: true}},
+		Sequences: []pgSequence{{Name: "a_id_seq"}, {Name: "b_id_seq"}},
+		Indexes:   []pgCatalogIndex{{Table: "a", Name: "a_id_idx", Method: "btree", Columns: []string{"id"}}}}
+	catalog.index()
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}, catalog: catalog}
+	table, err := postgres.Table("a")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(table.Columns) != 1 || len(table.Constraints) != 3 ||
+		table.Constraints[0].Type != ConstraintPrimaryKey ||
+		table.Constraints[1].Type != ConstraintCheck ||
+		table.Constraints[1].Expression != "((id > 0))" ||
+		table.Constraints[2].Type != ConstraintForeignKey ||
+		table.Constraints[2].OnDelete != "cascade" ||
+		table.Constraints[2].OnUpdate != "no action" ||
+		!table.Constraints[2].Deferrable ||
+		strings.Join(table.Sequences, ",") != "a_id_seq" ||
+		len(table.Indexes) != 1 || table.Indexes[0].Method != "btree" {
+		t.Fatalf("Table not as expected: %v", table)
+	}
+
+	if table, err := postgres.Table("b"); table != nil || err != nil {
+		t.Fatalf("Table must not exist, but was: %v %v", table, err)
+	}
+}
+
+func TestPostgresDialectColumn(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	field := MetaField{Name: "Id", Tags: []MetaTag{{"type", "BIGINT"}, {"", "id"}}}
+	column, err := postgres.Column("a", &field)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if column.Name != "id" || column.Type != "bigint" || !column.Id || !column.NotNull ||
+		column.Default != "nextval('a_id_seq'::regclass)" ||
+		column.Sequence == nil || *column.Sequence != (SequenceSpec{Start: "1", Increment: "1", Cache: "1"}) {
+		t.Fatalf("Column not as expected: %v", column)
+	}
+
+	seq := MetaField{Name: "Number", Tags: []MetaTag{{"type", "integer"}, {"seq", "10,2,-,100,-"}, {"default", "nextval(seq)"}}}
+	column, err = postgres.Column("a", &seq)
+
+	if err != nil || column.Default != "nextval('a_number_seq'::regclass)" ||
+		*column.Sequence != (SequenceSpec{Start: "10", Increment: "2", Max: "100"}) {
+		t.Fatalf("Sequence not as expected: %v %v", column, err)
+	}
+
+	seq.Tags[1].Value = "1,1"
+
+	if _, err := postgres.Column("a", &seq); err == nil {
+		t.Fatal("Sequence with missing arguments must return an error")
+	}
+
+	postgres.CockroachDB = true
+	column, err = postgres.Column("a", &field)
+
+	if err != nil || column.Default != "unique_rowid()" || column.Sequence != nil {
+		t.Fatalf("Id must use unique_rowid(), but was: %v %v", column, err)
+	}
+}
+
+func TestPostgresDialectSQL(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	input := []Operation{&AlterColumnNotNull{Table: "a", Column: "b", NotNull: true},
+		&AlterColumnDefault{Table: "a", Column: "b"},
+		&AddUnique{Table: "a", Name: "a_b_key", Column: "b"},
+		&DropConstraint{Table: "a", Name: "a_b_key", Type: ConstraintUnique},
+		&AddForeignKey{Table: "a", Name: "a_b_c_id_fk", Column: "b",
+			ForeignKey: ForeignKeySpec{RefTable: "c", RefColumn: "id", OnDelete: "set null", OnUpdate: "no action", Deferred: true}}}
+	expected := []string{`ALTER TABLE "a" ALTER COLUMN "b" SET NOT NULL`,
+		`ALTER TABLE "a" ALTER COLUMN "b" DROP DEFAULT`,
+		`ALTER TABLE "a" ADD CONSTRAINT "a_b_key" UNIQUE ("b")`,
+		`ALTER TABLE "a" DROP CONSTRAINT IF EXISTS "a_b_key"`,
+		`ALTER TABLE "a"
+		ADD CONSTRAINT "a_b_c_id_fk"
+		FOREIGN KEY ("b")
+		REFERENCES "c"("id") ON DELETE SET NULL DEFERRABLE INITIALLY DEFERRED`}
+	testPostgresDialectSQL(t, postgres, input, expected)
+	postgres.CockroachDB = true
+
+	if queries, err := postgres.SQL(&AlterSequenceOwner{Table: "a", Column: "id", Name: "a_id_seq"}); err != nil || len(queries) != 0 {
+		t.Fatalf("Sequences must not be owned on CockroachDB, but was: %v %v", queries, err)
+	}
+}
+
+func TestPostgresDialectCreateTableSQL(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	columns := []ColumnSpec{{Name: "id", Type: "bigint", NotNull: true, Id: true, Default: "nextval('a_id_seq'::regclass)"},
+		{Name: "name", Type: "varchar(255)", Unique: true, Default: "'none'"}}
+	input := []Operation{&CreateSequence{Table: "a", Column: "id", Name: "a_id_seq", Sequence: SequenceSpec{Start: "1", Increment: "1", Cache: "1"}},
+		&CreateTable{Table: "a", Columns: columns, PrimaryKey: "a_pkey", PrimaryKeyColumns: []string{"id"}},
+		&AlterSequenceOwner{Table: "a", Column: "id", Name: "a_id_seq"},
+		&AddColumn{Table: "a", Column: ColumnSpec{Name: "age", Type: "integer", NotNull: true}},
+		&AddCheck{Table: "a", Name: "a_age_check", Expression: "age >= 0"},
+		&CreateIndex{Table: "a", Index: IndexSpec{Name: "a_name_idx", Columns: []string{"name", "age"}, Unique: true, Method: "btree", Where: "age > 0"}},
+		&DropSequence{Table: "a", Name: "a_id_seq"}}
+	expected := []string{`CREATE SEQUENCE IF NOT EXISTS "a_id_seq"
+		START WITH 1
+		INCREMENT BY 1 NO MINVALUE NO MAXVALUE CACHE 1`,
+		`CREATE TABLE IF NOT EXISTS "a" ("id" bigint DEFAULT nextval('a_id_seq'::regclass) NOT NULL,` +
+			`"name" varchar(255) DEFAULT 'none' UNIQUE,CONSTRAINT "a_pkey" PRIMARY KEY ("id"))`,
+		`ALTER SEQUENCE "a_id_seq"
+		OWNED BY "a"."id"`,
+		`ALTER TABLE "a" ADD COLUMN "age" integer NOT NULL`,
+		`ALTER TABLE "a" ADD CONSTRAINT "a_age_check" CHECK (age >= 0)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "a_name_idx" ON "a"
+		USING btree ("name", "age") WHERE age > 0`,
+		`DROP SEQUENCE IF EXISTS "a_id_seq" CASCADE`}
+	testPostgresDialectSQL(t, postgres, input, expected)
+}
+
+func TestPostgresDialectRenameSQL(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	input := []Operation{&RenameTable{Table: "a", Name: "b"},
+		&RenameColumn{Table: "b", Column: "id", Name: "key"},
+		&RenameSequence{Table: "b", Name: "a_id_seq", NewName: "b_key_seq"},
+		&RenameConstraint{Table: "b", Name: "a_id_pkey", NewName: "b_key_pkey", Type: ConstraintPrimaryKey},
+		&RenameIndex{Table: "b", Name: "a_id_idx", NewName: "b_key_idx"}}
+	expected := []string{`ALTER TABLE "a" RENAME TO "b"`,
+		`ALTER TABLE "b" RENAME COLUMN "id" TO "key"`,
+		`ALTER SEQUENCE "a_id_seq" RENAME TO "b_key_seq"`,
+		`ALTER TABLE "b" RENAME CONSTRAINT "a_id_pkey" TO "b_key_pkey"`,
+		`ALTER INDEX "a_id_idx" RENAME TO "b_key_idx"`}
+	testPostgresDialectSQL(t, postgres, input, expected)
+	postgres.CockroachDB = true
+
+	if queries, err := postgres.SQL(input[3]); err != nil || len(queries) != 0 {
+		t.Fatalf("Primary keys must not be renamed on CockroachDB, but was: %v %v", queries, err)
+	}
+}
+
+func testPostgresDialectSQL(t *testing.T, postgres *pgRun, input []Operation, expected []string) {
+	for i, op := range input {
+		queries, err := postgres.SQL(op)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(queries) != 1 || queries[0] != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], queries)
+		}
+	}
+}
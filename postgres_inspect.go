@@ -0,0 +1,187 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	pgGoTypes = map[string]reflect.Type{"bigint": reflect.TypeOf(int64(0)),
+		"integer":                     reflect.TypeOf(int32(0)),
+		"smallint":                    reflect.TypeOf(int16(0)),
+		"boolean":                     reflect.TypeOf(false),
+		"real":                        reflect.TypeOf(float32(0)),
+		"double precision":            reflect.TypeOf(float64(0)),
+		"numeric":                     reflect.TypeOf(float64(0)),
+		"bytea":                       reflect.TypeOf([]byte{}),
+		"date":                        reflect.TypeOf(time.Time{}),
+		"timestamp with time zone":    reflect.TypeOf(time.Time{}),
+		"timestamp without time zone": reflect.TypeOf(time.Time{}),
+		"time with time zone":         reflect.TypeOf(time.Time{}),
+		"time without time zone":      reflect.TypeOf(time.Time{})}
+)
+
+// Inspect reads all tables of the schema into models, except the history table.
+// The models, fields and references in fk tags use the names of the database.
+// Each field has the tags to create the column: type, pk, seq, default, notnull, unique and fk.
+// The type of each field is the Go type for the column, which is a pointer if the column is nullable.
+func (m *Postgres) Inspect(ctx context.Context, conn *sql.DB, schema NameSchema) ([]MetaModel, error) {
+	run := m.newRun(ctx, conn, schema)
+	catalog, err := run.loadCatalog()
+
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]MetaModel, 0, len(catalog.Tables))
+
+	for _, table := range catalog.Tables {
+		if table != pgHistoryTable {
+			models = append(models, run.inspectTable(catalog, table))
+		}
+	}
+
+	return models, nil
+}
+
+func (m *pgRun) inspectTable(catalog *pgCatalog, tableName string) MetaModel {
+	model := MetaModel{ModelName: tableName, Fields: make([]MetaField, 0)}
+	pkColumns := make([]string, 0)
+
+	if pk := catalog.tableConstraints(tableName, "p"); len(pk) > 0 {
+		pkColumns = pk[0].Columns
+	}
+
+	for _, column := range catalog.tableColumns(tableName) {
+		model.Fields = append(model.Fields, MetaField{Name: column.Name,
+			Tags: m.inspectColumn(catalog, &column, pkColumns),
+			Type: pgGoType(column.Type, column.NotNull)})
+	}
+
+	return model
+}
+
+func (m *pgRun) inspectColumn(catalog *pgCatalog, column *pgColumn, pkColumns []string) []MetaTag {
+	tags := []MetaTag{{"type", column.Type}}
+
+	if containsString(pkColumns, column.Name) {
+		tags = append(tags, MetaTag{"", "pk"})
+	}
+
+	// sequences named like the ones created by Gondolier are declared using seq
+	seqName := column.Table + "_" + column.Name + "_seq"
+
+	if seq := catalog.sequence(seqName); seq != nil &&
+		strings.HasPrefix(column.Default, "nextval(") &&
+		strings.Contains(column.Default, seqName) {
+		tags = append(tags, MetaTag{"seq", pgSequenceTag(seq)}, MetaTag{"default", "nextval(seq)"})
+	} else if column.Default != "" {
+		tags = append(tags, MetaTag{"default", column.Default})
+	}
+
+	if column.NotNull {
+		tags = append(tags, MetaTag{"", "notnull"})
+	}
+
+	for _, constraint := range catalog.tableConstraints(column.Table, "u") {
+		if len(constraint.Columns) == 1 && constraint.Columns[0] == column.Name {
+			tags = append(tags, MetaTag{"", "unique"})
+			break
+		}
+	}
+
+	for _, constraint := range catalog.tableConstraints(column.Table, "f") {
+		if len(constraint.Columns) == 1 && constraint.Columns[0] == column.Name && len(constraint.RefColumns) == 1 {
+			tags = append(tags, MetaTag{"fk", pgForeignKeyTag(&constraint)})
+			break
+		}
+	}
+
+	return tags
+}
+
+// Returns the Go type for given column type. Unknown types are mapped to string.
+// Nullable columns are mapped to pointers, except for slices.
+func pgGoType(columnType string, notnull bool) reflect.Type {
+	columnType = pgNormalizeType(columnType)
+	array := strings.HasSuffix(columnType, "[]")
+	columnType = strings.TrimSuffix(columnType, "[]")
+
+	// remove modifiers like in character varying(255) or timestamp(3) with time zone
+	if i := strings.Index(columnType, "("); i > -1 {
+		columnType = columnType[:i] + columnType[strings.Index(columnType, ")")+1:]
+	}
+
+	t, ok := pgGoTypes[columnType]
+
+	if !ok {
+		t = reflect.TypeOf("")
+	}
+
+	if array {
+		return reflect.SliceOf(t)
+	}
+
+	if !notnull && t.Kind() != reflect.Slice {
+		return reflect.PtrTo(t)
+	}
+
+	return t
+}
+
+// Returns the seq tag value for given sequence, using - for default min and max values.
+func pgSequenceTag(seq *pgSequence) string {
+	min := strconv.FormatInt(seq.Min, 10)
+	max := strconv.FormatInt(seq.Max, 10)
+
+	if (seq.Increment > 0 && seq.Min == 1) || (seq.Increment < 0 && seq.Min == math.MinInt64) {
+		min = "-"
+	}
+
+	if (seq.Increment > 0 && seq.Max == math.MaxInt64) || (seq.Increment < 0 && seq.Max == -1) {
+		max = "-"
+	}
+
+	return strconv.FormatInt(seq.Start, 10) + "," +
+		strconv.FormatInt(seq.Increment, 10) + "," +
+		min + "," +
+		max + "," +
+		strconv.FormatInt(seq.Cache, 10)
+}
+
+// Returns the fk tag value for given foreign key, including referential actions and deferrability if set.
+func pgForeignKeyTag(fk *pgConstraint) string {
+	tag := fk.RefTable + "." + fk.RefColumns[0]
+
+	if action := pgFkAction(fk.OnDelete); action != "" && action != "no action" {
+		tag += ",ondelete:" + action
+	}
+
+	if action := pgFkAction(fk.OnUpdate); action != "" && action != "no action" {
+		tag += ",onupdate:" + action
+	}
+
+	if fk.Deferred {
+		tag += ",deferred"
+	} else if fk.Deferrable {
+		tag += ",deferrable"
+	}
+
+	return tag
+}
+
+// Returns the referential action for given code used in the catalog or an empty string if it is unknown.
+func pgFkAction(code string) string {
+	for action, actionCode := range pgFkActions {
+		if actionCode == code {
+			return action
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,144 @@
+package gondolier
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPostgresInspectTable(t *testing.T) {
+	catalog := &pgCatalog{Tables: []string{"post", "user"},
+		Columns: []pgColumn{{Table: "post", Name: "id", Type: "bigint", NotNull: true, Default: "nextval('post_id_seq'::regclass)"},
+			{Table: "post", Name: "title", Type: "character varying(255)", NotNull: true, Default: "'untitled'::character varying"},
+			{Table: "post", Name: "user", Type: "bigint"}},
+		Constraints: []pgConstraint{{Table: "post", Name: "post_id_pkey", Type: "p", Columns: []string{"id"}},
+			{Table: "post", Name: "post_title_key", Type: "u", Columns: []string{"title"}},
+			{Table: "post", Name: "post_user_user_id_fk", Type: "f", Columns: []string{"user"}, RefTable: "user", RefColumns: []string{"id"}, OnDelete: "c", OnUpdate: "a", Deferrable: true, Deferred: true}},
+		Sequences: []pgSequence{{Name: "post_id_seq", Start: 1, Increment: 1, Min: 1, Max: 9223372036854775807, Cache: 1}}}
+	catalog.index()
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	model := postgres.inspectTable(catalog, "post")
+
+	if model.ModelName != "post" || len(model.Fields) != 3 {
+		t.Fatalf("Model not as expected: %v", model)
+	}
+
+	expected := []string{"type:bigint;pk;seq:1,1,-,-,1;default:nextval(seq);notnull",
+		"type:character varying(255);default:'untitled'::character varying;notnull;unique",
+		"type:bigint;fk:user.id,ondelete:cascade,deferred"}
+
+	for i, field := range model.Fields {
+		if tag := testTagString(field.Tags); tag != expected[i] {
+			t.Fatalf("Tags of field %v not as expected: %v", field.Name, tag)
+		}
+	}
+
+	if model.Fields[0].Type.String() != "int64" || model.Fields[1].Type.String() != "string" || model.Fields[2].Type.String() != "*int64" {
+		t.Fatalf("Types of fields not as expected: %v %v %v", model.Fields[0].Type, model.Fields[1].Type, model.Fields[2].Type)
+	}
+}
+
+func TestPostgresGoType(t *testing.T) {
+	types := []struct {
+		columnType string
+		notnull    bool
+		goType     string
+	}{
+		{"bigint", true, "int64"},
+		{"int4", false, "*int32"},
+		{"character varying(255)", true, "string"},
+		{"timestamp(3) with time zone", false, "*time.Time"},
+		{"date", true, "time.Time"},
+		{"numeric(10,2)", true, "float64"},
+		{"bytea", false, "[]uint8"},
+		{"text[]", false, "[]string"},
+		{"integer[]", true, "[]int32"},
+		{"jsonb", false, "*string"},
+	}
+
+	for _, typ := range types {
+		if goType := pgGoType(typ.columnType, typ.notnull).String(); goType != typ.goType {
+			t.Fatalf("Go type for %v not as expected: %v", typ.columnType, goType)
+		}
+	}
+}
+
+func TestPostgresSequenceTag(t *testing.T) {
+	if tag := pgSequenceTag(&pgSequence{Start: 10, Increment: 5, Min: 1, Max: 1000, Cache: 20}); tag != "10,5,-,1000,20" {
+		t.Fatalf("Sequence tag not as expected: %v", tag)
+	}
+
+	if tag := pgSequenceTag(&pgSequence{Start: -1, Increment: -1, Min: -9223372036854775808, Max: -1, Cache: 1}); tag != "-1,-1,-,-,1" {
+		t.Fatalf("Sequence tag not as expected: %v", tag)
+	}
+}
+
+func TestPostgresInspect(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresInspect ---")
+
+	postgres := &Postgres{Schema: "public", Log: true, History: true}
+	Use(testdb, postgres)
+	Model(testUser{}, testPost{}, testPicture{}, testArticle{})
+	Migrate()
+	models, err := Inspect()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var post *MetaModel
+
+	for i := range models {
+		if models[i].ModelName == pgHistoryTable {
+			t.Fatal("History table must not be inspected")
+		}
+
+		if models[i].ModelName == "test_post" {
+			post = &models[i]
+		}
+	}
+
+	if post == nil || len(post.Fields) != 4 {
+		t.Fatalf("Model test_post must have been inspected, but was: %v", post)
+	}
+
+	if tag := testTagString(post.Fields[0].Tags); tag != "type:bigint;pk;seq:1,1,-,-,1;default:nextval(seq);notnull" {
+		t.Fatalf("Tags of id not as expected: %v", tag)
+	}
+
+	if tag := testTagString(post.Fields[2].Tags); tag != "type:bigint;notnull;fk:test_user.id" {
+		t.Fatalf("Tags of user not as expected: %v", tag)
+	}
+
+	// migrating the inspected models must not change anything
+	plan, err := postgres.Plan(context.Background(), testdb, &SnakeCase{}, models)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		for _, statement := range plan.Statements {
+			if !strings.Contains(statement.Query, "SET NOT NULL") &&
+				!strings.Contains(statement.Query, "DROP NOT NULL") &&
+				!strings.Contains(statement.Query, "DEFAULT") {
+				t.Fatalf("Migrating the inspected models must not change the schema, but was: %v", statement.Query)
+			}
+		}
+	}
+}
+
+func testTagString(tags []MetaTag) string {
+	parts := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		if tag.Name == "" {
+			parts = append(parts, tag.Value)
+		} else {
+			parts = append(parts, tag.Name+":"+tag.Value)
+		}
+	}
+
+	return strings.Join(parts, ";")
+}
@@ -1,8 +1,16 @@
 package gondolier
 
 import (
+	"context"
 	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 type testUser struct {
@@ -61,6 +69,25 @@ type testUpdateColumnSeqReduce struct {
 	Column int `gondolier:"type:integer"`
 }
 
+type testRenameColumn struct {
+	Key    uint64 `gondolier:"type:bigint;pk;was:Id"`
+	Number uint64 `gondolier:"type:bigint;seq:1,1,-,-,1;default:nextval(seq);notnull;was:Code"`
+	Title  string `gondolier:"type:text;unique;renamed_from:Name"`
+}
+
+type testRenameTable struct {
+	Id   uint64 `gondolier:"type:bigint;id"`
+	Name string `gondolier:"type:text;unique"`
+}
+
+func (m testRenameTable) GondolierPreviousNames() []string {
+	return []string{"testRenameTableOld"}
+}
+
+type testRenameTableRef struct {
+	Ref uint64 `gondolier:"type:bigint;fk:testRenameTable.Id"`
+}
+
 type testUpdateColumnFk struct {
 	Fk uint64 `gondolier:"type:bigint;fk:testOther.Id"`
 }
@@ -69,6 +96,10 @@ type testUpdateColumnFkReduce struct {
 	Fk uint64 `gondolier:"type:bigint"`
 }
 
+type testUpdateColumnFkAction struct {
+	Fk uint64 `gondolier:"type:bigint;fk:testOther.Id,ondelete:cascade,onupdate:set null,deferred"`
+}
+
 type testNullableFields struct {
 	NullBool   sql.NullBool    `gondolier:"type:boolean"`
 	NullFloat  sql.NullFloat64 `gondolier:"type:real"`
@@ -76,6 +107,90 @@ type testNullableFields struct {
 	NullString sql.NullString  `gondolier:"type:text"`
 }
 
+type testCompositeKey struct {
+	A     uint64 `gondolier:"type:bigint;pk"`
+	B     uint64 `gondolier:"type:bigint;pk"`
+	Value string `gondolier:"type:text"`
+}
+
+type testCompositeKeyReduce struct {
+	A uint64 `gondolier:"type:bigint;pk"`
+	B uint64 `gondolier:"type:bigint"`
+}
+
+type testIndex struct {
+	Id      uint64    `gondolier:"type:bigint;id"`
+	Name    string    `gondolier:"type:text;index"`
+	First   string    `gondolier:"type:text;index:full_name,unique"`
+	Last    string    `gondolier:"type:text;index:full_name"`
+	Tags    []string  `gondolier:"type:text[];index:tags,gin"`
+	Deleted time.Time `gondolier:"type:timestamp;index:active,where:deleted IS NULL"`
+}
+
+type testIndexUpdate struct {
+	Name   string `gondolier:"type:text;index:name,unique"`
+	Status string `gondolier:"type:text;index:status,where:status IN ('active', 'pending')"`
+}
+
+type testIndexReduce struct {
+	Name string `gondolier:"type:text"`
+}
+
+type testCheck struct {
+	Age    int    `gondolier:"type:integer;check:age >= 0"`
+	Status string `gondolier:"type:varchar(20);check:status IN ('active', 'deleted')"`
+	Min    int    `gondolier:"type:integer"`
+	Max    int    `gondolier:"type:integer"`
+}
+
+func (m testCheck) GondolierChecks() map[string]string {
+	return map[string]string{"range": "min <= max"}
+}
+
+type testCheckReduce struct {
+	Age int `gondolier:"type:integer"`
+}
+
+type testStatus string
+
+type testInferType struct {
+	Id       uint64         `gondolier:"id"`
+	Name     string         `gondolier:"unique"`
+	Nickname *string        `gondolier:"null"`
+	Active   bool           `gondolier:"notnull"`
+	Deleted  *time.Time     `gondolier:"index"`
+	Score    sql.NullInt64  `gondolier:"default:0"`
+	Tags     []string       `gondolier:"null"`
+	Data     []byte         `gondolier:"null"`
+	Status   testStatus     `gondolier:"default:'active'"`
+	Comment  sql.NullString `gondolier:"notnull"`
+}
+
+type testNullTypes struct {
+	Created sql.NullTime
+	Count   sql.NullInt32
+	Rank    sql.NullInt16
+	Flags   sql.NullByte
+}
+
+type testTypeAlias struct {
+	Id      int64     `gondolier:"type:int8"`
+	Name    string    `gondolier:"type:varchar(255)"`
+	Price   float64   `gondolier:"type:decimal(10, 2)"`
+	Created time.Time `gondolier:"type:timestamptz"`
+	Tags    []string  `gondolier:"type:varchar(20)[]"`
+	Active  bool      `gondolier:"type:bool"`
+}
+
+type testUnknownTag struct {
+	Id uint64 `gondolier:"type:bigint;unknown"`
+}
+
+type testInvalidType struct {
+	Id     uint64 `gondolier:"type:bigint;id"`
+	Column string `gondolier:"type:notatype"`
+}
+
 func TestPostgresCreateTable(t *testing.T) {
 	testCleanDb()
 	t.Log("--- TestPostgresCreateTable ---")
@@ -85,47 +200,47 @@ func TestPostgresCreateTable(t *testing.T) {
 	Model(testUser{}, testPost{}, testPicture{}, testArticle{})
 	Migrate()
 
-	if !postgres.tableExists("test_post") {
+	if !testBool(testTableExists("test_post")) {
 		t.Fatal("Table must have been created: test_post")
 	}
 
-	if !postgres.tableExists("test_user") {
+	if !testBool(testTableExists("test_user")) {
 		t.Fatal("Table must have been created: test_user")
 	}
 
-	if !postgres.tableExists("test_picture") {
+	if !testBool(testTableExists("test_picture")) {
 		t.Fatal("Table must have been created: test_picture")
 	}
 
-	if !postgres.tableExists("test_article") {
+	if !testBool(testTableExists("test_article")) {
 		t.Fatal("Table must have been created: test_article")
 	}
 
-	if !postgres.sequenceExists("test_post_id_seq") {
+	if !testBool(testSequenceExists("test_post_id_seq")) {
 		t.Fatal("Sequence must have been created: test_post_id_seq")
 	}
 
-	if !postgres.sequenceExists("test_user_id_seq") {
+	if !testBool(testSequenceExists("test_user_id_seq")) {
 		t.Fatal("Sequence must have been created: test_user_id_seq")
 	}
 
-	if !postgres.sequenceExists("test_picture_id_seq") {
+	if !testBool(testSequenceExists("test_picture_id_seq")) {
 		t.Fatal("Sequence must have been created: test_picture_id_seq")
 	}
 
-	if !postgres.sequenceExists("test_article_id_seq") {
+	if !testBool(testSequenceExists("test_article_id_seq")) {
 		t.Fatal("Sequence must have been created: test_article_id_seq")
 	}
 
-	if !postgres.foreignKeyExists("test_user", "test_user_picture_test_picture_id_fk") {
+	if !testBool(testForeignKeyExists("test_user", "test_user_picture_test_picture_id_fk")) {
 		t.Fatal("Foreign key must have been created: test_user_test_picture_fk")
 	}
 
-	if !postgres.foreignKeyExists("test_post", "test_post_user_test_user_id_fk") {
+	if !testBool(testForeignKeyExists("test_post", "test_post_user_test_user_id_fk")) {
 		t.Fatal("Foreign key must have been created: test_post_test_user_fk")
 	}
 
-	if !postgres.foreignKeyExists("test_post", "test_post_picture_test_picture_id_fk") {
+	if !testBool(testForeignKeyExists("test_post", "test_post_picture_test_picture_id_fk")) {
 		t.Fatal("Foreign key must have been created: test_post_test_picture_fk")
 	}
 }
@@ -142,7 +257,7 @@ func TestPostgresDropTable(t *testing.T) {
 	Use(testdb, postgres)
 	Drop(testUser{})
 
-	if postgres.tableExists("test_user") {
+	if testBool(testTableExists("test_user")) {
 		t.Fatal("Table must have been dropped")
 	}
 }
@@ -155,11 +270,29 @@ func TestPostgresDropTableNotExists(t *testing.T) {
 	Use(testdb, postgres)
 	Drop(testUser{})
 
-	if postgres.tableExists("test_user") {
+	if testBool(testTableExists("test_user")) {
 		t.Fatal("Table must have been dropped")
 	}
 }
 
+func TestPostgresDropTablesCycle(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresDropTablesCycle ---")
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testDepCycleA{}, testDepCycleB{})
+	Migrate()
+
+	if err := DropE(testDepCycleA{}, testDepCycleB{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if testBool(testTableExists("test_dep_cycle_a")) || testBool(testTableExists("test_dep_cycle_b")) {
+		t.Fatal("Tables must have been dropped")
+	}
+}
+
 func TestPostgresDropColumn(t *testing.T) {
 	testCleanDb()
 	t.Log("--- TestPostgresDropColumn ---")
@@ -174,11 +307,11 @@ func TestPostgresDropColumn(t *testing.T) {
 	Model(testDropColumn{})
 	Migrate()
 
-	if postgres.columnExists("test_drop_column", "drop_me") {
+	if testBool(testColumnExists("test_drop_column", "drop_me")) {
 		t.Fatal("Column 'drop_me' should not exist anymore")
 	}
 
-	if !postgres.columnExists("test_drop_column", "id") {
+	if !testBool(testColumnExists("test_drop_column", "id")) {
 		t.Fatal("Column 'id' must still exist")
 	}
 }
@@ -196,7 +329,7 @@ func TestPostgresAddColumn(t *testing.T) {
 	Model(testAddColumn{})
 	Migrate()
 
-	if !postgres.columnExists("test_add_column", "new_column") {
+	if !testBool(testColumnExists("test_add_column", "new_column")) {
 		t.Fatal("Column 'new_column' must exist")
 	}
 }
@@ -214,21 +347,25 @@ func TestPostgresUpdateColumn(t *testing.T) {
 	Use(testdb, postgres)
 	Model(testUpdateColumn{})
 	Migrate()
-	istype := postgres.getColumnType("test_update_column", "column")
+	istype, err := testColumnType("test_update_column", "column")
+
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if istype != "character varying" {
 		t.Fatalf("Type must be character varying, but was %v", istype)
 	}
 
-	if postgres.isNullable("test_update_column", "column") {
+	if testBool(testIsNullable("test_update_column", "column")) {
 		t.Fatal("Column must not be nullable")
 	}
 
-	if !postgres.constraintExists("test_update_column_pkey") {
+	if !testBool(testConstraintExists("test_update_column_pkey")) {
 		t.Fatal("Primary key constraint must exist")
 	}
 
-	if !postgres.constraintExists("test_update_column_column_key") {
+	if !testBool(testConstraintExists("test_update_column_column_key")) {
 		t.Fatal("Unique constraint must exist")
 	}
 }
@@ -253,15 +390,15 @@ func TestPostgresUpdateColumnReduce(t *testing.T) {
 	Model(testUpdateColumnReduce{})
 	Migrate()
 
-	if !postgres.isNullable("test_update_column_reduce", "column") {
+	if !testBool(testIsNullable("test_update_column_reduce", "column")) {
 		t.Fatal("Column must be nullable")
 	}
 
-	if postgres.constraintExists("test_update_column_reduce_pkey") {
+	if testBool(testConstraintExists("test_update_column_reduce_pkey")) {
 		t.Fatal("Primary key constraint must not exist")
 	}
 
-	if postgres.constraintExists("test_update_column_column_reduce_unique") {
+	if testBool(testConstraintExists("test_update_column_column_reduce_unique")) {
 		t.Fatal("Unique constraint must not exist")
 	}
 }
@@ -280,11 +417,328 @@ func TestPostgresUpdateColumnSeq(t *testing.T) {
 	Model(testUpdateColumnSeq{})
 	Migrate()
 
-	if !postgres.sequenceExists("test_update_column_seq_column_seq") {
+	if !testBool(testSequenceExists("test_update_column_seq_column_seq")) {
 		t.Fatal("Sequence must exist")
 	}
 }
 
+func TestPostgresRenameColumn(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresRenameColumn ---")
+
+	if _, err := testdb.Exec(`CREATE SEQUENCE "test_rename_column_code_seq"`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_rename_column"
+		("id" bigint NOT NULL,
+		"code" bigint NOT NULL DEFAULT nextval('test_rename_column_code_seq'::regclass),
+		"name" text,
+		CONSTRAINT "test_rename_column_id_pkey" PRIMARY KEY ("id"),
+		CONSTRAINT "test_rename_column_name_key" UNIQUE ("name"))`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`INSERT INTO "test_rename_column" ("id", "name") VALUES (42, 'kept')`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true, DropColumns: true}
+	Use(testdb, postgres)
+	Model(testRenameColumn{})
+	Migrate()
+
+	if testBool(testColumnExists("test_rename_column", "id")) ||
+		!testBool(testColumnExists("test_rename_column", "key")) ||
+		!testBool(testColumnExists("test_rename_column", "number")) ||
+		!testBool(testColumnExists("test_rename_column", "title")) {
+		t.Fatal("Columns must have been renamed")
+	}
+
+	if !testBool(testSequenceExists("test_rename_column_number_seq")) ||
+		!testBool(testConstraintExists("test_rename_column_key_pkey")) ||
+		!testBool(testConstraintExists("test_rename_column_title_key")) {
+		t.Fatal("Sequence and constraints must have been renamed")
+	}
+
+	var title string
+
+	if err := testdb.QueryRow(`SELECT "title" FROM "test_rename_column" WHERE "key" = 42`).Scan(&title); err != nil || title != "kept" {
+		t.Fatalf("Data must have been kept, but was: %v %v", title, err)
+	}
+}
+
+func TestPostgresRenameColumnPlan(t *testing.T) {
+	catalog := &pgCatalog{Tables: []string{"a", "b"},
+		Columns: []pgColumn{{Table: "a", Name: "id", Type: "bigint", NotNull: true, Default: "nextval('a_id_seq'::regclass)"},
+			{Table: "b", Name: "a", Type: "bigint"}},
+		Constraints: []pgConstraint{{Table: "a", Name: "a_id_pkey", Type: "p", Columns: []string{"id"}},
+			{Table: "a", Name: "a_id_key", Type: "u", Columns: []string{"id"}},
+			{Table: "a", Name: "custom", Type: "u", Columns: []string{"id"}},
+			{Table: "b", Name: "b_a_a_id_fk", Type: "f", Columns: []string{"a"}, RefTable: "a", RefColumns: []string{"id"}, OnDelete: "a", OnUpdate: "a"}},
+		Sequences: []pgSequence{{Name: "a_id_seq"}},
+		Indexes:   []pgCatalogIndex{{Table: "a", Name: "a_id_idx", Method: "btree", Columns: []string{"id"}}}}
+	catalog.index()
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}, catalog: catalog, plan: new(Plan)}
+	models := []MetaModel{{ModelName: "a", Fields: []MetaField{{Name: "key", Tags: []MetaTag{{"type", "bigint"}, {"", "id"}, {"", "unique"}, {"", "index"}, {"was", "id"}}}}},
+		{ModelName: "b", Fields: []MetaField{{Name: "a", Tags: []MetaTag{{"type", "bigint"}, {"fk", "a.key"}}}}}}
+
+	if err := postgres.migrateModels(models); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{`ALTER TABLE "a" RENAME COLUMN "id" TO "key"`,
+		`ALTER SEQUENCE "a_id_seq" RENAME TO "a_key_seq"`,
+		`ALTER TABLE "a" RENAME CONSTRAINT "a_id_pkey" TO "a_key_pkey"`,
+		`ALTER TABLE "a" RENAME CONSTRAINT "a_id_key" TO "a_key_key"`,
+		`ALTER INDEX "a_id_idx" RENAME TO "a_key_idx"`,
+		`ALTER TABLE "b" RENAME CONSTRAINT "b_a_a_id_fk" TO "b_a_a_key_fk"`}
+
+	if len(postgres.plan.Statements) != len(expected) {
+		t.Fatalf("Expected %v statements, but was: %v", len(expected), postgres.plan)
+	}
+
+	for i, statement := range postgres.plan.Statements {
+		if statement.Query != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], statement.Query)
+		}
+	}
+
+	if catalog.column("a", "id") != nil ||
+		catalog.column("a", "key") == nil ||
+		catalog.column("a", "key").Default != "nextval('a_key_seq'::regclass)" ||
+		catalog.sequence("a_key_seq") == nil ||
+		catalog.constraint("a_key_pkey") == nil ||
+		catalog.constraint("custom").Columns[0] != "key" ||
+		catalog.constraint("b_a_a_key_fk").RefColumns[0] != "key" ||
+		catalog.tableIndexes("a")[0].Name != "a_key_idx" {
+		t.Fatalf("Catalog must have been updated, but was: %v", catalog)
+	}
+}
+
+func TestPostgresRenameTable(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresRenameTable ---")
+
+	if _, err := testdb.Exec(`CREATE SEQUENCE "test_rename_table_old_id_seq"`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_rename_table_old"
+		("id" bigint NOT NULL DEFAULT nextval('test_rename_table_old_id_seq'::regclass),
+		"name" text,
+		CONSTRAINT "test_rename_table_old_id_pkey" PRIMARY KEY ("id"),
+		CONSTRAINT "test_rename_table_old_name_key" UNIQUE ("name"))`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_rename_table_ref"
+		("ref" bigint,
+		CONSTRAINT "test_rename_table_ref_ref_test_rename_table_old_id_fk" FOREIGN KEY ("ref") REFERENCES "test_rename_table_old"("id"))`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`INSERT INTO "test_rename_table_old" ("name") VALUES ('kept')`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testRenameTable{}, testRenameTableRef{})
+	Migrate()
+
+	if testBool(testTableExists("test_rename_table_old")) || !testBool(testTableExists("test_rename_table")) {
+		t.Fatal("Table must have been renamed")
+	}
+
+	if !testBool(testSequenceExists("test_rename_table_id_seq")) ||
+		!testBool(testConstraintExists("test_rename_table_id_pkey")) ||
+		!testBool(testConstraintExists("test_rename_table_name_key")) ||
+		!testBool(testConstraintExists("test_rename_table_ref_ref_test_rename_table_id_fk")) {
+		t.Fatal("Sequence and constraints must have been renamed")
+	}
+
+	var name string
+
+	if err := testdb.QueryRow(`SELECT "name" FROM "test_rename_table"`).Scan(&name); err != nil || name != "kept" {
+		t.Fatalf("Data must have been kept, but was: %v %v", name, err)
+	}
+}
+
+func TestPostgresRenameTablePlan(t *testing.T) {
+	catalog := &pgCatalog{Tables: []string{"a", "b"},
+		Columns: []pgColumn{{Table: "a", Name: "id", Type: "bigint", NotNull: true, Default: "nextval('a_id_seq'::regclass)"},
+			{Table: "a", Name: "parent", Type: "bigint"},
+			{Table: "b", Name: "a", Type: "bigint"}},
+		Constraints: []pgConstraint{{Table: "a", Name: "a_id_pkey", Type: "p", Columns: []string{"id"}},
+			{Table: "a", Name: "a_parent_a_id_fk", Type: "f", Columns: []string{"parent"}, RefTable: "a", RefColumns: []string{"id"}, OnDelete: "a", OnUpdate: "a"},
+			{Table: "a", Name: "custom", Type: "u", Columns: []string{"parent"}},
+			{Table: "b", Name: "b_a_a_id_fk", Type: "f", Columns: []string{"a"}, RefTable: "a", RefColumns: []string{"id"}, OnDelete: "a", OnUpdate: "a"}},
+		Sequences: []pgSequence{{Name: "a_id_seq"}},
+		Indexes:   []pgCatalogIndex{{Table: "a", Name: "a_parent_idx", Method: "btree", Columns: []string{"parent"}}}}
+	catalog.index()
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}, catalog: catalog, plan: new(Plan)}
+	models := []MetaModel{{ModelName: "c", PreviousNames: []string{"d", "a"},
+		Fields: []MetaField{{Name: "id", Tags: []MetaTag{{"type", "bigint"}, {"", "id"}}},
+			{Name: "parent", Tags: []MetaTag{{"type", "bigint"}, {"fk", "c.id"}, {"", "index"}}}}},
+		{ModelName: "b", Fields: []MetaField{{Name: "a", Tags: []MetaTag{{"type", "bigint"}, {"fk", "c.id"}}}}}}
+
+	if err := postgres.migrateModels(models); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{`ALTER TABLE "a" RENAME TO "c"`,
+		`ALTER SEQUENCE "a_id_seq" RENAME TO "c_id_seq"`,
+		`ALTER TABLE "c" RENAME CONSTRAINT "a_id_pkey" TO "c_id_pkey"`,
+		`ALTER TABLE "c" RENAME CONSTRAINT "a_parent_a_id_fk" TO "c_parent_c_id_fk"`,
+		`ALTER INDEX "a_parent_idx" RENAME TO "c_parent_idx"`,
+		`ALTER TABLE "b" RENAME CONSTRAINT "b_a_a_id_fk" TO "b_a_c_id_fk"`}
+
+	if len(postgres.plan.Statements) != len(expected) {
+		t.Fatalf("Expected %v statements, but was: %v", len(expected), postgres.plan)
+	}
+
+	for i, statement := range postgres.plan.Statements {
+		if statement.Query != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], statement.Query)
+		}
+	}
+
+	if catalog.table("a") || !catalog.table("c") ||
+		catalog.column("c", "id") == nil ||
+		catalog.column("c", "id").Default != "nextval('c_id_seq'::regclass)" ||
+		catalog.constraint("custom").Table != "c" ||
+		catalog.constraint("b_a_c_id_fk").RefTable != "c" ||
+		len(catalog.tableIndexes("c")) != 1 {
+		t.Fatalf("Catalog must have been updated, but was: %v", catalog)
+	}
+}
+
+func TestPostgresCockroachIdDefault(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{CockroachDB: true}}
+	input := []string{"bigint", "INT8", "uuid"}
+	expected := []string{"unique_rowid()", "unique_rowid()", "gen_random_uuid()"}
+
+	for i, in := range input {
+		if value, err := postgres.getCockroachIdDefault(in); err != nil || value != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v %v", expected[i], value, err)
+		}
+	}
+
+	if _, err := postgres.getCockroachIdDefault("integer"); err == nil {
+		t.Fatal("Unsupported id type must return an error")
+	}
+}
+
+func TestPostgresCockroachCreateTablePlan(t *testing.T) {
+	catalog := &pgCatalog{}
+	catalog.index()
+	postgres := &pgRun{Postgres: &Postgres{CockroachDB: true}, naming: &SnakeCase{}, catalog: catalog, plan: new(Plan)}
+	model := MetaModel{ModelName: "a", Fields: []MetaField{{Name: "id", Tags: []MetaTag{{"type", "bigint"}, {"", "id"}}},
+		{Name: "number", Tags: []MetaTag{{"type", "bigint"}, {"seq", "1,1,-,-,1"}, {"default", "nextval(seq)"}}}}}
+
+	if err := postgres.migrateModels([]MetaModel{model}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(postgres.plan.Statements) != 2 {
+		t.Fatalf("Expected sequence and table, but was: %v", postgres.plan)
+	}
+
+	if !strings.HasPrefix(postgres.plan.Statements[0].Query, `CREATE SEQUENCE IF NOT EXISTS "a_number_seq"`) {
+		t.Fatalf("Sequence must have been created, but was: %v", postgres.plan.Statements[0].Query)
+	}
+
+	if !strings.Contains(postgres.plan.Statements[1].Query, `"id" bigint DEFAULT unique_rowid()`) {
+		t.Fatalf("Id must use unique_rowid(), but was: %v", postgres.plan.Statements[1].Query)
+	}
+
+	model.Fields[0].Tags[0].Value = "integer"
+
+	if err := postgres.migrateModels([]MetaModel{model}); err == nil {
+		t.Fatal("Unsupported id type must return an error")
+	}
+}
+
+func TestPostgresCockroachUpdateColumnPlan(t *testing.T) {
+	catalog := &pgCatalog{Tables: []string{"a"},
+		Columns: []pgColumn{{Table: "a", Name: "id", Type: "bigint", NotNull: true, Default: "unique_rowid()"},
+			{Table: "a", Name: "name", Type: "varchar(100)"}}}
+	catalog.index()
+	postgres := &pgRun{Postgres: &Postgres{CockroachDB: true}, naming: &SnakeCase{}, catalog: catalog, plan: new(Plan)}
+	model := MetaModel{ModelName: "a", Fields: []MetaField{{Name: "id", Tags: []MetaTag{{"type", "uuid"}, {"", "id"}}},
+		{Name: "name", Tags: []MetaTag{{"type", "varchar(255)"}}}}}
+
+	if err := postgres.migrateModels([]MetaModel{model}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range postgres.plan.Statements {
+		if strings.Contains(statement.Query, "TYPE") || strings.Contains(statement.Query, "SEQUENCE") {
+			t.Fatalf("Types must be changed outside the transaction without sequences, but was: %v", statement.Query)
+		}
+	}
+
+	if !strings.Contains(postgres.plan.String(), `ALTER TABLE "a" ALTER COLUMN "id" SET DEFAULT gen_random_uuid()`) {
+		t.Fatalf("Id must use gen_random_uuid(), but was: %v", postgres.plan)
+	}
+
+	n := len(postgres.plan.Statements)
+
+	if err := postgres.alterColumnTypes(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(postgres.plan.Statements) != n+2 ||
+		!strings.HasSuffix(postgres.plan.Statements[n].Query, "TYPE uuid") ||
+		!strings.HasSuffix(postgres.plan.Statements[n+1].Query, "TYPE varchar(255)") {
+		t.Fatalf("Types must have been changed at the end, but was: %v", postgres.plan)
+	}
+
+	if postgres.plan.Statements[n-1].NoTransaction || !postgres.plan.Statements[n].NoTransaction || !postgres.plan.Statements[n+1].NoTransaction {
+		t.Fatal("Types must be changed outside the transaction")
+	}
+}
+
+func TestPostgresCockroachRenameColumnPlan(t *testing.T) {
+	catalog := &pgCatalog{Tables: []string{"a"},
+		Columns: []pgColumn{{Table: "a", Name: "id", Type: "bigint", NotNull: true, Default: "unique_rowid()"}},
+		Constraints: []pgConstraint{{Table: "a", Name: "a_id_pkey", Type: "p", Columns: []string{"id"}},
+			{Table: "a", Name: "a_id_key", Type: "u", Columns: []string{"id"}}}}
+	catalog.index()
+	postgres := &pgRun{Postgres: &Postgres{CockroachDB: true}, naming: &SnakeCase{}, catalog: catalog, plan: new(Plan)}
+	model := MetaModel{ModelName: "a", Fields: []MetaField{{Name: "key", Tags: []MetaTag{{"type", "bigint"}, {"", "id"}, {"", "unique"}, {"was", "id"}}}}}
+
+	if err := postgres.migrateModels([]MetaModel{model}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{`ALTER TABLE "a" RENAME COLUMN "id" TO "key"`,
+		`ALTER TABLE "a" RENAME CONSTRAINT "a_id_key" TO "a_key_key"`}
+
+	if len(postgres.plan.Statements) != len(expected) {
+		t.Fatalf("Expected %v statements, but was: %v", len(expected), postgres.plan)
+	}
+
+	for i, statement := range postgres.plan.Statements {
+		if statement.Query != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], statement.Query)
+		}
+	}
+
+	if catalog.constraint("a_id_pkey") == nil || catalog.constraint("a_id_pkey").Columns[0] != "key" {
+		t.Fatalf("Primary key must have kept its name, but was: %v", catalog)
+	}
+}
+
+func TestPostgresCockroachLock(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{CockroachDB: true, Lock: true}}
+
+	if err := postgres.lock(); err == nil {
+		t.Fatal("Lock must return an error for CockroachDB")
+	}
+}
+
 func TestPostgresUpdateColumnSeqReduce(t *testing.T) {
 	testCleanDb()
 	t.Log("--- TestPostgresUpdateColumnSeqReduce ---")
@@ -309,7 +763,7 @@ func TestPostgresUpdateColumnSeqReduce(t *testing.T) {
 	Model(testUpdateColumnSeqReduce{})
 	Migrate()
 
-	if postgres.sequenceExists("test_update_column_seq_reduce_column_seq") {
+	if testBool(testSequenceExists("test_update_column_seq_reduce_column_seq")) {
 		t.Fatal("Sequence must not exist")
 	}
 }
@@ -333,7 +787,7 @@ func TestPostgresUpdateColumnFk(t *testing.T) {
 	Model(testUpdateColumnFk{})
 	Migrate()
 
-	if !postgres.constraintExists("test_update_column_fk_fk_test_other_id_fk") {
+	if !testBool(testConstraintExists("test_update_column_fk_fk_test_other_id_fk")) {
 		t.Fatal("Foreign key must exist")
 	}
 }
@@ -357,11 +811,82 @@ func TestPostgresUpdateColumnFkReduce(t *testing.T) {
 	Model(testUpdateColumnFkReduce{})
 	Migrate()
 
-	if postgres.constraintExists("test_update_column_fk_reduce_fk_test_other_id_fk") {
+	if testBool(testConstraintExists("test_update_column_fk_reduce_fk_test_other_id_fk")) {
 		t.Fatal("Foreign key must not exist")
 	}
 }
 
+func TestPostgresUpdateColumnFkAction(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresUpdateColumnFkAction ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_other"
+		("id" bigint unique)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_update_column_fk_action"
+		("fk" bigint CONSTRAINT "test_update_column_fk_action_fk_test_other_id_fk" REFERENCES "test_other"("id"))`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testUpdateColumnFkAction{})
+	Migrate()
+
+	var onDelete, onUpdate string
+	var deferrable, deferred bool
+
+	if err := testdb.QueryRow(`SELECT confdeltype, confupdtype, condeferrable, condeferred
+		FROM pg_constraint
+		WHERE conname = 'test_update_column_fk_action_fk_test_other_id_fk'`).Scan(&onDelete, &onUpdate, &deferrable, &deferred); err != nil {
+		t.Fatal(err)
+	}
+
+	if onDelete != "c" || onUpdate != "n" || !deferrable || !deferred {
+		t.Fatalf("Foreign key actions must have been updated, but was: %v %v %v %v", onDelete, onUpdate, deferrable, deferred)
+	}
+
+	// nothing must change on second run
+	plan := &Postgres{Schema: "public"}
+	Use(testdb, plan)
+	Model(testUpdateColumnFkAction{})
+	p, err := PlanMigration()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(p.String(), "CONSTRAINT") {
+		t.Fatalf("Foreign key must not be recreated, but was: %v", p)
+	}
+}
+
+func TestPostgresForeignKeyInfo(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	fk, err := postgres.getForeignKeyInfo("test", "Other.Id, onDelete:set  null,onupdate:cascade,deferrable,notvalid")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fk.refTable != "other" || fk.refColumn != "id" ||
+		fk.onDelete != "set null" || fk.onUpdate != "cascade" ||
+		!fk.deferrable || fk.deferred || !fk.notValid {
+		t.Fatalf("Foreign key not as expected: %v", fk)
+	}
+
+	if _, err := postgres.getForeignKeyInfo("test", "Other.Id,ondelete:drop"); err == nil {
+		t.Fatal("Unknown action must return an error")
+	}
+
+	if _, err := postgres.getForeignKeyInfo("test", "Other.Id,unknown"); err == nil {
+		t.Fatal("Unknown option must return an error")
+	}
+}
+
 func TestPostgresDontDropPk(t *testing.T) {
 	testCleanDb()
 	t.Log("--- TestPostgresDontDropPk ---")
@@ -387,19 +912,1107 @@ func TestPostgresNullableFields(t *testing.T) {
 	Migrate()
 }
 
-func testCleanDb() {
-	testdb.Exec(`DROP TABLE IF EXISTS "test_post"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_user"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_picture"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_article"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_drop_column"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_add_column"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_reduce"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_seq"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_seq_reduce"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_fk"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_fk_reduce"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_other"`)
-	testdb.Exec(`DROP TABLE IF EXISTS "test_nullable_fields"`)
+func TestPostgresUnknownTag(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresUnknownTag ---")
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testUnknownTag{})
+	err := MigrateE()
+	std.reset()
+	tagErr, ok := err.(*TagError)
+
+	if !ok {
+		t.Fatalf("Error must be of type TagError, but was: %v", err)
+	}
+
+	if tagErr.Model != "testUnknownTag" || tagErr.Field != "Id" || tagErr.Tag != "unknown" {
+		t.Fatalf("Error must contain model, field and tag, but was: %v %v %v", tagErr.Model, tagErr.Field, tagErr.Tag)
+	}
+
+	if testBool(testTableExists("test_unknown_tag")) {
+		t.Fatal("Table must not have been created")
+	}
+}
+
+func TestPostgresSQLError(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresSQLError ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_invalid_type" ("id" bigint)`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testInvalidType{})
+	err := MigrateE()
+	std.reset()
+	sqlErr, ok := err.(*SQLError)
+
+	if !ok {
+		t.Fatalf("Error must be of type SQLError, but was: %v", err)
+	}
+
+	if sqlErr.Model != "testInvalidType" || sqlErr.Field != "Column" || sqlErr.Query == "" || sqlErr.Err == nil {
+		t.Fatalf("Error must contain model, field, query and driver error, but was: %v", sqlErr)
+	}
+
+	if testBool(testColumnExists("test_invalid_type", "column")) {
+		t.Fatal("Migration must have been rolled back")
+	}
+}
+
+func TestPostgresInstances(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresInstances ---")
+
+	// the migrator keeps no state between calls, so it can be shared
+	postgres := &Postgres{Schema: "public", Log: true}
+	a := New(testdb, postgres)
+	b := New(testdb, postgres)
+	a.Model(testPicture{})
+	b.Model(testArticle{})
+	errs := make(chan error, 2)
+
+	go func() {
+		errs <- a.MigrateE()
+	}()
+
+	go func() {
+		errs <- b.MigrateE()
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !testBool(testTableExists("test_picture")) || !testBool(testTableExists("test_article")) {
+		t.Fatal("Tables must have been created by both instances")
+	}
+}
+
+func TestPostgresMigrateContextCanceled(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresMigrateContextCanceled ---")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testPicture{})
+	err := MigrateContext(ctx)
+	std.reset()
+
+	if err == nil {
+		t.Fatal("Migration must fail if the context was canceled")
+	}
+
+	if testBool(testTableExists("test_picture")) {
+		t.Fatal("Table must not have been created")
+	}
+}
+
+func TestPostgresDropContextCanceled(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresDropContextCanceled ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_user" ("id" bigint not null)`); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+
+	if err := DropContext(ctx, testUser{}); err == nil {
+		t.Fatal("Drop must fail if the context was canceled")
+	}
+
+	if !testBool(testTableExists("test_user")) {
+		t.Fatal("Table must not have been dropped")
+	}
+}
+
+func TestPostgresPlan(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresPlan ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_add_column" ("id" bigint not null)`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testPicture{}, testAddColumn{})
+	plan, err := PlanMigration()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(plan)
+
+	if len(std.models) != 2 {
+		t.Fatal("Models must be kept after planning")
+	}
+
+	std.reset()
+
+	if plan.Empty() || plan.Statements[0].Model != "testPicture" {
+		t.Fatal("Plan must contain statements for testPicture first")
+	}
+
+	if testBool(testTableExists("test_picture")) || testBool(testColumnExists("test_add_column", "new_column")) {
+		t.Fatal("Plan must not have been executed")
+	}
+
+	if err := plan.Apply(testdb); err != nil {
+		t.Fatal(err)
+	}
+
+	if !testBool(testTableExists("test_picture")) || !testBool(testColumnExists("test_add_column", "new_column")) {
+		t.Fatal("Plan must have been applied")
+	}
+}
+
+func TestPostgresExportSQL(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresExportSQL ---")
+
+	dir, err := ioutil.TempDir("", "gondolier")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "migration.sql")
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testPicture{})
+	err = ExportSQL(path)
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log(string(script))
+
+	if !strings.Contains(string(script), "-- Model testPicture\nCREATE TABLE IF NOT EXISTS \"test_picture\"") {
+		t.Fatal("Script must contain create table statement")
+	}
+
+	if testBool(testTableExists("test_picture")) {
+		t.Fatal("Migration must not have been executed")
+	}
+
+	if _, err := testdb.Exec(string(script)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !testBool(testTableExists("test_picture")) {
+		t.Fatal("Script must be executable")
+	}
+}
+
+func TestPostgresHistory(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresHistory ---")
+
+	postgres := &Postgres{Schema: "public", Log: true, History: true, SkipUnchanged: true}
+	Use(testdb, postgres)
+	Model(testPicture{})
+	Migrate()
+	var count int
+	var hash, statements string
+	var duration int64
+
+	if err := testdb.QueryRow(`SELECT COUNT(1) FROM "gondolier_migrations"`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Migration must have been recorded, but was: %v", count)
+	}
+
+	if err := testdb.QueryRow(`SELECT "hash", "statements", "duration_ms" FROM "gondolier_migrations"`).Scan(&hash, &statements, &duration); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hash) != 64 || !strings.Contains(statements, `CREATE TABLE IF NOT EXISTS "test_picture"`) || duration < 0 {
+		t.Fatalf("Migration must have been recorded with hash, statements and duration, but was: %v %v %v", hash, statements, duration)
+	}
+
+	// unchanged
+	Model(testPicture{})
+	plan, err := PlanMigration()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		t.Fatal("Plan must be empty if the data model is unchanged")
+	}
+
+	Migrate()
+
+	if err := testdb.QueryRow(`SELECT COUNT(1) FROM "gondolier_migrations"`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Migration must have been skipped, but was: %v", count)
+	}
+
+	// changed
+	Model(testPicture{}, testArticle{})
+	Migrate()
+
+	if err := testdb.QueryRow(`SELECT COUNT(1) FROM "gondolier_migrations"`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 2 || !testBool(testTableExists("test_article")) {
+		t.Fatalf("Migration must have been executed and recorded, but was: %v", count)
+	}
+}
+
+// testPrefixNaming prefixes all names, so that names which must not be changed by the naming schema are noticed.
+type testPrefixNaming struct{}
+
+func (n *testPrefixNaming) Get(name string) string {
+	return "prefix_" + (&SnakeCase{}).Get(name)
+}
+
+func TestPostgresHistoryNameSchema(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresHistoryNameSchema ---")
+
+	postgres := &Postgres{Schema: "public", Log: true, History: true, SkipUnchanged: true}
+	Use(testdb, postgres)
+	Naming(&testPrefixNaming{})
+	defer Naming(&SnakeCase{})
+	Model(testPicture{})
+	Migrate()
+	Model(testPicture{})
+	plan, err := PlanMigration()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		t.Fatalf("Plan must be empty if the data model is unchanged, but was: %v", plan)
+	}
+}
+
+func TestPostgresLock(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresLock ---")
+
+	// hold the lock in another transaction
+	tx, err := testdb.Begin()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true, Lock: true, LockKey: 42, LockTimeout: time.Millisecond * 100}
+	Use(testdb, postgres)
+	Model(testPicture{})
+
+	if err := MigrateE(); err == nil {
+		t.Fatal("Migration must fail if the lock cannot be taken in time")
+	}
+
+	if testBool(testTableExists("test_picture")) {
+		t.Fatal("Table must not have been created")
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !testBool(testTableExists("test_picture")) {
+		t.Fatal("Table must have been created")
+	}
+}
+
+func TestPostgresLockTimeout(t *testing.T) {
+	input := []time.Duration{time.Microsecond, time.Millisecond, time.Millisecond + time.Nanosecond, time.Second}
+	expected := []string{"1ms", "1ms", "2ms", "1000ms"}
+
+	for i, in := range input {
+		if query := pgLockTimeout(in); query != `SET LOCAL lock_timeout = '`+expected[i]+`'` {
+			t.Fatalf("Expected timeout of '%v', but was: %v", expected[i], query)
+		}
+	}
+}
+
+func TestPostgresLockConcurrent(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresLockConcurrent ---")
+
+	n := 4
+	errs := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			g := New(testdb, &Postgres{Schema: "public", Log: true, Lock: true})
+			g.Model(testUser{}, testPost{}, testPicture{}, testArticle{})
+			errs <- g.MigrateE()
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPostgresCompositeKey(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresCompositeKey ---")
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testCompositeKey{})
+	Migrate()
+	testPrimaryKey(t, "test_composite_key", "test_composite_key_a_b_pkey", "a,b")
+
+	// unchanged
+	Model(testCompositeKey{})
+	Migrate()
+	testPrimaryKey(t, "test_composite_key", "test_composite_key_a_b_pkey", "a,b")
+}
+
+func TestPostgresCompositeKeyUpdate(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresCompositeKeyUpdate ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_composite_key"
+		("a" bigint PRIMARY KEY, "b" bigint)`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testCompositeKey{})
+	Migrate()
+	testPrimaryKey(t, "test_composite_key", "test_composite_key_a_b_pkey", "a,b")
+}
+
+func TestPostgresCompositeKeyReduce(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresCompositeKeyReduce ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_composite_key_reduce"
+		("a" bigint, "b" bigint, PRIMARY KEY ("a", "b"))`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testCompositeKeyReduce{})
+	Migrate()
+	testPrimaryKey(t, "test_composite_key_reduce", "test_composite_key_reduce_a_pkey", "a")
+
+	if !testBool(testIsNullable("test_composite_key_reduce", "b")) {
+		t.Fatal("Column b must be nullable")
+	}
+}
+
+func TestPostgresNormalizeExpr(t *testing.T) {
+	exprs := [][]string{
+		{"deleted IS NULL", "(deleted IS NULL)"},
+		{"status = 'active'", "((status)::text = 'active'::text)"},
+		{"status IN ('a', 'b')", "(status = ANY (ARRAY['a'::text, 'b'::text]))"},
+		{"status NOT IN ('a','b')", "(status <> ALL (ARRAY['a'::character varying, 'b'::character varying]))"},
+		{"age >= 0 AND age != 5", "((age >= 0) AND (age <> 5))"},
+		{"status IN ('active', 'deleted')", "(((status)::text = ANY ((ARRAY['active'::character varying, 'deleted'::character varying])::text[])))"},
+		{"-1", "'-1'::integer"},
+		{"'-1'", "'-1'::integer"},
+		{"-1.5", "'-1.5'::numeric"},
+		{"0", "0"},
+		{"'A b'", "'A b'::text"},
+		{"'it''s'", "'it''s'::character varying"},
+		{"name <> '(a)'", "((name)::text <> '(a)'::text)"},
+	}
+
+	for _, expr := range exprs {
+		if pgNormalizeExpr(expr[0]) != pgNormalizeExpr(expr[1]) {
+			t.Fatalf("Expressions must be equal: %v (%v) %v (%v)", expr[0], pgNormalizeExpr(expr[0]), expr[1], pgNormalizeExpr(expr[1]))
+		}
+	}
+
+	different := [][]string{
+		{"age > 0", "(age >= 0)"},
+		{"'a b'", "'ab'::text"},
+		{"'A'", "'a'::text"},
+		{"'(a)'", "'a'::text"},
+		{"'a]'", "'a'::text"},
+		{"'1'", "'-1'::integer"},
+	}
+
+	for _, expr := range different {
+		if pgNormalizeExpr(expr[0]) == pgNormalizeExpr(expr[1]) {
+			t.Fatalf("Expressions must not be equal: %v %v (%v)", expr[0], expr[1], pgNormalizeExpr(expr[0]))
+		}
+	}
+}
+
+func TestPostgresNormalizeType(t *testing.T) {
+	types := [][]string{
+		{"int4", "integer"},
+		{"INT", "integer"},
+		{"serial", "integer"},
+		{"int8", "bigint"},
+		{"bool", "boolean"},
+		{"varchar(255)", "character varying(255)"},
+		{"VARCHAR (255)", "character varying(255)"},
+		{"varchar", "character varying"},
+		{"char", "character(1)"},
+		{"bpchar(10)", "character(10)"},
+		{"float", "double precision"},
+		{"float(10)", "real"},
+		{"float8", "double precision"},
+		{"decimal(10, 2)", "numeric(10,2)"},
+		{"timestamptz", "timestamp with time zone"},
+		{"timestamptz(3)", "timestamp(3) with time zone"},
+		{"timestamp", "timestamp without time zone"},
+		{"time with time zone", "time with time zone"},
+		{"timetz", "time with time zone"},
+		{"int4[]", "integer[]"},
+		{"integer[][]", "integer[]"},
+		{"varchar(100)[3]", "character varying(100)[]"},
+		{"text array", "text[]"},
+		{"text", "text"},
+		{"jsonb", "jsonb"},
+	}
+
+	for _, typ := range types {
+		if pgNormalizeType(typ[0]) != typ[1] || pgNormalizeType(typ[1]) != typ[1] {
+			t.Fatalf("Type not normalized as expected: %v (%v) %v (%v)", typ[0], pgNormalizeType(typ[0]), typ[1], pgNormalizeType(typ[1]))
+		}
+	}
+
+	if pgNormalizeType("varchar(100)") == pgNormalizeType("varchar(200)") {
+		t.Fatal("Types must not be equal")
+	}
+}
+
+func TestPostgresModelIndexes(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testIndex{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexes, err := getTagIndexes(&model, postgres.naming, pgIndexSupport)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []modelIndex{
+		{"test_index_name_idx", "Name", []string{"name"}, false, "btree", ""},
+		{"test_index_full_name_idx", "First", []string{"first", "last"}, true, "btree", ""},
+		{"test_index_tags_idx", "Tags", []string{"tags"}, false, "gin", ""},
+		{"test_index_active_idx", "Deleted", []string{"deleted"}, false, "btree", "deleted IS NULL"},
+	}
+
+	if len(indexes) != len(expected) {
+		t.Fatalf("Expected %v indexes, but was: %v", len(expected), len(indexes))
+	}
+
+	for i := range expected {
+		if indexes[i].name != expected[i].name || indexes[i].field != expected[i].field || indexes[i].method != expected[i].method || indexes[i].unique != expected[i].unique ||
+			indexes[i].where != expected[i].where || strings.Join(indexes[i].columns, ",") != strings.Join(expected[i].columns, ",") {
+			t.Fatalf("Expected index %v, but was: %v", expected[i], indexes[i])
+		}
+	}
+}
+
+func TestPostgresIndex(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresIndex ---")
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testIndex{})
+	Migrate()
+	indexes, err := testPostgresIndexes(postgres, "test_index")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := &SchemaDiff{}
+
+	if len(indexes) != 4 {
+		t.Fatalf("Four indexes must have been created, but was: %v", len(indexes))
+	}
+
+	fullName := diff.findIndex(indexes, "test_index_full_name_idx")
+
+	if fullName == nil || !fullName.Unique || strings.Join(fullName.Columns, ",") != "first,last" {
+		t.Fatalf("Unique multi-column index must have been created, but was: %v", fullName)
+	}
+
+	tags := diff.findIndex(indexes, "test_index_tags_idx")
+
+	if tags == nil || tags.Method != "gin" {
+		t.Fatalf("Gin index must have been created, but was: %v", tags)
+	}
+
+	active := diff.findIndex(indexes, "test_index_active_idx")
+
+	if active == nil || active.Where == "" {
+		t.Fatalf("Partial index must have been created, but was: %v", active)
+	}
+
+	// unchanged
+	Model(testIndex{})
+	plan, err := PlanMigration()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(plan.String(), "INDEX") {
+		t.Fatalf("Indexes must not be changed, but was: %v", plan)
+	}
+}
+
+func TestPostgresIndexUpdate(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresIndexUpdate ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_index_update" ("name" text, "status" text)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`CREATE INDEX "test_index_update_name_idx" ON "test_index_update" ("name")`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testIndexUpdate{})
+	Migrate()
+	indexes, err := testPostgresIndexes(postgres, "test_index_update")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := &SchemaDiff{}
+	name := diff.findIndex(indexes, "test_index_update_name_idx")
+
+	if name == nil || !name.Unique {
+		t.Fatalf("Index must have been recreated as unique index, but was: %v", name)
+	}
+
+	if diff.findIndex(indexes, "test_index_update_status_idx") == nil {
+		t.Fatal("Partial index must have been created")
+	}
+
+	// unchanged
+	Model(testIndexUpdate{})
+	plan, err := PlanMigration()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(plan.String(), "INDEX") {
+		t.Fatalf("Indexes must not be changed, but was: %v", plan)
+	}
+}
+
+func testPostgresIndexes(postgres *Postgres, tableName string) ([]IndexState, error) {
+	run := postgres.newRun(context.Background(), testdb, &SnakeCase{})
+	catalog, err := run.loadCatalog()
+
+	if err != nil {
+		return nil, err
+	}
+
+	run.catalog = catalog
+	table, err := run.Table(tableName)
+
+	if err != nil || table == nil {
+		return nil, err
+	}
+
+	return table.Indexes, nil
+}
+
+func TestPostgresIndexReduce(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresIndexReduce ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_index_reduce" ("name" text UNIQUE)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`CREATE INDEX "test_index_reduce_name_idx" ON "test_index_reduce" ("name")`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testdb.Exec(`CREATE INDEX "custom_index" ON "test_index_reduce" ("name")`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testIndexReduce{})
+	Migrate()
+	var count int
+
+	if err := testdb.QueryRow(`SELECT COUNT(1) FROM pg_indexes WHERE tablename = 'test_index_reduce'`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Only the custom index must be kept, but was: %v", count)
+	}
+}
+
+func testPrimaryKey(t *testing.T, tableName, name, columns string) {
+	pkName, pkColumns, err := testGetPrimaryKey(tableName)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pkName != name || strings.Join(pkColumns, ",") != columns {
+		t.Fatalf("Primary key must be %v (%v), but was: %v (%v)", name, columns, pkName, pkColumns)
+	}
+}
+
+// Returns the catalog of the test database, to check the schema after a migration.
+func testCatalog() (*pgCatalog, error) {
+	postgres := &Postgres{Schema: "public"}
+	return postgres.newRun(context.Background(), testdb, &SnakeCase{}).loadCatalog()
+}
+
+func testTableExists(name string) (bool, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return false, err
+	}
+
+	return catalog.table(name), nil
+}
+
+func testColumnExists(tableName, columnName string) (bool, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return false, err
+	}
+
+	return catalog.column(tableName, columnName) != nil, nil
+}
+
+func testSequenceExists(name string) (bool, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return false, err
+	}
+
+	return catalog.sequence(name) != nil, nil
+}
+
+func testForeignKeyExists(tableName, fkName string) (bool, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return false, err
+	}
+
+	constraint := catalog.constraint(fkName)
+	return constraint != nil && constraint.Table == tableName, nil
+}
+
+func testIsNullable(tableName, columnName string) (bool, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return false, err
+	}
+
+	column := catalog.column(tableName, columnName)
+
+	if column == nil {
+		return false, sql.ErrNoRows
+	}
+
+	return !column.NotNull, nil
+}
+
+func testConstraintExists(name string) (bool, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return false, err
+	}
+
+	return catalog.constraint(name) != nil, nil
+}
+
+func testColumnType(tableName, columnName string) (string, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return "", err
+	}
+
+	column := catalog.column(tableName, columnName)
+
+	if column == nil {
+		return "", sql.ErrNoRows
+	}
+
+	return column.Type, nil
+}
+
+func testGetPrimaryKey(tableName string) (string, []string, error) {
+	catalog, err := testCatalog()
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	pk := catalog.tableConstraints(tableName, "p")
+
+	if len(pk) == 0 {
+		return "", []string{}, nil
+	}
+
+	return pk[0].Name, pk[0].Columns, nil
+}
+
+func testBool(b bool, err error) bool {
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func testCleanDb() {
+	testdb.Exec(`DROP TABLE IF EXISTS "test_post"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_user"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_picture"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_article"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_drop_column"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_dep_cycle_a" CASCADE`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_dep_cycle_b" CASCADE`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_add_column"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_reduce"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_seq"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_seq_reduce"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_fk"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_fk_reduce"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_update_column_fk_action"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_other"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_nullable_fields"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_unknown_tag"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_invalid_type"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_composite_key"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_composite_key_reduce"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_index"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_index_update"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_index_reduce"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_check"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_check_reduce"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_infer_type"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_type_alias"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_verify_extra"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_rename_column"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_rename_table_ref"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_rename_table"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "test_rename_table_old"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "prefix_test_picture"`)
+	testdb.Exec(`DROP TABLE IF EXISTS "gondolier_migrations"`)
+}
+
+func TestPostgresModelChecks(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testCheck{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err := getTagChecks(&model, postgres.naming)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checks) != 3 {
+		t.Fatalf("Three checks must have been found, but was: %v", len(checks))
+	}
+
+	if checks[0].name != "test_check_age_check" || checks[0].field != "Age" || checks[0].expr != "age >= 0" ||
+		checks[1].name != "test_check_status_check" ||
+		checks[2].name != "test_check_range_check" || checks[2].field != "" || checks[2].expr != "min <= max" {
+		t.Fatalf("Checks not as expected: %v", checks)
+	}
+}
+
+func TestPostgresCheck(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresCheck ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_check" ("age" integer CHECK (age > 0),
+		"status" varchar(20),
+		"min" integer,
+		"max" integer)`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testCheck{})
+	Migrate()
+	var def string
+
+	if err := testdb.QueryRow(`SELECT pg_get_constraintdef(oid) FROM pg_constraint WHERE conname = 'test_check_age_check'`).Scan(&def); err != nil {
+		t.Fatal(err)
+	}
+
+	if pgNormalizeExpr(def) != pgNormalizeExpr("CHECK (age >= 0)") {
+		t.Fatalf("Check constraint must have been replaced, but was: %v", def)
+	}
+
+	if !testBool(testConstraintExists("test_check_status_check")) ||
+		!testBool(testConstraintExists("test_check_range_check")) {
+		t.Fatal("Check constraints must exist")
+	}
+
+	if _, err := testdb.Exec(`INSERT INTO "test_check" ("age", "min", "max") VALUES (1, 2, 1)`); err == nil {
+		t.Fatal("Check constraint must be enforced")
+	}
+
+	// nothing must change on second run
+	Model(testCheck{})
+	plan, err := PlanMigration()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(plan.String(), "CHECK") {
+		t.Fatalf("Check constraints must not be recreated, but was: %v", plan)
+	}
+}
+
+func TestPostgresCheckReduce(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresCheckReduce ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_check_reduce" ("age" integer CHECK (age >= 0) CONSTRAINT "custom_check" CHECK (age < 200))`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testCheckReduce{})
+	Migrate()
+
+	if testBool(testConstraintExists("test_check_reduce_age_check")) {
+		t.Fatal("Check constraint must not exist")
+	}
+
+	if !testBool(testConstraintExists("custom_check")) {
+		t.Fatal("Custom check constraint must be kept")
+	}
+}
+
+func TestPostgresFieldType(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	postgres.RegisterType(testStatus(""), "varchar(20)")
+	model, err := buildMetaModel(testInferType{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		columnType string
+		notnull    bool
+	}{
+		{"bigint", true},
+		{"text", true},
+		{"text", false},
+		{"boolean", true},
+		{"timestamptz", false},
+		{"bigint", false},
+		{"text[]", true},
+		{"bytea", true},
+		{"varchar(20)", true},
+		{"text", false},
+	}
+
+	for i, field := range model.Fields {
+		columnType, notnull, err := postgres.getFieldType(&field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if columnType != expected[i].columnType || notnull != expected[i].notnull {
+			t.Fatalf("Type of field %v not as expected: %v %v", field.Name, columnType, notnull)
+		}
+	}
+
+	columnType, notnull, err := postgres.getFieldType(&MetaField{Name: "Tagged", Tags: []MetaTag{{"type", "integer"}}, Type: model.Fields[1].Type})
+
+	if err != nil || columnType != "integer" || notnull {
+		t.Fatalf("Type tag must be used, but was: %v %v %v", columnType, notnull, err)
+	}
+
+	if _, _, err := postgres.getFieldType(&MetaField{Name: "Map", Type: reflect.TypeOf(map[string]string{})}); err == nil {
+		t.Fatal("Type must not be inferred for maps")
+	}
+}
+
+func TestPostgresNullFieldType(t *testing.T) {
+	postgres := &pgRun{Postgres: &Postgres{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testNullTypes{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"timestamptz", "integer", "smallint", "smallint"}
+
+	for i, field := range model.Fields {
+		columnType, notnull, err := postgres.getFieldType(&field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if columnType != expected[i] || notnull {
+			t.Fatalf("Type of field %v not as expected: %v %v", field.Name, columnType, notnull)
+		}
+	}
+}
+
+func TestPostgresInferType(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresInferType ---")
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testInferType{})
+	Migrate()
+
+	rows, err := testdb.Query(`SELECT column_name, format_type(a.atttypid, a.atttypmod), is_nullable::boolean
+		FROM information_schema.columns c
+		JOIN pg_attribute a ON a.attrelid = '"test_infer_type"'::regclass AND a.attname = c.column_name
+		WHERE table_name = 'test_infer_type'
+		ORDER BY ordinal_position`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+	columns := ""
+
+	for rows.Next() {
+		var name, columnType string
+		var nullable bool
+
+		if err := rows.Scan(&name, &columnType, &nullable); err != nil {
+			t.Fatal(err)
+		}
+
+		columns += name + " " + columnType + " " + strconv.FormatBool(nullable) + ","
+	}
+
+	if columns != "id bigint false,name text false,nickname text true,active boolean false,deleted timestamp with time zone true,"+
+		"score bigint true,tags text[] true,data bytea true,status text false,comment text false," {
+		t.Fatalf("Columns not as expected: %v", columns)
+	}
+}
+
+func TestPostgresUpdateColumnTypeAlias(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresUpdateColumnTypeAlias ---")
+
+	if _, err := testdb.Exec(`CREATE TABLE "test_type_alias" ("id" bigint,
+		"name" character varying(255),
+		"price" numeric(10,2),
+		"created" timestamp with time zone,
+		"tags" character varying(20)[],
+		"active" boolean)`); err != nil {
+		t.Fatal(err)
+	}
+
+	postgres := &Postgres{Schema: "public", Log: true}
+	Use(testdb, postgres)
+	Model(testTypeAlias{})
+	plan, err := PlanMigration()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(plan.String(), " TYPE ") {
+		t.Fatalf("Unchanged column types must not be altered, but was: %v", plan)
+	}
+
+	if _, err := testdb.Exec(`ALTER TABLE "test_type_alias" ALTER COLUMN "name" TYPE varchar(100)`); err != nil {
+		t.Fatal(err)
+	}
+
+	Model(testTypeAlias{})
+	plan, err = PlanMigration()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(plan.String(), "TYPE varchar(255)") || strings.Contains(plan.String(), "TYPE int8") {
+		t.Fatalf("Changed column type must be altered, but was: %v", plan)
+	}
 }
@@ -0,0 +1,48 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Verify compares the given data model to the schema and returns the differences, without changing the schema.
+// The differences are found by the same SchemaDiff used to migrate the schema.
+// Tables and columns which are not declared by the data model are reported too, except for the history table.
+// The result is empty if the schema matches the data model.
+func (m *Postgres) Verify(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) ([]Difference, error) {
+	run := m.newRun(ctx, conn, schema)
+	catalog, err := run.loadCatalog()
+
+	if err != nil {
+		return nil, err
+	}
+
+	run.catalog = catalog
+	diff := &SchemaDiff{Dialect: run, Naming: schema}
+	diffs, err := diff.Verify(metaModels)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string]bool)
+
+	for _, model := range metaModels {
+		tables[schema.Get(model.ModelName)] = true
+	}
+
+	// tables of previous model names are reported as missing table already
+	for _, d := range diffs {
+		if d.Kind == DiffMissingTable && d.Actual != "" {
+			tables[d.Actual] = true
+		}
+	}
+
+	for _, table := range catalog.Tables {
+		if !tables[table] && table != pgHistoryTable {
+			diffs = append(diffs, Difference{Kind: DiffExtraTable, Model: table, Actual: table})
+		}
+	}
+
+	return diffs, nil
+}
@@ -0,0 +1,72 @@
+package gondolier
+
+import (
+	"testing"
+)
+
+func TestPostgresVerify(t *testing.T) {
+	testCleanDb()
+	t.Log("--- TestPostgresVerify ---")
+
+	postgres := &Postgres{Schema: "public", Log: true, History: true}
+	Use(testdb, postgres)
+	Model(testPicture{}, testUser{}, testPost{})
+	Migrate()
+	Model(testPicture{}, testUser{}, testPost{})
+	diffs, err := Verify()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 0 {
+		t.Fatalf("Schema must match the models after migration, but was: %v", diffs)
+	}
+
+	// change the schema by hand
+	testdb.Exec(`ALTER TABLE "test_post" DROP COLUMN "post"`)
+	testdb.Exec(`ALTER TABLE "test_post" ADD COLUMN "title" text`)
+	testdb.Exec(`ALTER TABLE "test_user" ALTER COLUMN "age" DROP NOT NULL`)
+	testdb.Exec(`ALTER TABLE "test_user" ALTER COLUMN "age" TYPE bigint`)
+	testdb.Exec(`ALTER TABLE "test_user" DROP CONSTRAINT "test_user_name_unique"`)
+	testdb.Exec(`CREATE TABLE "test_verify_extra" ("id" bigint)`)
+	diffs, err = Verify()
+	std.reset()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Difference{
+		{DiffType, "testUser", "Age", "integer", "bigint"},
+		{DiffNullability, "testUser", "Age", "not null", "null"},
+		{DiffMissingColumn, "testPost", "Post", "post", ""},
+		{DiffExtraColumn, "testPost", "title", "", "title"},
+		{DiffExtraTable, "test_verify_extra", "", "", "test_verify_extra"},
+	}
+	found := make(map[Difference]bool)
+
+	for _, diff := range diffs {
+		found[diff] = true
+	}
+
+	for _, diff := range expected {
+		if !found[diff] {
+			t.Fatalf("Difference %v expected, but was: %v", diff, diffs)
+		}
+	}
+
+	if !testHasDifference(diffs, DiffUnique, "Name") {
+		t.Fatalf("Missing unique constraint must have been found, but was: %v", diffs)
+	}
+}
+
+func testHasDifference(diffs []Difference, kind DifferenceKind, field string) bool {
+	for _, diff := range diffs {
+		if diff.Kind == kind && diff.Field == field {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,548 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	sqliteRebuildPrefix = "gondolier_new_"
+)
+
+var (
+	sqliteTypes = map[reflect.Type]string{reflect.TypeOf(false): "boolean",
+		reflect.TypeOf(int(0)):            "integer",
+		reflect.TypeOf(int8(0)):           "integer",
+		reflect.TypeOf(int16(0)):          "integer",
+		reflect.TypeOf(int32(0)):          "integer",
+		reflect.TypeOf(int64(0)):          "integer",
+		reflect.TypeOf(uint(0)):           "integer",
+		reflect.TypeOf(uint8(0)):          "integer",
+		reflect.TypeOf(uint16(0)):         "integer",
+		reflect.TypeOf(uint32(0)):         "integer",
+		reflect.TypeOf(uint64(0)):         "integer",
+		reflect.TypeOf(float32(0)):        "real",
+		reflect.TypeOf(float64(0)):        "real",
+		reflect.TypeOf(""):                "text",
+		reflect.TypeOf([]byte{}):          "blob",
+		reflect.TypeOf(time.Time{}):       "datetime",
+		reflect.TypeOf(sql.NullBool{}):    "boolean",
+		reflect.TypeOf(sql.NullByte{}):    "integer",
+		reflect.TypeOf(sql.NullFloat64{}): "real",
+		reflect.TypeOf(sql.NullInt16{}):   "integer",
+		reflect.TypeOf(sql.NullInt32{}):   "integer",
+		reflect.TypeOf(sql.NullInt64{}):   "integer",
+		reflect.TypeOf(sql.NullString{}):  "text",
+		reflect.TypeOf(sql.NullTime{}):    "datetime"}
+	sqliteFkActions    = []string{"no action", "restrict", "cascade", "set null", "set default"}
+	sqliteIndexSupport = &indexSupport{"SQLite", nil, true}
+)
+
+// SQLite migrator for SQLite databases (3.26 or newer).
+// It accepts the same tags as the Postgres migrator, as far as SQLite supports them:
+//
+//  // The type must be the database type.
+//  // Optional. If omitted, the type is inferred from the Go type of the field (see RegisterType)
+//  // and the column is not null, unless the field is a pointer or sql.Null* type.
+//  type:database type
+//  // Sets the column as primary key.
+//  // Set it for multiple fields to create a composite primary key.
+//  pk/primary key
+//  // Sets the default value for column, strings must be escaped.
+//  default:default value
+//  // Sets not null constraint for column.
+//  not null/notnull
+//  // Optional. Drops not null constraint if set for column. Not null is also dropped if not null is not set.
+//  null
+//  // Sets unique constraint for column.
+//  unique
+//  // Shortcut for INTEGER PRIMARY KEY AUTOINCREMENT and not null.
+//  // The type is always integer, as SQLite requires it for AUTOINCREMENT.
+//  id
+//  // Sets foreign key constraint for column.
+//  // It refers to the given model and column.
+//  // Referential actions can be added as options separated by comma.
+//  // Actions are: cascade, set null, set default, restrict and no action.
+//  // Example: fk:MyModel.Id,ondelete:cascade,onupdate:restrict
+//  fk/foreign key:Model.Column,ondelete:action,onupdate:action
+//  // Creates an index for the column. Fields with the same index name share a multi-column index.
+//  // Options are separated by comma: unique and a where clause for partial indexes, which must be the last option.
+//  // Example: index:name,unique,where:deleted IS NULL
+//  index/index:name,options
+//  // Creates a check constraint for the column named table_column_check.
+//  // Example: check:age >= 0
+//  check:expression
+//  // Renames the column of a previous field name, if the column does not exist yet.
+//  // Example: was:OldName
+//  was/renamed_from:previous field name
+//
+// Sequences (seq), index methods and deferrable foreign keys are not supported and return an error.
+// Check constraints which are not bound to a single field can be declared by implementing the Checker interface.
+// Models which were renamed can declare their previous names by implementing the Renamer interface.
+//
+// Tables are compared to the data model by the SchemaDiff.
+// SQLite cannot change or drop columns and constraints of an existing table.
+// New columns are added if possible, otherwise the table is rebuilt: a new table is created,
+// the data is copied, the old table is dropped and the new table renamed.
+// Indexes which were not created by Gondolier are recreated, constraints and triggers which are not declared by the model are lost.
+// Foreign keys are disabled on the connection while migrating and checked afterwards.
+// Statements returned by Plan must be applied with foreign keys disabled, as tables might be dropped while rebuilding them.
+// The state of a migration is kept for each call, so that one SQLite migrator can be used by multiple Gondolier instances
+// and goroutines, as long as RegisterType is not called at the same time.
+type SQLite struct {
+	DropColumns bool
+	Log         bool
+
+	types map[reflect.Type]string
+}
+
+// sqliteRun is the state of a single call of the SQLite migrator, like a migration or plan.
+// It implements the Dialect interface, the tables are compared to the catalog read by the call.
+type sqliteRun struct {
+	*SQLite
+
+	ctx            context.Context
+	db             *sql.DB
+	naming         NameSchema
+	tx             *sql.Tx
+	model          string
+	field          string
+	diff           *SchemaDiff
+	models         map[string]*MetaModel
+	columns        map[string]ColumnSpec
+	defined        map[string]bool
+	restoreIndexes []sqliteIndex
+	rebuilt        bool
+	plan           *Plan
+	catalog        *sqliteCatalog
+}
+
+// sqliteColumnSpec is a column declared by the tags of a field.
+type sqliteColumnSpec struct {
+	name          string
+	columnType    string
+	notnull       bool
+	primaryKey    bool
+	autoIncrement bool
+	unique        bool
+	defaultValue  string
+	fk            string
+}
+
+// Migrate migrates the given data model.
+// The migration is rolled back if one of the statements fails or the context is canceled.
+func (m *SQLite) Migrate(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) error {
+	run := m.newRun(ctx, conn, schema)
+
+	// foreign keys can only be disabled outside of a transaction, so one connection is used for both
+	c, err := run.db.Conn(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer c.Close()
+	var foreignKeys bool
+
+	if err := c.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return err
+	}
+
+	if foreignKeys {
+		if _, err := c.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+
+		// the context might be canceled already, but the connection is returned to the pool
+		defer c.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := c.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	run.tx = tx
+
+	if err := run.migrateModels(metaModels); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if foreignKeys && run.rebuilt {
+		if err := run.checkForeignKeys(); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Plan returns the statements Migrate would execute for the given data model, without executing them.
+// The database is read to find the differences between the data model and the schema.
+func (m *SQLite) Plan(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) (*Plan, error) {
+	run := m.newRun(ctx, conn, schema)
+	plan := &Plan{make([]Statement, 0)}
+	run.plan = plan
+
+	if err := run.migrateModels(metaModels); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// RegisterType sets the database type for fields of the same Go type as given value, which have no type tag.
+// It overrides the default mapping or adds custom types.
+//
+// Example:
+//  sqlite.RegisterType(time.Time{}, "timestamp")
+func (m *SQLite) RegisterType(value interface{}, dbType string) {
+	m.types = registerType(m.types, value, dbType)
+}
+
+// DropTable drops the given table.
+func (m *SQLite) DropTable(ctx context.Context, conn *sql.DB, schema NameSchema, name string) error {
+	return m.newRun(ctx, conn, schema).dropTable(name)
+}
+
+// Returns the state of a new call of the migrator, so that calls do not share their connection, transaction and catalog.
+func (m *SQLite) newRun(ctx context.Context, conn *sql.DB, schema NameSchema) *sqliteRun {
+	return &sqliteRun{SQLite: m, ctx: ctx, db: conn, naming: schema}
+}
+
+func (m *sqliteRun) dropTable(name string) error {
+	m.model, m.field = name, ""
+	return m.exec(`DROP TABLE IF EXISTS ` + m.quote(m.naming.Get(name)))
+}
+
+// DropTables drops the given tables in a transaction.
+// Foreign keys are checked when the transaction is committed, after all tables referencing each other were dropped.
+func (m *SQLite) DropTables(ctx context.Context, conn *sql.DB, schema NameSchema, names []string) error {
+	run := m.newRun(ctx, conn, schema)
+	tx, err := run.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	run.tx = tx
+
+	if err := run.exec("PRAGMA defer_foreign_keys = ON"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, name := range names {
+		if err := run.dropTable(name); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (m *sqliteRun) migrateModels(metaModels []MetaModel) error {
+	// read the schema once, the migration is compared to this snapshot
+	catalog, err := m.loadCatalog()
+
+	if err != nil {
+		return err
+	}
+
+	m.catalog = catalog
+	m.diff = &SchemaDiff{Dialect: m, Naming: m.naming, DropColumns: m.DropColumns}
+	m.models = make(map[string]*MetaModel)
+	m.defined = make(map[string]bool)
+
+	for i := range metaModels {
+		if err := m.migrate(&metaModels[i]); err != nil {
+			return err
+		}
+	}
+
+	// foreign keys are created with the tables, the ones of existing tables are added by rebuilding them
+	if err := m.execOperations(m.diff.ForeignKeys()); err != nil {
+		return err
+	}
+
+	return m.createIndexes()
+}
+
+func (m *sqliteRun) migrate(model *MetaModel) error {
+	m.model, m.field = model.ModelName, ""
+
+	// the model is kept to rebuild the table with all of its columns and constraints
+	m.models[m.naming.Get(model.ModelName)] = model
+	ops, err := m.diff.Model(model)
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.execOperations(ops); err != nil {
+		return err
+	}
+
+	m.model, m.field = model.ModelName, ""
+	return m.createIndexes()
+}
+
+// Executes the statements of given operations found by the schema diff.
+func (m *sqliteRun) execOperations(ops []Operation) error {
+	for _, op := range ops {
+		source := op.Origin()
+		m.model, m.field = source.Model, source.Field
+		queries, err := m.SQL(op)
+
+		if err != nil {
+			return err
+		}
+
+		for _, query := range queries {
+			if err := m.exec(query); err != nil {
+				return err
+			}
+		}
+
+		m.apply(op)
+	}
+
+	return nil
+}
+
+// Returns an error if a row references a row which does not exist, which might be the case after rebuilding tables.
+func (m *sqliteRun) checkForeignKeys() error {
+	var table, parent string
+	var rowid sql.NullInt64
+	var fkid int
+	found := false
+	err := m.queryRows(`PRAGMA foreign_key_check`, func(rows *sql.Rows) error {
+		found = true
+		return rows.Scan(&table, &rowid, &parent, &fkid)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if found {
+		return errors.New("Foreign key check failed after rebuilding tables, a row of table '" + table + "' references a missing row in table '" + parent + "'")
+	}
+
+	return nil
+}
+
+// Returns the column declared by the tags of given field.
+// Returns an error for tags which are unknown or not supported by SQLite.
+func (m *sqliteRun) getColumnSpec(field *MetaField) (*sqliteColumnSpec, error) {
+	columnType, notnull, err := m.getFieldType(field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	column := &sqliteColumnSpec{name: m.naming.Get(field.Name), columnType: columnType, notnull: notnull}
+
+	for _, tag := range field.Tags {
+		key := strings.ToLower(tag.Name)
+		value := strings.ToLower(tag.Value)
+
+		if key == "type" || key == "index" || value == "index" || key == "check" || key == "was" || key == "renamed_from" {
+			// the type was read already, indexes and check constraints are created for the table and columns renamed before
+			continue
+		} else if value == "notnull" || value == "not null" {
+			column.notnull = true
+		} else if value == "null" {
+			column.notnull = false
+		} else if key == "default" && value == "nextval(seq)" {
+			return nil, &TagError{m.model, m.field, tag.Name + ":" + tag.Value, "Sequences are not supported by SQLite, use id for AUTOINCREMENT columns"}
+		} else if key == "default" {
+			// value must be case sensitive here
+			column.defaultValue = tag.Value
+		} else if value == "id" {
+			// AUTOINCREMENT is only allowed for columns of type integer
+			column.columnType = "integer"
+			column.notnull = true
+			column.autoIncrement = true
+		} else if value == "pk" || value == "primary key" {
+			// primary keys cannot be null
+			column.notnull = true
+			column.primaryKey = true
+		} else if value == "unique" {
+			column.unique = true
+		} else if key == "seq" || key == "sequence" {
+			return nil, &TagError{m.model, m.field, tag.Name + ":" + tag.Value, "Sequences are not supported by SQLite, use id for AUTOINCREMENT columns"}
+		} else if key == "fk" || key == "foreign key" {
+			// value must be case sensitive here
+			column.fk = tag.Value
+		} else {
+			return nil, unknownTag(m.model, m.field, key, value)
+		}
+	}
+
+	return column, nil
+}
+
+// Returns the database type of given field and whether the column must be not null.
+func (m *sqliteRun) getFieldType(field *MetaField) (string, bool, error) {
+	return getFieldType(m.model, field, m.types, sqliteTypes, false)
+}
+
+// Returns the check constraints declared by the model of given table, which is empty if no model was migrated for it.
+func (m *sqliteRun) getModelChecks(tableName string) ([]sqliteCheck, error) {
+	model := m.models[tableName]
+
+	if model == nil {
+		return nil, nil
+	}
+
+	tagChecks, err := getTagChecks(model, m.naming)
+
+	if err != nil {
+		return nil, err
+	}
+
+	checks := make([]sqliteCheck, 0, len(tagChecks))
+
+	for _, check := range tagChecks {
+		checks = append(checks, sqliteCheck{check.name, check.expr})
+	}
+
+	return checks, nil
+}
+
+// Parses the fk tag value of given column.
+func (m *sqliteRun) getForeignKeyInfo(tableName, columnName, info string) (*sqliteForeignKey, error) {
+	options := strings.Split(info, ",")
+	infos := strings.Split(strings.TrimSpace(options[0]), ".")
+
+	if len(infos) != 2 {
+		return nil, &TagError{m.model,
+			m.field,
+			"fk:" + info,
+			"Two arguments must be specified for fk in model '" + m.model + "': ReferencedModel.ReferencedAttribute"}
+	}
+
+	fk := &sqliteForeignKey{table: tableName,
+		column:    columnName,
+		refTable:  m.naming.Get(infos[0]),
+		refColumn: m.naming.Get(infos[1]),
+		onDelete:  "no action",
+		onUpdate:  "no action"}
+
+	for _, option := range options[1:] {
+		option = strings.Join(strings.Fields(strings.ToLower(option)), " ")
+		var action *string
+
+		if strings.HasPrefix(option, "ondelete:") {
+			action, option = &fk.onDelete, option[len("ondelete:"):]
+		} else if strings.HasPrefix(option, "onupdate:") {
+			action, option = &fk.onUpdate, option[len("onupdate:"):]
+		} else if option == "deferrable" || option == "deferred" || option == "notvalid" || option == "not valid" {
+			return nil, &TagError{m.model, m.field, "fk:" + info, "Option '" + option + "' for fk is not supported by SQLite"}
+		} else {
+			return nil, &TagError{m.model, m.field, "fk:" + info, "Unknown option '" + option + "' for fk in model '" + m.model + "'"}
+		}
+
+		if *action = strings.TrimSpace(option); !containsString(sqliteFkActions, *action) {
+			return nil, &TagError{m.model,
+				m.field,
+				"fk:" + info,
+				"Unknown action '" + *action + "' for fk in model '" + m.model + "': cascade, set null, set default, restrict or no action"}
+		}
+	}
+
+	return fk, nil
+}
+
+// Returns the name of the primary key for given columns, as SQLite does not keep it.
+// Single column primary keys are named after the table, composite ones after their columns.
+func (m *sqliteRun) getPrimaryKeyName(tableName string, columnNames []string) string {
+	if len(columnNames) == 1 {
+		return tableName + "_pkey"
+	}
+
+	return tableName + "_" + strings.Join(columnNames, "_") + "_pkey"
+}
+
+func (m *sqliteRun) getForeignKeyName(tableName, columnName, refTableName, refColumnName string) string {
+	return tableName + "_" + columnName + "_" + refTableName + "_" + refColumnName + "_fk"
+}
+
+func (m *sqliteRun) getUniqueName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_key"
+}
+
+func (m *sqliteRun) quote(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func (m *sqliteRun) quoteColumns(columns []string) string {
+	quoted := make([]string, 0, len(columns))
+
+	for _, column := range columns {
+		quoted = append(quoted, m.quote(column))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// Executes the query within the transaction if one was started and calls scan for each row.
+func (m *sqliteRun) queryRows(query string, scan func(*sql.Rows) error) error {
+	var rows *sql.Rows
+	var err error
+
+	if m.tx != nil {
+		rows, err = m.tx.QueryContext(m.ctx, query)
+	} else {
+		rows, err = m.db.QueryContext(m.ctx, query)
+	}
+
+	if err != nil {
+		return &SQLError{m.model, m.field, query, err}
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (m *sqliteRun) exec(query string) error {
+	if m.plan != nil {
+		m.plan.add(m.model, m.field, query)
+		return nil
+	}
+
+	if m.Log {
+		log.Println(query)
+	}
+
+	var err error
+
+	if m.tx != nil {
+		_, err = m.tx.ExecContext(m.ctx, query)
+	} else {
+		_, err = m.db.ExecContext(m.ctx, query)
+	}
+
+	if err != nil {
+		return &SQLError{m.model, m.field, query, err}
+	}
+
+	return nil
+}
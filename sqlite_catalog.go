@@ -0,0 +1,383 @@
+package gondolier
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+)
+
+// The schema is read from sqlite_master and the table valued pragma functions (SQLite 3.16 or newer).
+const (
+	sqliteTablesQuery = `SELECT name, sql
+		FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`
+	sqliteColumnsQuery = `SELECT m.name, c.name, c.type, c."notnull", c.dflt_value, c.pk
+		FROM sqlite_master m
+		JOIN pragma_table_info(m.name) c
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, c.cid`
+	sqliteForeignKeysQuery = `SELECT m.name, f."from", f."table", COALESCE(f."to", ''), f.on_delete, f.on_update
+		FROM sqlite_master m
+		JOIN pragma_foreign_key_list(m.name) f
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, f.id, f.seq`
+	sqliteIndexesQuery = `SELECT m.name, i.name, i."unique", i.origin, COALESCE(s.sql, ''), COALESCE(c.name, '')
+		FROM sqlite_master m
+		JOIN pragma_index_list(m.name) i
+		JOIN pragma_index_info(i.name) c
+		LEFT JOIN sqlite_master s ON s.type = 'index' AND s.name = i.name
+		WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+		ORDER BY m.name, i.name, c.seqno`
+)
+
+var (
+	sqliteCheckName            = regexp.MustCompile(`(?i)CONSTRAINT\s+"((?:[^"]|"")+)"\s+CHECK\s*\(`)
+	sqliteIndexWhere           = regexp.MustCompile(`(?is)\)\s*WHERE\s+(.+)$`)
+	sqliteAutoIncrementKeyword = regexp.MustCompile(`(?i)\bAUTOINCREMENT\b`)
+)
+
+// sqliteCatalog is a snapshot of the tables, columns, foreign keys and indexes of a database.
+type sqliteCatalog struct {
+	tables      []sqliteTable
+	columns     []sqliteColumn
+	foreignKeys []sqliteForeignKey
+	indexes     []sqliteIndex
+}
+
+// sqliteTable is a table read from the catalog, including the statement it was created with.
+type sqliteTable struct {
+	name string
+	sql  string
+}
+
+// sqliteColumn is a column read from the catalog.
+// Pk is the position of the column in the primary key starting at 1, or 0 if it is not part of it.
+type sqliteColumn struct {
+	table        string
+	name         string
+	columnType   string
+	notnull      bool
+	hasDefault   bool
+	defaultValue string
+	pk           int
+}
+
+// sqliteForeignKey is a foreign key declared by a fk tag or read from the catalog.
+type sqliteForeignKey struct {
+	table     string
+	column    string
+	refTable  string
+	refColumn string
+	onDelete  string
+	onUpdate  string
+}
+
+// sqliteIndex is an index declared by index tags or read from the catalog.
+// Origin is c for indexes created by CREATE INDEX, u for unique constraints and pk for primary keys.
+type sqliteIndex struct {
+	table   string
+	name    string
+	unique  bool
+	origin  string
+	sql     string
+	columns []string
+	where   string
+}
+
+// sqliteCheck is a check constraint declared by a check tag or model or read from the statement of a table.
+type sqliteCheck struct {
+	name string
+	expr string
+}
+
+func (m *sqliteRun) loadCatalog() (*sqliteCatalog, error) {
+	catalog := new(sqliteCatalog)
+	err := m.queryRows(sqliteTablesQuery, func(rows *sql.Rows) error {
+		var table sqliteTable
+
+		if err := rows.Scan(&table.name, &table.sql); err != nil {
+			return err
+		}
+
+		catalog.tables = append(catalog.tables, table)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(sqliteColumnsQuery, func(rows *sql.Rows) error {
+		var column sqliteColumn
+		var defaultValue sql.NullString
+
+		if err := rows.Scan(&column.table, &column.name, &column.columnType, &column.notnull, &defaultValue, &column.pk); err != nil {
+			return err
+		}
+
+		column.hasDefault, column.defaultValue = defaultValue.Valid, defaultValue.String
+		catalog.columns = append(catalog.columns, column)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(sqliteForeignKeysQuery, func(rows *sql.Rows) error {
+		var fk sqliteForeignKey
+
+		if err := rows.Scan(&fk.table, &fk.column, &fk.refTable, &fk.refColumn, &fk.onDelete, &fk.onUpdate); err != nil {
+			return err
+		}
+
+		fk.onDelete = strings.ToLower(fk.onDelete)
+		fk.onUpdate = strings.ToLower(fk.onUpdate)
+		catalog.foreignKeys = append(catalog.foreignKeys, fk)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(sqliteIndexesQuery, func(rows *sql.Rows) error {
+		var index sqliteIndex
+		var column string
+
+		if err := rows.Scan(&index.table, &index.name, &index.unique, &index.origin, &index.sql, &column); err != nil {
+			return err
+		}
+
+		// one row is returned for each column of the index
+		if existing := catalog.index(index.table, index.name); existing != nil {
+			existing.columns = append(existing.columns, column)
+			return nil
+		}
+
+		if where := sqliteIndexWhere.FindStringSubmatch(index.sql); where != nil {
+			index.where = strings.TrimSpace(where[1])
+		}
+
+		index.columns = []string{column}
+		catalog.indexes = append(catalog.indexes, index)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+// Returns the table or nil if it does not exist.
+func (c *sqliteCatalog) table(name string) *sqliteTable {
+	for i := range c.tables {
+		if c.tables[i].name == name {
+			return &c.tables[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the column or nil if it does not exist.
+func (c *sqliteCatalog) column(tableName, name string) *sqliteColumn {
+	for i := range c.columns {
+		if c.columns[i].table == tableName && c.columns[i].name == name {
+			return &c.columns[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns all columns of given table in order.
+func (c *sqliteCatalog) tableColumns(tableName string) []sqliteColumn {
+	columns := make([]sqliteColumn, 0)
+
+	for _, column := range c.columns {
+		if column.table == tableName {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// Returns the columns of the primary key of given table in key order, which are empty if it has none.
+func (c *sqliteCatalog) primaryKey(tableName string) []string {
+	columns := make([]string, 0)
+
+	for pk := 1; ; pk++ {
+		found := false
+
+		for _, column := range c.columns {
+			if column.table == tableName && column.pk == pk {
+				columns = append(columns, column.name)
+				found = true
+			}
+		}
+
+		if !found {
+			return columns
+		}
+	}
+}
+
+// Returns the foreign keys of given table.
+func (c *sqliteCatalog) tableForeignKeys(tableName string) []sqliteForeignKey {
+	fks := make([]sqliteForeignKey, 0)
+
+	for _, fk := range c.foreignKeys {
+		if fk.table == tableName {
+			fks = append(fks, fk)
+		}
+	}
+
+	return fks
+}
+
+// Returns the index of given table or nil if it does not exist.
+func (c *sqliteCatalog) index(tableName, name string) *sqliteIndex {
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName && c.indexes[i].name == name {
+			return &c.indexes[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the indexes of given table and origin, ordered by name.
+func (c *sqliteCatalog) tableIndexes(tableName, origin string) []sqliteIndex {
+	indexes := make([]sqliteIndex, 0)
+
+	for _, index := range c.indexes {
+		if index.table == tableName && index.origin == origin {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return indexes
+}
+
+// Updates the catalog after a table was renamed.
+func (c *sqliteCatalog) renameTable(oldName, newName string) {
+	for i := range c.tables {
+		if c.tables[i].name == oldName {
+			c.tables[i].name = newName
+		}
+	}
+
+	for i := range c.columns {
+		if c.columns[i].table == oldName {
+			c.columns[i].table = newName
+		}
+	}
+
+	for i := range c.foreignKeys {
+		if c.foreignKeys[i].table == oldName {
+			c.foreignKeys[i].table = newName
+		}
+
+		if c.foreignKeys[i].refTable == oldName {
+			c.foreignKeys[i].refTable = newName
+		}
+	}
+
+	for i := range c.indexes {
+		if c.indexes[i].table == oldName {
+			c.indexes[i].table = newName
+		}
+	}
+}
+
+// Updates the catalog after a column was renamed.
+func (c *sqliteCatalog) renameColumn(tableName, oldName, newName string) {
+	for i := range c.columns {
+		if c.columns[i].table == tableName && c.columns[i].name == oldName {
+			c.columns[i].name = newName
+		}
+	}
+
+	for i := range c.foreignKeys {
+		if c.foreignKeys[i].table == tableName && c.foreignKeys[i].column == oldName {
+			c.foreignKeys[i].column = newName
+		}
+
+		if c.foreignKeys[i].refTable == tableName && c.foreignKeys[i].refColumn == oldName {
+			c.foreignKeys[i].refColumn = newName
+		}
+	}
+
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName {
+			c.indexes[i].columns = replaceString(c.indexes[i].columns, oldName, newName)
+		}
+	}
+}
+
+// Updates the catalog after a table was rebuilt with given columns.
+// The indexes of the table are removed, as they are dropped with the old table.
+func (c *sqliteCatalog) rebuildTable(tableName string, columns []sqliteColumn) {
+	existing := c.columns
+	c.columns = make([]sqliteColumn, 0, len(existing))
+
+	for _, column := range existing {
+		if column.table != tableName {
+			c.columns = append(c.columns, column)
+		}
+	}
+
+	c.columns = append(c.columns, columns...)
+	indexes := c.indexes
+	c.indexes = make([]sqliteIndex, 0, len(indexes))
+
+	for _, index := range indexes {
+		if index.table != tableName {
+			c.indexes = append(c.indexes, index)
+		}
+	}
+}
+
+// Removes the index from the catalog after it was dropped.
+func (c *sqliteCatalog) dropIndex(tableName, name string) {
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName && c.indexes[i].name == name {
+			c.indexes = append(c.indexes[:i], c.indexes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Returns the check constraints declared in the statement of a table using CONSTRAINT "name" CHECK (expression).
+// The expression is returned as written, as SQLite keeps the statement text.
+func sqliteParseChecks(statement string) []sqliteCheck {
+	checks := make([]sqliteCheck, 0)
+
+	for _, match := range sqliteCheckName.FindAllStringSubmatchIndex(statement, -1) {
+		name := strings.Replace(statement[match[2]:match[3]], `""`, `"`, -1)
+		depth, inString := 1, false
+
+		// find the closing parenthesis, ignoring parentheses in string literals
+		for i := match[1]; i < len(statement); i++ {
+			if statement[i] == '\'' {
+				inString = !inString
+			} else if !inString && statement[i] == '(' {
+				depth++
+			} else if !inString && statement[i] == ')' {
+				depth--
+
+				if depth == 0 {
+					checks = append(checks, sqliteCheck{name, strings.TrimSpace(statement[match[1]:i])})
+					break
+				}
+			}
+		}
+	}
+
+	return checks
+}
@@ -0,0 +1,561 @@
+package gondolier
+
+import (
+	"strings"
+)
+
+// sqliteAutoIncrement is the default of INTEGER PRIMARY KEY AUTOINCREMENT columns, which are declared by the id tag.
+const sqliteAutoIncrement = "AUTOINCREMENT"
+
+// Table returns the current state of given table or nil if it does not exist.
+// It implements the Dialect interface and reads the catalog of the running migration.
+// SQLite does not keep the names of primary keys, unique constraints and foreign keys, so they are named like the ones created by Gondolier.
+// AUTOINCREMENT columns have the default AUTOINCREMENT, like the columns declared by the id tag.
+func (m *sqliteRun) Table(name string) (*TableState, error) {
+	sqliteTable := m.catalog.table(name)
+
+	if sqliteTable == nil {
+		return nil, nil
+	}
+
+	table := &TableState{Name: name}
+	pkColumns := m.catalog.primaryKey(name)
+	autoIncrement := len(pkColumns) == 1 && sqliteAutoIncrementKeyword.MatchString(sqliteTable.sql)
+
+	for _, column := range m.catalog.tableColumns(name) {
+		state := ColumnState{Name: column.name, Type: column.columnType, NotNull: column.notnull}
+
+		if autoIncrement && column.pk == 1 {
+			state.Default = sqliteAutoIncrement
+		} else if column.hasDefault {
+			state.Default = column.defaultValue
+		}
+
+		table.Columns = append(table.Columns, state)
+	}
+
+	if len(pkColumns) > 0 {
+		table.Constraints = append(table.Constraints, ConstraintState{Name: m.getPrimaryKeyName(name, pkColumns), Type: ConstraintPrimaryKey, Columns: pkColumns})
+	}
+
+	for _, index := range m.catalog.tableIndexes(name, "u") {
+		uniqueName := index.name
+
+		if len(index.columns) == 1 {
+			uniqueName = m.getUniqueName(name, index.columns[0])
+		}
+
+		table.Constraints = append(table.Constraints, ConstraintState{Name: uniqueName, Type: ConstraintUnique, Columns: index.columns})
+	}
+
+	for _, fk := range m.catalog.tableForeignKeys(name) {
+		table.Constraints = append(table.Constraints, ConstraintState{Name: m.getForeignKeyName(name, fk.column, fk.refTable, fk.refColumn),
+			Type:       ConstraintForeignKey,
+			Columns:    []string{fk.column},
+			RefTable:   fk.refTable,
+			RefColumns: []string{fk.refColumn},
+			OnDelete:   fk.onDelete,
+			OnUpdate:   fk.onUpdate})
+	}
+
+	for _, check := range sqliteParseChecks(sqliteTable.sql) {
+		table.Constraints = append(table.Constraints, ConstraintState{Name: check.name, Type: ConstraintCheck, Expression: check.expr})
+	}
+
+	for _, index := range m.catalog.tableIndexes(name, "c") {
+		table.Indexes = append(table.Indexes, IndexState{Name: index.name, Columns: index.columns, Unique: index.unique, Where: index.where})
+	}
+
+	return table, nil
+}
+
+// Column returns the column declared by the tags of given field for a table.
+// It implements the Dialect interface.
+// The column is kept to rebuild the table, as SQLite cannot alter columns and constraints.
+func (m *sqliteRun) Column(tableName string, field *MetaField) (*ColumnSpec, error) {
+	m.field = field.Name
+	spec, err := m.getColumnSpec(field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	column := &ColumnSpec{Name: spec.name,
+		Type:       spec.columnType,
+		NotNull:    spec.notnull,
+		PrimaryKey: spec.primaryKey,
+		Id:         spec.autoIncrement,
+		Unique:     spec.unique,
+		Default:    spec.defaultValue}
+
+	if spec.autoIncrement {
+		column.Default = sqliteAutoIncrement
+	}
+
+	if spec.fk != "" {
+		fk, err := m.getForeignKeyInfo(tableName, column.Name, spec.fk)
+
+		if err != nil {
+			return nil, err
+		}
+
+		column.ForeignKey = &ForeignKeySpec{RefTable: fk.refTable,
+			RefColumn: fk.refColumn,
+			OnDelete:  fk.onDelete,
+			OnUpdate:  fk.onUpdate}
+	}
+
+	if m.columns == nil {
+		m.columns = make(map[string]ColumnSpec)
+	}
+
+	m.columns[tableName+"."+column.Name] = *column
+	return column, nil
+}
+
+// Indexes returns the indexes declared by the index tags of given model for a table.
+// It implements the Dialect interface.
+func (m *sqliteRun) Indexes(tableName string, model *MetaModel) ([]IndexSpec, error) {
+	indexes, err := getTagIndexes(model, m.naming, sqliteIndexSupport)
+
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]IndexSpec, 0, len(indexes))
+
+	for _, index := range indexes {
+		specs = append(specs, IndexSpec{index.name, index.field, index.columns, index.unique, index.method, index.where})
+	}
+
+	return specs, nil
+}
+
+// NormalizeType returns given type in the form used by SQLite.
+// It implements the Dialect interface.
+// SQLite keeps the declared type as written, so only the case and spaces are normalized.
+func (m *sqliteRun) NormalizeType(columnType string) string {
+	return strings.ToLower(strings.Join(strings.Fields(columnType), " "))
+}
+
+// NormalizeExpr returns given expression in the form used by SQLite.
+// It implements the Dialect interface.
+// SQLite keeps expressions as written, so they are compared as they are.
+func (m *sqliteRun) NormalizeExpr(expr string) string {
+	expr = strings.TrimSpace(expr)
+
+	if strings.ToLower(expr) == "null" {
+		return ""
+	}
+
+	return expr
+}
+
+// SQL returns the statements for given operation.
+// It implements the Dialect interface.
+// Operations SQLite cannot apply using ALTER TABLE rebuild the table with all columns and constraints of the model,
+// following operations for the same table return no statements then.
+func (m *sqliteRun) SQL(op Operation) ([]string, error) {
+	if tableName, rebuild := m.getTableChange(op); m.defined[tableName] {
+		return nil, nil
+	} else if rebuild {
+		return m.getRebuildTable(tableName)
+	}
+
+	switch op := op.(type) {
+	case *CreateTable:
+		checks, err := m.getModelChecks(op.Table)
+
+		if err != nil {
+			return nil, err
+		}
+
+		definition, err := m.getTableDefinition(op.Table, op.Columns, checks)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{"CREATE TABLE " + m.quote(op.Table) + " " + definition}, nil
+	case *AddColumn:
+		return []string{"ALTER TABLE " + m.quote(op.Table) + " ADD COLUMN " + m.quote(op.Column.Name) + " " + m.getColumnDefinition(&op.Column)}, nil
+	case *CreateIndex:
+		return []string{m.getCreateIndex(op.Table, &op.Index)}, nil
+	case *DropIndex:
+		// the index might have been dropped already by rebuilding the table
+		if m.catalog.index(op.Table, op.Name) == nil {
+			return nil, nil
+		}
+
+		return []string{"DROP INDEX " + m.quote(op.Name)}, nil
+	case *RenameTable:
+		return []string{"ALTER TABLE " + m.quote(op.Table) + " RENAME TO " + m.quote(op.Name)}, nil
+	case *RenameColumn:
+		return []string{"ALTER TABLE " + m.quote(op.Table) + " RENAME COLUMN " + m.quote(op.Column) + " TO " + m.quote(op.Name)}, nil
+	case *RenameConstraint:
+		return nil, nil
+	case *RenameIndex:
+		index := m.catalog.index(op.Table, op.Name)
+
+		if index == nil {
+			return nil, nil
+		}
+
+		// SQLite cannot rename indexes, so it is created again with the new name
+		return []string{"DROP INDEX " + m.quote(op.Name), m.getRenamedIndex(index, op.NewName).sql}, nil
+	case *CreateSequence, *AlterSequenceOwner, *DropSequence, *RenameSequence:
+		return nil, &ModelError{m.model, m.field, "Sequences are not supported by SQLite, use id for AUTOINCREMENT columns"}
+	}
+
+	return nil, &ModelError{m.model, m.field, "Unknown operation"}
+}
+
+// Updates the catalog after the statements of given operation were executed,
+// as the statements of the following operations depend on the tables which were rebuilt and the indexes.
+func (m *sqliteRun) apply(op Operation) {
+	if tableName, rebuild := m.getTableChange(op); rebuild && !m.defined[tableName] {
+		m.rebuiltTable(tableName)
+		return
+	}
+
+	switch op := op.(type) {
+	case *CreateTable:
+		m.defined[op.Table] = true
+	case *AddColumn:
+		if !m.defined[op.Table] {
+			m.catalog.columns = append(m.catalog.columns, sqliteColumn{table: op.Table,
+				name:         op.Column.Name,
+				columnType:   op.Column.Type,
+				notnull:      op.Column.NotNull,
+				hasDefault:   op.Column.Default != "",
+				defaultValue: op.Column.Default})
+		}
+	case *CreateIndex:
+		m.keepIndex(op.Table, op.Index.Name)
+	case *DropIndex:
+		m.catalog.dropIndex(op.Table, op.Name)
+		m.keepIndex(op.Table, op.Name)
+	case *RenameTable:
+		m.catalog.renameTable(op.Table, op.Name)
+	case *RenameColumn:
+		m.catalog.renameColumn(op.Table, op.Column, op.Name)
+	case *RenameIndex:
+		if index := m.catalog.index(op.Table, op.Name); index != nil {
+			*index = *m.getRenamedIndex(index, op.NewName)
+		}
+	}
+}
+
+// Returns the table changed by given operation, if it changes its columns or constraints,
+// and true if the table must be rebuilt for it, as SQLite can only add columns to an existing table.
+func (m *sqliteRun) getTableChange(op Operation) (string, bool) {
+	switch op := op.(type) {
+	case *AddColumn:
+		return op.Table, !m.canAddColumn(&op.Column)
+	case *DropColumn:
+		return op.Table, true
+	case *AlterColumnType:
+		return op.Table, true
+	case *AlterColumnNotNull:
+		return op.Table, true
+	case *AlterColumnDefault:
+		return op.Table, true
+	case *AddPrimaryKey:
+		return op.Table, true
+	case *AddUnique:
+		return op.Table, true
+	case *AddForeignKey:
+		return op.Table, true
+	case *AddCheck:
+		return op.Table, true
+	case *DropConstraint:
+		return op.Table, true
+	case *RenameConstraint:
+		// check constraints are named in the statement of the table, the names of other constraints are not kept by SQLite
+		return op.Table, op.Type == ConstraintCheck
+	}
+
+	return "", false
+}
+
+// Returns true if the column can be added using ALTER TABLE ADD COLUMN, which does not support
+// primary keys, unique constraints, not null without a default value and defaults which are no constants.
+// Columns with foreign keys are added by rebuilding the table, so that the constraint is named.
+func (m *sqliteRun) canAddColumn(column *ColumnSpec) bool {
+	defaultValue := strings.ToLower(strings.TrimSpace(column.Default))
+
+	if column.PrimaryKey || column.Id || column.Unique || column.ForeignKey != nil {
+		return false
+	}
+
+	if strings.HasPrefix(defaultValue, "(") || strings.HasPrefix(defaultValue, "current_") {
+		return false
+	}
+
+	return !column.NotNull || (defaultValue != "" && defaultValue != "null")
+}
+
+// Returns the statements to rebuild the table by creating a new table, copying the data, dropping the old table and renaming the new one.
+func (m *sqliteRun) getRebuildTable(tableName string) ([]string, error) {
+	columns := m.getRebuildColumns(tableName)
+	checks, err := m.getModelChecks(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// constraints are named after the table, not the new table
+	newName := sqliteRebuildPrefix + tableName
+	definition, err := m.getTableDefinition(tableName, columns, checks)
+
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []string{"CREATE TABLE " + m.quote(newName) + " " + definition}
+	copyColumns := make([]string, 0, len(columns))
+
+	for _, column := range columns {
+		if m.catalog.column(tableName, column.Name) != nil {
+			copyColumns = append(copyColumns, column.Name)
+		}
+	}
+
+	if len(copyColumns) > 0 {
+		queries = append(queries, "INSERT INTO "+m.quote(newName)+" ("+m.quoteColumns(copyColumns)+") "+
+			"SELECT "+m.quoteColumns(copyColumns)+" FROM "+m.quote(tableName))
+	}
+
+	return append(queries,
+		"DROP TABLE "+m.quote(tableName),
+		"ALTER TABLE "+m.quote(newName)+" RENAME TO "+m.quote(tableName)), nil
+}
+
+// Updates the catalog after given table was rebuilt.
+// The indexes are dropped with the old table, the ones of columns which still exist are created again after the model was migrated.
+func (m *sqliteRun) rebuiltTable(tableName string) {
+	columns := m.getRebuildColumns(tableName)
+	pkColumns := m.getPrimaryKeyColumns(columns)
+	tableColumns := make([]sqliteColumn, 0, len(columns))
+
+	for _, column := range columns {
+		tableColumns = append(tableColumns, sqliteColumn{table: tableName,
+			name:         column.Name,
+			columnType:   column.Type,
+			notnull:      column.NotNull,
+			hasDefault:   column.Default != "" && column.Default != sqliteAutoIncrement,
+			defaultValue: column.Default,
+			pk:           m.getPrimaryKeyPosition(pkColumns, column.Name)})
+	}
+
+	for _, index := range m.catalog.tableIndexes(tableName, "c") {
+		if index.sql != "" && m.columnsContain(columns, index.columns) {
+			m.restoreIndexes = append(m.restoreIndexes, index)
+		}
+	}
+
+	m.catalog.rebuildTable(tableName, tableColumns)
+	m.defined[tableName] = true
+	m.rebuilt = true
+}
+
+// Returns the columns of the model of given table in field order, followed by the columns which are not part of it, unless DropColumns is set.
+func (m *sqliteRun) getRebuildColumns(tableName string) []ColumnSpec {
+	columns := make([]ColumnSpec, 0)
+
+	if model := m.models[tableName]; model != nil {
+		for _, field := range model.Fields {
+			if column, ok := m.columns[tableName+"."+m.naming.Get(field.Name)]; ok {
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	if m.DropColumns {
+		return columns
+	}
+
+	for _, column := range m.catalog.tableColumns(tableName) {
+		if !m.columnsContain(columns, []string{column.name}) {
+			spec := ColumnSpec{Name: column.name, Type: column.columnType, NotNull: column.notnull}
+
+			if column.hasDefault {
+				spec.Default = column.defaultValue
+			}
+
+			columns = append(columns, spec)
+		}
+	}
+
+	return columns
+}
+
+// Creates the indexes again which were dropped by rebuilding tables and not dropped or created by the schema diff.
+func (m *sqliteRun) createIndexes() error {
+	indexes := m.restoreIndexes
+	m.restoreIndexes = nil
+
+	for _, index := range indexes {
+		if err := m.exec(index.sql); err != nil {
+			return err
+		}
+
+		m.catalog.indexes = append(m.catalog.indexes, index)
+	}
+
+	return nil
+}
+
+// Removes the index of given name from the ones created again, as it was dropped or created by the schema diff.
+func (m *sqliteRun) keepIndex(tableName, name string) {
+	indexes := make([]sqliteIndex, 0, len(m.restoreIndexes))
+
+	for _, index := range m.restoreIndexes {
+		if index.table != tableName || index.name != name {
+			indexes = append(indexes, index)
+		}
+	}
+
+	m.restoreIndexes = indexes
+}
+
+// Returns the definition of the table with given columns and check constraints to create it.
+func (m *sqliteRun) getTableDefinition(tableName string, columns []ColumnSpec, checks []sqliteCheck) (string, error) {
+	pkColumns := m.getPrimaryKeyColumns(columns)
+	definitions := make([]string, 0, len(columns))
+	constraints := make([]string, 0)
+	autoIncrement := false
+
+	for i := range columns {
+		column := &columns[i]
+		definition := m.quote(column.Name) + " " + m.getColumnDefinition(column)
+
+		if column.Default == sqliteAutoIncrement {
+			if len(pkColumns) != 1 {
+				return "", &ModelError{m.model, m.field, "AUTOINCREMENT requires id to be the only primary key column"}
+			}
+
+			definition += " PRIMARY KEY AUTOINCREMENT"
+			autoIncrement = true
+		}
+
+		definitions = append(definitions, definition)
+
+		if column.Unique {
+			constraints = append(constraints, "CONSTRAINT "+m.quote(m.getUniqueName(tableName, column.Name))+" UNIQUE ("+m.quote(column.Name)+")")
+		}
+
+		if column.ForeignKey != nil {
+			constraints = append(constraints, m.getForeignKeyConstraint(tableName, column))
+		}
+	}
+
+	if len(pkColumns) > 0 && !autoIncrement {
+		definitions = append(definitions, "PRIMARY KEY ("+m.quoteColumns(pkColumns)+")")
+	}
+
+	for _, check := range checks {
+		constraints = append(constraints, "CONSTRAINT "+m.quote(check.name)+" CHECK ("+check.expr+")")
+	}
+
+	definitions = append(definitions, constraints...)
+	return "(" + strings.Join(definitions, ", ") + ")", nil
+}
+
+// Returns the definition of a column without its primary key.
+func (m *sqliteRun) getColumnDefinition(column *ColumnSpec) string {
+	definition := column.Type
+
+	if column.NotNull {
+		definition += " NOT NULL"
+	}
+
+	if column.Default != "" && column.Default != sqliteAutoIncrement {
+		definition += " DEFAULT " + column.Default
+	}
+
+	return definition
+}
+
+func (m *sqliteRun) getForeignKeyConstraint(tableName string, column *ColumnSpec) string {
+	fk := column.ForeignKey
+	constraint := "CONSTRAINT " + m.quote(m.getForeignKeyName(tableName, column.Name, fk.RefTable, fk.RefColumn)) +
+		" FOREIGN KEY (" + m.quote(column.Name) + ")" +
+		" REFERENCES " + m.quote(fk.RefTable) + " (" + m.quote(fk.RefColumn) + ")"
+
+	if fk.OnDelete != "no action" {
+		constraint += " ON DELETE " + strings.ToUpper(fk.OnDelete)
+	}
+
+	if fk.OnUpdate != "no action" {
+		constraint += " ON UPDATE " + strings.ToUpper(fk.OnUpdate)
+	}
+
+	return constraint
+}
+
+func (m *sqliteRun) getCreateIndex(tableName string, index *IndexSpec) string {
+	query := "CREATE "
+
+	if index.Unique {
+		query += "UNIQUE "
+	}
+
+	query += "INDEX " + m.quote(index.Name) + " ON " + m.quote(tableName) + " (" + m.quoteColumns(index.Columns) + ")"
+
+	if index.Where != "" {
+		query += " WHERE " + index.Where
+	}
+
+	return query
+}
+
+// Returns given index with a new name and the statement to create it.
+func (m *sqliteRun) getRenamedIndex(index *sqliteIndex, name string) *sqliteIndex {
+	renamed := *index
+	renamed.name = name
+	renamed.sql = m.getCreateIndex(index.table, &IndexSpec{Name: name, Columns: index.columns, Unique: index.unique, Where: index.where})
+	return &renamed
+}
+
+// Returns the names of all primary key columns in order.
+func (m *sqliteRun) getPrimaryKeyColumns(columns []ColumnSpec) []string {
+	names := make([]string, 0)
+
+	for _, column := range columns {
+		if column.PrimaryKey || column.Id {
+			names = append(names, column.Name)
+		}
+	}
+
+	return names
+}
+
+func (m *sqliteRun) getPrimaryKeyPosition(pkColumns []string, column string) int {
+	for i, pk := range pkColumns {
+		if pk == column {
+			return i + 1
+		}
+	}
+
+	return 0
+}
+
+func (m *sqliteRun) columnsContain(columns []ColumnSpec, names []string) bool {
+	for _, name := range names {
+		found := false
+
+		for _, column := range columns {
+			if column.Name == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,507 @@
+package gondolier
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type testSQLiteUser struct {
+	Id      uint64  `gondolier:"type:bigint;id"`
+	Name    string  `gondolier:"type:varchar(100);notnull;unique"`
+	Age     uint    `gondolier:"type:integer;notnull;default:0;check:age >= 0"`
+	Picture *uint64 `gondolier:"fk:testSQLitePicture.Id,ondelete:set null;index"`
+}
+
+type testSQLitePicture struct {
+	Id       uint64 `gondolier:"id"`
+	FileName string `gondolier:"type:varchar(255);notnull"`
+}
+
+type testSQLiteRebuild struct {
+	Id     uint64  `gondolier:"id"`
+	Name   string  `gondolier:"type:varchar(200);notnull;default:'unknown';was:Title"`
+	Amount float64 `gondolier:"type:real;notnull;default:0"`
+	Parent *uint64 `gondolier:"fk:testSQLiteRebuild.Id,ondelete:cascade"`
+	Note   *string `gondolier:"index:note,where:note IS NOT NULL"`
+}
+
+type testSQLiteComposite struct {
+	A uint64 `gondolier:"pk"`
+	B uint64 `gondolier:"pk"`
+}
+
+type testSQLiteRenamed struct {
+	Id   uint64 `gondolier:"id"`
+	Name string `gondolier:"index"`
+}
+
+func (m testSQLiteRenamed) GondolierPreviousNames() []string {
+	return []string{"testSQLiteOld"}
+}
+
+type testSQLiteAddColumn struct {
+	Id    uint64  `gondolier:"id"`
+	Note  *string `gondolier:"default:'none'"`
+	Count int     `gondolier:"default:0"`
+}
+
+type testSQLiteSeq struct {
+	Id uint64 `gondolier:"type:bigint;pk;seq:1,1,-,-,1;default:nextval(seq)"`
+}
+
+type testSQLiteDeferrable struct {
+	Id      uint64 `gondolier:"id"`
+	Picture uint64 `gondolier:"fk:testSQLitePicture.Id,deferred"`
+}
+
+type testSQLiteIndexMethod struct {
+	Id   uint64 `gondolier:"id"`
+	Name string `gondolier:"index:name,gin"`
+}
+
+type testSQLiteAutoIncrement struct {
+	Id   uint64 `gondolier:"id"`
+	Name string `gondolier:"pk"`
+}
+
+type testSQLiteCycleA struct {
+	Id uint64 `gondolier:"id"`
+	B  uint64 `gondolier:"null;fk:testSQLiteCycleB.Id"`
+}
+
+type testSQLiteCycleB struct {
+	Id uint64 `gondolier:"id"`
+	A  uint64 `gondolier:"fk:testSQLiteCycleA.Id"`
+}
+
+func TestSQLiteParseChecks(t *testing.T) {
+	checks := sqliteParseChecks(`CREATE TABLE "t" ("a" integer, CONSTRAINT "t_a_check" CHECK (a >= 0 AND (a < 10)), ` +
+		`CONSTRAINT "t_""b""_check" CHECK (b IN ('(', ')')), CONSTRAINT "t_c_key" UNIQUE ("c"))`)
+
+	if len(checks) != 2 {
+		t.Fatalf("Two check constraints must have been found, but was: %v", checks)
+	}
+
+	if checks[0].name != "t_a_check" || checks[0].expr != "a >= 0 AND (a < 10)" {
+		t.Fatalf("First check constraint not as expected: %v", checks[0])
+	}
+
+	if checks[1].name != `t_"b"_check` || checks[1].expr != "b IN ('(', ')')" {
+		t.Fatalf("Second check constraint not as expected: %v", checks[1])
+	}
+}
+
+func TestSQLiteColumnSpec(t *testing.T) {
+	sqlite := &sqliteRun{SQLite: &SQLite{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testSQLiteUser{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := make([]ColumnSpec, 0, len(model.Fields))
+
+	for i := range model.Fields {
+		column, err := sqlite.Column("test_sq_lite_user", &model.Fields[i])
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		columns = append(columns, *column)
+	}
+
+	definition, err := sqlite.getTableDefinition("test_sq_lite_user", columns, []sqliteCheck{{"test_sq_lite_user_age_check", "age >= 0"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT, ` +
+		`"name" varchar(100) NOT NULL, ` +
+		`"age" integer NOT NULL DEFAULT 0, ` +
+		`"picture" integer, ` +
+		`CONSTRAINT "test_sq_lite_user_name_key" UNIQUE ("name"), ` +
+		`CONSTRAINT "test_sq_lite_user_picture_test_sq_lite_picture_id_fk" FOREIGN KEY ("picture") REFERENCES "test_sq_lite_picture" ("id") ON DELETE SET NULL, ` +
+		`CONSTRAINT "test_sq_lite_user_age_check" CHECK (age >= 0))`
+
+	if definition != expected {
+		t.Fatalf("Definition not as expected: %v", definition)
+	}
+}
+
+func TestSQLiteNullFieldType(t *testing.T) {
+	sqlite := &sqliteRun{SQLite: &SQLite{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testNullTypes{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"datetime", "integer", "integer", "integer"}
+
+	for i, field := range model.Fields {
+		columnType, notnull, err := sqlite.getFieldType(&field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if columnType != expected[i] || notnull {
+			t.Fatalf("Type of field %v not as expected: %v %v", field.Name, columnType, notnull)
+		}
+	}
+}
+
+func TestSQLiteUnsupportedTags(t *testing.T) {
+	models := []interface{}{testSQLiteSeq{}, testSQLiteDeferrable{}, testSQLiteIndexMethod{}}
+
+	for _, model := range models {
+		g := New(testsqlitedb, &SQLite{})
+		g.Model(model, testSQLitePicture{})
+
+		if _, err := g.Plan(); err == nil || !strings.Contains(err.Error(), "not supported") {
+			t.Fatalf("Unsupported tag must return an error, but was: %v", err)
+		}
+	}
+
+	g := New(testsqlitedb, &SQLite{})
+	g.Model(testSQLiteAutoIncrement{})
+
+	if _, err := g.Plan(); err == nil || !strings.Contains(err.Error(), "AUTOINCREMENT") {
+		t.Fatalf("Composite primary key with id must return an error, but was: %v", err)
+	}
+}
+
+func TestSQLiteCreateTable(t *testing.T) {
+	testCleanSQLiteDb()
+	t.Log("--- TestSQLiteCreateTable ---")
+
+	sqlite := &SQLite{Log: true}
+	g := New(testsqlitedb, sqlite)
+	g.Model(testSQLiteUser{}, testSQLitePicture{}, testSQLiteComposite{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := testSQLiteCatalog(t, sqlite)
+
+	if catalog.table("test_sq_lite_user") == nil || catalog.table("test_sq_lite_picture") == nil {
+		t.Fatalf("Tables must have been created: %v", catalog.tables)
+	}
+
+	if pk := catalog.primaryKey("test_sq_lite_composite"); strings.Join(pk, ",") != "a,b" {
+		t.Fatalf("Composite primary key must have been created, but was: %v", pk)
+	}
+
+	if fks := catalog.tableForeignKeys("test_sq_lite_user"); len(fks) != 1 || fks[0].column != "picture" || fks[0].refTable != "test_sq_lite_picture" || fks[0].onDelete != "set null" {
+		t.Fatalf("Foreign key must have been created, but was: %v", fks)
+	}
+
+	if catalog.index("test_sq_lite_user", "test_sq_lite_user_picture_idx") == nil {
+		t.Fatal("Index must have been created")
+	}
+
+	if _, err := testsqlitedb.Exec(`INSERT INTO "test_sq_lite_user" ("name", "age") VALUES ('a', -1)`); err == nil {
+		t.Fatal("Check constraint must have been created")
+	}
+
+	// migrating again must not change anything
+	g.Model(testSQLiteUser{}, testSQLitePicture{}, testSQLiteComposite{})
+	plan, err := g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		t.Fatalf("Plan must be empty, but was: %v", plan)
+	}
+}
+
+func TestSQLiteAddColumn(t *testing.T) {
+	testCleanSQLiteDb()
+	t.Log("--- TestSQLiteAddColumn ---")
+
+	if _, err := testsqlitedb.Exec(`CREATE TABLE "test_sq_lite_picture" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	sqlite := &SQLite{Log: true}
+	g := New(testsqlitedb, sqlite)
+	g.Model(testSQLitePicture{})
+	plan, err := g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// not null without a default cannot be added
+	if len(plan.Statements) != 4 || !strings.HasPrefix(plan.Statements[0].Query, `CREATE TABLE "gondolier_new_test_sq_lite_picture"`) {
+		t.Fatalf("Table must be rebuilt, but was: %v", plan)
+	}
+
+	if _, err := testsqlitedb.Exec(`CREATE TABLE "test_sq_lite_add_column" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	g = New(testsqlitedb, sqlite)
+	g.Model(testSQLiteAddColumn{})
+	plan, err = g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `ALTER TABLE "test_sq_lite_add_column" ADD COLUMN "note" text DEFAULT 'none';
+ALTER TABLE "test_sq_lite_add_column" ADD COLUMN "count" integer NOT NULL DEFAULT 0;
+`
+
+	if plan.String() != expected {
+		t.Fatalf("Columns must be added, but was: %v", plan)
+	}
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if column := testSQLiteCatalog(t, sqlite).column("test_sq_lite_add_column", "count"); column == nil || !column.notnull || column.defaultValue != "0" {
+		t.Fatalf("Column must have been added, but was: %v", column)
+	}
+}
+
+func TestSQLiteRebuild(t *testing.T) {
+	testCleanSQLiteDb()
+	t.Log("--- TestSQLiteRebuild ---")
+
+	if _, err := testsqlitedb.Exec(`CREATE TABLE "test_sq_lite_rebuild" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT,
+		"title" varchar(100),
+		"amount" integer,
+		"parent" integer,
+		"keep_me" text,
+		"drop_me" text)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testsqlitedb.Exec(`CREATE INDEX "custom_keep_me" ON "test_sq_lite_rebuild" ("keep_me")`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testsqlitedb.Exec(`CREATE INDEX "custom_drop_me" ON "test_sq_lite_rebuild" ("drop_me")`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testsqlitedb.Exec(`INSERT INTO "test_sq_lite_rebuild" ("id", "title", "amount", "parent", "keep_me") VALUES (1, 'first', 5, NULL, 'keep'), (2, 'second', 7, 1, NULL)`); err != nil {
+		t.Fatal(err)
+	}
+
+	sqlite := &SQLite{Log: true}
+	g := New(testsqlitedb, sqlite)
+	g.Model(testSQLiteRebuild{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := testSQLiteCatalog(t, sqlite)
+
+	if catalog.table(sqliteRebuildPrefix+"test_sq_lite_rebuild") != nil || catalog.column("test_sq_lite_rebuild", "title") != nil {
+		t.Fatal("Table must have been rebuilt and the column renamed")
+	}
+
+	if catalog.column("test_sq_lite_rebuild", "keep_me") == nil || catalog.column("test_sq_lite_rebuild", "drop_me") == nil {
+		t.Fatal("Columns must be kept if DropColumns is not set")
+	}
+
+	if name := catalog.column("test_sq_lite_rebuild", "name"); name == nil || name.columnType != "varchar(200)" || !name.notnull {
+		t.Fatalf("Column must have been changed, but was: %v", name)
+	}
+
+	if catalog.index("test_sq_lite_rebuild", "custom_keep_me") == nil || catalog.index("test_sq_lite_rebuild", "test_sq_lite_rebuild_note_idx") == nil {
+		t.Fatal("Indexes must have been recreated")
+	}
+
+	var name string
+	var amount float64
+
+	if err := testsqlitedb.QueryRow(`SELECT "name", "amount" FROM "test_sq_lite_rebuild" WHERE "id" = 2`).Scan(&name, &amount); err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "second" || amount != 7 {
+		t.Fatalf("Data must have been copied, but was: %v %v", name, amount)
+	}
+
+	// the foreign key must be enforced again after migrating
+	if _, err := testsqlitedb.Exec(`INSERT INTO "test_sq_lite_rebuild" ("name", "parent") VALUES ('third', 42)`); err == nil {
+		t.Fatal("Foreign key must have been created")
+	}
+
+	// drop columns and their indexes
+	sqlite.DropColumns = true
+	g.Model(testSQLiteRebuild{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog = testSQLiteCatalog(t, sqlite)
+
+	if catalog.column("test_sq_lite_rebuild", "keep_me") != nil || catalog.column("test_sq_lite_rebuild", "drop_me") != nil {
+		t.Fatal("Columns must have been dropped")
+	}
+
+	if catalog.index("test_sq_lite_rebuild", "custom_keep_me") != nil || catalog.index("test_sq_lite_rebuild", "custom_drop_me") != nil {
+		t.Fatal("Indexes of dropped columns must have been dropped")
+	}
+
+	g.Model(testSQLiteRebuild{})
+	plan, err := g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !plan.Empty() {
+		t.Fatalf("Plan must be empty, but was: %v", plan)
+	}
+}
+
+func TestSQLiteRebuildForeignKeyCheck(t *testing.T) {
+	testCleanSQLiteDb()
+	t.Log("--- TestSQLiteRebuildForeignKeyCheck ---")
+
+	if _, err := testsqlitedb.Exec(`CREATE TABLE "test_sq_lite_rebuild" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT, "name" varchar(200) NOT NULL DEFAULT 'unknown', "amount" real NOT NULL DEFAULT 0, "parent" integer, "note" text)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testsqlitedb.Exec(`INSERT INTO "test_sq_lite_rebuild" ("id", "parent") VALUES (1, 42)`); err != nil {
+		t.Fatal(err)
+	}
+
+	g := New(testsqlitedb, &SQLite{Log: true})
+	g.Model(testSQLiteRebuild{})
+
+	if err := g.MigrateE(); err == nil || !strings.Contains(err.Error(), "Foreign key check failed") {
+		t.Fatalf("Migration must fail if a foreign key is violated, but was: %v", err)
+	}
+
+	var fks int
+
+	if err := testsqlitedb.QueryRow(`SELECT COUNT(*) FROM pragma_foreign_key_list('test_sq_lite_rebuild')`).Scan(&fks); err != nil || fks != 0 {
+		t.Fatalf("Migration must have been rolled back, but was: %v %v", fks, err)
+	}
+}
+
+func TestSQLiteRenameTable(t *testing.T) {
+	testCleanSQLiteDb()
+	t.Log("--- TestSQLiteRenameTable ---")
+
+	if _, err := testsqlitedb.Exec(`CREATE TABLE "test_sq_lite_old" ("id" integer NOT NULL PRIMARY KEY AUTOINCREMENT, "name" text NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testsqlitedb.Exec(`CREATE INDEX "test_sq_lite_old_name_idx" ON "test_sq_lite_old" ("name")`); err != nil {
+		t.Fatal(err)
+	}
+
+	sqlite := &SQLite{Log: true}
+	g := New(testsqlitedb, sqlite)
+	g.Model(testSQLiteRenamed{})
+	plan, err := g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `ALTER TABLE "test_sq_lite_old" RENAME TO "test_sq_lite_renamed";
+DROP INDEX "test_sq_lite_old_name_idx";
+CREATE INDEX "test_sq_lite_renamed_name_idx" ON "test_sq_lite_renamed" ("name");
+`
+
+	if plan.String() != expected {
+		t.Fatalf("Table must be renamed, but was: %v", plan)
+	}
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if catalog := testSQLiteCatalog(t, sqlite); catalog.table("test_sq_lite_old") != nil || catalog.table("test_sq_lite_renamed") == nil {
+		t.Fatalf("Table must have been renamed: %v", catalog.tables)
+	}
+}
+
+func TestSQLiteDropTable(t *testing.T) {
+	testCleanSQLiteDb()
+	t.Log("--- TestSQLiteDropTable ---")
+
+	sqlite := &SQLite{Log: true}
+	g := New(testsqlitedb, sqlite)
+	g.Model(testSQLiteUser{}, testSQLitePicture{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.DropE(testSQLitePicture{}, testSQLiteUser{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if catalog := testSQLiteCatalog(t, sqlite); catalog.table("test_sq_lite_user") != nil || catalog.table("test_sq_lite_picture") != nil {
+		t.Fatalf("Tables must have been dropped: %v", catalog.tables)
+	}
+}
+
+func TestSQLiteDropTablesCycle(t *testing.T) {
+	testCleanSQLiteDb()
+	t.Log("--- TestSQLiteDropTablesCycle ---")
+
+	sqlite := &SQLite{Log: true}
+	g := New(testsqlitedb, sqlite)
+	g.Model(testSQLiteCycleA{}, testSQLiteCycleB{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, query := range []string{`INSERT INTO "test_sq_lite_cycle_a" ("id") VALUES (1)`,
+		`INSERT INTO "test_sq_lite_cycle_b" ("id", "a") VALUES (1, 1)`,
+		`UPDATE "test_sq_lite_cycle_a" SET "b" = 1`} {
+		if _, err := testsqlitedb.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := g.DropE(testSQLiteCycleA{}, testSQLiteCycleB{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if catalog := testSQLiteCatalog(t, sqlite); catalog.table("test_sq_lite_cycle_a") != nil || catalog.table("test_sq_lite_cycle_b") != nil {
+		t.Fatalf("Tables must have been dropped: %v", catalog.tables)
+	}
+}
+
+func testSQLiteCatalog(t *testing.T, sqlite *SQLite) *sqliteCatalog {
+	catalog, err := sqlite.newRun(context.Background(), testsqlitedb, &SnakeCase{}).loadCatalog()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return catalog
+}
+
+func testCleanSQLiteDb() {
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_user"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_picture"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_composite"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_rebuild"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_renamed"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_old"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_add_column"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_cycle_a"`)
+	testsqlitedb.Exec(`DROP TABLE IF EXISTS "test_sq_lite_cycle_b"`)
+}
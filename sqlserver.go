@@ -0,0 +1,642 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mssqlDefaultSchema = "dbo"
+)
+
+var (
+	mssqlTypes = map[reflect.Type]string{reflect.TypeOf(false): "bit",
+		reflect.TypeOf(int(0)):            "bigint",
+		reflect.TypeOf(int8(0)):           "smallint",
+		reflect.TypeOf(int16(0)):          "smallint",
+		reflect.TypeOf(int32(0)):          "int",
+		reflect.TypeOf(int64(0)):          "bigint",
+		reflect.TypeOf(uint(0)):           "bigint",
+		reflect.TypeOf(uint8(0)):          "tinyint",
+		reflect.TypeOf(uint16(0)):         "int",
+		reflect.TypeOf(uint32(0)):         "bigint",
+		reflect.TypeOf(uint64(0)):         "bigint",
+		reflect.TypeOf(float32(0)):        "real",
+		reflect.TypeOf(float64(0)):        "float",
+		reflect.TypeOf(""):                "nvarchar(255)",
+		reflect.TypeOf([]byte{}):          "varbinary(max)",
+		reflect.TypeOf(time.Time{}):       "datetime2",
+		reflect.TypeOf(sql.NullBool{}):    "bit",
+		reflect.TypeOf(sql.NullByte{}):    "tinyint",
+		reflect.TypeOf(sql.NullFloat64{}): "float",
+		reflect.TypeOf(sql.NullInt16{}):   "smallint",
+		reflect.TypeOf(sql.NullInt32{}):   "int",
+		reflect.TypeOf(sql.NullInt64{}):   "bigint",
+		reflect.TypeOf(sql.NullString{}):  "nvarchar(255)",
+		reflect.TypeOf(sql.NullTime{}):    "datetime2"}
+	mssqlTypeAliases = map[string]string{"integer": "int",
+		"dec":                        "decimal",
+		"double precision":           "float",
+		"character":                  "char",
+		"character varying":          "varchar",
+		"char varying":               "varchar",
+		"national character":         "nchar",
+		"national char":              "nchar",
+		"national character varying": "nvarchar",
+		"national char varying":      "nvarchar",
+		"rowversion":                 "timestamp"}
+	mssqlFkActions    = []string{"no action", "cascade", "set null", "set default"}
+	mssqlIndexSupport = &indexSupport{"SQL Server", nil, true}
+	mssqlTypeParts    = regexp.MustCompile(`^([a-z0-9 ]+?)\s*(\(([\w\s,]+)\))?$`)
+)
+
+// SQLServer migrator for Microsoft SQL Server databases (2016 or newer).
+// It accepts the same tags as the Postgres migrator, as far as SQL Server supports them:
+//
+//  // The type must be the database type.
+//  // Optional. If omitted, the type is inferred from the Go type of the field (see RegisterType)
+//  // and the column is not null, unless the field is a pointer or sql.Null* type.
+//  type:database type
+//  // Sets the column as primary key.
+//  // Set it for multiple fields to create a composite primary key.
+//  pk/primary key
+//  // Creates a sequence named table_column_seq with given parameters for the column.
+//  seq:start,increment,minvalue,maxvalue,cache
+//  // Sets the default value for column, strings must be escaped.
+//  // nextval(seq) refers to the sequence of the column (using seq:...).
+//  default:default value/nextval(seq)
+//  // Sets not null constraint for column.
+//  not null/notnull
+//  // Optional. Drops not null constraint if set for column. Not null is also dropped if not null is not set.
+//  null
+//  // Sets unique constraint for column.
+//  unique
+//  // Shortcut for primary key, not null and IDENTITY(1,1).
+//  id
+//  // Sets foreign key constraint for column.
+//  // It refers to the given model and column.
+//  // Referential actions and notvalid (WITH NOCHECK) can be added as options separated by comma.
+//  // Actions are: cascade, set null, set default and no action.
+//  // Example: fk:MyModel.Id,ondelete:cascade,notvalid
+//  fk/foreign key:Model.Column,ondelete:action,onupdate:action,notvalid
+//  // Creates an index for the column. Fields with the same index name share a multi-column index.
+//  // Options are separated by comma: unique and a where clause for filtered indexes, which must be the last option.
+//  // Example: index:name,unique,where:deleted IS NULL
+//  index/index:name,options
+//  // Creates a check constraint for the column named table_column_check.
+//  // Example: check:age >= 0
+//  check:expression
+//  // Renames the column of a previous field name, if the column does not exist yet.
+//  // Example: was:OldName
+//  was/renamed_from:previous field name
+//
+// Constraints are named like the ones of the Postgres migrator, default constraints are named table_column_df.
+// Index methods, deferrable foreign keys and the restrict action are not supported and return an error.
+// The identity of an existing column cannot be changed.
+// Constraints and indexes depending on a column are dropped and recreated when the type of the column changes.
+// Identifiers are quoted using brackets.
+//
+// Models which were renamed can declare their previous names by implementing the Renamer interface.
+// The table is renamed if it still uses a previous name, together with the constraints, indexes and sequences named after it.
+//
+// Schema is the schema to migrate, dbo is used if it is empty.
+//
+// Tables are compared to the data model by the SchemaDiff. The state of a migration is kept for each call,
+// so that one SQLServer migrator can be used by multiple Gondolier instances and goroutines,
+// as long as RegisterType is not called at the same time.
+type SQLServer struct {
+	Schema      string
+	DropColumns bool
+	Log         bool
+
+	types map[reflect.Type]string
+}
+
+// mssqlRun is the state of a single call of the SQLServer migrator, like a migration or plan.
+// It implements the Dialect interface, the tables are compared to the catalog read by the call.
+type mssqlRun struct {
+	*SQLServer
+
+	ctx                context.Context
+	db                 *sql.DB
+	naming             NameSchema
+	tx                 *sql.Tx
+	model              string
+	field              string
+	diff               *SchemaDiff
+	columns            map[string]ColumnSpec
+	modified           map[string]bool
+	createFK           []Operation
+	restoreConstraints []mssqlConstraint
+	restoreIndexes     []mssqlIndex
+	plan               *Plan
+	catalog            *mssqlCatalog
+}
+
+// mssqlColumnSpec is a column declared by the tags of a field.
+type mssqlColumnSpec struct {
+	columnType   string
+	notnull      bool
+	identity     bool
+	primaryKey   bool
+	unique       bool
+	defaultValue string
+	seq          string
+	fk           string
+}
+
+// Migrate migrates the given data model.
+// The migration is rolled back if one of the statements fails or the context is canceled.
+func (m *SQLServer) Migrate(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) error {
+	run := m.newRun(ctx, conn, schema)
+	tx, err := run.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+
+	run.tx = tx
+
+	if err := run.migrateModels(metaModels); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Plan returns the statements Migrate would execute for the given data model, without executing them.
+// The database is read to find the differences between the data model and the schema.
+func (m *SQLServer) Plan(ctx context.Context, conn *sql.DB, schema NameSchema, metaModels []MetaModel) (*Plan, error) {
+	run := m.newRun(ctx, conn, schema)
+	plan := &Plan{make([]Statement, 0)}
+	run.plan = plan
+
+	if err := run.migrateModels(metaModels); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// RegisterType sets the database type for fields of the same Go type as given value, which have no type tag.
+// It overrides the default mapping or adds custom types.
+//
+// Example:
+//  sqlserver.RegisterType("", "nvarchar(max)")
+func (m *SQLServer) RegisterType(value interface{}, dbType string) {
+	m.types = registerType(m.types, value, dbType)
+}
+
+// DropTable drops the given table and the sequences of its columns.
+func (m *SQLServer) DropTable(ctx context.Context, conn *sql.DB, schema NameSchema, name string) error {
+	return m.newRun(ctx, conn, schema).dropTable(name)
+}
+
+// Returns the state of a new call of the migrator, so that calls do not share their connection, transaction and catalog.
+func (m *SQLServer) newRun(ctx context.Context, conn *sql.DB, schema NameSchema) *mssqlRun {
+	return &mssqlRun{SQLServer: m, ctx: ctx, db: conn, naming: schema}
+}
+
+func (m *mssqlRun) dropTable(name string) error {
+	m.model, m.field = name, ""
+	tableName := m.naming.Get(name)
+
+	// sequences are not owned by the table in SQL Server, so they are dropped separately
+	catalog, err := m.loadCatalog()
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.exec("DROP TABLE IF EXISTS " + m.quoteTable(tableName)); err != nil {
+		return err
+	}
+
+	for _, column := range catalog.tableColumns(tableName) {
+		if seq := m.getSequenceName(tableName, column.name); catalog.sequence(seq) {
+			if err := m.exec("DROP SEQUENCE " + m.quoteTable(seq)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DropTables drops the given tables and the sequences of their columns after the foreign keys between them.
+func (m *SQLServer) DropTables(ctx context.Context, conn *sql.DB, schema NameSchema, names []string) error {
+	run := m.newRun(ctx, conn, schema)
+	catalog, err := run.loadCatalog()
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		run.model, run.field = name, ""
+		tableName := run.naming.Get(name)
+
+		for _, fk := range catalog.tableConstraints(tableName, "F") {
+			if err := run.exec("ALTER TABLE " + run.quoteTable(tableName) + " DROP CONSTRAINT " + run.quote(fk.name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range names {
+		if err := run.dropTable(name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *mssqlRun) migrateModels(metaModels []MetaModel) error {
+	// read the schema once, the migration is compared to this snapshot
+	if m.catalog == nil {
+		catalog, err := m.loadCatalog()
+
+		if err != nil {
+			return err
+		}
+
+		m.catalog = catalog
+	}
+
+	m.diff = &SchemaDiff{Dialect: m, Naming: m.naming, DropColumns: m.DropColumns}
+
+	for _, model := range metaModels {
+		if err := m.migrate(&model); err != nil {
+			return err
+		}
+	}
+
+	// create foreign keys after all tables, so that models referencing each other in a cycle can be created
+	if err := m.execOperations(m.diff.ForeignKeys()); err != nil {
+		return err
+	}
+
+	// add the foreign keys again which were dropped to alter their columns
+	createFK := m.createFK
+	m.createFK = nil
+	return m.execOperations(createFK)
+}
+
+func (m *mssqlRun) migrate(model *MetaModel) error {
+	m.model, m.field = model.ModelName, ""
+
+	// create, rename or update the table, foreign keys are created after all tables
+	ops, err := m.diff.Model(model)
+
+	if err != nil {
+		return err
+	}
+
+	if err := m.execOperations(ops); err != nil {
+		return err
+	}
+
+	m.model, m.field = model.ModelName, ""
+
+	if err := m.restoreTable(); err != nil {
+		return err
+	}
+
+	return m.renamePrimaryKey(model)
+}
+
+// Executes the statements of given operations found by the schema diff.
+func (m *mssqlRun) execOperations(ops []Operation) error {
+	for _, op := range ops {
+		source := op.Origin()
+		m.model, m.field = source.Model, source.Field
+		queries, err := m.SQL(op)
+
+		if err != nil {
+			return err
+		}
+
+		for _, query := range queries {
+			if err := m.exec(query); err != nil {
+				return err
+			}
+		}
+
+		m.apply(op)
+	}
+
+	return nil
+}
+
+// Renames the primary key of the table of given model if it was named by SQL Server,
+// as primary keys declared without a name get a generated one.
+func (m *mssqlRun) renamePrimaryKey(model *MetaModel) error {
+	tableName := m.naming.Get(model.ModelName)
+	pk := m.catalog.primaryKey(tableName)
+	pkColumns := getPrimaryKeyColumns(model, m.naming)
+
+	if pk == nil || !strings.HasPrefix(pk.name, "PK__") || strings.Join(pk.columns, ",") != strings.Join(pkColumns, ",") {
+		return nil
+	}
+
+	return m.execOperations([]Operation{&RenameConstraint{Source{model.ModelName, ""},
+		tableName,
+		pk.name,
+		m.getPrimaryKeyName(tableName, pkColumns),
+		ConstraintPrimaryKey}})
+}
+
+// Returns the column declared by the tags of given field.
+// Returns an error for tags which are unknown or not supported by SQL Server.
+func (m *mssqlRun) getColumnSpec(tableName string, field *MetaField) (*mssqlColumnSpec, error) {
+	columnType, notnull, err := m.getFieldType(field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &mssqlColumnSpec{columnType: columnType, notnull: notnull}
+
+	for _, tag := range field.Tags {
+		key := strings.ToLower(tag.Name)
+		value := strings.ToLower(tag.Value)
+
+		if key == "type" || key == "index" || value == "index" || key == "check" || key == "was" || key == "renamed_from" {
+			// the type was read already, indexes and checks are created for the table and columns renamed before
+			continue
+		} else if value == "notnull" || value == "not null" {
+			spec.notnull = true
+		} else if value == "null" {
+			spec.notnull = false
+		} else if key == "default" && value == "nextval(seq)" {
+			spec.defaultValue = "NEXT VALUE FOR " + m.quoteTable(m.getSequenceName(tableName, m.naming.Get(field.Name)))
+		} else if key == "default" {
+			// value must be case sensitive here
+			spec.defaultValue = tag.Value
+		} else if value == "id" {
+			spec.notnull = true
+			spec.identity = true
+		} else if value == "pk" || value == "primary key" {
+			// primary keys cannot be null
+			spec.notnull = true
+			spec.primaryKey = true
+		} else if value == "unique" {
+			spec.unique = true
+		} else if key == "seq" || key == "sequence" {
+			spec.seq = tag.Value
+		} else if key == "fk" || key == "foreign key" {
+			// value must be case sensitive here
+			spec.fk = tag.Value
+		} else {
+			return nil, unknownTag(m.model, m.field, key, value)
+		}
+	}
+
+	return spec, nil
+}
+
+// Returns the database type of given field and whether the column must be not null.
+func (m *mssqlRun) getFieldType(field *MetaField) (string, bool, error) {
+	return getFieldType(m.model, field, m.types, mssqlTypes, false)
+}
+
+// Parses the fk tag value of given column. Returns nil if the value is empty.
+func (m *mssqlRun) getForeignKeyInfo(tableName, columnName, info string) (*mssqlConstraint, error) {
+	if info == "" {
+		return nil, nil
+	}
+
+	options := strings.Split(info, ",")
+	infos := strings.Split(strings.TrimSpace(options[0]), ".")
+
+	if len(infos) != 2 {
+		return nil, &TagError{m.model,
+			m.field,
+			"fk:" + info,
+			"Two arguments must be specified for fk in model '" + m.model + "': ReferencedModel.ReferencedAttribute"}
+	}
+
+	fk := &mssqlConstraint{table: tableName,
+		constraintType: "F",
+		columns:        []string{columnName},
+		refTable:       m.naming.Get(infos[0]),
+		refColumn:      m.naming.Get(infos[1]),
+		onDelete:       "no action",
+		onUpdate:       "no action"}
+	fk.name = m.getForeignKeyName(tableName, columnName, fk.refTable, fk.refColumn)
+
+	for _, option := range options[1:] {
+		option = strings.Join(strings.Fields(strings.ToLower(option)), " ")
+		var action *string
+
+		if strings.HasPrefix(option, "ondelete:") {
+			action, option = &fk.onDelete, option[len("ondelete:"):]
+		} else if strings.HasPrefix(option, "onupdate:") {
+			action, option = &fk.onUpdate, option[len("onupdate:"):]
+		} else if option == "notvalid" || option == "not valid" {
+			fk.notValid = true
+			continue
+		} else if option == "deferrable" || option == "deferred" {
+			return nil, &TagError{m.model, m.field, "fk:" + info, "Option '" + option + "' for fk is not supported by SQL Server"}
+		} else {
+			return nil, &TagError{m.model, m.field, "fk:" + info, "Unknown option '" + option + "' for fk in model '" + m.model + "'"}
+		}
+
+		if *action = strings.TrimSpace(option); *action == "restrict" {
+			return nil, &TagError{m.model, m.field, "fk:" + info, "Action 'restrict' for fk is not supported by SQL Server, use no action instead"}
+		} else if !containsString(mssqlFkActions, *action) {
+			return nil, &TagError{m.model,
+				m.field,
+				"fk:" + info,
+				"Unknown action '" + *action + "' for fk in model '" + m.model + "': cascade, set null, set default or no action"}
+		}
+	}
+
+	return fk, nil
+}
+
+// Returns the name of the primary key for given columns.
+// Single column primary keys are named after the table, composite ones after their columns.
+func (m *mssqlRun) getPrimaryKeyName(tableName string, columnNames []string) string {
+	if len(columnNames) == 1 {
+		return tableName + "_pkey"
+	}
+
+	return tableName + "_" + strings.Join(columnNames, "_") + "_pkey"
+}
+
+func (m *mssqlRun) getForeignKeyName(tableName, columnName, refTableName, refColumnName string) string {
+	return tableName + "_" + columnName + "_" + refTableName + "_" + refColumnName + "_fk"
+}
+
+func (m *mssqlRun) getUniqueName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_key"
+}
+
+func (m *mssqlRun) getDefaultName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_df"
+}
+
+func (m *mssqlRun) getSequenceName(tableName, columnName string) string {
+	return tableName + "_" + columnName + "_seq"
+}
+
+func (m *mssqlRun) getSchema() string {
+	if m.Schema == "" {
+		return mssqlDefaultSchema
+	}
+
+	return m.Schema
+}
+
+func (m *mssqlRun) quote(name string) string {
+	return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+}
+
+// Returns the name of a table or sequence qualified by the schema.
+func (m *mssqlRun) quoteTable(name string) string {
+	return m.quote(m.getSchema()) + "." + m.quote(name)
+}
+
+func (m *mssqlRun) quoteColumns(columns []string) string {
+	quoted := make([]string, 0, len(columns))
+
+	for _, column := range columns {
+		quoted = append(quoted, m.quote(column))
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// Executes the query with the schema as argument within the transaction if one was started and calls scan for each row.
+func (m *mssqlRun) queryRows(query string, scan func(*sql.Rows) error) error {
+	var rows *sql.Rows
+	var err error
+
+	if m.tx != nil {
+		rows, err = m.tx.QueryContext(m.ctx, query, m.getSchema())
+	} else {
+		rows, err = m.db.QueryContext(m.ctx, query, m.getSchema())
+	}
+
+	if err != nil {
+		return &SQLError{m.model, m.field, query, err}
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (m *mssqlRun) exec(query string) error {
+	if m.plan != nil {
+		m.plan.add(m.model, m.field, query)
+		return nil
+	}
+
+	if m.Log {
+		log.Println(query)
+	}
+
+	var err error
+
+	if m.tx != nil {
+		_, err = m.tx.ExecContext(m.ctx, query)
+	} else {
+		_, err = m.db.ExecContext(m.ctx, query)
+	}
+
+	if err != nil {
+		return &SQLError{m.model, m.field, query, err}
+	}
+
+	return nil
+}
+
+// Normalizes a column type to compare it with the type returned by SQL Server,
+// which resolves aliases and adds the default length, precision and scale.
+func mssqlNormalizeType(t string) string {
+	t = strings.Join(strings.Fields(strings.ToLower(t)), " ")
+	parts := mssqlTypeParts.FindStringSubmatch(t)
+
+	if parts == nil {
+		return t
+	}
+
+	name, modifier := parts[1], strings.Replace(parts[3], " ", "", -1)
+
+	if alias, ok := mssqlTypeAliases[name]; ok {
+		name = alias
+	}
+
+	switch name {
+	case "varchar", "char", "nvarchar", "nchar", "varbinary", "binary":
+		if modifier == "" {
+			modifier = "1"
+		}
+	case "decimal", "numeric":
+		if modifier == "" {
+			modifier = "18,0"
+		} else if !strings.Contains(modifier, ",") {
+			modifier += ",0"
+		}
+	case "datetime2", "time", "datetimeoffset":
+		if modifier == "" {
+			modifier = "7"
+		}
+	case "float":
+		// float(1) to float(24) is stored as real
+		if n, err := strconv.Atoi(modifier); err == nil && n <= 24 {
+			return "real"
+		}
+
+		return "float"
+	default:
+		if modifier == "" {
+			return name
+		}
+	}
+
+	return name + "(" + modifier + ")"
+}
+
+// Normalizes an SQL expression to compare it with the expression returned by SQL Server,
+// which adds parentheses and brackets and changes the case of keywords.
+// String literals are kept as they are.
+func mssqlNormalizeExpr(expr string) string {
+	var normalized strings.Builder
+	inString := false
+
+	for _, c := range expr {
+		if c == '\'' {
+			inString = !inString
+		}
+
+		if inString || c == '\'' {
+			normalized.WriteRune(c)
+		} else if !strings.ContainsRune(" \t\r\n()[]", c) {
+			normalized.WriteString(strings.ToLower(string(c)))
+		}
+	}
+
+	return normalized.String()
+}
+
+// Returns given value as a Unicode string literal.
+func mssqlString(value string) string {
+	return "N'" + strings.Replace(value, "'", "''", -1) + "'"
+}
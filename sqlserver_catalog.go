@@ -0,0 +1,491 @@
+package gondolier
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// The schema is read from the sys catalog views, filtered by the schema of the migrator.
+const (
+	mssqlTablesQuery = `SELECT t.name
+		FROM sys.tables t
+		WHERE SCHEMA_NAME(t.schema_id) = @p1
+		ORDER BY t.name`
+	mssqlColumnsQuery = `SELECT t.name, c.name, ty.name, c.max_length, c.precision, c.scale, c.is_nullable, c.is_identity,
+			COALESCE(d.name, ''), COALESCE(d.definition, '')
+		FROM sys.columns c
+		JOIN sys.tables t ON t.object_id = c.object_id
+		JOIN sys.types ty ON ty.user_type_id = c.user_type_id
+		LEFT JOIN sys.default_constraints d ON d.object_id = c.default_object_id
+		WHERE SCHEMA_NAME(t.schema_id) = @p1
+		ORDER BY t.name, c.column_id`
+	mssqlKeyConstraintsQuery = `SELECT t.name, k.name, k.type, c.name
+		FROM sys.key_constraints k
+		JOIN sys.tables t ON t.object_id = k.parent_object_id
+		JOIN sys.index_columns ic ON ic.object_id = k.parent_object_id AND ic.index_id = k.unique_index_id
+		JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+		WHERE SCHEMA_NAME(t.schema_id) = @p1
+		ORDER BY t.name, k.name, ic.key_ordinal`
+	mssqlForeignKeysQuery = `SELECT t.name, f.name, c.name, rt.name, rc.name,
+			f.delete_referential_action_desc, f.update_referential_action_desc, f.is_not_trusted
+		FROM sys.foreign_keys f
+		JOIN sys.tables t ON t.object_id = f.parent_object_id
+		JOIN sys.tables rt ON rt.object_id = f.referenced_object_id
+		JOIN sys.foreign_key_columns fc ON fc.constraint_object_id = f.object_id
+		JOIN sys.columns c ON c.object_id = fc.parent_object_id AND c.column_id = fc.parent_column_id
+		JOIN sys.columns rc ON rc.object_id = fc.referenced_object_id AND rc.column_id = fc.referenced_column_id
+		WHERE SCHEMA_NAME(t.schema_id) = @p1
+		ORDER BY t.name, f.name, fc.constraint_column_id`
+	mssqlChecksQuery = `SELECT t.name, k.name, k.definition
+		FROM sys.check_constraints k
+		JOIN sys.tables t ON t.object_id = k.parent_object_id
+		WHERE SCHEMA_NAME(t.schema_id) = @p1
+		ORDER BY t.name, k.name`
+	mssqlIndexesQuery = `SELECT t.name, i.name, i.is_unique, COALESCE(i.filter_definition, ''), c.name
+		FROM sys.indexes i
+		JOIN sys.tables t ON t.object_id = i.object_id
+		JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+		JOIN sys.columns c ON c.object_id = ic.object_id AND c.column_id = ic.column_id
+		WHERE SCHEMA_NAME(t.schema_id) = @p1
+		AND i.is_primary_key = 0 AND i.is_unique_constraint = 0 AND ic.is_included_column = 0
+		ORDER BY t.name, i.name, ic.key_ordinal`
+	mssqlSequencesQuery = `SELECT s.name
+		FROM sys.sequences s
+		WHERE SCHEMA_NAME(s.schema_id) = @p1
+		ORDER BY s.name`
+)
+
+// mssqlCatalog is a snapshot of the tables, columns, constraints, indexes and sequences of a schema.
+type mssqlCatalog struct {
+	tables      []string
+	columns     []mssqlColumn
+	constraints []mssqlConstraint
+	indexes     []mssqlIndex
+	sequences   []string
+}
+
+// mssqlColumn is a column read from the catalog.
+// The type includes its length, precision and scale. The default is bound to the named default constraint.
+type mssqlColumn struct {
+	table        string
+	name         string
+	columnType   string
+	notnull      bool
+	identity     bool
+	defaultName  string
+	defaultValue string
+}
+
+// mssqlConstraint is a constraint declared by tags or read from the catalog.
+// The constraint type is PK, UQ, F for foreign keys or C for check constraints.
+// The referenced table and column, the referential actions and notValid are set for foreign keys only,
+// the definition for check constraints only.
+type mssqlConstraint struct {
+	table          string
+	name           string
+	constraintType string
+	columns        []string
+	refTable       string
+	refColumn      string
+	onDelete       string
+	onUpdate       string
+	notValid       bool
+	definition     string
+}
+
+// mssqlIndex is an index declared by index tags or read from the catalog.
+type mssqlIndex struct {
+	table   string
+	name    string
+	unique  bool
+	columns []string
+	where   string
+}
+
+func (m *mssqlRun) loadCatalog() (*mssqlCatalog, error) {
+	catalog := new(mssqlCatalog)
+	err := m.queryRows(mssqlTablesQuery, func(rows *sql.Rows) error {
+		var table string
+
+		if err := rows.Scan(&table); err != nil {
+			return err
+		}
+
+		catalog.tables = append(catalog.tables, table)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mssqlColumnsQuery, func(rows *sql.Rows) error {
+		var column mssqlColumn
+		var typeName string
+		var maxLength, precision, scale int
+		var nullable bool
+
+		if err := rows.Scan(&column.table,
+			&column.name,
+			&typeName,
+			&maxLength,
+			&precision,
+			&scale,
+			&nullable,
+			&column.identity,
+			&column.defaultName,
+			&column.defaultValue); err != nil {
+			return err
+		}
+
+		column.columnType = mssqlColumnType(typeName, maxLength, precision, scale)
+		column.notnull = !nullable
+		catalog.columns = append(catalog.columns, column)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mssqlKeyConstraintsQuery, func(rows *sql.Rows) error {
+		var constraint mssqlConstraint
+		var column string
+
+		if err := rows.Scan(&constraint.table, &constraint.name, &constraint.constraintType, &column); err != nil {
+			return err
+		}
+
+		// one row is returned for each column of the constraint
+		if existing := catalog.constraint(constraint.table, constraint.name); existing != nil {
+			existing.columns = append(existing.columns, column)
+			return nil
+		}
+
+		constraint.constraintType = strings.TrimSpace(constraint.constraintType)
+		constraint.columns = []string{column}
+		catalog.constraints = append(catalog.constraints, constraint)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mssqlForeignKeysQuery, func(rows *sql.Rows) error {
+		constraint := mssqlConstraint{constraintType: "F"}
+		var column string
+
+		if err := rows.Scan(&constraint.table,
+			&constraint.name,
+			&column,
+			&constraint.refTable,
+			&constraint.refColumn,
+			&constraint.onDelete,
+			&constraint.onUpdate,
+			&constraint.notValid); err != nil {
+			return err
+		}
+
+		if existing := catalog.constraint(constraint.table, constraint.name); existing != nil {
+			existing.columns = append(existing.columns, column)
+			return nil
+		}
+
+		// actions are returned like NO_ACTION
+		constraint.onDelete = strings.Replace(strings.ToLower(constraint.onDelete), "_", " ", -1)
+		constraint.onUpdate = strings.Replace(strings.ToLower(constraint.onUpdate), "_", " ", -1)
+		constraint.columns = []string{column}
+		catalog.constraints = append(catalog.constraints, constraint)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mssqlChecksQuery, func(rows *sql.Rows) error {
+		constraint := mssqlConstraint{constraintType: "C"}
+
+		if err := rows.Scan(&constraint.table, &constraint.name, &constraint.definition); err != nil {
+			return err
+		}
+
+		catalog.constraints = append(catalog.constraints, constraint)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mssqlIndexesQuery, func(rows *sql.Rows) error {
+		var index mssqlIndex
+		var column string
+
+		if err := rows.Scan(&index.table, &index.name, &index.unique, &index.where, &column); err != nil {
+			return err
+		}
+
+		// one row is returned for each column of the index
+		if existing := catalog.index(index.table, index.name); existing != nil {
+			existing.columns = append(existing.columns, column)
+			return nil
+		}
+
+		index.columns = []string{column}
+		catalog.indexes = append(catalog.indexes, index)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.queryRows(mssqlSequencesQuery, func(rows *sql.Rows) error {
+		var sequence string
+
+		if err := rows.Scan(&sequence); err != nil {
+			return err
+		}
+
+		catalog.sequences = append(catalog.sequences, sequence)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
+func (c *mssqlCatalog) table(name string) bool {
+	return containsString(c.tables, name)
+}
+
+func (c *mssqlCatalog) sequence(name string) bool {
+	return containsString(c.sequences, name)
+}
+
+// Returns the column or nil if it does not exist.
+func (c *mssqlCatalog) column(tableName, name string) *mssqlColumn {
+	for i := range c.columns {
+		if c.columns[i].table == tableName && c.columns[i].name == name {
+			return &c.columns[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns all columns of given table in order.
+func (c *mssqlCatalog) tableColumns(tableName string) []mssqlColumn {
+	columns := make([]mssqlColumn, 0)
+
+	for _, column := range c.columns {
+		if column.table == tableName {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// Returns the constraint of given table or nil if it does not exist.
+func (c *mssqlCatalog) constraint(tableName, name string) *mssqlConstraint {
+	for i := range c.constraints {
+		if c.constraints[i].table == tableName && c.constraints[i].name == name {
+			return &c.constraints[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the constraints of given type for given table, or all constraints of the table if the type is empty.
+func (c *mssqlCatalog) tableConstraints(tableName, constraintType string) []mssqlConstraint {
+	constraints := make([]mssqlConstraint, 0)
+
+	for _, constraint := range c.constraints {
+		if constraint.table == tableName && (constraintType == "" || constraint.constraintType == constraintType) {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	return constraints
+}
+
+// Returns the primary key of given table or nil if it has none.
+func (c *mssqlCatalog) primaryKey(tableName string) *mssqlConstraint {
+	if pk := c.tableConstraints(tableName, "PK"); len(pk) > 0 {
+		return &pk[0]
+	}
+
+	return nil
+}
+
+// Returns the foreign keys of other tables referencing given column.
+func (c *mssqlCatalog) referencingForeignKeys(tableName, columnName string) []mssqlConstraint {
+	constraints := make([]mssqlConstraint, 0)
+
+	for _, constraint := range c.constraints {
+		if constraint.constraintType == "F" && constraint.refTable == tableName && constraint.refColumn == columnName {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	return constraints
+}
+
+// Returns the index of given table or nil if it does not exist.
+func (c *mssqlCatalog) index(tableName, name string) *mssqlIndex {
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName && c.indexes[i].name == name {
+			return &c.indexes[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the indexes of given table, ordered by name.
+func (c *mssqlCatalog) tableIndexes(tableName string) []mssqlIndex {
+	indexes := make([]mssqlIndex, 0)
+
+	for _, index := range c.indexes {
+		if index.table == tableName {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return indexes
+}
+
+// Removes the constraint from the catalog after it was dropped.
+func (c *mssqlCatalog) dropConstraint(tableName, name string) {
+	for i := range c.constraints {
+		if c.constraints[i].table == tableName && c.constraints[i].name == name {
+			c.constraints = append(c.constraints[:i], c.constraints[i+1:]...)
+			return
+		}
+	}
+}
+
+// Removes the index from the catalog after it was dropped.
+func (c *mssqlCatalog) dropIndex(tableName, name string) {
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName && c.indexes[i].name == name {
+			c.indexes = append(c.indexes[:i], c.indexes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Removes the sequence from the catalog after it was dropped.
+func (c *mssqlCatalog) dropSequence(name string) {
+	for i := range c.sequences {
+		if c.sequences[i] == name {
+			c.sequences = append(c.sequences[:i], c.sequences[i+1:]...)
+			return
+		}
+	}
+}
+
+// Updates the catalog after a table was renamed.
+func (c *mssqlCatalog) renameTable(oldName, newName string) {
+	c.tables = replaceString(c.tables, oldName, newName)
+
+	for i := range c.columns {
+		if c.columns[i].table == oldName {
+			c.columns[i].table = newName
+		}
+	}
+
+	for i := range c.constraints {
+		if c.constraints[i].table == oldName {
+			c.constraints[i].table = newName
+		}
+
+		if c.constraints[i].refTable == oldName {
+			c.constraints[i].refTable = newName
+		}
+	}
+
+	for i := range c.indexes {
+		if c.indexes[i].table == oldName {
+			c.indexes[i].table = newName
+		}
+	}
+}
+
+// Updates the catalog after a column was renamed.
+// Check constraints are left unchanged, as SQL Server keeps their definitions as they were.
+func (c *mssqlCatalog) renameColumn(tableName, oldName, newName string) {
+	for i := range c.columns {
+		if c.columns[i].table == tableName && c.columns[i].name == oldName {
+			c.columns[i].name = newName
+		}
+	}
+
+	for i := range c.constraints {
+		if c.constraints[i].table == tableName {
+			c.constraints[i].columns = replaceString(c.constraints[i].columns, oldName, newName)
+		}
+
+		if c.constraints[i].refTable == tableName && c.constraints[i].refColumn == oldName {
+			c.constraints[i].refColumn = newName
+		}
+	}
+
+	for i := range c.indexes {
+		if c.indexes[i].table == tableName {
+			c.indexes[i].columns = replaceString(c.indexes[i].columns, oldName, newName)
+		}
+	}
+}
+
+// Updates the catalog after a constraint, default constraint, index or sequence was renamed.
+func (c *mssqlCatalog) renameObject(tableName, oldName, newName string) {
+	if constraint := c.constraint(tableName, oldName); constraint != nil {
+		constraint.name = newName
+	}
+
+	if index := c.index(tableName, oldName); index != nil {
+		index.name = newName
+	}
+
+	for i := range c.columns {
+		if c.columns[i].table == tableName && c.columns[i].defaultName == oldName {
+			c.columns[i].defaultName = newName
+		}
+	}
+
+	c.sequences = replaceString(c.sequences, oldName, newName)
+}
+
+// Returns the type of a column as it is declared, including its length, precision and scale.
+// The length of nchar and nvarchar is returned in bytes by SQL Server.
+func mssqlColumnType(name string, maxLength, precision, scale int) string {
+	name = strings.ToLower(name)
+
+	switch name {
+	case "varchar", "char", "varbinary", "binary", "nvarchar", "nchar":
+		if maxLength == -1 {
+			return name + "(max)"
+		}
+
+		if name == "nvarchar" || name == "nchar" {
+			maxLength /= 2
+		}
+
+		return name + "(" + strconv.Itoa(maxLength) + ")"
+	case "decimal", "numeric":
+		return name + "(" + strconv.Itoa(precision) + "," + strconv.Itoa(scale) + ")"
+	case "datetime2", "time", "datetimeoffset":
+		return name + "(" + strconv.Itoa(scale) + ")"
+	}
+
+	return name
+}
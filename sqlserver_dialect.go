@@ -0,0 +1,746 @@
+package gondolier
+
+import (
+	"strings"
+)
+
+// mssqlIdentity is the default of IDENTITY columns, which are declared by the id tag.
+const mssqlIdentity = "IDENTITY(1,1)"
+
+// Table returns the current state of given table or nil if it does not exist.
+// It implements the Dialect interface and reads the catalog of the running migration.
+// IDENTITY columns have the default IDENTITY(1,1), like the columns declared by the id tag.
+// Sequences are the ones named after the columns of the table, as SQL Server does not bind them to a column.
+func (m *mssqlRun) Table(name string) (*TableState, error) {
+	if !m.catalog.table(name) {
+		return nil, nil
+	}
+
+	table := &TableState{Name: name}
+
+	for _, column := range m.catalog.tableColumns(name) {
+		state := ColumnState{column.name, column.columnType, column.notnull, column.defaultValue}
+
+		if column.identity {
+			state.Default = mssqlIdentity
+		}
+
+		table.Columns = append(table.Columns, state)
+
+		if seq := m.getSequenceName(name, column.name); m.catalog.sequence(seq) {
+			table.Sequences = append(table.Sequences, seq)
+		}
+	}
+
+	constraintTypes := map[string]ConstraintType{"PK": ConstraintPrimaryKey, "UQ": ConstraintUnique, "F": ConstraintForeignKey, "C": ConstraintCheck}
+
+	for _, constraint := range m.catalog.tableConstraints(name, "") {
+		state := ConstraintState{Name: constraint.name,
+			Type:       constraintTypes[constraint.constraintType],
+			Columns:    constraint.columns,
+			Expression: constraint.definition}
+
+		if constraint.constraintType == "F" {
+			state.RefTable, state.RefColumns = constraint.refTable, []string{constraint.refColumn}
+			state.OnDelete, state.OnUpdate = constraint.onDelete, constraint.onUpdate
+		}
+
+		table.Constraints = append(table.Constraints, state)
+	}
+
+	for _, index := range m.catalog.tableIndexes(name) {
+		table.Indexes = append(table.Indexes, IndexState{Name: index.name, Columns: index.columns, Unique: index.unique, Where: index.where})
+	}
+
+	return table, nil
+}
+
+// Column returns the column declared by the tags of given field for a table.
+// It implements the Dialect interface.
+// The column is kept to alter it, as SQL Server sets the type and not null in one statement.
+func (m *mssqlRun) Column(tableName string, field *MetaField) (*ColumnSpec, error) {
+	m.field = field.Name
+	spec, err := m.getColumnSpec(tableName, field)
+
+	if err != nil {
+		return nil, err
+	}
+
+	columnName := m.naming.Get(field.Name)
+	fk, err := m.getForeignKeyInfo(tableName, columnName, spec.fk)
+
+	if err != nil {
+		return nil, err
+	}
+
+	column := &ColumnSpec{Name: columnName,
+		Type:       spec.columnType,
+		NotNull:    spec.notnull,
+		PrimaryKey: spec.primaryKey,
+		Id:         spec.identity,
+		Unique:     spec.unique,
+		Default:    spec.defaultValue}
+
+	if spec.identity {
+		column.Default = mssqlIdentity
+	}
+
+	if spec.seq != "" {
+		if column.Sequence, err = m.getSequenceSpec(spec.seq); err != nil {
+			return nil, err
+		}
+	}
+
+	if fk != nil {
+		column.ForeignKey = &ForeignKeySpec{RefTable: fk.refTable,
+			RefColumn: fk.refColumn,
+			OnDelete:  fk.onDelete,
+			OnUpdate:  fk.onUpdate,
+			NotValid:  fk.notValid}
+	}
+
+	if m.columns == nil {
+		m.columns = make(map[string]ColumnSpec)
+	}
+
+	m.columns[tableName+"."+column.Name] = *column
+	return column, nil
+}
+
+// Indexes returns the indexes declared by the index tags of given model for a table.
+// It implements the Dialect interface.
+func (m *mssqlRun) Indexes(tableName string, model *MetaModel) ([]IndexSpec, error) {
+	indexes, err := getTagIndexes(model, m.naming, mssqlIndexSupport)
+
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]IndexSpec, 0, len(indexes))
+
+	for _, index := range indexes {
+		specs = append(specs, IndexSpec{index.name, index.field, index.columns, index.unique, index.method, index.where})
+	}
+
+	return specs, nil
+}
+
+// NormalizeType returns given type in the form used by SQL Server.
+// It implements the Dialect interface.
+func (m *mssqlRun) NormalizeType(columnType string) string {
+	return mssqlNormalizeType(columnType)
+}
+
+// NormalizeExpr returns given expression in the form used by SQL Server.
+// It implements the Dialect interface.
+func (m *mssqlRun) NormalizeExpr(expr string) string {
+	return mssqlNormalizeExpr(expr)
+}
+
+// SQL returns the statements for given operation.
+// It implements the Dialect interface.
+// Constraints and indexes depending on a column are dropped to alter it and created again after the table was migrated,
+// foreign keys after all tables were migrated.
+func (m *mssqlRun) SQL(op Operation) ([]string, error) {
+	switch op := op.(type) {
+	case *CreateTable:
+		columns := make([]string, 0, len(op.Columns)+1)
+		constraints := make([]string, 0)
+
+		if len(op.PrimaryKeyColumns) > 0 {
+			constraints = append(constraints, "CONSTRAINT "+m.quote(op.PrimaryKey)+" PRIMARY KEY ("+m.quoteColumns(op.PrimaryKeyColumns)+")")
+		}
+
+		for i := range op.Columns {
+			column := &op.Columns[i]
+			columns = append(columns, m.quote(column.Name)+" "+m.getColumnDefinition(op.Table, column))
+
+			if column.Unique {
+				constraints = append(constraints, "CONSTRAINT "+m.quote(m.getUniqueName(op.Table, column.Name))+" UNIQUE ("+m.quote(column.Name)+")")
+			}
+		}
+
+		columns = append(columns, constraints...)
+		return []string{"CREATE TABLE " + m.quoteTable(op.Table) + " (" + strings.Join(columns, ", ") + ")"}, nil
+	case *AddColumn:
+		queries := []string{"ALTER TABLE " + m.quoteTable(op.Table) + " ADD " + m.quote(op.Column.Name) + " " + m.getColumnDefinition(op.Table, &op.Column)}
+
+		if op.Column.Unique {
+			unique := &mssqlConstraint{table: op.Table, name: m.getUniqueName(op.Table, op.Column.Name), constraintType: "UQ", columns: []string{op.Column.Name}}
+			queries = append(queries, m.getAddConstraint(unique))
+		}
+
+		return queries, nil
+	case *DropColumn:
+		queries := append(m.getDropDependents(op.Table, op.Column), "ALTER TABLE "+m.quoteTable(op.Table)+" DROP COLUMN "+m.quote(op.Column))
+
+		// sequences are not bound to the column, so they are dropped separately
+		if seq := m.getSequenceName(op.Table, op.Column); m.catalog.sequence(seq) {
+			queries = append(queries, "DROP SEQUENCE "+m.quoteTable(seq))
+		}
+
+		return queries, nil
+	case *AlterColumnType:
+		return m.getAlterColumn(op.Table, op.Column)
+	case *AlterColumnNotNull:
+		return m.getAlterColumn(op.Table, op.Column)
+	case *AlterColumnDefault:
+		return m.getAlterColumnDefault(op)
+	case *AddPrimaryKey:
+		return []string{m.getAddConstraint(&mssqlConstraint{table: op.Table, name: op.Name, constraintType: "PK", columns: op.Columns})}, nil
+	case *AddUnique:
+		return []string{m.getAddConstraint(&mssqlConstraint{table: op.Table, name: op.Name, constraintType: "UQ", columns: []string{op.Column}})}, nil
+	case *AddForeignKey:
+		return []string{m.getCreateForeignKey(op)}, nil
+	case *AddCheck:
+		return []string{m.getAddConstraint(&mssqlConstraint{table: op.Table, name: op.Name, constraintType: "C", definition: op.Expression})}, nil
+	case *DropConstraint:
+		constraint := m.catalog.constraint(op.Table, op.Name)
+
+		// the constraint might have been dropped already to alter its column
+		if constraint == nil {
+			return nil, nil
+		}
+
+		queries := make([]string, 0)
+
+		if constraint.constraintType == "PK" {
+			for _, fk := range m.getPrimaryKeyReferences(constraint) {
+				queries = append(queries, m.getDropConstraint(fk.table, fk.name))
+			}
+		}
+
+		return append(queries, m.getDropConstraint(op.Table, op.Name)), nil
+	case *CreateSequence:
+		return []string{m.getCreateSequence(op.Name, &op.Sequence)}, nil
+	case *AlterSequenceOwner:
+		// sequences cannot be owned by a column in SQL Server
+		return nil, nil
+	case *DropSequence:
+		return []string{"DROP SEQUENCE " + m.quoteTable(op.Name)}, nil
+	case *CreateIndex:
+		return []string{m.getCreateIndex(op.Table, &op.Index)}, nil
+	case *DropIndex:
+		if m.catalog.index(op.Table, op.Name) == nil {
+			return nil, nil
+		}
+
+		return []string{m.getDropIndex(op.Table, op.Name)}, nil
+	case *RenameTable:
+		queries := []string{m.getRename(m.quoteTable(op.Table), op.Name, "OBJECT")}
+
+		// default constraints are named after the table and column
+		for _, column := range m.catalog.tableColumns(op.Table) {
+			if column.defaultName == m.getDefaultName(op.Table, column.name) {
+				queries = append(queries, m.getRename(m.quoteTable(column.defaultName), m.getDefaultName(op.Name, column.name), "OBJECT"))
+			}
+		}
+
+		return queries, nil
+	case *RenameColumn:
+		queries := []string{m.getRename(m.quoteTable(op.Table)+"."+m.quote(op.Column), op.Name, "COLUMN")}
+
+		if column := m.catalog.column(op.Table, op.Column); column != nil && column.defaultName == m.getDefaultName(op.Table, op.Column) {
+			queries = append(queries, m.getRename(m.quoteTable(column.defaultName), m.getDefaultName(op.Table, op.Name), "OBJECT"))
+		}
+
+		return queries, nil
+	case *RenameConstraint:
+		return []string{m.getRename(m.quoteTable(op.Name), op.NewName, "OBJECT")}, nil
+	case *RenameSequence:
+		return []string{m.getRename(m.quoteTable(op.Name), op.NewName, "OBJECT")}, nil
+	case *RenameIndex:
+		return []string{m.getRename(m.quoteTable(op.Table)+"."+m.quote(op.Name), op.NewName, "INDEX")}, nil
+	}
+
+	return nil, &ModelError{m.model, m.field, "Unknown operation"}
+}
+
+// Updates the catalog after the statements of given operation were executed,
+// as the statements of the following operations depend on the constraints, indexes and sequences.
+func (m *mssqlRun) apply(op Operation) {
+	switch op := op.(type) {
+	case *DropColumn:
+		m.dropDependents(op.Table, op.Column, false)
+		m.catalog.dropSequence(m.getSequenceName(op.Table, op.Column))
+	case *AlterColumnType:
+		m.alteredColumn(op.Table, op.Column)
+	case *AlterColumnNotNull:
+		m.alteredColumn(op.Table, op.Column)
+	case *AlterColumnDefault:
+		if column := m.catalog.column(op.Table, op.Column); column != nil && !m.modified[op.Table+"."+op.Column] {
+			column.defaultName, column.defaultValue = "", ""
+
+			if op.Default != "" {
+				column.defaultName, column.defaultValue = m.getDefaultName(op.Table, op.Column), op.Default
+			}
+		}
+	case *AddPrimaryKey:
+		m.keepConstraint(op.Table, "")
+	case *AddUnique:
+		m.keepConstraint(op.Table, op.Name)
+	case *AddForeignKey:
+		m.keepForeignKey(op.Name)
+	case *AddCheck:
+		m.keepConstraint(op.Table, op.Name)
+	case *DropConstraint:
+		if constraint := m.catalog.constraint(op.Table, op.Name); constraint != nil && constraint.constraintType == "PK" {
+			for _, fk := range m.getPrimaryKeyReferences(constraint) {
+				m.restoreForeignKey(&fk)
+				m.catalog.dropConstraint(fk.table, fk.name)
+			}
+		}
+
+		m.catalog.dropConstraint(op.Table, op.Name)
+		m.keepConstraint(op.Table, op.Name)
+
+		if op.Type == ConstraintForeignKey {
+			m.keepForeignKey(op.Name)
+		}
+	case *CreateSequence:
+		m.catalog.sequences = append(m.catalog.sequences, op.Name)
+	case *DropSequence:
+		m.catalog.dropSequence(op.Name)
+	case *CreateIndex:
+		m.keepConstraint(op.Table, op.Index.Name)
+	case *DropIndex:
+		m.catalog.dropIndex(op.Table, op.Name)
+		m.keepConstraint(op.Table, op.Name)
+	case *RenameTable:
+		m.catalog.renameTable(op.Table, op.Name)
+
+		for _, column := range m.catalog.tableColumns(op.Name) {
+			if column.defaultName == m.getDefaultName(op.Table, column.name) {
+				m.catalog.renameObject(op.Name, column.defaultName, m.getDefaultName(op.Name, column.name))
+			}
+		}
+	case *RenameColumn:
+		if column := m.catalog.column(op.Table, op.Column); column != nil && column.defaultName == m.getDefaultName(op.Table, op.Column) {
+			m.catalog.renameObject(op.Table, column.defaultName, m.getDefaultName(op.Table, op.Name))
+		}
+
+		m.catalog.renameColumn(op.Table, op.Column, op.Name)
+	case *RenameConstraint:
+		m.catalog.renameObject(op.Table, op.Name, op.NewName)
+	case *RenameSequence:
+		m.catalog.renameObject(op.Table, op.Name, op.NewName)
+	case *RenameIndex:
+		m.catalog.renameObject(op.Table, op.Name, op.NewName)
+	}
+}
+
+// Returns the statements to alter the type and not null of a column in one statement.
+// The constraints, indexes and default depending on the column are dropped before and the default is added again after.
+// The column is altered once, no matter how many of them changed.
+func (m *mssqlRun) getAlterColumn(tableName, columnName string) ([]string, error) {
+	if m.modified[tableName+"."+columnName] {
+		return nil, nil
+	}
+
+	column, ok := m.columns[tableName+"."+columnName]
+
+	if !ok {
+		return nil, &ModelError{m.model, m.field, "No field found for column '" + columnName + "'"}
+	}
+
+	if err := m.checkIdentity(tableName, columnName, column.Default); err != nil {
+		return nil, err
+	}
+
+	query := "ALTER TABLE " + m.quoteTable(tableName) + " ALTER COLUMN " + m.quote(columnName) + " " + column.Type
+
+	if column.NotNull {
+		query += " NOT NULL"
+	} else {
+		query += " NULL"
+	}
+
+	queries := append(m.getDropDependents(tableName, columnName), query)
+
+	if column.Default != "" && column.Default != mssqlIdentity {
+		queries = append(queries, m.getAddDefault(tableName, columnName, column.Default))
+	}
+
+	return queries, nil
+}
+
+// Returns the statements to replace the default constraint of a column, unless it was altered before.
+func (m *mssqlRun) getAlterColumnDefault(op *AlterColumnDefault) ([]string, error) {
+	if err := m.checkIdentity(op.Table, op.Column, op.Default); err != nil {
+		return nil, err
+	}
+
+	if m.modified[op.Table+"."+op.Column] {
+		return nil, nil
+	}
+
+	queries := make([]string, 0, 2)
+
+	if column := m.catalog.column(op.Table, op.Column); column != nil && column.defaultName != "" {
+		queries = append(queries, m.getDropConstraint(op.Table, column.defaultName))
+	}
+
+	if op.Default != "" {
+		queries = append(queries, m.getAddDefault(op.Table, op.Column, op.Default))
+	}
+
+	return queries, nil
+}
+
+// Returns an error if the identity of the existing column differs from given default.
+func (m *mssqlRun) checkIdentity(tableName, columnName, defaultValue string) error {
+	if column := m.catalog.column(tableName, columnName); column != nil && column.identity != (defaultValue == mssqlIdentity) {
+		return &ModelError{m.model, m.field, "The identity of column '" + columnName + "' cannot be changed by SQL Server, the table must be recreated"}
+	}
+
+	return nil
+}
+
+// Updates the catalog after a column was altered.
+// The dropped constraints and indexes are created again after the table was migrated, foreign keys after all tables.
+func (m *mssqlRun) alteredColumn(tableName, columnName string) {
+	if m.modified[tableName+"."+columnName] {
+		return
+	}
+
+	m.dropDependents(tableName, columnName, true)
+
+	if m.modified == nil {
+		m.modified = make(map[string]bool)
+	}
+
+	m.modified[tableName+"."+columnName] = true
+	column := m.catalog.column(tableName, columnName)
+
+	if spec := m.columns[tableName+"."+columnName]; column != nil && spec.Default != "" && spec.Default != mssqlIdentity {
+		column.defaultName, column.defaultValue = m.getDefaultName(tableName, columnName), spec.Default
+	}
+}
+
+// Returns the foreign keys, constraints and indexes depending on given column, which must be dropped to alter or drop it.
+// Foreign keys include the ones of other tables referencing the column or the primary key containing it.
+func (m *mssqlRun) getColumnDependents(tableName, columnName string) ([]mssqlConstraint, []mssqlConstraint, []mssqlIndex) {
+	fks := m.catalog.referencingForeignKeys(tableName, columnName)
+	constraints := make([]mssqlConstraint, 0)
+
+	for _, constraint := range m.catalog.tableConstraints(tableName, "") {
+		depends := containsString(constraint.columns, columnName)
+
+		// the columns of check constraints are not read, but the definition contains them in brackets
+		if constraint.constraintType == "C" {
+			depends = strings.Contains(strings.ToLower(constraint.definition), strings.ToLower(m.quote(columnName)))
+		}
+
+		if !depends {
+			continue
+		}
+
+		if constraint.constraintType == "F" {
+			fks = m.appendConstraint(fks, constraint)
+			continue
+		}
+
+		if constraint.constraintType == "PK" {
+			for _, fk := range m.getPrimaryKeyReferences(&constraint) {
+				fks = m.appendConstraint(fks, fk)
+			}
+		}
+
+		constraints = append(constraints, constraint)
+	}
+
+	indexes := make([]mssqlIndex, 0)
+
+	for _, index := range m.catalog.tableIndexes(tableName) {
+		if containsString(index.columns, columnName) {
+			indexes = append(indexes, index)
+		}
+	}
+
+	return fks, constraints, indexes
+}
+
+// Returns the statements to drop the foreign keys, constraints, default and indexes depending on given column.
+func (m *mssqlRun) getDropDependents(tableName, columnName string) []string {
+	fks, constraints, indexes := m.getColumnDependents(tableName, columnName)
+	queries := make([]string, 0)
+
+	for _, fk := range fks {
+		queries = append(queries, m.getDropConstraint(fk.table, fk.name))
+	}
+
+	for _, constraint := range constraints {
+		queries = append(queries, m.getDropConstraint(tableName, constraint.name))
+	}
+
+	if column := m.catalog.column(tableName, columnName); column != nil && column.defaultName != "" {
+		queries = append(queries, m.getDropConstraint(tableName, column.defaultName))
+	}
+
+	for _, index := range indexes {
+		queries = append(queries, m.getDropIndex(tableName, index.name))
+	}
+
+	return queries
+}
+
+// Removes the foreign keys, constraints, default and indexes depending on given column from the catalog.
+// They are created again if restore is true, which is not the case if the column was dropped.
+func (m *mssqlRun) dropDependents(tableName, columnName string, restore bool) {
+	fks, constraints, indexes := m.getColumnDependents(tableName, columnName)
+
+	for i := range fks {
+		if restore {
+			m.restoreForeignKey(&fks[i])
+		}
+
+		m.catalog.dropConstraint(fks[i].table, fks[i].name)
+	}
+
+	for _, constraint := range constraints {
+		if restore {
+			m.restoreConstraints = append(m.restoreConstraints, constraint)
+		}
+
+		m.catalog.dropConstraint(tableName, constraint.name)
+	}
+
+	if column := m.catalog.column(tableName, columnName); column != nil {
+		column.defaultName, column.defaultValue = "", ""
+	}
+
+	for _, index := range indexes {
+		if restore {
+			m.restoreIndexes = append(m.restoreIndexes, index)
+		}
+
+		m.catalog.dropIndex(tableName, index.name)
+	}
+}
+
+// Returns the foreign keys of other tables referencing the columns of given primary key.
+func (m *mssqlRun) getPrimaryKeyReferences(pk *mssqlConstraint) []mssqlConstraint {
+	fks := make([]mssqlConstraint, 0)
+
+	for _, column := range pk.columns {
+		for _, fk := range m.catalog.referencingForeignKeys(pk.table, column) {
+			fks = m.appendConstraint(fks, fk)
+		}
+	}
+
+	return fks
+}
+
+// Appends the constraint unless a constraint of the same table and name was added before.
+func (m *mssqlRun) appendConstraint(constraints []mssqlConstraint, constraint mssqlConstraint) []mssqlConstraint {
+	for _, c := range constraints {
+		if c.table == constraint.table && c.name == constraint.name {
+			return constraints
+		}
+	}
+
+	return append(constraints, constraint)
+}
+
+// Creates the constraints and indexes again which were dropped to alter the columns of the table of the current model,
+// unless the schema diff dropped or created them.
+func (m *mssqlRun) restoreTable() error {
+	for _, constraint := range m.restoreConstraints {
+		if err := m.exec(m.getAddConstraint(&constraint)); err != nil {
+			return err
+		}
+
+		m.catalog.constraints = append(m.catalog.constraints, constraint)
+	}
+
+	for _, index := range m.restoreIndexes {
+		spec := &IndexSpec{Name: index.name, Columns: index.columns, Unique: index.unique, Where: index.where}
+
+		if err := m.exec(m.getCreateIndex(index.table, spec)); err != nil {
+			return err
+		}
+
+		m.catalog.indexes = append(m.catalog.indexes, index)
+	}
+
+	m.restoreConstraints, m.restoreIndexes = nil, nil
+	return nil
+}
+
+// Removes the constraint or index of given name from the ones created again, as it was dropped or created by the schema diff.
+// The primary key is removed if the name is empty.
+func (m *mssqlRun) keepConstraint(tableName, name string) {
+	constraints := make([]mssqlConstraint, 0, len(m.restoreConstraints))
+
+	for _, constraint := range m.restoreConstraints {
+		if constraint.table != tableName || (name == "" && constraint.constraintType != "PK") || (name != "" && constraint.name != name) {
+			constraints = append(constraints, constraint)
+		}
+	}
+
+	indexes := make([]mssqlIndex, 0, len(m.restoreIndexes))
+
+	for _, index := range m.restoreIndexes {
+		if index.table != tableName || index.name != name {
+			indexes = append(indexes, index)
+		}
+	}
+
+	m.restoreConstraints, m.restoreIndexes = constraints, indexes
+}
+
+// Adds the foreign key again after all tables were migrated.
+func (m *mssqlRun) restoreForeignKey(fk *mssqlConstraint) {
+	m.createFK = append(m.createFK, &AddForeignKey{Source{m.model, m.field},
+		fk.table,
+		fk.name,
+		fk.columns[0],
+		ForeignKeySpec{RefTable: fk.refTable, RefColumn: fk.refColumn, OnDelete: fk.onDelete, OnUpdate: fk.onUpdate, NotValid: fk.notValid}})
+}
+
+// Removes the foreign key of given name from the ones added again, as it was dropped or added by the schema diff.
+func (m *mssqlRun) keepForeignKey(name string) {
+	createFK := make([]Operation, 0, len(m.createFK))
+
+	for _, op := range m.createFK {
+		if op.(*AddForeignKey).Name != name {
+			createFK = append(createFK, op)
+		}
+	}
+
+	m.createFK = createFK
+}
+
+// Returns the definition of a column to create or add it, including its default constraint.
+func (m *mssqlRun) getColumnDefinition(tableName string, column *ColumnSpec) string {
+	definition := column.Type
+
+	if column.Default == mssqlIdentity {
+		definition += " " + mssqlIdentity
+	}
+
+	if column.NotNull {
+		definition += " NOT NULL"
+	} else {
+		definition += " NULL"
+	}
+
+	if column.Default != "" && column.Default != mssqlIdentity {
+		definition += " CONSTRAINT " + m.quote(m.getDefaultName(tableName, column.Name)) + " DEFAULT " + column.Default
+	}
+
+	return definition
+}
+
+// Parses the seq tag value. Arguments set to - are empty.
+func (m *mssqlRun) getSequenceSpec(seq string) (*SequenceSpec, error) {
+	infos := strings.Split(seq, ",")
+
+	if len(infos) != 5 {
+		return nil, &TagError{m.model,
+			m.field,
+			"seq:" + seq,
+			"Five arguments must be specified for seq in model '" + m.model + "': start, increment, min, max, cache"}
+	}
+
+	for i := range infos {
+		if infos[i] = strings.TrimSpace(infos[i]); infos[i] == "-" {
+			infos[i] = ""
+		}
+	}
+
+	return &SequenceSpec{infos[0], infos[1], infos[2], infos[3], infos[4]}, nil
+}
+
+func (m *mssqlRun) getCreateSequence(name string, seq *SequenceSpec) string {
+	query := "CREATE SEQUENCE " + m.quoteTable(name) + " AS bigint START WITH " + seq.Start + " INCREMENT BY " + seq.Increment
+
+	if seq.Min == "" {
+		query += " NO MINVALUE"
+	} else {
+		query += " MINVALUE " + seq.Min
+	}
+
+	if seq.Max == "" {
+		query += " NO MAXVALUE"
+	} else {
+		query += " MAXVALUE " + seq.Max
+	}
+
+	if seq.Cache != "" {
+		query += " CACHE " + seq.Cache
+	}
+
+	return query
+}
+
+// Returns the statement to add a primary key, unique or check constraint.
+func (m *mssqlRun) getAddConstraint(constraint *mssqlConstraint) string {
+	query := "ALTER TABLE " + m.quoteTable(constraint.table) + " ADD CONSTRAINT " + m.quote(constraint.name)
+
+	switch constraint.constraintType {
+	case "PK":
+		return query + " PRIMARY KEY (" + m.quoteColumns(constraint.columns) + ")"
+	case "UQ":
+		return query + " UNIQUE (" + m.quoteColumns(constraint.columns) + ")"
+	}
+
+	return query + " CHECK (" + constraint.definition + ")"
+}
+
+func (m *mssqlRun) getAddDefault(tableName, columnName, value string) string {
+	return "ALTER TABLE " + m.quoteTable(tableName) +
+		" ADD CONSTRAINT " + m.quote(m.getDefaultName(tableName, columnName)) +
+		" DEFAULT " + value + " FOR " + m.quote(columnName)
+}
+
+func (m *mssqlRun) getCreateForeignKey(op *AddForeignKey) string {
+	fk := op.ForeignKey
+	query := "ALTER TABLE " + m.quoteTable(op.Table)
+
+	if fk.NotValid {
+		query += " WITH NOCHECK"
+	}
+
+	query += " ADD CONSTRAINT " + m.quote(op.Name) +
+		" FOREIGN KEY (" + m.quote(op.Column) + ")" +
+		" REFERENCES " + m.quoteTable(fk.RefTable) + " (" + m.quote(fk.RefColumn) + ")"
+
+	if fk.OnDelete != "no action" {
+		query += " ON DELETE " + strings.ToUpper(fk.OnDelete)
+	}
+
+	if fk.OnUpdate != "no action" {
+		query += " ON UPDATE " + strings.ToUpper(fk.OnUpdate)
+	}
+
+	return query
+}
+
+func (m *mssqlRun) getCreateIndex(tableName string, index *IndexSpec) string {
+	query := "CREATE "
+
+	if index.Unique {
+		query += "UNIQUE "
+	}
+
+	query += "INDEX " + m.quote(index.Name) + " ON " + m.quoteTable(tableName) + " (" + m.quoteColumns(index.Columns) + ")"
+
+	if index.Where != "" {
+		query += " WHERE " + index.Where
+	}
+
+	return query
+}
+
+func (m *mssqlRun) getDropConstraint(tableName, name string) string {
+	return "ALTER TABLE " + m.quoteTable(tableName) + " DROP CONSTRAINT " + m.quote(name)
+}
+
+func (m *mssqlRun) getDropIndex(tableName, name string) string {
+	return "DROP INDEX " + m.quote(name) + " ON " + m.quoteTable(tableName)
+}
+
+func (m *mssqlRun) getRename(name, newName, objectType string) string {
+	return "EXEC sp_rename " + mssqlString(name) + ", " + mssqlString(newName) + ", '" + objectType + "'"
+}
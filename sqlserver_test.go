@@ -0,0 +1,460 @@
+package gondolier
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type testSQLServerUser struct {
+	Id      uint64 `gondolier:"id"`
+	Name    string `gondolier:"type:nvarchar(100);notnull;unique"`
+	Age     uint   `gondolier:"type:int;notnull;default:0;check:age >= 0"`
+	Picture uint64 `gondolier:"type:bigint;fk:testSQLServerPicture.Id,ondelete:set null;null;index"`
+}
+
+type testSQLServerPicture struct {
+	Id       uint64 `gondolier:"id"`
+	FileName string `gondolier:"type:nvarchar(255);notnull"`
+}
+
+type testSQLServerSeq struct {
+	Id uint64 `gondolier:"type:bigint;pk;seq:1,1,-,-,1;default:nextval(seq)"`
+}
+
+type testSQLServerUpdate struct {
+	Id   uint64 `gondolier:"id"`
+	Name string `gondolier:"type:nvarchar(200);notnull;default:'unknown';was:Title;index:name,where:name <> ''"`
+	Age  *uint  `gondolier:"index:age,unique"`
+}
+
+type testSQLServerDeferrable struct {
+	Id      uint64 `gondolier:"id"`
+	Picture uint64 `gondolier:"fk:testSQLServerPicture.Id,deferrable"`
+}
+
+type testSQLServerRestrict struct {
+	Id      uint64 `gondolier:"id"`
+	Picture uint64 `gondolier:"fk:testSQLServerPicture.Id,ondelete:restrict"`
+}
+
+type testSQLServerIndexMethod struct {
+	Id   uint64 `gondolier:"id"`
+	Name string `gondolier:"index:name,gin"`
+}
+
+func TestSQLServerNormalizeType(t *testing.T) {
+	types := [][]string{
+		{"INTEGER", "int"},
+		{"bigint", "bigint"},
+		{"varchar", "varchar(1)"},
+		{"VARCHAR (255)", "varchar(255)"},
+		{"character varying(100)", "varchar(100)"},
+		{"nvarchar(MAX)", "nvarchar(max)"},
+		{"national character varying(10)", "nvarchar(10)"},
+		{"decimal", "decimal(18,0)"},
+		{"dec(5)", "decimal(5,0)"},
+		{"numeric(10, 2)", "numeric(10,2)"},
+		{"datetime2", "datetime2(7)"},
+		{"datetime2(3)", "datetime2(3)"},
+		{"double precision", "float"},
+		{"float(53)", "float"},
+		{"float(24)", "real"},
+		{"real", "real"},
+		{"bit", "bit"},
+	}
+
+	for _, typ := range types {
+		if mssqlNormalizeType(typ[0]) != typ[1] || mssqlNormalizeType(typ[1]) != typ[1] {
+			t.Fatalf("Type not normalized as expected: %v (%v) %v (%v)", typ[0], mssqlNormalizeType(typ[0]), typ[1], mssqlNormalizeType(typ[1]))
+		}
+	}
+
+	if mssqlNormalizeType("nvarchar(100)") == mssqlNormalizeType("nvarchar(200)") {
+		t.Fatal("Types must not be equal")
+	}
+
+	columnTypes := []struct {
+		name                        string
+		maxLength, precision, scale int
+		expected                    string
+	}{
+		{"nvarchar", 200, 0, 0, "nvarchar(100)"},
+		{"varchar", -1, 0, 0, "varchar(max)"},
+		{"decimal", 9, 10, 2, "decimal(10,2)"},
+		{"datetime2", 8, 27, 7, "datetime2(7)"},
+		{"bigint", 8, 19, 0, "bigint"},
+	}
+
+	for _, typ := range columnTypes {
+		if columnType := mssqlColumnType(typ.name, typ.maxLength, typ.precision, typ.scale); columnType != typ.expected {
+			t.Fatalf("Column type must be %v, but was: %v", typ.expected, columnType)
+		}
+	}
+}
+
+func TestSQLServerNormalizeExpr(t *testing.T) {
+	exprs := [][]string{
+		{"0", "((0))"},
+		{"'unknown'", "('unknown')"},
+		{"GETDATE()", "(getdate())"},
+		{"age >= 0", "([age]>=(0))"},
+		{"name <> ''", "([name]<>'')"},
+		{"NEXT VALUE FOR [dbo].[t_id_seq]", "(NEXT VALUE FOR [dbo].[t_id_seq])"},
+	}
+
+	for _, expr := range exprs {
+		if mssqlNormalizeExpr(expr[0]) != mssqlNormalizeExpr(expr[1]) {
+			t.Fatalf("Expressions must be equal: %v (%v) %v (%v)", expr[0], mssqlNormalizeExpr(expr[0]), expr[1], mssqlNormalizeExpr(expr[1]))
+		}
+	}
+
+	if mssqlNormalizeExpr("'Active'") == mssqlNormalizeExpr("'active'") || mssqlNormalizeExpr("'a b'") == mssqlNormalizeExpr("'ab'") {
+		t.Fatal("String literals must be kept as they are")
+	}
+}
+
+func TestSQLServerColumnDefinition(t *testing.T) {
+	sqlserver := &mssqlRun{SQLServer: &SQLServer{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testSQLServerUser{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"bigint IDENTITY(1,1) NOT NULL",
+		"nvarchar(100) NOT NULL",
+		"int NOT NULL CONSTRAINT [t_age_df] DEFAULT 0",
+		"bigint NULL"}
+
+	for i, field := range model.Fields {
+		column, err := sqlserver.Column("t", &field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if definition := sqlserver.getColumnDefinition("t", column); definition != expected[i] {
+			t.Fatalf("Definition of field %v must be '%v', but was: %v", field.Name, expected[i], definition)
+		}
+	}
+
+	if quoted := sqlserver.quote("my]table"); quoted != "[my]]table]" {
+		t.Fatalf("Identifier must be quoted with brackets, but was: %v", quoted)
+	}
+
+	if quoted := sqlserver.quoteTable("user"); quoted != "[dbo].[user]" {
+		t.Fatalf("Table must be qualified by the default schema, but was: %v", quoted)
+	}
+}
+
+func TestSQLServerNullFieldType(t *testing.T) {
+	sqlserver := &mssqlRun{SQLServer: &SQLServer{}, naming: &SnakeCase{}}
+	model, err := buildMetaModel(testNullTypes{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"datetime2", "int", "smallint", "tinyint"}
+
+	for i, field := range model.Fields {
+		columnType, notnull, err := sqlserver.getFieldType(&field)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if columnType != expected[i] || notnull {
+			t.Fatalf("Type of field %v not as expected: %v %v", field.Name, columnType, notnull)
+		}
+	}
+}
+
+func TestSQLServerUnsupportedTags(t *testing.T) {
+	sqlserver := &mssqlRun{SQLServer: &SQLServer{}, naming: &SnakeCase{}}
+	models := []interface{}{testSQLServerDeferrable{}, testSQLServerRestrict{}, testSQLServerIndexMethod{}}
+
+	for _, model := range models {
+		metaModel, err := buildMetaModel(model)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sqlserver.model = metaModel.ModelName
+		_, err = sqlserver.Indexes("t", &metaModel)
+
+		for _, field := range metaModel.Fields {
+			if err != nil {
+				break
+			}
+
+			sqlserver.field = field.Name
+			var spec *mssqlColumnSpec
+
+			if spec, err = sqlserver.getColumnSpec("t", &field); err == nil {
+				_, err = sqlserver.getForeignKeyInfo("t", "picture", spec.fk)
+			}
+		}
+
+		if _, ok := err.(*TagError); !ok || !strings.Contains(err.Error(), "not supported") {
+			t.Fatalf("Unsupported tag must return a TagError for model %v, but was: %v", metaModel.ModelName, err)
+		}
+	}
+}
+
+func TestSQLServerPlanCreateTable(t *testing.T) {
+	plan := testSQLServerPlan(t, &mssqlCatalog{}, testSQLServerSeq{}, testSQLServerPicture{}, testSQLServerUser{})
+	expected := []string{"CREATE SEQUENCE [dbo].[test_sql_server_seq_id_seq] AS bigint START WITH 1 INCREMENT BY 1 NO MINVALUE NO MAXVALUE CACHE 1",
+		"CREATE TABLE [dbo].[test_sql_server_seq] ([id] bigint NOT NULL CONSTRAINT [test_sql_server_seq_id_df] DEFAULT NEXT VALUE FOR [dbo].[test_sql_server_seq_id_seq], " +
+			"CONSTRAINT [test_sql_server_seq_pkey] PRIMARY KEY ([id]))",
+		"CREATE TABLE [dbo].[test_sql_server_picture] ([id] bigint IDENTITY(1,1) NOT NULL, [file_name] nvarchar(255) NOT NULL, " +
+			"CONSTRAINT [test_sql_server_picture_pkey] PRIMARY KEY ([id]))",
+		"CREATE TABLE [dbo].[test_sql_server_user] ([id] bigint IDENTITY(1,1) NOT NULL, [name] nvarchar(100) NOT NULL, " +
+			"[age] int NOT NULL CONSTRAINT [test_sql_server_user_age_df] DEFAULT 0, [picture] bigint NULL, " +
+			"CONSTRAINT [test_sql_server_user_pkey] PRIMARY KEY ([id]), CONSTRAINT [test_sql_server_user_name_key] UNIQUE ([name]))",
+		"ALTER TABLE [dbo].[test_sql_server_user] ADD CONSTRAINT [test_sql_server_user_age_check] CHECK (age >= 0)",
+		"CREATE INDEX [test_sql_server_user_picture_idx] ON [dbo].[test_sql_server_user] ([picture])",
+		"ALTER TABLE [dbo].[test_sql_server_user] ADD CONSTRAINT [test_sql_server_user_picture_test_sql_server_picture_id_fk] " +
+			"FOREIGN KEY ([picture]) REFERENCES [dbo].[test_sql_server_picture] ([id]) ON DELETE SET NULL"}
+	testSQLServerComparePlan(t, plan, expected)
+}
+
+func TestSQLServerPlanUpdateTable(t *testing.T) {
+	table := "test_sql_server_update"
+	catalog := &mssqlCatalog{tables: []string{table, "test_sql_server_ref"},
+		columns: []mssqlColumn{{table: table, name: "id", columnType: "bigint", notnull: true, identity: true},
+			{table: table, name: "title", columnType: "nvarchar(100)", defaultName: "DF__test_sql__title", defaultValue: "('unknown')"},
+			{table: table, name: "drop_me", columnType: "nvarchar(max)"}},
+		constraints: []mssqlConstraint{{table: table, name: table + "_pkey", constraintType: "PK", columns: []string{"id"}},
+			{table: table, name: table + "_title_key", constraintType: "UQ", columns: []string{"title"}},
+			{table: "test_sql_server_ref", name: "test_sql_server_ref_update_test_sql_server_update_title_fk", constraintType: "F",
+				columns: []string{"update"}, refTable: table, refColumn: "title", onDelete: "cascade", onUpdate: "no action"}},
+		indexes: []mssqlIndex{{table: table, name: table + "_title_idx", columns: []string{"title"}}}}
+	sqlserver := &SQLServer{DropColumns: true}
+	plan := testSQLServerPlanWith(t, sqlserver, catalog, testSQLServerUpdate{})
+	expected := []string{"EXEC sp_rename N'[dbo].[test_sql_server_update].[title]', N'name', 'COLUMN'",
+		"EXEC sp_rename N'[dbo].[test_sql_server_update_title_key]', N'test_sql_server_update_name_key', 'OBJECT'",
+		"EXEC sp_rename N'[dbo].[test_sql_server_update].[test_sql_server_update_title_idx]', N'test_sql_server_update_name_idx', 'INDEX'",
+		"ALTER TABLE [dbo].[test_sql_server_ref] DROP CONSTRAINT [test_sql_server_ref_update_test_sql_server_update_title_fk]",
+		"ALTER TABLE [dbo].[test_sql_server_update] DROP CONSTRAINT [test_sql_server_update_name_key]",
+		"ALTER TABLE [dbo].[test_sql_server_update] DROP CONSTRAINT [DF__test_sql__title]",
+		"DROP INDEX [test_sql_server_update_name_idx] ON [dbo].[test_sql_server_update]",
+		"ALTER TABLE [dbo].[test_sql_server_update] ALTER COLUMN [name] nvarchar(200) NOT NULL",
+		"ALTER TABLE [dbo].[test_sql_server_update] ADD CONSTRAINT [test_sql_server_update_name_df] DEFAULT 'unknown' FOR [name]",
+		"ALTER TABLE [dbo].[test_sql_server_update] ADD [age] bigint NULL",
+		"ALTER TABLE [dbo].[test_sql_server_update] DROP COLUMN [drop_me]",
+		"CREATE INDEX [test_sql_server_update_name_idx] ON [dbo].[test_sql_server_update] ([name]) WHERE name <> ''",
+		"CREATE UNIQUE INDEX [test_sql_server_update_age_idx] ON [dbo].[test_sql_server_update] ([age])",
+		"ALTER TABLE [dbo].[test_sql_server_ref] ADD CONSTRAINT [test_sql_server_ref_update_test_sql_server_update_title_fk] " +
+			"FOREIGN KEY ([update]) REFERENCES [dbo].[test_sql_server_update] ([name]) ON DELETE CASCADE"}
+	testSQLServerComparePlan(t, plan, expected)
+
+	// the identity of a column cannot be changed
+	catalog.columns[0].identity = false
+	run := &mssqlRun{SQLServer: sqlserver, naming: &SnakeCase{}, catalog: catalog, plan: &Plan{}}
+	model, _ := buildMetaModel(testSQLServerUpdate{})
+
+	if err := run.migrateModels([]MetaModel{model}); err == nil || !strings.Contains(err.Error(), "identity") {
+		t.Fatalf("Changing the identity must return an error, but was: %v", err)
+	}
+}
+
+func TestSQLServerCreateTable(t *testing.T) {
+	if testmssqldb == nil {
+		t.Skip("No SQL Server database configured")
+	}
+
+	testCleanSQLServerDb()
+	t.Log("--- TestSQLServerCreateTable ---")
+
+	sqlserver := &SQLServer{Log: true}
+	g := New(testmssqldb, sqlserver)
+	g.Model(testSQLServerUser{}, testSQLServerPicture{}, testSQLServerSeq{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := testSQLServerCatalog(t, sqlserver)
+
+	if !catalog.table("test_sql_server_user") || !catalog.table("test_sql_server_picture") {
+		t.Fatalf("Tables must have been created: %v", catalog.tables)
+	}
+
+	if id := catalog.column("test_sql_server_user", "id"); id == nil || !id.identity || !id.notnull {
+		t.Fatal("Column id must be not null and IDENTITY")
+	}
+
+	if catalog.constraint("test_sql_server_user", "test_sql_server_user_name_key") == nil ||
+		catalog.constraint("test_sql_server_user", "test_sql_server_user_age_check") == nil {
+		t.Fatal("Unique and check constraints must have been created")
+	}
+
+	fk := catalog.constraint("test_sql_server_user", "test_sql_server_user_picture_test_sql_server_picture_id_fk")
+
+	if fk == nil || fk.onDelete != "set null" {
+		t.Fatalf("Foreign key must have been created, but was: %v", fk)
+	}
+
+	if !catalog.sequence("test_sql_server_seq_id_seq") {
+		t.Fatal("Sequence must have been created")
+	}
+
+	// migrating again must not change anything
+	g.Model(testSQLServerUser{}, testSQLServerPicture{}, testSQLServerSeq{})
+	plan, err := g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Statements) != 0 {
+		t.Fatalf("Plan must be empty, but was: %v", plan)
+	}
+}
+
+func TestSQLServerUpdateTable(t *testing.T) {
+	if testmssqldb == nil {
+		t.Skip("No SQL Server database configured")
+	}
+
+	testCleanSQLServerDb()
+	t.Log("--- TestSQLServerUpdateTable ---")
+
+	if _, err := testmssqldb.Exec("CREATE TABLE [test_sql_server_update] ([id] bigint IDENTITY(1,1) NOT NULL PRIMARY KEY, [title] nvarchar(100) NULL, [drop_me] nvarchar(max))"); err != nil {
+		t.Fatal(err)
+	}
+
+	sqlserver := &SQLServer{DropColumns: true, Log: true}
+	g := New(testmssqldb, sqlserver)
+	g.Model(testSQLServerUpdate{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := testSQLServerCatalog(t, sqlserver)
+
+	if catalog.column("test_sql_server_update", "title") != nil || catalog.column("test_sql_server_update", "drop_me") != nil {
+		t.Fatal("Column must have been renamed and dropped")
+	}
+
+	name := catalog.column("test_sql_server_update", "name")
+
+	if name == nil || name.columnType != "nvarchar(200)" || !name.notnull || mssqlNormalizeExpr(name.defaultValue) != "'unknown'" {
+		t.Fatalf("Column name must have been updated, but was: %v", name)
+	}
+
+	if pk := catalog.primaryKey("test_sql_server_update"); pk == nil || pk.name != "test_sql_server_update_pkey" {
+		t.Fatalf("Primary key must have been recreated, but was: %v", pk)
+	}
+
+	if index := catalog.index("test_sql_server_update", "test_sql_server_update_age_idx"); index == nil || !index.unique {
+		t.Fatal("Unique index must have been created")
+	}
+
+	if index := catalog.index("test_sql_server_update", "test_sql_server_update_name_idx"); index == nil || index.where == "" {
+		t.Fatal("Filtered index must have been created")
+	}
+
+	g.Model(testSQLServerUpdate{})
+	plan, err := g.Plan()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Statements) != 0 {
+		t.Fatalf("Plan must be empty, but was: %v", plan)
+	}
+}
+
+func TestSQLServerDropTable(t *testing.T) {
+	if testmssqldb == nil {
+		t.Skip("No SQL Server database configured")
+	}
+
+	testCleanSQLServerDb()
+	t.Log("--- TestSQLServerDropTable ---")
+
+	sqlserver := &SQLServer{Log: true}
+	g := New(testmssqldb, sqlserver)
+	g.Model(testSQLServerUser{}, testSQLServerPicture{}, testSQLServerSeq{})
+
+	if err := g.MigrateE(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.DropE(testSQLServerPicture{}, testSQLServerUser{}, testSQLServerSeq{}); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog := testSQLServerCatalog(t, sqlserver)
+
+	if catalog.table("test_sql_server_user") || catalog.table("test_sql_server_picture") || catalog.table("test_sql_server_seq") {
+		t.Fatal("Tables must have been dropped")
+	}
+
+	if catalog.sequence("test_sql_server_seq_id_seq") {
+		t.Fatal("Sequence must have been dropped")
+	}
+}
+
+func testSQLServerPlan(t *testing.T, catalog *mssqlCatalog, models ...interface{}) *Plan {
+	return testSQLServerPlanWith(t, &SQLServer{}, catalog, models...)
+}
+
+// Plans the migration of given models against the catalog instead of a database.
+func testSQLServerPlanWith(t *testing.T, sqlserver *SQLServer, catalog *mssqlCatalog, models ...interface{}) *Plan {
+	plan := &Plan{make([]Statement, 0)}
+	run := &mssqlRun{SQLServer: sqlserver, naming: &SnakeCase{}, catalog: catalog, plan: plan}
+	metaModels := make([]MetaModel, 0, len(models))
+
+	for _, model := range models {
+		metaModel, err := buildMetaModel(model)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		metaModels = append(metaModels, metaModel)
+	}
+
+	if err := run.migrateModels(metaModels); err != nil {
+		t.Fatal(err)
+	}
+
+	return plan
+}
+
+func testSQLServerComparePlan(t *testing.T, plan *Plan, expected []string) {
+	if len(plan.Statements) != len(expected) {
+		t.Fatalf("Plan must have %v statements, but was: %v", len(expected), plan)
+	}
+
+	for i, statement := range plan.Statements {
+		if statement.Query != expected[i] {
+			t.Fatalf("Statement %v must be '%v', but was: %v", i, expected[i], statement.Query)
+		}
+	}
+}
+
+func testSQLServerCatalog(t *testing.T, sqlserver *SQLServer) *mssqlCatalog {
+	catalog, err := sqlserver.newRun(context.Background(), testmssqldb, &SnakeCase{}).loadCatalog()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return catalog
+}
+
+func testCleanSQLServerDb() {
+	testmssqldb.Exec("DROP TABLE IF EXISTS [test_sql_server_user]")
+	testmssqldb.Exec("DROP TABLE IF EXISTS [test_sql_server_picture]")
+	testmssqldb.Exec("DROP TABLE IF EXISTS [test_sql_server_update]")
+	testmssqldb.Exec("DROP TABLE IF EXISTS [test_sql_server_seq]")
+	testmssqldb.Exec("DROP SEQUENCE IF EXISTS [test_sql_server_seq_id_seq]")
+}
@@ -0,0 +1,301 @@
+package gondolier
+
+import (
+	"reflect"
+	"strings"
+)
+
+// modelCheck is a check constraint declared by a check tag or model or read from the database.
+// The field is empty if the check constraint belongs to the model.
+type modelCheck struct {
+	name  string
+	field string
+	expr  string
+}
+
+// modelIndex is an index declared by index tags or read from the database.
+// The method is empty for databases which do not support index methods.
+type modelIndex struct {
+	name    string
+	field   string
+	columns []string
+	unique  bool
+	method  string
+	where   string
+}
+
+// indexSupport are the options of index tags supported by a database.
+// The first method is used if none is set by tag.
+type indexSupport struct {
+	database string
+	methods  []string
+	where    bool
+}
+
+// Sets the database type for the Go type of given value in the types registered for a migrator.
+// The map is created if it is nil.
+func registerType(types map[reflect.Type]string, value interface{}, dbType string) map[reflect.Type]string {
+	if types == nil {
+		types = make(map[reflect.Type]string)
+	}
+
+	types[reflect.TypeOf(value)] = dbType
+	return types
+}
+
+// Returns the database type of given field and whether the column must be not null.
+// The type is inferred from the Go type if the field has no type tag, using the registered types before the default types.
+// Null is allowed for fields with a type tag, unless set by tag.
+// Slices and arrays other than bytes are mapped to array types if arrays is set.
+func getFieldType(modelName string, field *MetaField, types, defaultTypes map[reflect.Type]string, arrays bool) (string, bool, error) {
+	for _, tag := range field.Tags {
+		if strings.ToLower(tag.Name) == "type" {
+			return tag.Value, false, nil
+		}
+	}
+
+	if field.Type == nil {
+		return "", false, &ModelError{modelName, field.Name, "No type tag set for field '" + field.Name + "'"}
+	}
+
+	t := field.Type
+	notnull := true
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		notnull = false
+	} else if t.PkgPath() == "database/sql" && strings.HasPrefix(t.Name(), "Null") {
+		notnull = false
+	}
+
+	columnType := getType(t, types, defaultTypes, arrays)
+
+	if columnType == "" {
+		return "", false, &ModelError{modelName,
+			field.Name,
+			"The type for field '" + field.Name + "' cannot be inferred from '" + field.Type.String() + "', set it using the type tag or RegisterType"}
+	}
+
+	return columnType, notnull, nil
+}
+
+// Returns the database type for given Go type or an empty string if it is unknown.
+func getType(t reflect.Type, types, defaultTypes map[reflect.Type]string, arrays bool) string {
+	if columnType, ok := types[t]; ok {
+		return columnType
+	}
+
+	if columnType, ok := defaultTypes[t]; ok {
+		return columnType
+	}
+
+	kind := t.Kind()
+
+	if kind == reflect.Slice || kind == reflect.Array {
+		// bytes are stored as binary, all other slices and arrays as arrays
+		if t.Elem().Kind() == reflect.Uint8 {
+			return getType(reflect.TypeOf([]byte{}), types, defaultTypes, arrays)
+		}
+
+		if !arrays {
+			return ""
+		}
+
+		if elemType := getType(t.Elem(), types, defaultTypes, arrays); elemType != "" {
+			return elemType + "[]"
+		}
+
+		return ""
+	}
+
+	// named types use the type of their underlying basic type
+	for basic := range defaultTypes {
+		if basic.Kind() == kind && basic.PkgPath() == "" && basic.Name() != "" && basic != t {
+			return getType(basic, types, defaultTypes, arrays)
+		}
+	}
+
+	return ""
+}
+
+// Returns the column names of all fields tagged as primary key in field order.
+func getPrimaryKeyColumns(model *MetaModel, naming NameSchema) []string {
+	columns := make([]string, 0)
+
+	for _, field := range model.Fields {
+		for _, tag := range field.Tags {
+			value := strings.ToLower(tag.Value)
+
+			if tag.Name == "" && (value == "id" || value == "pk" || value == "primary key") {
+				columns = append(columns, naming.Get(field.Name))
+				break
+			}
+		}
+	}
+
+	return columns
+}
+
+// Returns the column names of the previous names of given field set by the was tag.
+func getPreviousNames(field *MetaField, naming NameSchema) []string {
+	names := make([]string, 0)
+
+	for _, tag := range field.Tags {
+		key := strings.ToLower(tag.Name)
+
+		if key == "was" || key == "renamed_from" {
+			names = append(names, naming.Get(strings.TrimSpace(tag.Value)))
+		}
+	}
+
+	return names
+}
+
+func unknownTag(modelName, fieldName, key, value string) error {
+	name := value
+
+	if key != "" {
+		name = key + ":" + value
+	}
+
+	return &TagError{modelName, fieldName, name, "Unknown tag '" + name + "' for model '" + modelName + "'"}
+}
+
+// Returns the check constraints declared by check tags and the model.
+func getTagChecks(model *MetaModel, naming NameSchema) ([]modelCheck, error) {
+	tableName := naming.Get(model.ModelName)
+	checks := make([]modelCheck, 0)
+
+	for _, field := range model.Fields {
+		for _, tag := range field.Tags {
+			if strings.ToLower(tag.Name) != "check" {
+				continue
+			}
+
+			if tag.Value == "" {
+				return nil, &TagError{model.ModelName, field.Name, tag.Name + ":", "The expression of a check constraint must not be empty"}
+			}
+
+			checks = append(checks, modelCheck{tableName + "_" + naming.Get(field.Name) + "_check", field.Name, tag.Value})
+		}
+	}
+
+	for _, check := range model.Checks {
+		name := tableName + "_" + naming.Get(check.Name) + "_check"
+
+		if findModelCheck(checks, name) != nil {
+			return nil, &ModelError{model.ModelName, "", "Check constraint '" + name + "' is declared more than once"}
+		}
+
+		checks = append(checks, modelCheck{name, "", check.Expr})
+	}
+
+	return checks, nil
+}
+
+func findModelCheck(checks []modelCheck, name string) *modelCheck {
+	for i := range checks {
+		if checks[i].name == name {
+			return &checks[i]
+		}
+	}
+
+	return nil
+}
+
+// Returns the indexes declared for given model, merging fields with the same index name.
+func getTagIndexes(model *MetaModel, naming NameSchema, support *indexSupport) ([]modelIndex, error) {
+	tableName := naming.Get(model.ModelName)
+	indexes := make([]modelIndex, 0)
+
+	for _, field := range model.Fields {
+		for _, tag := range field.Tags {
+			if strings.ToLower(tag.Name) != "index" && !(tag.Name == "" && strings.ToLower(tag.Value) == "index") {
+				continue
+			}
+
+			index, err := parseIndexTag(model.ModelName, tableName, field.Name, tag, naming, support)
+
+			if err != nil {
+				return nil, err
+			}
+
+			existing := findModelIndex(indexes, index.name)
+
+			if existing == nil {
+				indexes = append(indexes, index)
+				continue
+			}
+
+			if index.method != existing.method || (index.where != "" && existing.where != "" && index.where != existing.where) {
+				return nil, &TagError{model.ModelName, field.Name, tag.Name + ":" + tag.Value, "Index '" + index.name + "' is declared with different methods or where clauses"}
+			}
+
+			existing.columns = append(existing.columns, index.columns...)
+			existing.unique = existing.unique || index.unique
+
+			if existing.where == "" {
+				existing.where = index.where
+			}
+		}
+	}
+
+	return indexes, nil
+}
+
+func parseIndexTag(modelName, tableName, fieldName string, tag MetaTag, naming NameSchema, support *indexSupport) (modelIndex, error) {
+	columnName := naming.Get(fieldName)
+	index := modelIndex{field: fieldName, columns: []string{columnName}}
+	name := columnName
+	value := tag.Value
+
+	if len(support.methods) > 0 {
+		index.method = support.methods[0]
+	}
+
+	if tag.Name == "" {
+		value = ""
+	}
+
+	// the where clause must be the last option, as it might contain commas
+	if i := strings.Index(strings.ToLower(value), "where:"); i > -1 && support.where {
+		index.where = strings.TrimSpace(value[i+len("where:"):])
+		value = value[:i]
+
+		if index.where == "" {
+			return index, &TagError{modelName, fieldName, tag.Name + ":" + tag.Value, "The where clause of an index must not be empty"}
+		}
+	}
+
+	for _, option := range strings.Split(value, ",") {
+		option = strings.TrimSpace(option)
+		lower := strings.ToLower(option)
+
+		if option == "" {
+			continue
+		}
+
+		if lower == "unique" {
+			index.unique = true
+		} else if containsString(support.methods, lower) {
+			index.method = lower
+		} else if strings.HasPrefix(lower, "where:") || containsString(pgIndexMethods, lower) || containsString(mysqlIndexMethods, lower) {
+			return index, &TagError{modelName, fieldName, tag.Name + ":" + tag.Value, "Option '" + option + "' for index is not supported by " + support.database}
+		} else {
+			name = naming.Get(option)
+		}
+	}
+
+	index.name = tableName + "_" + name + "_idx"
+	return index, nil
+}
+
+func findModelIndex(indexes []modelIndex, name string) *modelIndex {
+	for i := range indexes {
+		if indexes[i].name == name {
+			return &indexes[i]
+		}
+	}
+
+	return nil
+}
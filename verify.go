@@ -0,0 +1,474 @@
+package gondolier
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Kinds of differences between the data model and the database schema.
+const (
+	DiffMissingTable  DifferenceKind = "missing table"
+	DiffExtraTable    DifferenceKind = "extra table"
+	DiffMissingColumn DifferenceKind = "missing column"
+	DiffExtraColumn   DifferenceKind = "extra column"
+	DiffType          DifferenceKind = "type"
+	DiffNullability   DifferenceKind = "nullability"
+	DiffDefault       DifferenceKind = "default"
+	DiffPrimaryKey    DifferenceKind = "primary key"
+	DiffUnique        DifferenceKind = "unique"
+	DiffForeignKey    DifferenceKind = "foreign key"
+	DiffSequence      DifferenceKind = "sequence"
+	DiffCheck         DifferenceKind = "check"
+	DiffIndex         DifferenceKind = "index"
+)
+
+// Verifier is implemented by migrators which can compare the data model to the database schema without changing it.
+type Verifier interface {
+	Verify(context.Context, *sql.DB, NameSchema, []MetaModel) ([]Difference, error)
+}
+
+// DifferenceKind is the kind of a difference found by Verify.
+type DifferenceKind string
+
+// Difference is a difference between the data model and the database schema.
+// Model and Field are the names used in the data model, or the name in the database for extra tables and columns.
+// Expected is the state declared by the data model and Actual the state of the database.
+// They are empty if something is not declared or does not exist.
+type Difference struct {
+	Kind     DifferenceKind
+	Model    string
+	Field    string
+	Expected string
+	Actual   string
+}
+
+// String returns a description of the difference.
+func (d Difference) String() string {
+	msg := string(d.Kind) + " in model '" + d.Model + "'"
+
+	if d.Field != "" {
+		msg += ", field '" + d.Field + "'"
+	}
+
+	if d.Expected != "" || d.Actual != "" {
+		msg += ": expected '" + d.Expected + "', but was '" + d.Actual + "'"
+	}
+
+	return msg
+}
+
+// Verify returns the differences between given models and the current state of the tables, without changing the schema.
+// The differences describe the operations a migration would execute, so that verifying and migrating cannot diverge.
+// Columns which are not declared by the data model are reported as extra columns.
+// A missing table is reported by a single difference, instead of all operations to create it.
+func (d *SchemaDiff) Verify(metaModels []MetaModel) ([]Difference, error) {
+	dropColumns := d.DropColumns
+	d.DropColumns = true
+	ops, err := d.Diff(metaModels)
+	d.DropColumns = dropColumns
+
+	if err != nil {
+		return nil, err
+	}
+
+	v := &verifier{dialect: d.Dialect,
+		ops:     ops,
+		created: make(map[string]bool),
+		renamed: make(map[string]string),
+		tables:  make(map[string]*TableState)}
+	return v.differences()
+}
+
+// verifier describes the operations of a SchemaDiff as differences.
+// The actual state is read from the dialect, which is not changed while verifying.
+type verifier struct {
+	dialect Dialect
+	ops     []Operation
+	created map[string]bool
+	renamed map[string]string // new table or table.column name to the previous one
+	tables  map[string]*TableState
+}
+
+func (v *verifier) differences() ([]Difference, error) {
+	for _, op := range v.ops {
+		switch op := op.(type) {
+		case *CreateTable:
+			v.created[op.Table] = true
+		case *RenameTable:
+			v.renamed[op.Name] = op.Table
+		case *RenameColumn:
+			v.renamed[op.Table+"."+op.Name] = op.Column
+		}
+	}
+
+	diffs := make([]Difference, 0)
+	diff := func(source Source, kind DifferenceKind, expected, actual string) {
+		diffs = append(diffs, Difference{kind, source.Model, source.Field, expected, actual})
+	}
+
+	for _, op := range v.ops {
+		switch op := op.(type) {
+		case *CreateTable:
+			diff(op.Source, DiffMissingTable, op.Table, "")
+		case *RenameTable:
+			diff(op.Source, DiffMissingTable, op.Name, op.Table)
+		case *AddColumn:
+			diff(op.Source, DiffMissingColumn, op.Column.Name, "")
+		case *RenameColumn:
+			diff(op.Source, DiffMissingColumn, op.Name, op.Column)
+		case *DropColumn:
+			diff(op.Source, DiffExtraColumn, "", op.Column)
+		case *AlterColumnType:
+			column, err := v.column(op.Table, op.Column)
+
+			if err != nil {
+				return nil, err
+			}
+
+			diff(op.Source, DiffType, v.dialect.NormalizeType(op.Type), v.dialect.NormalizeType(column.Type))
+		case *AlterColumnNotNull:
+			diff(op.Source, DiffNullability, nullability(op.NotNull), nullability(!op.NotNull))
+		case *AlterColumnDefault:
+			column, err := v.column(op.Table, op.Column)
+
+			if err != nil {
+				return nil, err
+			}
+
+			diff(op.Source, DiffDefault, op.Default, column.Default)
+		case *AddPrimaryKey:
+			table, err := v.table(op.Table)
+
+			if err != nil {
+				return nil, err
+			}
+
+			// a changed primary key is reported when it is dropped
+			if len(table.constraints(ConstraintPrimaryKey)) == 0 {
+				diff(op.Source, DiffPrimaryKey, strings.Join(op.Columns, ","), "")
+			}
+		case *AddUnique:
+			diff(op.Source, DiffUnique, op.Name, "")
+		case *AddForeignKey:
+			if v.created[op.Table] {
+				continue
+			}
+
+			existing, err := v.foreignKey(op.Table, op.Column)
+
+			if err != nil {
+				return nil, err
+			}
+
+			actual := ""
+
+			if existing != nil {
+				actual = describeForeignKey(existing.Name, existing.RefTable, strings.Join(existing.RefColumns, ","),
+					existing.OnDelete, existing.OnUpdate, existing.Deferrable, existing.Deferred)
+			}
+
+			fk := op.ForeignKey
+			diff(op.Source, DiffForeignKey, describeForeignKey(op.Name, fk.RefTable, fk.RefColumn, fk.OnDelete, fk.OnUpdate, fk.Deferrable, fk.Deferred), actual)
+		case *AddCheck:
+			if v.created[op.Table] {
+				continue
+			}
+
+			existing, err := v.constraint(op.Table, op.Name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			actual := ""
+
+			if existing != nil {
+				actual = describeCheck(existing.Name, existing.Expression)
+			}
+
+			diff(op.Source, DiffCheck, describeCheck(op.Name, op.Expression), actual)
+		case *DropConstraint:
+			dropped, err := v.dropConstraint(op)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if dropped != nil {
+				diffs = append(diffs, *dropped)
+			}
+		case *RenameConstraint:
+			diff(op.Source, constraintDifferenceKind(op.Type), op.NewName, op.Name)
+		case *CreateSequence:
+			if !v.created[op.Table] {
+				diff(op.Source, DiffSequence, op.Name, "")
+			}
+		case *DropSequence:
+			diff(op.Source, DiffSequence, "", op.Name)
+		case *RenameSequence:
+			diff(op.Source, DiffSequence, op.NewName, op.Name)
+		case *CreateIndex:
+			if v.created[op.Table] {
+				continue
+			}
+
+			existing, err := v.index(op.Table, op.Index.Name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			actual := ""
+
+			if existing != nil {
+				actual = describeIndex(existing.Name, existing.Columns, existing.Unique, existing.Method, existing.Where)
+			}
+
+			index := op.Index
+			diff(op.Source, DiffIndex, describeIndex(index.Name, index.Columns, index.Unique, index.Method, index.Where), actual)
+		case *DropIndex:
+			// a changed index is reported when it is created again
+			if v.indexCreated(op.Table, op.Name) {
+				continue
+			}
+
+			existing, err := v.index(op.Table, op.Name)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if existing != nil {
+				diff(op.Source, DiffIndex, "", describeIndex(existing.Name, existing.Columns, existing.Unique, existing.Method, existing.Where))
+			}
+		case *RenameIndex:
+			diff(op.Source, DiffIndex, op.NewName, op.Name)
+		}
+	}
+
+	return diffs, nil
+}
+
+// Returns the difference of given dropped constraint or nil if it is reported by the operation adding it again.
+func (v *verifier) dropConstraint(op *DropConstraint) (*Difference, error) {
+	existing, err := v.constraint(op.Table, op.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if existing == nil {
+		existing = &ConstraintState{Name: op.Name, Type: op.Type}
+	}
+
+	diff := &Difference{constraintDifferenceKind(op.Type), op.Model, op.Field, "", op.Name}
+
+	switch op.Type {
+	case ConstraintPrimaryKey:
+		diff.Expected, diff.Actual = strings.Join(v.primaryKey(op.Table), ","), strings.Join(existing.Columns, ",")
+	case ConstraintForeignKey:
+		if len(existing.Columns) == 1 && v.foreignKeyAdded(op.Table, existing.Columns[0]) {
+			return nil, nil
+		}
+
+		diff.Actual = describeForeignKey(existing.Name, existing.RefTable, strings.Join(existing.RefColumns, ","),
+			existing.OnDelete, existing.OnUpdate, existing.Deferrable, existing.Deferred)
+	case ConstraintCheck:
+		if v.checkAdded(op.Table, op.Name) {
+			return nil, nil
+		}
+
+		diff.Actual = describeCheck(existing.Name, existing.Expression)
+	}
+
+	return diff, nil
+}
+
+// Returns the current state of given table, which is read by its previous name if it was renamed.
+// An empty state is returned if the table does not exist.
+func (v *verifier) table(name string) (*TableState, error) {
+	if table, ok := v.tables[name]; ok {
+		return table, nil
+	}
+
+	tableName := name
+
+	if previous, ok := v.renamed[name]; ok {
+		tableName = previous
+	}
+
+	table, err := v.dialect.Table(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if table == nil {
+		table = &TableState{Name: tableName}
+	}
+
+	v.tables[name] = table
+	return table, nil
+}
+
+// Returns the current state of given column, which is read by its previous name if it was renamed.
+// An empty state is returned if the column does not exist.
+func (v *verifier) column(tableName, columnName string) (*ColumnState, error) {
+	table, err := v.table(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if previous, ok := v.renamed[tableName+"."+columnName]; ok {
+		columnName = previous
+	}
+
+	if column := table.column(columnName); column != nil {
+		return column, nil
+	}
+
+	return &ColumnState{Name: columnName}, nil
+}
+
+func (v *verifier) constraint(tableName, name string) (*ConstraintState, error) {
+	table, err := v.table(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return table.constraint(name), nil
+}
+
+func (v *verifier) foreignKey(tableName, columnName string) (*ConstraintState, error) {
+	table, err := v.table(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, constraint := range table.constraints(ConstraintForeignKey) {
+		if len(constraint.Columns) == 1 && constraint.Columns[0] == columnName {
+			found := constraint
+			return &found, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (v *verifier) index(tableName, name string) (*IndexState, error) {
+	table, err := v.table(tableName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range table.Indexes {
+		if table.Indexes[i].Name == name {
+			return &table.Indexes[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Returns the columns of the primary key added to given table.
+func (v *verifier) primaryKey(tableName string) []string {
+	for _, op := range v.ops {
+		if pk, ok := op.(*AddPrimaryKey); ok && pk.Table == tableName {
+			return pk.Columns
+		}
+	}
+
+	return nil
+}
+
+func (v *verifier) foreignKeyAdded(tableName, columnName string) bool {
+	for _, op := range v.ops {
+		if fk, ok := op.(*AddForeignKey); ok && fk.Table == tableName && fk.Column == columnName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *verifier) checkAdded(tableName, name string) bool {
+	for _, op := range v.ops {
+		if check, ok := op.(*AddCheck); ok && check.Table == tableName && check.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *verifier) indexCreated(tableName, name string) bool {
+	for _, op := range v.ops {
+		if index, ok := op.(*CreateIndex); ok && index.Table == tableName && index.Index.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func constraintDifferenceKind(constraintType ConstraintType) DifferenceKind {
+	switch constraintType {
+	case ConstraintPrimaryKey:
+		return DiffPrimaryKey
+	case ConstraintForeignKey:
+		return DiffForeignKey
+	case ConstraintCheck:
+		return DiffCheck
+	default:
+		return DiffUnique
+	}
+}
+
+func describeForeignKey(name, refTable, refColumn, onDelete, onUpdate string, deferrable, deferred bool) string {
+	desc := name + ": " + refTable + "(" + refColumn + ") on delete " + onDelete + " on update " + onUpdate
+
+	if deferred {
+		desc += " deferrable initially deferred"
+	} else if deferrable {
+		desc += " deferrable"
+	}
+
+	return desc
+}
+
+func describeCheck(name, expression string) string {
+	return name + ": " + expression
+}
+
+func describeIndex(name string, columns []string, unique bool, method, where string) string {
+	desc := name + ":"
+
+	if unique {
+		desc += " unique"
+	}
+
+	if method != "" {
+		desc += " " + method
+	}
+
+	desc += " (" + strings.Join(columns, ", ") + ")"
+
+	if where != "" {
+		desc += " where " + where
+	}
+
+	return desc
+}
+
+func nullability(notnull bool) string {
+	if notnull {
+		return "not null"
+	}
+
+	return "null"
+}
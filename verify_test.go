@@ -0,0 +1,70 @@
+package gondolier
+
+import (
+	"testing"
+)
+
+func TestDifferenceString(t *testing.T) {
+	input := []Difference{
+		{DiffMissingTable, "User", "", "user", ""},
+		{DiffExtraColumn, "User", "nickname", "", "nickname"},
+		{DiffType, "User", "Name", "character varying(255)", "text"},
+		{DiffPrimaryKey, "User", "", "id", ""},
+	}
+	expected := []string{
+		"missing table in model 'User': expected 'user', but was ''",
+		"extra column in model 'User', field 'nickname': expected '', but was 'nickname'",
+		"type in model 'User', field 'Name': expected 'character varying(255)', but was 'text'",
+		"primary key in model 'User': expected 'id', but was ''",
+	}
+
+	for i, diff := range input {
+		if diff.String() != expected[i] {
+			t.Fatalf("Expected '%v', but was: %v", expected[i], diff.String())
+		}
+	}
+}
+
+func TestSchemaDiffVerify(t *testing.T) {
+	table := &TableState{Name: "test_diff_user",
+		Columns: []ColumnState{{Name: "id", Type: "bigint", NotNull: true, Default: "generated"},
+			{Name: "name", Type: "VARCHAR(100)"},
+			{Name: "picture", Type: "bigint", Default: "0"},
+			{Name: "old", Type: "text"}},
+		Sequences: []string{"test_diff_user_id_seq"},
+		Constraints: []ConstraintState{{Name: "test_diff_user_name_pkey", Type: ConstraintPrimaryKey, Columns: []string{"name"}},
+			{Name: "test_diff_user_picture_test_diff_picture_id_fk", Type: ConstraintForeignKey, Columns: []string{"picture"},
+				RefTable: "test_diff_picture", RefColumns: []string{"id"}, OnDelete: "no action", OnUpdate: "no action"}}}
+	diff := &SchemaDiff{Dialect: &testDialect{map[string]*TableState{"test_diff_user": table}}, Naming: &SnakeCase{}}
+	diffs, err := diff.Verify(testBuildMetaModels(t, testDiffPicture{}, testDiffUser{}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fk := "test_diff_user_picture_test_diff_picture_id_fk: test_diff_picture(id) on delete "
+	expected := []Difference{
+		{DiffMissingTable, "testDiffPicture", "", "test_diff_picture", ""},
+		{DiffPrimaryKey, "testDiffUser", "", "id", "name"},
+		{DiffType, "testDiffUser", "Name", "varchar(255)", "varchar(100)"},
+		{DiffUnique, "testDiffUser", "Name", "test_diff_user_name_key", ""},
+		{DiffNullability, "testDiffUser", "Name", "not null", "null"},
+		{DiffDefault, "testDiffUser", "Picture", "", "0"},
+		{DiffExtraColumn, "testDiffUser", "old", "", "old"},
+		{DiffForeignKey, "testDiffUser", "Picture", fk + "cascade on update no action", fk + "no action on update no action"},
+	}
+
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %v differences, but was: %v", len(expected), diffs)
+	}
+
+	for i := range expected {
+		if diffs[i] != expected[i] {
+			t.Fatalf("Expected difference %v, but was: %v", expected[i], diffs[i])
+		}
+	}
+
+	if diff.DropColumns {
+		t.Fatal("DropColumns must have been restored")
+	}
+}